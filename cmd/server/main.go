@@ -3,10 +3,18 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
 
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/instances"
 	"github.com/ole-larsen/green-api/internal/server"
 	"github.com/ole-larsen/green-api/internal/server/config"
+	"github.com/ole-larsen/green-api/internal/storage"
+	"github.com/ole-larsen/green-api/internal/storage/migrations"
 )
 
 //go:embed certs/server.crt certs/server.key
@@ -31,6 +39,40 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	settings := config.GetConfig()
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		defer cancel()
+
+		if err := runMigrate(ctx, settings.DSN, args[1:]); err != nil {
+			fmt.Println("Error running migrations:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "rotate-keys" {
+		defer cancel()
+
+		if err := runRotateKeys(ctx, settings, args[1:]); err != nil {
+			fmt.Println("Error rotating keys:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "users" {
+		defer cancel()
+
+		if err := runUsers(ctx, settings.DSN, args[1:]); err != nil {
+			fmt.Println("Error managing users:", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	settings.Reload(config.WithServerCrt(certBytes), config.WithServerKey(keyBytes))
 	fmt.Printf("protocol: %s\n", settings.Protocol)
 
@@ -41,3 +83,67 @@ func main() {
 
 	srv.Run(ctx, cancel)
 }
+
+// runMigrate runs "migrate up|down|status" subcommand against the database by dsn.
+func runMigrate(ctx context.Context, dsn string, args []string) (err error) {
+	if dsn == "" {
+		return errors.New("database dsn is required")
+	}
+
+	store, err := storage.NewPostgres(ctx, dsn)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, store.Close())
+	}()
+
+	return migrations.Command(ctx, store.DB(), args, os.Stdout)
+}
+
+// runRotateKeys runs "rotate-keys [batch size]" subcommand: tokens of registered instances, bodies
+// of messages and payloads are sealed with the key of the secret, previous secrets decrypt them.
+func runRotateKeys(ctx context.Context, settings *config.Config, args []string) (err error) {
+	if settings.DSN == "" {
+		return errors.New("database dsn is required")
+	}
+
+	if err := settings.CheckSecret(); err != nil {
+		return err
+	}
+
+	sealer, err := encryption.NewSealer(settings.Secret, settings.PreviousSecrets...)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.NewPostgres(ctx, settings.DSN)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, store.Close())
+	}()
+
+	return instances.RotateCommand(ctx, store, sealer, args, os.Stdout)
+}
+
+// runUsers runs "users list|add|passwd|delete|roles|grant|revoke" subcommand, passwords are read from stdin.
+func runUsers(ctx context.Context, dsn string, args []string) (err error) {
+	if dsn == "" {
+		return errors.New("database dsn is required")
+	}
+
+	store, err := storage.NewPostgres(ctx, dsn)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, store.Close())
+	}()
+
+	return auth.UsersCommand(ctx, auth.NewUsers(store).SetRoles(store), args, os.Stdin, os.Stdout)
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+const (
+	// APIKeyPrefix starts every key, so leaked keys are easy to find by secret scanners.
+	APIKeyPrefix = "gapi_"
+
+	// prefixSize and secretSize are random bytes of the public prefix and of the secret part of a key.
+	prefixSize = 6
+	secretSize = 32
+	// touchEvery is how often the last use of a key is written.
+	touchEvery = time.Minute
+)
+
+var (
+	ErrAPIKey         = errors.New("invalid api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRequest  = errors.New("invalid api key request")
+)
+
+var scopes = []Scope{ScopeRead, ScopeSend, ScopeAdmin}
+
+// APIKeyRequest issues a key. Instances are names or idInstance, empty allows every instance.
+// Empty ExpiresAt never expires.
+type APIKeyRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Name      string     `json:"name"`
+	Scopes    []Scope    `json:"scopes"`
+	Instances []string   `json:"instances,omitempty"`
+}
+
+// IssuedAPIKey is a new key with its secret, the secret is shown once and only its hash is stored.
+type IssuedAPIKey struct {
+	storage.APIKey
+	Key string `json:"key"`
+}
+
+// APIKeys issues and checks API keys. A key is gapi_{prefix}_{secret}, the prefix finds the key in the storage
+// and is shown in the list, the whole key is stored as SHA-256 hash.
+type APIKeys struct {
+	store   storage.APIKeyStorage
+	clients httpclient.Provider
+	now     func() time.Time
+}
+
+func NewAPIKeys(store storage.APIKeyStorage) *APIKeys {
+	return &APIKeys{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// SetInstances sets instances keys are restricted to, names are resolved to idInstance by them.
+// Without it instances must be given by idInstance.
+func (k *APIKeys) SetInstances(clients httpclient.Provider) *APIKeys {
+	k.clients = clients
+	return k
+}
+
+// SetClock replaces time source, for tests.
+func (k *APIKeys) SetClock(now func() time.Time) *APIKeys {
+	k.now = now
+	return k
+}
+
+// Issue validates the request and creates a key on behalf of createdBy.
+func (k *APIKeys) Issue(ctx context.Context, r *APIKeyRequest, createdBy string) (*IssuedAPIKey, error) {
+	name := strings.TrimSpace(r.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrAPIKeyRequest)
+	}
+
+	if len(r.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one of scopes %v is required", ErrAPIKeyRequest, scopes)
+	}
+
+	keyScopes := pq.StringArray{}
+
+	for _, s := range r.Scopes {
+		if !slices.Contains(scopes, s) {
+			return nil, fmt.Errorf("%w: unknown scope %q, expected one of %v", ErrAPIKeyRequest, s, scopes)
+		}
+
+		if !slices.Contains(keyScopes, string(s)) {
+			keyScopes = append(keyScopes, string(s))
+		}
+	}
+
+	now := k.now()
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at is in the past", ErrAPIKeyRequest)
+	}
+
+	instances, err := k.resolve(r.Instances)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := randomString(prefixSize, hex.EncodeToString)
+	key := APIKeyPrefix + prefix + "_" + randomString(secretSize, base64.RawURLEncoding.EncodeToString)
+
+	issued := &IssuedAPIKey{
+		APIKey: storage.APIKey{
+			ID:        newID(),
+			Prefix:    prefix,
+			Name:      name,
+			Hash:      hashKey(key),
+			Scopes:    keyScopes,
+			Instances: instances,
+			CreatedBy: createdBy,
+			CreatedAt: now,
+			ExpiresAt: r.ExpiresAt,
+		},
+		Key: key,
+	}
+
+	if err := k.store.SaveAPIKey(ctx, &issued.APIKey); err != nil {
+		return nil, err
+	}
+
+	return issued, nil
+}
+
+// List returns keys, the latest first, without secrets.
+func (k *APIKeys) List(ctx context.Context) ([]storage.APIKey, error) {
+	return k.store.ListAPIKeys(ctx)
+}
+
+// Revoke revokes the key by id, it is rejected from now on.
+func (k *APIKeys) Revoke(ctx context.Context, id string) error {
+	err := k.store.RevokeAPIKey(ctx, id, k.now())
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrAPIKeyNotFound
+	}
+
+	return err
+}
+
+// Authenticate returns the identity of the key, ErrAPIKey is returned for unknown, revoked or expired keys.
+// The last use of the key is recorded.
+func (k *APIKeys) Authenticate(ctx context.Context, key string) (*Identity, error) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return nil, ErrAPIKey
+	}
+
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, ErrAPIKey
+	}
+
+	stored, err := k.store.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrAPIKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(hashKey(key))) != 1 {
+		return nil, ErrAPIKey
+	}
+
+	now := k.now()
+	if stored.RevokedAt != nil || (stored.ExpiresAt != nil && !now.Before(*stored.ExpiresAt)) {
+		return nil, ErrAPIKey
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= touchEvery {
+		if err := k.store.TouchAPIKey(ctx, stored.ID, now); err != nil {
+			logger.Errorln(err)
+		}
+	}
+
+	identity := &Identity{
+		KeyID:     stored.ID,
+		KeyName:   stored.Name,
+		Instances: stored.Instances,
+	}
+
+	for _, s := range stored.Scopes {
+		identity.Scopes = append(identity.Scopes, Scope(s))
+	}
+
+	return identity, nil
+}
+
+// resolve returns idInstance of the instances.
+func (k *APIKeys) resolve(instances []string) (pq.StringArray, error) {
+	resolved := pq.StringArray{}
+
+	for _, key := range instances {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		if k.clients != nil {
+			c, err := k.clients.Client(key)
+			if err != nil {
+				return nil, fmt.Errorf("%w: unknown instance %q", ErrAPIKeyRequest, key)
+			}
+
+			key = c.GetIDInstance()
+		}
+
+		if !slices.Contains(resolved, key) {
+			resolved = append(resolved, key)
+		}
+	}
+
+	return resolved, nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,198 @@
+package auth_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// fakeAPIKeys is an in-memory APIKeyStorage.
+type fakeAPIKeys struct {
+	keys    map[string]storage.APIKey
+	touched int
+	mu      sync.Mutex
+}
+
+func newFakeAPIKeys() *fakeAPIKeys {
+	return &fakeAPIKeys{keys: make(map[string]storage.APIKey)}
+}
+
+func (f *fakeAPIKeys) SaveAPIKey(_ context.Context, k *storage.APIKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, other := range f.keys {
+		if other.Prefix == k.Prefix {
+			return storage.ErrDuplicate
+		}
+	}
+
+	f.keys[k.ID] = *k
+
+	return nil
+}
+
+func (f *fakeAPIKeys) GetAPIKeyByPrefix(_ context.Context, prefix string) (*storage.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.keys {
+		if k.Prefix == prefix {
+			return &k, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (f *fakeAPIKeys) ListAPIKeys(context.Context) ([]storage.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.APIKey{}
+	for _, k := range f.keys {
+		list = append(list, k)
+	}
+
+	return list, nil
+}
+
+func (f *fakeAPIKeys) RevokeAPIKey(_ context.Context, id string, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k, ok := f.keys[id]
+	if !ok || k.RevokedAt != nil {
+		return storage.ErrNotFound
+	}
+
+	k.RevokedAt = &at
+	f.keys[id] = k
+
+	return nil
+}
+
+func (f *fakeAPIKeys) TouchAPIKey(_ context.Context, id string, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k := f.keys[id]
+	k.LastUsedAt = &at
+	f.keys[id] = k
+	f.touched++
+
+	return nil
+}
+
+func TestAPIKeys_Issue(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	clients := httpclient.NewPool("", nil, map[string]string{"1101000001": "token"})
+	keys := auth.NewAPIKeys(newFakeAPIKeys()).SetInstances(clients).SetClock(func() time.Time { return now })
+
+	tests := []struct {
+		name string
+		req  auth.APIKeyRequest
+		err  error
+	}{
+		{"valid", auth.APIKeyRequest{Name: "billing", Scopes: []auth.Scope{auth.ScopeSend, auth.ScopeSend}}, nil},
+		{"no name", auth.APIKeyRequest{Name: " ", Scopes: []auth.Scope{auth.ScopeRead}}, auth.ErrAPIKeyRequest},
+		{"no scopes", auth.APIKeyRequest{Name: "billing"}, auth.ErrAPIKeyRequest},
+		{"unknown scope", auth.APIKeyRequest{Name: "billing", Scopes: []auth.Scope{"write"}}, auth.ErrAPIKeyRequest},
+		{"expired", auth.APIKeyRequest{Name: "billing", Scopes: []auth.Scope{auth.ScopeRead}, ExpiresAt: &past},
+			auth.ErrAPIKeyRequest},
+		{"unknown instance", auth.APIKeyRequest{Name: "billing", Scopes: []auth.Scope{auth.ScopeRead},
+			Instances: []string{"1101000002"}}, auth.ErrAPIKeyRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issued, err := keys.Issue(context.Background(), &tt.req, "anna")
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(issued.Key, auth.APIKeyPrefix+issued.Prefix+"_"))
+			assert.NotContains(t, issued.Hash, issued.Key)
+			assert.Equal(t, []string{"send"}, []string(issued.Scopes))
+			assert.Equal(t, "anna", issued.CreatedBy)
+		})
+	}
+}
+
+func TestAPIKeys_Authenticate(t *testing.T) {
+	now := time.Now()
+	store := newFakeAPIKeys()
+	clients := httpclient.NewPool("", nil, map[string]string{"1101000001": "token"})
+	keys := auth.NewAPIKeys(store).SetInstances(clients).SetClock(func() time.Time { return now })
+
+	expires := now.Add(time.Hour)
+
+	issued, err := keys.Issue(context.Background(), &auth.APIKeyRequest{
+		Name:      "billing",
+		Scopes:    []auth.Scope{auth.ScopeSend},
+		Instances: []string{"1101000001"},
+		ExpiresAt: &expires,
+	}, "anna")
+	require.NoError(t, err)
+
+	identity, err := keys.Authenticate(context.Background(), issued.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "key billing", identity.Name())
+	assert.True(t, identity.Allows(auth.ScopeSend))
+	assert.False(t, identity.Allows(auth.ScopeRead))
+	assert.True(t, identity.AllowsInstance("1101000001", auth.ScopeSend))
+	assert.False(t, identity.AllowsInstance("1101000001", auth.ScopeRead))
+	assert.False(t, identity.AllowsInstance("1101000002", auth.ScopeSend))
+	assert.False(t, identity.AllowsInstance(auth.AllInstances, auth.ScopeSend), "the key is restricted")
+
+	_, err = keys.Authenticate(context.Background(), issued.Key)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.touched, "the last use is written once a minute")
+
+	for _, key := range []string{"", "secret", issued.Key + "x", auth.APIKeyPrefix + "unknown_secret"} {
+		_, err = keys.Authenticate(context.Background(), key)
+		require.ErrorIs(t, err, auth.ErrAPIKey, key)
+	}
+
+	now = expires
+	_, err = keys.Authenticate(context.Background(), issued.Key)
+	require.ErrorIs(t, err, auth.ErrAPIKey, "the key is expired")
+}
+
+func TestAPIKeys_Revoke(t *testing.T) {
+	keys := auth.NewAPIKeys(newFakeAPIKeys())
+
+	issued, err := keys.Issue(context.Background(), &auth.APIKeyRequest{
+		Name:   "ops",
+		Scopes: []auth.Scope{auth.ScopeAdmin},
+	}, "anna")
+	require.NoError(t, err)
+
+	identity, err := keys.Authenticate(context.Background(), issued.Key)
+	require.NoError(t, err)
+	assert.True(t, identity.Allows(auth.ScopeRead), "admin allows everything")
+	assert.True(t, identity.AllowsInstance(auth.AllInstances, auth.ScopeAdmin))
+
+	require.NoError(t, keys.Revoke(context.Background(), issued.ID))
+	require.ErrorIs(t, keys.Revoke(context.Background(), issued.ID), auth.ErrAPIKeyNotFound)
+
+	_, err = keys.Authenticate(context.Background(), issued.Key)
+	require.ErrorIs(t, err, auth.ErrAPIKey)
+
+	list, err := keys.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.NotNil(t, list[0].RevokedAt)
+}
@@ -0,0 +1,125 @@
+// Package auth keeps accounts of the web interface and their sessions. Passwords are stored as
+// bcrypt hashes, a session is a cookie signed with a key derived from the server secret which
+// expires when it is idle for too long and after the absolute lifetime. Users have roles per
+// instance, machine clients use API keys limited by scopes and instances instead.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"slices"
+
+	"github.com/ole-larsen/green-api/internal/log"
+)
+
+var logger = log.NewLogger("info", log.DefaultBuildLogger)
+
+// Scope is what an API key or a role may do.
+type Scope string
+
+const (
+	// ScopeRead allows reading instances, journals, messages and jobs.
+	ScopeRead Scope = "read"
+	// ScopeSend allows sending messages, directly, queued, scheduled or in campaigns.
+	ScopeSend Scope = "send"
+	// ScopeAdmin allows everything, settings of instances, the registry, users and keys included.
+	ScopeAdmin Scope = "admin"
+)
+
+// AllInstances is the instance of roles and checks that cover every instance.
+const AllInstances = "*"
+
+var (
+	ErrNotFound    = errors.New("user not found")
+	ErrExists      = errors.New("user already exists")
+	ErrInvalid     = errors.New("invalid user")
+	ErrCredentials = errors.New("wrong username or password")
+	ErrSession     = errors.New("no valid session")
+	ErrNoSecret    = errors.New("sessions require a secret")
+)
+
+// Identity is who makes the request: a signed in user or an API key.
+type Identity struct {
+	// Roles of the user by idInstance, AllInstances included.
+	Roles    map[string]Role `json:"roles,omitempty"`
+	UserID   string          `json:"user_id,omitempty"`
+	Username string          `json:"username,omitempty"`
+	KeyID    string          `json:"key_id,omitempty"`
+	KeyName  string          `json:"key_name,omitempty"`
+	Scopes   []Scope         `json:"scopes,omitempty"`
+	// Instances are idInstance the key is restricted to, empty allows every instance.
+	Instances []string `json:"instances,omitempty"`
+}
+
+// Name returns the username or the name of the key.
+func (id *Identity) Name() string {
+	if id.KeyID != "" {
+		return "key " + id.KeyName
+	}
+
+	return id.Username
+}
+
+// Allows reports whether the identity has the scope on some instance, routes that do not use instances
+// check it.
+func (id *Identity) Allows(scope Scope) bool {
+	if id.KeyID != "" {
+		return id.hasScope(scope)
+	}
+
+	for _, role := range id.Roles {
+		if role.Allows(scope) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsInstance reports whether the identity has the scope on the instance by idInstance,
+// AllInstances checks routes that serve every instance.
+func (id *Identity) AllowsInstance(idInstance string, scope Scope) bool {
+	if id.KeyID != "" {
+		return id.hasScope(scope) && (len(id.Instances) == 0 || slices.Contains(id.Instances, idInstance))
+	}
+
+	if id.Roles[AllInstances].Allows(scope) {
+		return true
+	}
+
+	return idInstance != AllInstances && id.Roles[idInstance].Allows(scope)
+}
+
+func (id *Identity) hasScope(scope Scope) bool {
+	return slices.Contains(id.Scopes, scope) || slices.Contains(id.Scopes, ScopeAdmin)
+}
+
+type identityKey struct{}
+
+// WithIdentity returns ctx carrying the identity of the request.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of the request, it is missing when authentication is disabled.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+func newID() string {
+	const size = 16
+
+	return randomString(size, hex.EncodeToString)
+}
+
+func randomString(size int, encode func([]byte) string) string {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return encode(b)
+}
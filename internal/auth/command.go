@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var ErrUsage = errors.New("usage: users list|add <username>|passwd <username>|delete <username>|" +
+	"roles <username>|grant <username> <role> [instance]|revoke <username> [instance]")
+
+// UsersCommand runs users subcommand and prints the result to w. Passwords of add and passwd
+// are read from the first line of in, so they don't stay in the shell history. Roles are granted and
+// revoked on every instance unless the instance is given by idInstance, names of registered instances
+// are resolved by the server only.
+func UsersCommand(ctx context.Context, users *Users, args []string, in io.Reader, w io.Writer) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		list, err := users.List(ctx)
+		if err != nil {
+			return err
+		}
+
+		const padding = 2
+
+		tw := tabwriter.NewWriter(w, 0, 0, padding, ' ', 0)
+
+		if _, err := fmt.Fprintln(tw, "USERNAME\tCREATED AT"); err != nil {
+			return err
+		}
+
+		for _, u := range list {
+			if _, err := fmt.Fprintf(tw, "%s\t%s\n", u.Username, u.CreatedAt.Format(time.RFC3339)); err != nil {
+				return err
+			}
+		}
+
+		return tw.Flush()
+	case args[0] == "add" && len(args) == 2:
+		password, err := readPassword(in)
+		if err != nil {
+			return err
+		}
+
+		if _, err := users.Create(ctx, &UserRequest{Username: args[1], Password: password}); err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "user %s added\n", args[1])
+
+		return err
+	case args[0] == "passwd" && len(args) == 2:
+		password, err := readPassword(in)
+		if err != nil {
+			return err
+		}
+
+		if _, err := users.SetPassword(ctx, args[1], password); err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "password of %s changed, its sessions are ended\n", args[1])
+
+		return err
+	case args[0] == "delete" && len(args) == 2:
+		if err := users.Delete(ctx, args[1]); err != nil {
+			return err
+		}
+
+		_, err := fmt.Fprintf(w, "user %s deleted\n", args[1])
+
+		return err
+	case args[0] == "roles" && len(args) == 2:
+		list, err := users.Roles(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		for _, r := range list {
+			if _, err := fmt.Fprintf(w, "%s\t%s\n", r.Instance, r.Role); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case args[0] == "grant" && (len(args) == 3 || len(args) == 4):
+		instance := instanceArg(args, 3)
+
+		if _, err := users.Grant(ctx, args[1], instance, Role(args[2])); err != nil {
+			return err
+		}
+
+		_, err := fmt.Fprintf(w, "%s is %s of %s\n", args[1], args[2], instance)
+
+		return err
+	case args[0] == "revoke" && (len(args) == 2 || len(args) == 3):
+		instance := instanceArg(args, 2)
+
+		if err := users.Revoke(ctx, args[1], instance); err != nil {
+			return err
+		}
+
+		_, err := fmt.Fprintf(w, "role of %s on %s revoked\n", args[1], instance)
+
+		return err
+	default:
+		return ErrUsage
+	}
+}
+
+// instanceArg returns the optional instance argument at i, AllInstances by default.
+func instanceArg(args []string, i int) string {
+	if len(args) > i {
+		return args[i]
+	}
+
+	return AllInstances
+}
+
+func readPassword(in io.Reader) (string, error) {
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
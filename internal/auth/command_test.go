@@ -0,0 +1,55 @@
+package auth_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+)
+
+func TestUsersCommand(t *testing.T) {
+	ctx := context.Background()
+	users := newUsers()
+
+	run := func(stdin string, args ...string) (string, error) {
+		var out strings.Builder
+		err := auth.UsersCommand(ctx, users, args, strings.NewReader(stdin), &out)
+
+		return out.String(), err
+	}
+
+	out, err := run("correct horse\n", "add", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "user alice added\n", out)
+
+	_, err = users.Authenticate(ctx, "alice", "correct horse")
+	require.NoError(t, err)
+
+	out, err = run("battery staple", "passwd", "alice")
+	require.NoError(t, err)
+	assert.Contains(t, out, "password of alice changed")
+
+	_, err = users.Authenticate(ctx, "alice", "battery staple")
+	require.NoError(t, err)
+
+	out, err = run("", "list")
+	require.NoError(t, err)
+	assert.Contains(t, out, "USERNAME")
+	assert.Contains(t, out, "alice")
+
+	_, err = run("short\n", "add", "bob")
+	require.ErrorIs(t, err, auth.ErrInvalid)
+
+	out, err = run("", "delete", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "user alice deleted\n", out)
+
+	for _, args := range [][]string{{}, {"add"}, {"list", "alice"}, {"rename", "alice"}} {
+		_, err = run("", args...)
+		require.ErrorIs(t, err, auth.ErrUsage, args)
+	}
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// Role is what a user may do on an instance.
+type Role string
+
+const (
+	// RoleViewer reads the instance: state, settings, journals and chat history.
+	RoleViewer Role = "viewer"
+	// RoleOperator reads the instance and sends messages with it.
+	RoleOperator Role = "operator"
+	// RoleAdmin does everything, on AllInstances it manages the registry, users and keys as well.
+	RoleAdmin Role = "admin"
+)
+
+// idInstancePattern matches idInstance, names of registered instances start with a letter.
+var idInstancePattern = regexp.MustCompile(`^[0-9]{1,20}$`)
+
+var (
+	ErrRole         = errors.New("invalid role")
+	ErrRoleNotFound = errors.New("role not found")
+	ErrNoRoles      = errors.New("roles are not kept without a database")
+)
+
+// RoleRequest grants a role.
+type RoleRequest struct {
+	Role Role `json:"role"`
+}
+
+var roles = []Role{RoleViewer, RoleOperator, RoleAdmin}
+
+var roleScopes = map[Role][]Scope{
+	RoleViewer:   {ScopeRead},
+	RoleOperator: {ScopeRead, ScopeSend},
+	RoleAdmin:    {ScopeRead, ScopeSend, ScopeAdmin},
+}
+
+// Allows reports whether the role has the scope, an empty role has none.
+func (r Role) Allows(scope Scope) bool {
+	return slices.Contains(roleScopes[r], scope)
+}
+
+// SetRoles sets the storage of roles. Without it every user is an admin of every instance.
+func (u *Users) SetRoles(store storage.RoleStorage) *Users {
+	u.roles = store
+	return u
+}
+
+// SetInstances sets instances roles are granted on, names are resolved to idInstance by them.
+// Without it instances must be given by idInstance.
+func (u *Users) SetInstances(clients httpclient.Provider) *Users {
+	u.clients = clients
+	return u
+}
+
+// RolesEnabled reports whether roles are kept, otherwise they can't be granted.
+func (u *Users) RolesEnabled() bool {
+	return u.roles != nil
+}
+
+// Grant gives the user the role on the instance by name or idInstance, AllInstances gives it on every
+// instance. The previous role of the user on the instance is replaced.
+func (u *Users) Grant(ctx context.Context, username, instance string, role Role) (*storage.UserRole, error) {
+	if u.roles == nil {
+		return nil, ErrNoRoles
+	}
+
+	if !slices.Contains(roles, role) {
+		return nil, fmt.Errorf("%w: unknown role %q, expected one of %v", ErrRole, role, roles)
+	}
+
+	user, err := u.GetByName(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	idInstance, err := u.resolve(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &storage.UserRole{UserID: user.ID, Instance: idInstance, Role: string(role)}
+	if err := u.roles.SaveUserRole(ctx, r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Revoke takes the role on the instance by name or idInstance from the user.
+func (u *Users) Revoke(ctx context.Context, username, instance string) error {
+	if u.roles == nil {
+		return ErrNoRoles
+	}
+
+	user, err := u.GetByName(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	idInstance, err := u.resolve(instance)
+	if err != nil {
+		return err
+	}
+
+	err = u.roles.DeleteUserRole(ctx, user.ID, idInstance)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: %s has no role on %s", ErrRoleNotFound, username, instance)
+	}
+
+	return err
+}
+
+// Roles returns roles of the user by instance.
+func (u *Users) Roles(ctx context.Context, username string) ([]storage.UserRole, error) {
+	if u.roles == nil {
+		return nil, ErrNoRoles
+	}
+
+	user, err := u.GetByName(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.roles.ListUserRoles(ctx, user.ID)
+}
+
+// identity returns the identity of the user with its roles.
+func (u *Users) identity(ctx context.Context, user *storage.User) (*Identity, error) {
+	identity := &Identity{UserID: user.ID, Username: user.Username, Roles: make(map[string]Role)}
+
+	if u.roles == nil {
+		identity.Roles[AllInstances] = RoleAdmin
+		return identity, nil
+	}
+
+	list, err := u.roles.ListUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range list {
+		identity.Roles[r.Instance] = Role(r.Role)
+	}
+
+	return identity, nil
+}
+
+// resolve returns idInstance of the instance by name, AllInstances is kept. Without instances names
+// can't be resolved, only idInstance is accepted.
+func (u *Users) resolve(instance string) (string, error) {
+	instance = strings.TrimSpace(instance)
+	if instance == "" {
+		return "", fmt.Errorf("%w: instance is required", ErrRole)
+	}
+
+	if instance == AllInstances {
+		return instance, nil
+	}
+
+	if u.clients == nil {
+		if !idInstancePattern.MatchString(instance) {
+			return "", fmt.Errorf("%w: instance %q must be idInstance, names are resolved by the server only",
+				ErrRole, instance)
+		}
+
+		return instance, nil
+	}
+
+	c, err := u.clients.Client(instance)
+	if err != nil {
+		return "", fmt.Errorf("%w: unknown instance %q", ErrRole, instance)
+	}
+
+	return c.GetIDInstance(), nil
+}
@@ -0,0 +1,197 @@
+package auth_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// fakeRoles is an in-memory RoleStorage.
+type fakeRoles struct {
+	roles map[[2]string]string
+	mu    sync.Mutex
+}
+
+func newFakeRoles() *fakeRoles {
+	return &fakeRoles{roles: make(map[[2]string]string)}
+}
+
+func (f *fakeRoles) SaveUserRole(_ context.Context, r *storage.UserRole) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.roles[[2]string{r.UserID, r.Instance}] = r.Role
+
+	return nil
+}
+
+func (f *fakeRoles) ListUserRoles(_ context.Context, userID string) ([]storage.UserRole, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.UserRole{}
+
+	for k, role := range f.roles {
+		if k[0] == userID {
+			list = append(list, storage.UserRole{UserID: userID, Instance: k[1], Role: role})
+		}
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Instance < list[b].Instance })
+
+	return list, nil
+}
+
+func (f *fakeRoles) DeleteUserRole(_ context.Context, userID, instance string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.roles[[2]string{userID, instance}]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(f.roles, [2]string{userID, instance})
+
+	return nil
+}
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role  auth.Role
+		scope auth.Scope
+		want  bool
+	}{
+		{auth.RoleViewer, auth.ScopeRead, true},
+		{auth.RoleViewer, auth.ScopeSend, false},
+		{auth.RoleOperator, auth.ScopeSend, true},
+		{auth.RoleOperator, auth.ScopeAdmin, false},
+		{auth.RoleAdmin, auth.ScopeAdmin, true},
+		{"", auth.ScopeRead, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.role.Allows(tt.scope), "%s %s", tt.role, tt.scope)
+	}
+}
+
+func TestUsers_Roles(t *testing.T) {
+	ctx := context.Background()
+	clients := httpclient.NewPool("", nil, map[string]string{"1101000001": "token"})
+	users := newUsers().SetRoles(newFakeRoles()).SetInstances(clients)
+
+	_, err := users.Create(ctx, &auth.UserRequest{Username: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	sessions, err := auth.NewSessions(users, "secret")
+	require.NoError(t, err)
+
+	identity, _, err := authenticate(sessions, login(t, sessions, "correct horse"))
+	require.NoError(t, err)
+	assert.Empty(t, identity.Roles, "new users have no roles")
+
+	role, err := users.Grant(ctx, "alice", "1101000001", auth.RoleOperator)
+	require.NoError(t, err)
+	assert.Equal(t, "operator", role.Role)
+
+	_, err = users.Grant(ctx, "alice", auth.AllInstances, auth.RoleViewer)
+	require.NoError(t, err)
+
+	identity, _, err = authenticate(sessions, login(t, sessions, "correct horse"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]auth.Role{"1101000001": auth.RoleOperator, auth.AllInstances: auth.RoleViewer},
+		identity.Roles)
+	assert.True(t, identity.AllowsInstance("1101000001", auth.ScopeSend))
+	assert.False(t, identity.AllowsInstance("1101000002", auth.ScopeSend))
+	assert.True(t, identity.AllowsInstance("1101000002", auth.ScopeRead))
+	assert.False(t, identity.AllowsInstance(auth.AllInstances, auth.ScopeSend))
+
+	_, err = users.Grant(ctx, "alice", "1101000001", "owner")
+	require.ErrorIs(t, err, auth.ErrRole)
+
+	_, err = users.Grant(ctx, "alice", "1101000002", auth.RoleViewer)
+	require.ErrorIs(t, err, auth.ErrRole, "unknown instance")
+
+	_, err = users.Grant(ctx, "bob", auth.AllInstances, auth.RoleViewer)
+	require.ErrorIs(t, err, auth.ErrNotFound)
+
+	require.NoError(t, users.Revoke(ctx, "alice", "1101000001"))
+	require.ErrorIs(t, users.Revoke(ctx, "alice", "1101000001"), auth.ErrRoleNotFound)
+
+	list, err := users.Roles(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []storage.UserRole{{UserID: identity.UserID, Instance: auth.AllInstances, Role: "viewer"}}, list)
+}
+
+func TestUsers_WithoutRoles(t *testing.T) {
+	ctx := context.Background()
+	users := newUsers()
+
+	_, err := users.Create(ctx, &auth.UserRequest{Username: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	sessions, err := auth.NewSessions(users, "secret")
+	require.NoError(t, err)
+
+	identity, _, err := authenticate(sessions, login(t, sessions, "correct horse"))
+	require.NoError(t, err)
+	assert.True(t, identity.AllowsInstance(auth.AllInstances, auth.ScopeAdmin), "every user is an admin")
+
+	assert.False(t, users.RolesEnabled())
+
+	_, err = users.Grant(ctx, "alice", auth.AllInstances, auth.RoleViewer)
+	require.ErrorIs(t, err, auth.ErrNoRoles)
+}
+
+func TestUsersCommand_Roles(t *testing.T) {
+	ctx := context.Background()
+	users := newUsers().SetRoles(newFakeRoles())
+
+	_, err := users.Create(ctx, &auth.UserRequest{Username: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		err := auth.UsersCommand(ctx, users, args, strings.NewReader(""), &out)
+
+		return out.String(), err
+	}
+
+	out, err := run("grant", "alice", "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "alice is admin of *\n", out)
+
+	out, err = run("grant", "alice", "viewer", "1101000001")
+	require.NoError(t, err)
+	assert.Equal(t, "alice is viewer of 1101000001\n", out)
+
+	out, err = run("roles", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "*\tadmin\n1101000001\tviewer\n", out)
+
+	out, err = run("revoke", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "role of alice on * revoked\n", out)
+
+	_, err = run("grant", "alice", "owner")
+	require.ErrorIs(t, err, auth.ErrRole)
+
+	out, err = run("grant", "alice", "operator", "shop")
+	require.ErrorIs(t, err, auth.ErrRole, "names of registered instances are not known to the command")
+	assert.Empty(t, out)
+
+	out, err = run("roles", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "1101000001\tviewer\n", out)
+
+	_, err = run("grant", "alice")
+	require.ErrorIs(t, err, auth.ErrUsage)
+}
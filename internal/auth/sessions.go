@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+const (
+	// CookieName is the name of the session cookie.
+	CookieName = "green_api_session"
+	// DefaultIdleTimeout ends a session nobody used for so long.
+	DefaultIdleTimeout = 30 * time.Minute
+	// DefaultMaxAge ends a session this long after login however it is used.
+	DefaultMaxAge = 12 * time.Hour
+
+	// sessionContext separates the key of session signatures from other keys derived from the same secret.
+	sessionContext = "green-api sessions"
+	// refreshAfter is how often the last use of a session is written to the cookie.
+	refreshAfter = time.Minute
+	// epochSize is the size of the password fingerprint kept in the session.
+	epochSize = 8
+)
+
+// Sessions signs session cookies with HMAC-SHA256 by a key derived from the server secret. The cookie keeps
+// the user ID, login and last use time, nothing is stored on the server. A session carries a fingerprint
+// of the password hash, so changing the password or deleting the user ends every session of the user.
+type Sessions struct {
+	users  *Users
+	now    func() time.Time
+	keys   [][]byte
+	idle   time.Duration
+	maxAge time.Duration
+	secure bool
+}
+
+// session is the signed content of the cookie.
+type session struct {
+	UserID string `json:"u"`
+	Epoch  string `json:"e"`
+	Issued int64  `json:"i"`
+	Seen   int64  `json:"s"`
+}
+
+// NewSessions creates sessions of users signed by the key of secret, keys of previous secrets verify
+// sessions opened before the secret was changed. Empty secret is ErrNoSecret.
+func NewSessions(users *Users, secret string, previous ...string) (*Sessions, error) {
+	if secret == "" {
+		return nil, ErrNoSecret
+	}
+
+	s := &Sessions{
+		users:  users,
+		now:    time.Now,
+		idle:   DefaultIdleTimeout,
+		maxAge: DefaultMaxAge,
+	}
+
+	for _, sec := range append([]string{secret}, previous...) {
+		s.keys = append(s.keys, encryption.DeriveKey(sec, sessionContext))
+	}
+
+	return s, nil
+}
+
+// SetTimeouts sets idle timeout and absolute lifetime of sessions, zero keeps the default.
+func (s *Sessions) SetTimeouts(idle, maxAge time.Duration) *Sessions {
+	if idle > 0 {
+		s.idle = idle
+	}
+
+	if maxAge > 0 {
+		s.maxAge = maxAge
+	}
+
+	return s
+}
+
+// SetSecure marks cookies Secure, they are sent over https only.
+func (s *Sessions) SetSecure(secure bool) *Sessions {
+	s.secure = secure
+	return s
+}
+
+// SetClock replaces time source, for tests.
+func (s *Sessions) SetClock(now func() time.Time) *Sessions {
+	s.now = now
+	return s
+}
+
+// Login checks the password and sets the session cookie of the user.
+func (s *Sessions) Login(ctx context.Context, rw http.ResponseWriter, username, password string) (*Identity, error) {
+	user, err := s.users.Authenticate(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().Unix()
+	s.write(rw, &session{UserID: user.ID, Epoch: epoch(user), Issued: now, Seen: now})
+
+	return s.users.identity(ctx, user)
+}
+
+// Logout deletes the session cookie.
+func (s *Sessions) Logout(rw http.ResponseWriter) {
+	http.SetCookie(rw, s.cookie("", -1))
+}
+
+// Authenticate returns the identity of the session of the request, ErrSession is returned when there is
+// no session or it is expired, forged or ended. The cookie is renewed while the session is used.
+// Roles are read on every request, so granted and revoked roles apply at once.
+func (s *Sessions) Authenticate(rw http.ResponseWriter, r *http.Request) (*Identity, error) {
+	c, err := r.Cookie(CookieName)
+	if err != nil {
+		return nil, ErrSession
+	}
+
+	sess, err := s.decode(c.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	if now.Sub(time.Unix(sess.Seen, 0)) > s.idle || now.Sub(time.Unix(sess.Issued, 0)) > s.maxAge {
+		return nil, ErrSession
+	}
+
+	user, err := s.users.Get(r.Context(), sess.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrSession
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(sess.Epoch), []byte(epoch(user))) {
+		return nil, ErrSession
+	}
+
+	if now.Sub(time.Unix(sess.Seen, 0)) >= refreshAfter {
+		sess.Seen = now.Unix()
+		s.write(rw, sess)
+	}
+
+	return s.users.identity(r.Context(), user)
+}
+
+// write sets the cookie of the session, it expires with the session.
+func (s *Sessions) write(rw http.ResponseWriter, sess *session) {
+	payload, err := json.Marshal(sess)
+	if err != nil {
+		panic(err)
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	value += "." + base64.RawURLEncoding.EncodeToString(sign(s.keys[0], value))
+
+	left := time.Unix(sess.Issued, 0).Add(s.maxAge).Sub(s.now())
+	if left > s.idle {
+		left = s.idle
+	}
+
+	http.SetCookie(rw, s.cookie(value, int(left/time.Second)))
+}
+
+func (s *Sessions) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// decode verifies the signature of the cookie value by every key and returns the session.
+func (s *Sessions) decode(value string) (*session, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrSession
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, ErrSession
+	}
+
+	for _, key := range s.keys {
+		if !hmac.Equal(mac, sign(key, payload)) {
+			continue
+		}
+
+		data, err := base64.RawURLEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, ErrSession
+		}
+
+		var sess session
+		if err := json.Unmarshal(data, &sess); err != nil {
+			return nil, ErrSession
+		}
+
+		return &sess, nil
+	}
+
+	return nil, ErrSession
+}
+
+func sign(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+
+	return mac.Sum(nil)
+}
+
+// epoch is a fingerprint of the password hash, it changes with the password.
+func epoch(u *storage.User) string {
+	sum := sha256.Sum256([]byte(u.PasswordHash))
+	return hex.EncodeToString(sum[:epochSize])
+}
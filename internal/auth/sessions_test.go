@@ -0,0 +1,166 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+)
+
+// login opens a session of alice and returns its cookie.
+func login(t *testing.T, sessions *auth.Sessions, password string) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+
+	identity, err := sessions.Login(context.Background(), rec, "alice", password)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", identity.Username)
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	return cookies[0]
+}
+
+// authenticate requests with the cookie and returns the identity with the renewed cookie, if any.
+func authenticate(sessions *auth.Sessions, c *http.Cookie) (*auth.Identity, *http.Cookie, error) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if c != nil {
+		r.AddCookie(c)
+	}
+
+	rec := httptest.NewRecorder()
+
+	identity, err := sessions.Authenticate(rec, r)
+	if cookies := rec.Result().Cookies(); len(cookies) > 0 {
+		return identity, cookies[0], err
+	}
+
+	return identity, nil, err
+}
+
+func newSessions(t *testing.T, users *auth.Users, now *time.Time, secret string, previous ...string) *auth.Sessions {
+	t.Helper()
+
+	sessions, err := auth.NewSessions(users, secret, previous...)
+	require.NoError(t, err)
+
+	return sessions.
+		SetTimeouts(30*time.Minute, 2*time.Hour).
+		SetClock(func() time.Time { return *now })
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+	users := newUsers()
+	now := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	sessions := newSessions(t, users, &now, "secret").SetSecure(true)
+
+	_, err := users.Create(ctx, &auth.UserRequest{Username: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	_, err = sessions.Login(ctx, httptest.NewRecorder(), "alice", "wrong horse")
+	require.ErrorIs(t, err, auth.ErrCredentials)
+
+	c := login(t, sessions, "correct horse")
+	assert.Equal(t, auth.CookieName, c.Name)
+	assert.True(t, c.HttpOnly)
+	assert.True(t, c.Secure)
+	assert.Equal(t, http.SameSiteStrictMode, c.SameSite)
+	assert.Equal(t, 30*60, c.MaxAge)
+
+	identity, renewed, err := authenticate(sessions, c)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", identity.Username)
+	assert.Nil(t, renewed, "just issued cookie is not renewed")
+
+	// used sessions are kept, the cookie is renewed
+	for range 3 {
+		now = now.Add(20 * time.Minute)
+
+		_, renewed, err = authenticate(sessions, c)
+		require.NoError(t, err)
+		require.NotNil(t, renewed)
+
+		c = renewed
+	}
+
+	// idle timeout
+	now = now.Add(31 * time.Minute)
+	_, _, err = authenticate(sessions, c)
+	require.ErrorIs(t, err, auth.ErrSession)
+
+	// absolute lifetime
+	c = login(t, sessions, "correct horse")
+
+	for range 7 {
+		now = now.Add(20 * time.Minute)
+
+		_, renewed, err = authenticate(sessions, c)
+		if err != nil {
+			break
+		}
+
+		c = renewed
+	}
+
+	require.ErrorIs(t, err, auth.ErrSession)
+}
+
+func TestSessions_Ended(t *testing.T) {
+	ctx := context.Background()
+	users := newUsers()
+	now := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	sessions := newSessions(t, users, &now, "secret")
+
+	_, err := users.Create(ctx, &auth.UserRequest{Username: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	c := login(t, sessions, "correct horse")
+
+	// signed by the previous secret
+	_, _, err = authenticate(newSessions(t, users, &now, "new secret", "secret"), c)
+	require.NoError(t, err)
+
+	_, _, err = authenticate(newSessions(t, users, &now, "new secret"), c)
+	require.ErrorIs(t, err, auth.ErrSession)
+
+	forged := *c
+	payload, signature, _ := strings.Cut(c.Value, ".")
+	forged.Value = payload + "x." + signature
+
+	_, _, err = authenticate(sessions, &forged)
+	require.ErrorIs(t, err, auth.ErrSession)
+
+	_, _, err = authenticate(sessions, nil)
+	require.ErrorIs(t, err, auth.ErrSession)
+
+	// password change ends sessions
+	_, err = users.SetPassword(ctx, "alice", "battery staple")
+	require.NoError(t, err)
+
+	_, _, err = authenticate(sessions, c)
+	require.ErrorIs(t, err, auth.ErrSession)
+
+	// and so does deletion
+	c = login(t, sessions, "battery staple")
+	require.NoError(t, users.Delete(ctx, "alice"))
+
+	_, _, err = authenticate(sessions, c)
+	require.ErrorIs(t, err, auth.ErrSession)
+
+	rec := httptest.NewRecorder()
+	sessions.Logout(rec)
+	assert.Equal(t, -1, rec.Result().Cookies()[0].MaxAge)
+
+	_, err = auth.NewSessions(users, "")
+	require.ErrorIs(t, err, auth.ErrNoSecret)
+}
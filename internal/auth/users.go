@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// Password limits, bcrypt ignores bytes after the 72nd.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]{0,63}$`)
+
+// UserRequest creates a user or changes the password.
+type UserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Users keeps accounts and their roles in the storage.
+type Users struct {
+	store   storage.UserStorage
+	roles   storage.RoleStorage
+	clients httpclient.Provider
+	now     func() time.Time
+	// dummy is compared with passwords of unknown users, so they take as long as known ones.
+	dummy     []byte
+	cost      int
+	dummyOnce sync.Once
+}
+
+func NewUsers(store storage.UserStorage) *Users {
+	return &Users{
+		store: store,
+		now:   time.Now,
+		cost:  bcrypt.DefaultCost,
+	}
+}
+
+// SetCost sets bcrypt cost of new hashes, tests use bcrypt.MinCost.
+func (u *Users) SetCost(cost int) *Users {
+	u.cost = cost
+	return u
+}
+
+// SetClock replaces time source, for tests.
+func (u *Users) SetClock(now func() time.Time) *Users {
+	u.now = now
+	return u
+}
+
+// Create validates the user and saves it with the password hash.
+func (u *Users) Create(ctx context.Context, r *UserRequest) (*storage.User, error) {
+	username := strings.TrimSpace(r.Username)
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("%w: username %q must have up to 64 letters, digits, '.', '_', '@' or '-'",
+			ErrInvalid, username)
+	}
+
+	hash, err := u.hash(r.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := u.now()
+	user := &storage.User{
+		ID:           newID(),
+		Username:     username,
+		PasswordHash: hash,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	err = u.store.SaveUser(ctx, user)
+	if errors.Is(err, storage.ErrDuplicate) {
+		return nil, fmt.Errorf("%w: %s", ErrExists, username)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Authenticate returns the user with the password, otherwise ErrCredentials.
+func (u *Users) Authenticate(ctx context.Context, username, password string) (*storage.User, error) {
+	user, err := u.store.GetUserByName(ctx, strings.TrimSpace(username))
+	if errors.Is(err, storage.ErrNotFound) {
+		_ = bcrypt.CompareHashAndPassword(u.dummyHash(), []byte(password))
+		return nil, ErrCredentials
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrCredentials
+	}
+
+	return user, nil
+}
+
+// Get returns the user by id.
+func (u *Users) Get(ctx context.Context, id string) (*storage.User, error) {
+	user, err := u.store.GetUser(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	return user, err
+}
+
+// GetByName returns the user by username.
+func (u *Users) GetByName(ctx context.Context, username string) (*storage.User, error) {
+	user, err := u.store.GetUserByName(ctx, username)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	return user, err
+}
+
+// List returns users by username.
+func (u *Users) List(ctx context.Context) ([]storage.User, error) {
+	return u.store.ListUsers(ctx)
+}
+
+// SetPassword changes the password of the user. Sessions of the user opened before are ended.
+func (u *Users) SetPassword(ctx context.Context, username, password string) (*storage.User, error) {
+	user, err := u.GetByName(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.PasswordHash, err = u.hash(password); err != nil {
+		return nil, err
+	}
+
+	user.UpdatedAt = u.now()
+
+	err = u.store.UpdateUserPassword(ctx, user)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Delete deletes the user by username, its sessions end with it.
+func (u *Users) Delete(ctx context.Context, username string) error {
+	user, err := u.GetByName(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	err = u.store.DeleteUser(ctx, user.ID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+func (u *Users) hash(password string) (string, error) {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return "", fmt.Errorf("%w: password must have %d to %d bytes", ErrInvalid, MinPasswordLength, MaxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), u.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (u *Users) dummyHash() []byte {
+	u.dummyOnce.Do(func() {
+		u.dummy, _ = bcrypt.GenerateFromPassword([]byte(newID()), u.cost)
+	})
+
+	return u.dummy
+}
@@ -0,0 +1,175 @@
+package auth_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// fakeUsers is an in-memory UserStorage.
+type fakeUsers struct {
+	users map[string]storage.User
+	mu    sync.Mutex
+}
+
+func newUsers() *auth.Users {
+	return auth.NewUsers(&fakeUsers{users: make(map[string]storage.User)}).SetCost(bcrypt.MinCost)
+}
+
+func (f *fakeUsers) SaveUser(_ context.Context, u *storage.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, other := range f.users {
+		if other.Username == u.Username {
+			return storage.ErrDuplicate
+		}
+	}
+
+	f.users[u.ID] = *u
+
+	return nil
+}
+
+func (f *fakeUsers) GetUser(_ context.Context, id string) (*storage.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &u, nil
+}
+
+func (f *fakeUsers) GetUserByName(_ context.Context, username string) (*storage.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range f.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (f *fakeUsers) ListUsers(context.Context) ([]storage.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.User{}
+	for _, u := range f.users {
+		list = append(list, u)
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Username < list[b].Username })
+
+	return list, nil
+}
+
+func (f *fakeUsers) UpdateUserPassword(_ context.Context, u *storage.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.users[u.ID]; !ok {
+		return storage.ErrNotFound
+	}
+
+	f.users[u.ID] = *u
+
+	return nil
+}
+
+func (f *fakeUsers) DeleteUser(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.users[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(f.users, id)
+
+	return nil
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	users := newUsers()
+
+	u, err := users.Create(ctx, &auth.UserRequest{Username: " alice ", Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", u.Username)
+	assert.NotEmpty(t, u.ID)
+	assert.NotContains(t, u.PasswordHash, "correct horse")
+
+	got, err := users.Authenticate(ctx, "alice", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, got.ID)
+
+	_, err = users.Authenticate(ctx, "alice", "wrong horse")
+	require.ErrorIs(t, err, auth.ErrCredentials)
+
+	_, err = users.Authenticate(ctx, "bob", "correct horse")
+	require.ErrorIs(t, err, auth.ErrCredentials)
+
+	_, err = users.SetPassword(ctx, "alice", "battery staple")
+	require.NoError(t, err)
+
+	_, err = users.Authenticate(ctx, "alice", "correct horse")
+	require.ErrorIs(t, err, auth.ErrCredentials)
+
+	_, err = users.Authenticate(ctx, "alice", "battery staple")
+	require.NoError(t, err)
+
+	list, err := users.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	require.NoError(t, users.Delete(ctx, "alice"))
+	require.ErrorIs(t, users.Delete(ctx, "alice"), auth.ErrNotFound)
+
+	_, err = users.Get(ctx, u.ID)
+	require.ErrorIs(t, err, auth.ErrNotFound)
+}
+
+func TestUsers_Create_Errors(t *testing.T) {
+	ctx := context.Background()
+	users := newUsers()
+
+	_, err := users.Create(ctx, &auth.UserRequest{Username: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		want error
+		name string
+		req  auth.UserRequest
+	}{
+		{auth.ErrExists, "taken", auth.UserRequest{Username: "alice", Password: "correct horse"}},
+		{auth.ErrInvalid, "no username", auth.UserRequest{Password: "correct horse"}},
+		{auth.ErrInvalid, "spaces", auth.UserRequest{Username: "al ice", Password: "correct horse"}},
+		{auth.ErrInvalid, "short password", auth.UserRequest{Username: "bob", Password: "short"}},
+		{auth.ErrInvalid, "long password", auth.UserRequest{Username: "bob", Password: string(make([]byte, 73))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := users.Create(ctx, &tt.req)
+			require.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	_, err = users.SetPassword(ctx, "bob", "correct horse")
+	require.ErrorIs(t, err, auth.ErrNotFound)
+}
@@ -0,0 +1,603 @@
+// Package campaign sends a message to every recipient of an uploaded csv file. Messages are rendered
+// from a template with merge fields of the file and go through the outbound queue a few at a time,
+// so a running campaign respects rate limits of the instance and can be paused or cancelled at once.
+package campaign
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/log"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var logger = log.NewLogger("info", log.DefaultBuildLogger)
+
+var (
+	ErrNotFound = errors.New("campaign not found")
+	ErrStatus   = errors.New("not allowed in the campaign status")
+	ErrInvalid  = errors.New("invalid campaign")
+)
+
+const (
+	// DefaultInterval is how often running campaigns are advanced.
+	DefaultInterval = time.Second
+	// DefaultWindow is how many messages of a campaign are in the queue at once.
+	DefaultWindow = 5
+	// MaxRecipients limits rows of a campaign file.
+	MaxRecipients = 10000
+	// DefaultListLimit is how many campaigns List returns when limit is not set.
+	DefaultListLimit = 100
+	// DefaultPreviewLimit is how many messages Preview renders when limit is not set.
+	DefaultPreviewLimit = 5
+	// claimTimeout is how long a recipient is claimed without a job before its message is considered lost.
+	claimTimeout = time.Minute
+)
+
+// transitions are statuses a campaign may have before an action.
+var transitions = map[string]struct {
+	to   string
+	from []string
+}{
+	"start":  {to: storage.CampaignRunning, from: []string{storage.CampaignDraft}},
+	"pause":  {to: storage.CampaignPaused, from: []string{storage.CampaignRunning}},
+	"resume": {to: storage.CampaignRunning, from: []string{storage.CampaignPaused}},
+	"cancel": {
+		to:   storage.CampaignCancelled,
+		from: []string{storage.CampaignDraft, storage.CampaignRunning, storage.CampaignPaused},
+	},
+}
+
+// Request creates a campaign of the instance. File is csv with a header, see parseFile.
+type Request struct {
+	File       io.Reader
+	IDInstance string
+	Name       string
+	Template   string
+}
+
+// Preview is the message of a recipient as it will be sent. Error tells why it will not.
+type Preview struct {
+	Line    int    `json:"line"`
+	Phone   string `json:"phone"`
+	ChatID  string `json:"chat_id"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Manager keeps campaigns and runs them through the queue.
+type Manager struct {
+	store    storage.CampaignStorage
+	queue    *queue.Queue
+	now      func() time.Time
+	interval time.Duration
+	window   int
+}
+
+func New(store storage.CampaignStorage, q *queue.Queue) *Manager {
+	return &Manager{
+		store:    store,
+		queue:    q,
+		now:      time.Now,
+		interval: DefaultInterval,
+		window:   DefaultWindow,
+	}
+}
+
+// SetInterval sets how often running campaigns are advanced.
+func (m *Manager) SetInterval(d time.Duration) *Manager {
+	m.interval = d
+	return m
+}
+
+// SetWindow sets how many messages of a campaign are in the queue at once.
+func (m *Manager) SetWindow(n int) *Manager {
+	m.window = n
+	return m
+}
+
+// SetClock replaces time source, for tests.
+func (m *Manager) SetClock(now func() time.Time) *Manager {
+	m.now = now
+	return m
+}
+
+// Create reads recipients of the file and saves a draft campaign. It is sent once started.
+func (m *Manager) Create(ctx context.Context, r *Request) (*storage.Campaign, error) {
+	if r.IDInstance == "" {
+		return nil, fmt.Errorf("%w: id_instance is required", ErrInvalid)
+	}
+
+	if _, err := parseTemplate(r.Template); err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+
+	recipients, err := parseFile(r.File, now)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &storage.Campaign{
+		ID:         newID(),
+		IDInstance: r.IDInstance,
+		Name:       r.Name,
+		Template:   r.Template,
+		Status:     storage.CampaignDraft,
+		Total:      len(recipients),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err := m.store.SaveCampaign(ctx, c, recipients); err != nil {
+		return nil, err
+	}
+
+	return m.Get(ctx, c.ID)
+}
+
+// Get returns the campaign with its progress.
+func (m *Manager) Get(ctx context.Context, id string) (*storage.Campaign, error) {
+	c, err := m.store.GetCampaign(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Progress, err = m.store.CampaignProgress(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// List returns the latest campaigns with their progress, empty idInstance matches any.
+func (m *Manager) List(ctx context.Context, idInstance string, limit int) ([]storage.Campaign, error) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+
+	campaigns, err := m.store.ListCampaigns(ctx, idInstance, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range campaigns {
+		if campaigns[i].Progress, err = m.store.CampaignProgress(ctx, campaigns[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return campaigns, nil
+}
+
+// Update changes name and template of a draft, empty values are kept.
+func (m *Manager) Update(ctx context.Context, id, name, text string) (*storage.Campaign, error) {
+	c, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Status != storage.CampaignDraft {
+		return nil, fmt.Errorf("%w: only drafts can be changed", ErrStatus)
+	}
+
+	if text != "" {
+		if _, err := parseTemplate(text); err != nil {
+			return nil, err
+		}
+
+		c.Template = text
+	}
+
+	if name != "" {
+		c.Name = name
+	}
+
+	if err := m.update(ctx, c, storage.CampaignDraft); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Preview renders messages of the first recipients.
+func (m *Manager) Preview(ctx context.Context, id string, limit int) ([]Preview, error) {
+	if limit <= 0 {
+		limit = DefaultPreviewLimit
+	}
+
+	c, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := parseTemplate(c.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := m.store.CampaignRecipients(ctx, id, "", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	previews := make([]Preview, 0, len(recipients))
+
+	for i := range recipients {
+		r := &recipients[i]
+		p := Preview{
+			Line:   r.Line,
+			Phone:  r.Phone,
+			ChatID: r.ChatID,
+			Status: r.Status,
+			Error:  r.Error,
+		}
+
+		if r.Status != storage.RecipientSkipped {
+			if p.Message, err = render(t, r); err != nil {
+				p.Error = err.Error()
+			}
+		}
+
+		previews = append(previews, p)
+	}
+
+	return previews, nil
+}
+
+// Do performs action of the campaign: start, pause, resume or cancel. A campaign is started once,
+// every message is rendered and validated before. Messages already in the queue are still sent
+// after the campaign is paused or cancelled.
+func (m *Manager) Do(ctx context.Context, id, action string) (*storage.Campaign, error) {
+	transition, ok := transitions[action]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalid, action)
+	}
+
+	c, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	from := c.Status
+
+	allowed := false
+
+	for _, status := range transition.from {
+		allowed = allowed || status == from
+	}
+
+	if !allowed {
+		return nil, fmt.Errorf("%w: %s campaign can not %s", ErrStatus, from, action)
+	}
+
+	if action == "start" {
+		if err := m.validate(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+
+	c.Status = transition.to
+
+	if err := m.update(ctx, c, from); err != nil {
+		return nil, err
+	}
+
+	if c.Status == storage.CampaignCancelled {
+		if err := m.store.CancelRecipients(ctx, id, c.UpdatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return m.Get(ctx, id)
+}
+
+// Report writes results of every recipient as csv.
+func (m *Manager) Report(ctx context.Context, id string, w io.Writer) error {
+	if _, err := m.Get(ctx, id); err != nil {
+		return err
+	}
+
+	recipients, err := m.store.CampaignRecipients(ctx, id, "", 0)
+	if err != nil {
+		return err
+	}
+
+	report := csv.NewWriter(w)
+
+	if err := report.Write([]string{"line", "phone", "chat_id", "status", "id_message", "error", "updated_at"}); err != nil {
+		return err
+	}
+
+	for i := range recipients {
+		r := &recipients[i]
+
+		err := report.Write([]string{
+			strconv.Itoa(r.Line), r.Phone, r.ChatID, r.Status, r.IDMessage, r.Error, r.UpdatedAt.Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	report.Flush()
+
+	return report.Error()
+}
+
+// Run advances running campaigns every interval until done is closed.
+func (m *Manager) Run(done <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		campaigns, err := m.store.ActiveCampaigns(ctx)
+		if err != nil {
+			logger.Errorw("failed to read active campaigns", "error", err)
+		}
+
+		for i := range campaigns {
+			m.step(ctx, &campaigns[i])
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// step collects results of queued messages and queues pending ones up to the window.
+// A running campaign without pending and queued messages is completed.
+func (m *Manager) step(ctx context.Context, c *storage.Campaign) {
+	inFlight, err := m.collect(ctx, c)
+	if err != nil {
+		logger.Errorw("failed to collect campaign results", "id", c.ID, "error", err)
+		return
+	}
+
+	if c.Status != storage.CampaignRunning {
+		return
+	}
+
+	free := m.window - inFlight
+	if free <= 0 {
+		return
+	}
+
+	pending, err := m.store.CampaignRecipients(ctx, c.ID, storage.RecipientPending, free)
+	if err != nil {
+		logger.Errorw("failed to read campaign recipients", "id", c.ID, "error", err)
+		return
+	}
+
+	if len(pending) == 0 && inFlight == 0 {
+		c.Status = storage.CampaignCompleted
+
+		// a campaign paused meanwhile is completed once resumed
+		err := m.update(ctx, c, storage.CampaignRunning)
+
+		switch {
+		case err == nil:
+			logger.Infow("campaign completed", "id", c.ID, "instance", c.IDInstance)
+		case !errors.Is(err, ErrStatus):
+			logger.Errorw("failed to complete campaign", "id", c.ID, "error", err)
+		}
+
+		return
+	}
+
+	t, err := parseTemplate(c.Template)
+	if err != nil {
+		logger.Errorw("campaign template is broken", "id", c.ID, "error", err)
+		return
+	}
+
+	for i := range pending {
+		if !m.enqueue(ctx, c, t, &pending[i]) {
+			return
+		}
+	}
+}
+
+// collect updates queued recipients whose messages are sent or dead and returns how many are still queued.
+func (m *Manager) collect(ctx context.Context, c *storage.Campaign) (int, error) {
+	queued, err := m.store.CampaignRecipients(ctx, c.ID, storage.RecipientQueued, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	inFlight := 0
+
+	for i := range queued {
+		r := &queued[i]
+
+		if r.IDJob == "" {
+			// claimed by a runner which is queueing the message or failed to save its job
+			if m.now().Sub(r.UpdatedAt) < claimTimeout {
+				inFlight++
+				continue
+			}
+
+			r.Status = storage.RecipientFailed
+			r.Error = "the message is claimed without a job, it may have been sent"
+			r.UpdatedAt = m.now()
+
+			if err := m.store.UpdateRecipient(ctx, r, storage.RecipientQueued); err != nil &&
+				!errors.Is(err, storage.ErrNotFound) {
+				return 0, err
+			}
+
+			continue
+		}
+
+		job, err := m.queue.Get(ctx, r.IDJob)
+
+		switch {
+		case errors.Is(err, queue.ErrNotFound):
+			r.Status = storage.RecipientFailed
+			r.Error = "queued message is lost"
+		case err != nil:
+			return 0, err
+		case !job.Finished():
+			inFlight++
+			continue
+		case job.Status == storage.JobSent:
+			r.Status = storage.RecipientSent
+			r.IDMessage = job.IDMessage
+		default:
+			r.Status = storage.RecipientFailed
+			r.Error = job.Error
+		}
+
+		r.UpdatedAt = m.now()
+
+		// another runner may have collected the recipient meanwhile
+		if err := m.store.UpdateRecipient(ctx, r, storage.RecipientQueued); err != nil &&
+			!errors.Is(err, storage.ErrNotFound) {
+			return 0, err
+		}
+	}
+
+	return inFlight, nil
+}
+
+// enqueue claims the pending recipient and queues its message, so concurrent runners send it once.
+// A recipient claimed by another runner is skipped. It returns false when the queue failed
+// and the recipient is pending again.
+func (m *Manager) enqueue(ctx context.Context, c *storage.Campaign, t *template.Template, r *storage.Recipient) bool {
+	r.Status = storage.RecipientQueued
+	r.UpdatedAt = m.now()
+
+	err := m.store.UpdateRecipient(ctx, r, storage.RecipientPending)
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return true
+	case err != nil:
+		logger.Errorw("failed to claim campaign recipient", "id", c.ID, "line", r.Line, "error", err)
+		return false
+	}
+
+	queued := true
+
+	job, err := m.send(ctx, c, t, r)
+
+	switch {
+	case err == nil:
+		r.IDJob = job.ID
+	case errors.Is(err, errQueue):
+		logger.Errorw("failed to queue campaign message", "id", c.ID, "line", r.Line, "error", err)
+
+		r.Status = storage.RecipientPending
+		queued = false
+	default:
+		r.Status = storage.RecipientFailed
+		r.Error = err.Error()
+	}
+
+	r.UpdatedAt = m.now()
+
+	if err := m.store.UpdateRecipient(ctx, r, storage.RecipientQueued); err != nil {
+		logger.Errorw("failed to update campaign recipient", "id", c.ID, "line", r.Line, "error", err)
+		return false
+	}
+
+	return queued
+}
+
+// errQueue marks failures of the queue, the message may be queued later.
+var errQueue = errors.New("queue failed")
+
+// send queues the message of the recipient. Failures of the queue are errQueue,
+// other errors are of the recipient.
+func (m *Manager) send(ctx context.Context, c *storage.Campaign, t *template.Template,
+	r *storage.Recipient) (*storage.Job, error) {
+	body, err := payload(t, r)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := m.queue.Enqueue(ctx, c.IDInstance, httpclient.MethodSendMessage, body)
+	if err != nil && !queue.Rejected(err) {
+		return nil, fmt.Errorf("%w: %w", errQueue, err)
+	}
+
+	return job, err
+}
+
+// validate renders and validates messages of every pending recipient before the campaign starts.
+func (m *Manager) validate(ctx context.Context, c *storage.Campaign) error {
+	t, err := parseTemplate(c.Template)
+	if err != nil {
+		return err
+	}
+
+	recipients, err := m.store.CampaignRecipients(ctx, c.ID, storage.RecipientPending, 0)
+	if err != nil {
+		return err
+	}
+
+	if len(recipients) == 0 {
+		return fmt.Errorf("%w: campaign has no recipients to send to", ErrInvalid)
+	}
+
+	for i := range recipients {
+		r := &recipients[i]
+
+		body, err := payload(t, r)
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %w", ErrInvalid, r.Line, err)
+		}
+
+		if _, _, err := m.queue.Validate(c.IDInstance, httpclient.MethodSendMessage, body); err != nil {
+			return fmt.Errorf("line %d: %w", r.Line, err)
+		}
+	}
+
+	return nil
+}
+
+// update saves the campaign while it has status from, ErrStatus is returned when it was changed meanwhile.
+func (m *Manager) update(ctx context.Context, c *storage.Campaign, from string) error {
+	c.UpdatedAt = m.now()
+
+	err := m.store.UpdateCampaign(ctx, c, from)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrStatus
+	}
+
+	return err
+}
+
+// newID returns a random campaign id.
+func newID() string {
+	const size = 16
+
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,457 @@
+package campaign_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/campaign"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+const (
+	testID    = "1101000001"
+	testToken = "d75b3a66374942c5b3c019c698abc2067e151558acbd412345"
+)
+
+const file = "Phone,Name,Order\n" +
+	"+7 (999) 123-45-67,Anna,1001\n" +
+	"12,Boris,1002\n" +
+	"79991234567,Anna again,1003\n" +
+	"120363043968066561@g.us,Team,1004\n"
+
+// fakeCampaigns is an in-memory CampaignStorage.
+type fakeCampaigns struct {
+	campaigns  map[string]storage.Campaign
+	recipients map[string][]storage.Recipient
+	mu         sync.Mutex
+}
+
+func newFakeCampaigns() *fakeCampaigns {
+	return &fakeCampaigns{
+		campaigns:  make(map[string]storage.Campaign),
+		recipients: make(map[string][]storage.Recipient),
+	}
+}
+
+func (f *fakeCampaigns) SaveCampaign(_ context.Context, c *storage.Campaign, recipients []storage.Recipient) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.campaigns[c.ID] = *c
+
+	for _, r := range recipients {
+		r.CampaignID = c.ID
+		f.recipients[c.ID] = append(f.recipients[c.ID], r)
+	}
+
+	return nil
+}
+
+func (f *fakeCampaigns) UpdateCampaign(_ context.Context, c *storage.Campaign, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if stored, ok := f.campaigns[c.ID]; !ok || stored.Status != status {
+		return storage.ErrNotFound
+	}
+
+	saved := *c
+	saved.Progress = nil
+	f.campaigns[c.ID] = saved
+
+	return nil
+}
+
+func (f *fakeCampaigns) GetCampaign(_ context.Context, id string) (*storage.Campaign, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.campaigns[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &c, nil
+}
+
+func (f *fakeCampaigns) ListCampaigns(_ context.Context, idInstance string, _ int) ([]storage.Campaign, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	campaigns := []storage.Campaign{}
+
+	for _, c := range f.campaigns {
+		if idInstance == "" || c.IDInstance == idInstance {
+			campaigns = append(campaigns, c)
+		}
+	}
+
+	return campaigns, nil
+}
+
+func (f *fakeCampaigns) ActiveCampaigns(context.Context) ([]storage.Campaign, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	campaigns := []storage.Campaign{}
+
+	for id, c := range f.campaigns {
+		active := c.Status == storage.CampaignRunning
+
+		for _, r := range f.recipients[id] {
+			active = active || r.Status == storage.RecipientQueued
+		}
+
+		if active {
+			campaigns = append(campaigns, c)
+		}
+	}
+
+	sort.Slice(campaigns, func(i, j int) bool { return campaigns[i].ID < campaigns[j].ID })
+
+	return campaigns, nil
+}
+
+func (f *fakeCampaigns) CampaignProgress(_ context.Context, id string) (map[string]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	progress := make(map[string]int)
+	for _, r := range f.recipients[id] {
+		progress[r.Status]++
+	}
+
+	return progress, nil
+}
+
+func (f *fakeCampaigns) CampaignRecipients(_ context.Context, id, status string, limit int) ([]storage.Recipient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	recipients := []storage.Recipient{}
+
+	for _, r := range f.recipients[id] {
+		if (status == "" || r.Status == status) && (limit == 0 || len(recipients) < limit) {
+			recipients = append(recipients, r)
+		}
+	}
+
+	return recipients, nil
+}
+
+func (f *fakeCampaigns) UpdateRecipient(_ context.Context, r *storage.Recipient, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, stored := range f.recipients[r.CampaignID] {
+		if stored.Line == r.Line && stored.Status == status {
+			f.recipients[r.CampaignID][i] = *r
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
+
+func (f *fakeCampaigns) CancelRecipients(_ context.Context, id string, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, r := range f.recipients[id] {
+		if r.Status == storage.RecipientPending {
+			f.recipients[id][i].Status = storage.RecipientCancelled
+			f.recipients[id][i].UpdatedAt = now
+		}
+	}
+
+	return nil
+}
+
+// newQueue returns a queue of the instance over a fake GREEN-API which counts sent messages.
+func newQueue(t *testing.T) (*queue.Queue, *[]string) {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		sent []string
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		mu.Lock()
+		sent = append(sent, string(body))
+		mu.Unlock()
+
+		_, _ = io.WriteString(rw, `{"idMessage":"3EB0C767D097B7C7C030"}`)
+	}))
+	t.Cleanup(ts.Close)
+
+	q := queue.New(httpclient.NewPool(ts.URL, ts.Client(), map[string]string{testID: testToken})).
+		SetPolicy(queue.Policy{MaxAttempts: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	return q, &sent
+}
+
+// run starts the queue and the manager until the test ends.
+func run(t *testing.T, q *queue.Queue, m *campaign.Manager) {
+	t.Helper()
+
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for _, run := range []func(<-chan struct{}){q.Run, m.Run} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			run(done)
+		}()
+	}
+
+	t.Cleanup(func() {
+		close(done)
+		wg.Wait()
+	})
+}
+
+func create(t *testing.T, m *campaign.Manager, template string) *storage.Campaign {
+	t.Helper()
+
+	c, err := m.Create(context.Background(), &campaign.Request{
+		IDInstance: testID,
+		Name:       "orders",
+		Template:   template,
+		File:       strings.NewReader(file),
+	})
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestManager_Create(t *testing.T) {
+	q, _ := newQueue(t)
+	m := campaign.New(newFakeCampaigns(), q)
+
+	c := create(t, m, "Hello {{.Name}}, order {{.Order}} is ready")
+
+	assert.Equal(t, storage.CampaignDraft, c.Status)
+	assert.Equal(t, 4, c.Total)
+	assert.Equal(t, map[string]int{storage.RecipientPending: 2, storage.RecipientSkipped: 2}, c.Progress)
+
+	previews, err := m.Preview(context.Background(), c.ID, 10)
+	require.NoError(t, err)
+
+	assert.Equal(t, []campaign.Preview{
+		{
+			Line:    2,
+			Phone:   "+7 (999) 123-45-67",
+			ChatID:  "79991234567@c.us",
+			Status:  storage.RecipientPending,
+			Message: "Hello Anna, order 1001 is ready",
+		},
+		{
+			Line:   3,
+			Phone:  "12",
+			Status: storage.RecipientSkipped,
+			Error:  `invalid chat id: phone "12" has 2 digits, international numbers have 8 to 15`,
+		},
+		{
+			Line:   4,
+			Phone:  "79991234567",
+			ChatID: "79991234567@c.us",
+			Status: storage.RecipientSkipped,
+			Error:  "duplicate of line 2",
+		},
+		{
+			Line:    5,
+			Phone:   "120363043968066561@g.us",
+			ChatID:  "120363043968066561@g.us",
+			Status:  storage.RecipientPending,
+			Message: "Hello Team, order 1004 is ready",
+		},
+	}, previews)
+
+	// a template with an unknown field is shown in the preview and can be fixed in the draft
+	c, err = m.Update(context.Background(), c.ID, "", "Hello {{.Surname}}")
+	require.NoError(t, err)
+
+	previews, err = m.Preview(context.Background(), c.ID, 1)
+	require.NoError(t, err)
+	require.Len(t, previews, 1)
+	assert.Contains(t, previews[0].Error, "Surname")
+
+	_, err = m.Do(context.Background(), c.ID, "start")
+	require.ErrorIs(t, err, campaign.ErrInvalid)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestManager_Create_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		file     string
+	}{
+		{name: "no template", file: file},
+		{name: "broken template", template: "Hello {{.Name", file: file},
+		{name: "empty file", template: "hi"},
+		{name: "no phone column", template: "hi", file: "name\nAnna\n"},
+		{name: "no recipients", template: "hi", file: "phone\n"},
+		{name: "wrong number of fields", template: "hi", file: "phone,name\n79991234567\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := newQueue(t)
+
+			_, err := campaign.New(newFakeCampaigns(), q).Create(context.Background(), &campaign.Request{
+				IDInstance: testID,
+				Template:   tt.template,
+				File:       strings.NewReader(tt.file),
+			})
+			require.ErrorIs(t, err, campaign.ErrInvalid)
+		})
+	}
+}
+
+func TestManager_Run(t *testing.T) {
+	ctx := context.Background()
+	q, sent := newQueue(t)
+	m := campaign.New(newFakeCampaigns(), q).SetInterval(time.Millisecond).SetWindow(1)
+
+	c := create(t, m, "Hello {{.Name}}")
+
+	_, err := m.Do(ctx, c.ID, "pause")
+	require.ErrorIs(t, err, campaign.ErrStatus)
+
+	c, err = m.Do(ctx, c.ID, "start")
+	require.NoError(t, err)
+	assert.Equal(t, storage.CampaignRunning, c.Status)
+
+	_, err = m.Do(ctx, c.ID, "start")
+	require.ErrorIs(t, err, campaign.ErrStatus)
+
+	_, err = m.Update(ctx, c.ID, "renamed", "")
+	require.ErrorIs(t, err, campaign.ErrStatus)
+
+	run(t, q, m)
+
+	require.Eventually(t, func() bool {
+		c, err = m.Get(ctx, c.ID)
+		require.NoError(t, err)
+
+		return c.Status == storage.CampaignCompleted
+	}, 2*time.Second, time.Millisecond)
+
+	assert.Equal(t, map[string]int{storage.RecipientSent: 2, storage.RecipientSkipped: 2}, c.Progress)
+	assert.Len(t, *sent, 2)
+	assert.JSONEq(t, `{"chatId":"79991234567@c.us","message":"Hello Anna"}`, (*sent)[0])
+
+	var report bytes.Buffer
+
+	require.NoError(t, m.Report(ctx, c.ID, &report))
+
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, "line,phone,chat_id,status,id_message,error,updated_at", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "2,+7 (999) 123-45-67,79991234567@c.us,sent,3EB0C767D097B7C7C030,,"))
+	assert.True(t, strings.HasPrefix(lines[3], `4,79991234567,79991234567@c.us,skipped,,duplicate of line 2,`))
+
+	_, err = m.Do(ctx, c.ID, "cancel")
+	require.ErrorIs(t, err, campaign.ErrStatus)
+}
+
+func TestManager_ConcurrentRunners(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeCampaigns()
+	q, sent := newQueue(t)
+	m := campaign.New(store, q).SetInterval(time.Millisecond)
+
+	c := create(t, m, "Hello {{.Name}}")
+
+	_, err := m.Do(ctx, c.ID, "start")
+	require.NoError(t, err)
+
+	run(t, q, m)
+
+	// the second runner shares the database and claims pending recipients as well
+	other := campaign.New(store, q).SetInterval(time.Millisecond)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		other.Run(done)
+	}()
+
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+
+	require.Eventually(t, func() bool {
+		c, err = m.Get(ctx, c.ID)
+		require.NoError(t, err)
+
+		return c.Status == storage.CampaignCompleted
+	}, 2*time.Second, time.Millisecond)
+
+	assert.Equal(t, map[string]int{storage.RecipientSent: 2, storage.RecipientSkipped: 2}, c.Progress)
+	assert.Len(t, *sent, 2, "every recipient is sent once")
+}
+
+func TestManager_PauseCancel(t *testing.T) {
+	ctx := context.Background()
+	q, sent := newQueue(t)
+	m := campaign.New(newFakeCampaigns(), q).SetInterval(time.Millisecond)
+
+	c := create(t, m, "Hello {{.Name}}")
+
+	_, err := m.Do(ctx, c.ID, "start")
+	require.NoError(t, err)
+
+	c, err = m.Do(ctx, c.ID, "pause")
+	require.NoError(t, err)
+	assert.Equal(t, storage.CampaignPaused, c.Status)
+
+	run(t, q, m)
+
+	// a paused campaign queues nothing
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, *sent)
+
+	c, err = m.Do(ctx, c.ID, "cancel")
+	require.NoError(t, err)
+	assert.Equal(t, storage.CampaignCancelled, c.Status)
+	assert.Equal(t, map[string]int{storage.RecipientCancelled: 2, storage.RecipientSkipped: 2}, c.Progress)
+
+	_, err = m.Do(ctx, c.ID, "resume")
+	require.ErrorIs(t, err, campaign.ErrStatus)
+
+	_, err = m.Do(ctx, c.ID, "restart")
+	require.ErrorIs(t, err, campaign.ErrInvalid)
+
+	_, err = m.Get(ctx, "unknown")
+	require.ErrorIs(t, err, campaign.ErrNotFound)
+
+	list, err := m.List(ctx, testID, 0)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, 2, list[0].Progress[storage.RecipientCancelled])
+}
@@ -0,0 +1,155 @@
+package campaign
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/chatid"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+	"github.com/ole-larsen/green-api/internal/templates"
+)
+
+// phoneColumns are names of the recipient column, case is ignored.
+var phoneColumns = []string{"phone", "chatid", "chat_id"}
+
+// parseFile reads recipients of a csv file. The header names columns, the phone column is required,
+// all columns are merge fields. Rows which can not be sent to are skipped with the reason.
+func parseFile(file io.Reader, now time.Time) ([]storage.Recipient, error) {
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalid)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	phone := -1
+
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		header[i] = name
+
+		for _, column := range phoneColumns {
+			if phone < 0 && strings.EqualFold(name, column) {
+				phone = i
+			}
+		}
+	}
+
+	if phone < 0 {
+		return nil, fmt.Errorf("%w: file must have a phone column", ErrInvalid)
+	}
+
+	recipients := []storage.Recipient{}
+	lines := make(map[string]int)
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+
+		if len(recipients) == MaxRecipients {
+			return nil, fmt.Errorf("%w: file has more than %d recipients", ErrInvalid, MaxRecipients)
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		fields := make(map[string]string, len(header))
+		for i, name := range header {
+			fields[name] = strings.TrimSpace(record[i])
+		}
+
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+
+		r := storage.Recipient{
+			Line:      line,
+			Phone:     fields[header[phone]],
+			Fields:    data,
+			Status:    storage.RecipientPending,
+			UpdatedAt: now,
+		}
+
+		r.ChatID, err = chatid.Normalize(r.Phone)
+
+		switch {
+		case err != nil:
+			r.Status = storage.RecipientSkipped
+			r.Error = err.Error()
+		case lines[r.ChatID] > 0:
+			r.Status = storage.RecipientSkipped
+			r.Error = fmt.Sprintf("duplicate of line %d", lines[r.ChatID])
+		default:
+			lines[r.ChatID] = line
+		}
+
+		recipients = append(recipients, r)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: file has no recipients", ErrInvalid)
+	}
+
+	return recipients, nil
+}
+
+// parseTemplate parses message template, fields missing in a row fail its rendering.
+// Merge fields are placeholders of the templates package: {{name}} or {{.name}}.
+func parseTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("%w: template is required", ErrInvalid)
+	}
+
+	t, err := templates.Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	return t, nil
+}
+
+// render renders the message of the recipient.
+func render(t *template.Template, r *storage.Recipient) (string, error) {
+	var fields map[string]string
+	if err := json.Unmarshal(r.Fields, &fields); err != nil {
+		return "", err
+	}
+
+	var message strings.Builder
+	if err := t.Execute(&message, fields); err != nil {
+		return "", err
+	}
+
+	return message.String(), nil
+}
+
+// payload is sendMessage request of the recipient.
+func payload(t *template.Template, r *storage.Recipient) ([]byte, error) {
+	message, err := render(t, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&httpclient.SendMessageRequest{
+		ChatID:  r.ChatID,
+		Message: message,
+	})
+}
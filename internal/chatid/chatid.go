@@ -0,0 +1,158 @@
+// Package chatid parses phone numbers and chat ids typed by users into GREEN-API chat ids.
+// A phone like "+7 (999) 123-45-67" is normalized to E.164 "+79991234567" and then
+// to the personal chat id "79991234567@c.us". Group ids "...@g.us" are accepted as is.
+package chatid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Chat id suffixes of personal and group chats.
+const (
+	PersonalSuffix = "@c.us"
+	GroupSuffix    = "@g.us"
+)
+
+// E.164 limits of a phone number without the plus: country code and subscriber number.
+const (
+	MinDigits = 8
+	MaxDigits = 15
+)
+
+var (
+	ErrEmpty   = errors.New("chat id is empty")
+	ErrInvalid = errors.New("invalid chat id")
+)
+
+// separators may be typed between digits of a phone number.
+const separators = " -(). "
+
+// ID is a parsed chat id. Phone is E.164 number of a personal chat, empty for a group.
+type ID struct {
+	ChatID string `json:"chat_id"`
+	Phone  string `json:"phone,omitempty"`
+	Group  bool   `json:"group"`
+}
+
+// Parse parses a phone number or a chat id. Errors wrap ErrEmpty or ErrInvalid and tell what is wrong.
+func Parse(input string) (ID, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return ID{}, ErrEmpty
+	}
+
+	at := strings.IndexByte(input, '@')
+	if at < 0 {
+		phone, err := E164(input)
+		if err != nil {
+			return ID{}, err
+		}
+
+		return ID{ChatID: phone[1:] + PersonalSuffix, Phone: phone}, nil
+	}
+
+	local, suffix := input[:at], input[at:]
+
+	switch suffix {
+	case PersonalSuffix:
+		if err := digits(local, fmt.Sprintf("chat id %q", input)); err != nil {
+			return ID{}, err
+		}
+
+		return ID{ChatID: input, Phone: "+" + local}, nil
+	case GroupSuffix:
+		if err := group(local); err != nil {
+			return ID{}, err
+		}
+
+		return ID{ChatID: input, Group: true}, nil
+	default:
+		return ID{}, fmt.Errorf("%w: %q must end with %s or %s", ErrInvalid, input, PersonalSuffix, GroupSuffix)
+	}
+}
+
+// Normalize returns the chat id of a phone number or a chat id.
+func Normalize(input string) (string, error) {
+	id, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+
+	return id.ChatID, nil
+}
+
+// E164 returns the phone number as +79991234567. Spaces, dashes, dots and parentheses are dropped,
+// the plus is optional but only in front, the number must start with the country code.
+func E164(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	if phone == "" {
+		return "", ErrEmpty
+	}
+
+	var b strings.Builder
+
+	b.WriteByte('+')
+
+	position := 0
+
+	for _, r := range phone {
+		position++
+
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && position == 1:
+		case r == '+':
+			return "", fmt.Errorf("%w: phone %q may have + only in front", ErrInvalid, phone)
+		case strings.ContainsRune(separators, r):
+		default:
+			return "", fmt.Errorf("%w: phone %q has unexpected %q at position %d", ErrInvalid, phone, r, position)
+		}
+	}
+
+	number := b.String()
+	if err := digits(number[1:], fmt.Sprintf("phone %q", phone)); err != nil {
+		return "", err
+	}
+
+	return number, nil
+}
+
+// digits checks the number part of a phone or a personal chat id.
+func digits(number, what string) error {
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("%w: %s must have digits only before %s", ErrInvalid, what, PersonalSuffix)
+		}
+	}
+
+	if n := len(number); n < MinDigits || n > MaxDigits {
+		return fmt.Errorf("%w: %s has %d digits, international numbers have %d to %d",
+			ErrInvalid, what, n, MinDigits, MaxDigits)
+	}
+
+	if number[0] == '0' {
+		return fmt.Errorf("%w: %s must start with the country code, not 0", ErrInvalid, what)
+	}
+
+	return nil
+}
+
+// group checks the part of a group id before @g.us: digits, or creator phone and timestamp
+// joined by a dash in old groups.
+func group(local string) error {
+	parts := strings.Split(local, "-")
+	if local == "" || len(parts) > 2 {
+		return fmt.Errorf("%w: group id %q must be digits before %s", ErrInvalid, local+GroupSuffix, GroupSuffix)
+	}
+
+	for _, part := range parts {
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return fmt.Errorf("%w: group id %q must be digits before %s", ErrInvalid, local+GroupSuffix, GroupSuffix)
+		}
+	}
+
+	return nil
+}
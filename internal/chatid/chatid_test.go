@@ -0,0 +1,74 @@
+package chatid_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/chatid"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  chatid.ID
+	}{
+		{"formatted phone", "+7 (999) 123-45-67", chatid.ID{ChatID: "79991234567@c.us", Phone: "+79991234567"}},
+		{"digits", "79991234567", chatid.ID{ChatID: "79991234567@c.us", Phone: "+79991234567"}},
+		{"dots", " 1.650.555.0100 ", chatid.ID{ChatID: "16505550100@c.us", Phone: "+16505550100"}},
+		{"chat id", "79991234567@c.us", chatid.ID{ChatID: "79991234567@c.us", Phone: "+79991234567"}},
+		{"group", "120363043968066561@g.us", chatid.ID{ChatID: "120363043968066561@g.us", Group: true}},
+		{"old group", "79991234567-1587570015@g.us", chatid.ID{ChatID: "79991234567-1587570015@g.us", Group: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := chatid.Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"79991234567@s.whatsapp.net", `invalid chat id: "79991234567@s.whatsapp.net" must end with @c.us or @g.us`},
+		{"7999123456a", `invalid chat id: phone "7999123456a" has unexpected 'a' at position 11`},
+		{"7+9991234567", `invalid chat id: phone "7+9991234567" may have + only in front`},
+		{"+7 999", `invalid chat id: phone "+7 999" has 4 digits, international numbers have 8 to 15`},
+		{"8 (999) 123-45-67 12345", `invalid chat id: phone "8 (999) 123-45-67 12345" has 16 digits, ` +
+			`international numbers have 8 to 15`},
+		{"0079991234567", `invalid chat id: phone "0079991234567" must start with the country code, not 0`},
+		{"7999-123@c.us", `invalid chat id: chat id "7999-123@c.us" must have digits only before @c.us`},
+		{"@c.us", `invalid chat id: chat id "@c.us" has 0 digits, international numbers have 8 to 15`},
+		{"abc@g.us", `invalid chat id: group id "abc@g.us" must be digits before @g.us`},
+		{"1-2-3@g.us", `invalid chat id: group id "1-2-3@g.us" must be digits before @g.us`},
+		{"@g.us", `invalid chat id: group id "@g.us" must be digits before @g.us`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := chatid.Parse(tt.input)
+			require.ErrorIs(t, err, chatid.ErrInvalid)
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+
+	_, err := chatid.Parse("  ")
+	require.ErrorIs(t, err, chatid.ErrEmpty)
+}
+
+func TestE164(t *testing.T) {
+	phone, err := chatid.E164("+44 20 7946 0958")
+	require.NoError(t, err)
+	assert.Equal(t, "+442079460958", phone)
+
+	id, err := chatid.Normalize("+44 20 7946 0958")
+	require.NoError(t, err)
+	assert.Equal(t, "442079460958@c.us", id)
+}
@@ -36,6 +36,21 @@ func (c *CompressWriter) WriteHeader(statusCode int) {
 	c.w.WriteHeader(statusCode)
 }
 
+// Flush sends data compressed so far to the client.
+func (c *CompressWriter) Flush() {
+	if err := c.zw.Flush(); err != nil {
+		return
+	}
+
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *CompressWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
 func (c *CompressWriter) Close() error {
 	return c.zw.Close()
 }
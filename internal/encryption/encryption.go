@@ -0,0 +1,224 @@
+// Package encryption encrypts request bodies for the server with its RSA key.
+// Small payloads are encrypted with RSA-OAEP (SHA-256) directly, large ones with
+// a random AES-256-GCM session key that is encrypted with RSA-OAEP.
+// Secrets stored by the server are sealed with AES-256-GCM by Sealer.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Header marks encrypted request body and carries its scheme.
+const Header = "X-Encryption"
+
+const (
+	// SchemeRSA - body is RSA-OAEP ciphertext of the plaintext.
+	SchemeRSA = "rsa-oaep"
+	// SchemeHybrid - body is RSA-OAEP ciphertext of AES-256 session key || GCM nonce || GCM ciphertext.
+	SchemeHybrid = "rsa-oaep+aes-gcm"
+)
+
+const sessionKeySize = 32
+
+var (
+	ErrUnknownScheme = errors.New("unknown encryption scheme")
+	ErrCiphertext    = errors.New("malformed ciphertext")
+	ErrNoKey         = errors.New("key is missing")
+)
+
+// ParsePrivateKey parses PEM encoded PKCS#1 or PKCS#8 RSA private key.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNoKey
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+
+	return rsaKey, nil
+}
+
+// ParsePublicKey parses RSA public key from PEM encoded certificate or PKIX/PKCS#1 public key.
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrNoKey
+	}
+
+	var (
+		key any
+		err error
+	)
+
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err == nil {
+			key = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not RSA")
+	}
+
+	return rsaKey, nil
+}
+
+// Encrypt encrypts plaintext for the owner of pub and returns ciphertext with the scheme
+// to be sent in Header.
+func Encrypt(pub *rsa.PublicKey, plaintext []byte) (ciphertext []byte, scheme string, err error) {
+	if pub == nil {
+		return nil, "", ErrNoKey
+	}
+
+	// RSA-OAEP message limit: k - 2*hLen - 2.
+	if len(plaintext) <= pub.Size()-2*sha256.Size-2 {
+		ciphertext, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, plaintext, nil)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return ciphertext, SchemeRSA, nil
+	}
+
+	sessionKey := make([]byte, sessionKeySize)
+	if _, err = rand.Read(sessionKey); err != nil {
+		return nil, "", err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, sessionKey, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+
+	ciphertext = make([]byte, 0, len(encryptedKey)+len(nonce)+len(plaintext)+gcm.Overhead())
+	ciphertext = append(ciphertext, encryptedKey...)
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = gcm.Seal(ciphertext, nonce, plaintext, nil)
+
+	return ciphertext, SchemeHybrid, nil
+}
+
+// EncryptRequest replaces request body with its ciphertext for pub and sets Header.
+func EncryptRequest(r *http.Request, pub *rsa.PublicKey) error {
+	var plaintext []byte
+
+	if r.Body != nil {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+
+		if err = r.Body.Close(); err != nil {
+			return err
+		}
+
+		plaintext = data
+	}
+
+	ciphertext, scheme, err := Encrypt(pub, plaintext)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set(Header, scheme)
+	r.Header.Set("Content-Length", strconv.Itoa(len(ciphertext)))
+	r.ContentLength = int64(len(ciphertext))
+	r.Body = io.NopCloser(bytes.NewReader(ciphertext))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(ciphertext)), nil
+	}
+
+	return nil
+}
+
+// Decrypt decrypts ciphertext produced by Encrypt with the scheme.
+func Decrypt(priv *rsa.PrivateKey, scheme string, ciphertext []byte) ([]byte, error) {
+	if priv == nil {
+		return nil, ErrNoKey
+	}
+
+	switch scheme {
+	case SchemeRSA:
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, ciphertext, nil)
+	case SchemeHybrid:
+		keySize := priv.Size()
+		if len(ciphertext) < keySize {
+			return nil, ErrCiphertext
+		}
+
+		sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, ciphertext[:keySize], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		gcm, err := newGCM(sessionKey)
+		if err != nil {
+			return nil, err
+		}
+
+		rest := ciphertext[keySize:]
+		if len(rest) < gcm.NonceSize() {
+			return nil, ErrCiphertext
+		}
+
+		return gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+	default:
+		return nil, ErrUnknownScheme
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
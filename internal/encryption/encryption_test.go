@@ -0,0 +1,113 @@
+package encryption_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/common"
+	"github.com/ole-larsen/green-api/internal/encryption"
+)
+
+func TestParseKeys(t *testing.T) {
+	priv, err := encryption.ParsePrivateKey([]byte(common.ServerMockKey))
+	require.NoError(t, err)
+
+	pub, err := encryption.ParsePublicKey([]byte(common.ServerMockCert))
+	require.NoError(t, err)
+
+	assert.True(t, priv.PublicKey.Equal(pub))
+
+	_, err = encryption.ParsePrivateKey([]byte("not a key"))
+	require.ErrorIs(t, err, encryption.ErrNoKey)
+
+	_, err = encryption.ParsePublicKey([]byte(common.ServerMockCertInvalid))
+	require.Error(t, err)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	priv, err := encryption.ParsePrivateKey([]byte(common.ServerMockKey))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		wantScheme string
+		plaintext  []byte
+	}{
+		{
+			name:       "small payload",
+			plaintext:  []byte(`{"chatId":"79876543210@c.us","message":"hello"}`),
+			wantScheme: encryption.SchemeRSA,
+		},
+		{
+			name:       "large payload",
+			plaintext:  bytes.Repeat([]byte("a"), 64*1024),
+			wantScheme: encryption.SchemeHybrid,
+		},
+		{
+			name:       "empty payload",
+			plaintext:  []byte{},
+			wantScheme: encryption.SchemeRSA,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ciphertext, scheme, err := encryption.Encrypt(&priv.PublicKey, tt.plaintext)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantScheme, scheme)
+			assert.NotEqual(t, tt.plaintext, ciphertext)
+
+			plaintext, err := encryption.Decrypt(priv, scheme, ciphertext)
+			require.NoError(t, err)
+			assert.Equal(t, string(tt.plaintext), string(plaintext))
+		})
+	}
+}
+
+func TestDecrypt_Errors(t *testing.T) {
+	priv, err := encryption.ParsePrivateKey([]byte(common.ServerMockKey))
+	require.NoError(t, err)
+
+	ciphertext, scheme, err := encryption.Encrypt(&priv.PublicKey, bytes.Repeat([]byte("a"), 1024))
+	require.NoError(t, err)
+
+	_, err = encryption.Decrypt(priv, "aes", ciphertext)
+	require.ErrorIs(t, err, encryption.ErrUnknownScheme)
+
+	_, err = encryption.Decrypt(priv, scheme, ciphertext[:10])
+	require.ErrorIs(t, err, encryption.ErrCiphertext)
+
+	ciphertext[len(ciphertext)-1] ^= 0xff
+
+	_, err = encryption.Decrypt(priv, scheme, ciphertext)
+	require.Error(t, err)
+
+	_, err = encryption.Decrypt(nil, scheme, ciphertext)
+	require.ErrorIs(t, err, encryption.ErrNoKey)
+}
+
+func TestEncryptRequest(t *testing.T) {
+	priv, err := encryption.ParsePrivateKey([]byte(common.ServerMockKey))
+	require.NoError(t, err)
+
+	body := []byte(`{"chatId":"79876543210@c.us","message":"hello"}`)
+
+	r, err := http.NewRequest(http.MethodPost, "https://localhost:8080/api/v1/instances/1101000001/sendMessage", bytes.NewReader(body))
+	require.NoError(t, err)
+
+	require.NoError(t, encryption.EncryptRequest(r, &priv.PublicKey))
+	assert.Equal(t, encryption.SchemeRSA, r.Header.Get(encryption.Header))
+
+	ciphertext, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(ciphertext)), r.ContentLength)
+
+	plaintext, err := encryption.Decrypt(priv, r.Header.Get(encryption.Header), ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, body, plaintext)
+}
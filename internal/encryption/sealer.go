@@ -0,0 +1,118 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// sealerContext separates the key of stored secrets from other keys derived from the same secret.
+	sealerContext = "green-api stored credentials"
+	// keyIDSize is the size of the key ID prefix of sealed ciphertext.
+	keyIDSize = 4
+)
+
+// Sealer encrypts secrets kept in the database, like instance tokens, with AES-256-GCM.
+// Keys are derived from the server secret and previous secrets, the current key encrypts and
+// the previous ones only decrypt until the data is sealed again. Ciphertext is
+// key ID || GCM nonce || GCM ciphertext, the key ID is a fingerprint of the key.
+type Sealer struct {
+	keys []sealerKey
+}
+
+type sealerKey struct {
+	gcm cipher.AEAD
+	id  []byte
+}
+
+// NewSealer creates a sealer with the key derived from secret and fallback keys derived from previous
+// secrets. Empty secret is ErrNoKey.
+func NewSealer(secret string, previous ...string) (*Sealer, error) {
+	if secret == "" {
+		return nil, ErrNoKey
+	}
+
+	s := &Sealer{}
+
+	for _, sec := range append([]string{secret}, previous...) {
+		key := DeriveKey(sec, sealerContext)
+
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+
+		fingerprint := sha256.Sum256(key)
+		s.keys = append(s.keys, sealerKey{gcm: gcm, id: fingerprint[:keyIDSize]})
+	}
+
+	return s, nil
+}
+
+// DeriveKey derives a 32 bytes key for the context from secret with HMAC-SHA256.
+func DeriveKey(secret, context string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(context))
+
+	return mac.Sum(nil)
+}
+
+// KeyID returns hex encoded ID of the current key.
+func (s *Sealer) KeyID() string {
+	return hex.EncodeToString(s.keys[0].id)
+}
+
+// Seal encrypts plaintext with the current key. The ciphertext opens only with the same additional data,
+// so a secret copied to another row is not accepted.
+func (s *Sealer) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	k := s.keys[0]
+
+	out := make([]byte, keyIDSize+k.gcm.NonceSize(), keyIDSize+k.gcm.NonceSize()+len(plaintext)+k.gcm.Overhead())
+	copy(out, k.id)
+
+	nonce := out[keyIDSize:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return k.gcm.Seal(out, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts ciphertext produced by Seal with the same additional data by the key of its ID.
+func (s *Sealer) Open(ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < keyIDSize {
+		return nil, ErrCiphertext
+	}
+
+	for _, k := range s.keys {
+		if !bytes.Equal(ciphertext[:keyIDSize], k.id) {
+			continue
+		}
+
+		if plaintext, err := open(k.gcm, ciphertext[keyIDSize:], additionalData); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no key opens it", ErrCiphertext)
+}
+
+// Current reports whether ciphertext is sealed with the current key, otherwise it should be sealed again.
+func (s *Sealer) Current(ciphertext []byte) bool {
+	return len(ciphertext) >= keyIDSize && bytes.Equal(ciphertext[:keyIDSize], s.keys[0].id)
+}
+
+func open(gcm cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, ErrCiphertext
+	}
+
+	size := gcm.NonceSize()
+
+	return gcm.Open(nil, ciphertext[:size], ciphertext[size:], additionalData)
+}
@@ -0,0 +1,99 @@
+package encryption_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/encryption"
+)
+
+func TestSealer(t *testing.T) {
+	s, err := encryption.NewSealer("secret")
+	require.NoError(t, err)
+
+	ciphertext, err := s.Seal([]byte("token"), []byte("main"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "token")
+
+	again, err := s.Seal([]byte("token"), []byte("main"))
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, again, "nonce is random")
+
+	plaintext, err := s.Open(ciphertext, []byte("main"))
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(plaintext))
+
+	_, err = s.Open(ciphertext, []byte("other"))
+	require.ErrorIs(t, err, encryption.ErrCiphertext)
+
+	_, err = s.Open(ciphertext[:10], []byte("main"))
+	require.ErrorIs(t, err, encryption.ErrCiphertext)
+
+	other, err := encryption.NewSealer("another secret")
+	require.NoError(t, err)
+
+	_, err = other.Open(ciphertext, []byte("main"))
+	require.ErrorIs(t, err, encryption.ErrCiphertext)
+
+	_, err = encryption.NewSealer("")
+	require.ErrorIs(t, err, encryption.ErrNoKey)
+}
+
+func TestSealer_PreviousKeys(t *testing.T) {
+	old, err := encryption.NewSealer("old secret")
+	require.NoError(t, err)
+
+	ciphertext, err := old.Seal([]byte("token"), []byte("main"))
+	require.NoError(t, err)
+	assert.True(t, old.Current(ciphertext))
+
+	s, err := encryption.NewSealer("new secret", "old secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, old.KeyID(), s.KeyID())
+	assert.False(t, s.Current(ciphertext))
+
+	plaintext, err := s.Open(ciphertext, []byte("main"))
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(plaintext))
+
+	resealed, err := s.Seal(plaintext, []byte("main"))
+	require.NoError(t, err)
+	assert.True(t, s.Current(resealed))
+	assert.Equal(t, s.KeyID(), hex.EncodeToString(resealed[:4]))
+
+	// the old secret alone can't open data sealed after rotation
+	_, err = old.Open(resealed, []byte("main"))
+	require.ErrorIs(t, err, encryption.ErrCiphertext)
+}
+
+func TestSealer_WithoutKeyID(t *testing.T) {
+	key := encryption.DeriveKey("secret", "green-api stored credentials")
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	nonce := make([]byte, gcm.NonceSize())
+	legacy := gcm.Seal(nonce, nonce, []byte("token"), []byte("main"))
+
+	s, err := encryption.NewSealer("new secret", "secret")
+	require.NoError(t, err)
+
+	_, err = s.Open(legacy, []byte("main"))
+	require.ErrorIs(t, err, encryption.ErrCiphertext, "ciphertext without a key ID is not accepted")
+	assert.False(t, s.Current(legacy))
+}
+
+func TestDeriveKey(t *testing.T) {
+	key := encryption.DeriveKey("secret", "tokens")
+	assert.Len(t, key, 32)
+	assert.Equal(t, key, encryption.DeriveKey("secret", "tokens"))
+	assert.NotEqual(t, key, encryption.DeriveKey("secret", "sessions"))
+}
@@ -0,0 +1,32 @@
+// Package hash signs and verifies payloads with HMAC-SHA256.
+package hash
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Header carries hex encoded HMAC-SHA256 of the request or response body.
+const Header = "HashSHA256"
+
+// Sign returns hex encoded HMAC-SHA256 of data keyed with secret.
+func Sign(secret string, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether sum is a valid signature of data. Comparison is constant time.
+func Verify(secret string, data []byte, sum string) bool {
+	expected, err := hex.DecodeString(sum)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+
+	return hmac.Equal(mac.Sum(nil), expected)
+}
@@ -0,0 +1,41 @@
+package hash_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ole-larsen/green-api/internal/hash"
+)
+
+func TestSign(t *testing.T) {
+	// echo -n '{"status":"ok"}' | openssl dgst -sha256 -hmac supersecret
+	sum := hash.Sign("supersecret", []byte(`{"status":"ok"}`))
+	assert.Equal(t, "f66e8d5b0fa39cba5481a635cddf6b9182a3384297f2673b6427ed62300b0ddb", sum)
+	assert.NotEqual(t, sum, hash.Sign("othersecret", []byte(`{"status":"ok"}`)))
+}
+
+func TestVerify(t *testing.T) {
+	data := []byte(`{"chatId":"79876543210@c.us","message":"hello"}`)
+	sum := hash.Sign("supersecret", data)
+
+	tests := []struct {
+		name   string
+		secret string
+		sum    string
+		data   []byte
+		want   bool
+	}{
+		{name: "valid", secret: "supersecret", data: data, sum: sum, want: true},
+		{name: "wrong secret", secret: "othersecret", data: data, sum: sum, want: false},
+		{name: "modified body", secret: "supersecret", data: []byte(`{}`), sum: sum, want: false},
+		{name: "not hex", secret: "supersecret", data: data, sum: "zz", want: false},
+		{name: "empty", secret: "supersecret", data: data, sum: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hash.Verify(tt.secret, tt.data, tt.sum))
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package httpclient
+
+import (
+	"context"
+)
+
+// Settings - instance settings. Flags take "yes" or "no" values.
+// Empty fields are omitted, so the same struct is used for setSettings.
+type Settings struct {
+	Wid                               string `json:"wid,omitempty"`
+	CountryInstance                   string `json:"countryInstance,omitempty"`
+	TypeAccount                       string `json:"typeAccount,omitempty"`
+	WebhookURL                        string `json:"webhookUrl,omitempty"`
+	WebhookURLToken                   string `json:"webhookUrlToken,omitempty"`
+	MarkIncomingMessagesReaded        string `json:"markIncomingMessagesReaded,omitempty"`
+	MarkIncomingMessagesReadedOnReply string `json:"markIncomingMessagesReadedOnReply,omitempty"`
+	SharedSession                     string `json:"sharedSession,omitempty"`
+	OutgoingWebhook                   string `json:"outgoingWebhook,omitempty"`
+	OutgoingMessageWebhook            string `json:"outgoingMessageWebhook,omitempty"`
+	OutgoingAPIMessageWebhook         string `json:"outgoingAPIMessageWebhook,omitempty"`
+	IncomingWebhook                   string `json:"incomingWebhook,omitempty"`
+	DeviceWebhook                     string `json:"deviceWebhook,omitempty"`
+	StatusInstanceWebhook             string `json:"statusInstanceWebhook,omitempty"`
+	StateWebhook                      string `json:"stateWebhook,omitempty"`
+	EnableMessagesHistory             string `json:"enableMessagesHistory,omitempty"`
+	KeepOnlineStatus                  string `json:"keepOnlineStatus,omitempty"`
+	PollMessageWebhook                string `json:"pollMessageWebhook,omitempty"`
+	IncomingBlockWebhook              string `json:"incomingBlockWebhook,omitempty"`
+	IncomingCallWebhook               string `json:"incomingCallWebhook,omitempty"`
+	EditedMessageWebhook              string `json:"editedMessageWebhook,omitempty"`
+	DeletedMessageWebhook             string `json:"deletedMessageWebhook,omitempty"`
+	DelaySendMessagesMilliseconds     int    `json:"delaySendMessagesMilliseconds,omitempty"`
+}
+
+type SetSettingsResponse struct {
+	SaveSettings bool `json:"saveSettings"`
+}
+
+// StateInstanceResponse - authorization state: notAuthorized, authorized, blocked, sleepMode, starting, yellowCard.
+type StateInstanceResponse struct {
+	StateInstance string `json:"stateInstance"`
+}
+
+// StatusInstanceResponse - socket status: online or offline.
+type StatusInstanceResponse struct {
+	StatusInstance string `json:"statusInstance"`
+}
+
+type RebootResponse struct {
+	IsReboot bool `json:"isReboot"`
+}
+
+type LogoutResponse struct {
+	IsLogout bool `json:"isLogout"`
+}
+
+// QRResponse - type is qrCode, alreadyLogged or error. For qrCode message is base64 png.
+type QRResponse struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type AuthorizationCodeRequest struct {
+	PhoneNumber int64 `json:"phoneNumber"`
+}
+
+type AuthorizationCodeResponse struct {
+	Code   string `json:"code"`
+	Status bool   `json:"status"`
+}
+
+// GetSettings returns current instance settings.
+func (c *Client) GetSettings(ctx context.Context) (*Settings, error) {
+	var out Settings
+	if err := c.getJSON(ctx, MethodGetSettings, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// SetSettings applies non-empty settings. Instance reboots after settings are saved.
+func (c *Client) SetSettings(ctx context.Context, in *Settings) (*SetSettingsResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	var out SetSettingsResponse
+	if err := c.postJSON(ctx, MethodSetSettings, in, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// GetStateInstance returns instance authorization state.
+func (c *Client) GetStateInstance(ctx context.Context) (*StateInstanceResponse, error) {
+	var out StateInstanceResponse
+	if err := c.getJSON(ctx, MethodGetStateInstance, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// GetStatusInstance returns instance socket status.
+func (c *Client) GetStatusInstance(ctx context.Context) (*StatusInstanceResponse, error) {
+	var out StatusInstanceResponse
+	if err := c.getJSON(ctx, MethodGetStatusInstance, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// Reboot restarts the instance.
+func (c *Client) Reboot(ctx context.Context) (*RebootResponse, error) {
+	var out RebootResponse
+	if err := c.getJSON(ctx, MethodReboot, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// Logout logs the instance out of WhatsApp.
+func (c *Client) Logout(ctx context.Context) (*LogoutResponse, error) {
+	var out LogoutResponse
+	if err := c.getJSON(ctx, MethodLogout, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// QR returns authorization qr code.
+func (c *Client) QR(ctx context.Context) (*QRResponse, error) {
+	var out QRResponse
+	if err := c.getJSON(ctx, MethodQR, nil, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// GetAuthorizationCode returns a code to authorize the instance by phone number instead of qr.
+func (c *Client) GetAuthorizationCode(ctx context.Context, in *AuthorizationCodeRequest) (*AuthorizationCodeResponse, error) {
+	if in == nil || in.PhoneNumber <= 0 {
+		return nil, NewError(errPhoneNumber)
+	}
+
+	var out AuthorizationCodeResponse
+	if err := c.postJSON(ctx, MethodGetAuthorizationCode, in, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
@@ -0,0 +1,140 @@
+package httpclient_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+func TestClient_AccountMethods(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		call       func(c *httpclient.Client) (any, error)
+		want       any
+		name       string
+		response   string
+		httpMethod string
+		apiMethod  string
+		body       string
+	}{
+		{
+			name:       "getSettings",
+			response:   `{"wid":"79876543210@c.us","webhookUrl":"https://example.com","delaySendMessagesMilliseconds":1000}`,
+			httpMethod: http.MethodGet,
+			apiMethod:  httpclient.MethodGetSettings,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.GetSettings(ctx)
+			},
+			want: &httpclient.Settings{
+				Wid:                           "79876543210@c.us",
+				WebhookURL:                    "https://example.com",
+				DelaySendMessagesMilliseconds: 1000,
+			},
+		},
+		{
+			name:       "setSettings",
+			response:   `{"saveSettings":true}`,
+			httpMethod: http.MethodPost,
+			apiMethod:  httpclient.MethodSetSettings,
+			body:       `{"incomingWebhook":"yes"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SetSettings(ctx, &httpclient.Settings{IncomingWebhook: "yes"})
+			},
+			want: &httpclient.SetSettingsResponse{SaveSettings: true},
+		},
+		{
+			name:       "getStateInstance",
+			response:   `{"stateInstance":"authorized"}`,
+			httpMethod: http.MethodGet,
+			apiMethod:  httpclient.MethodGetStateInstance,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.GetStateInstance(ctx)
+			},
+			want: &httpclient.StateInstanceResponse{StateInstance: "authorized"},
+		},
+		{
+			name:       "getStatusInstance",
+			response:   `{"statusInstance":"online"}`,
+			httpMethod: http.MethodGet,
+			apiMethod:  httpclient.MethodGetStatusInstance,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.GetStatusInstance(ctx)
+			},
+			want: &httpclient.StatusInstanceResponse{StatusInstance: "online"},
+		},
+		{
+			name:       "reboot",
+			response:   `{"isReboot":true}`,
+			httpMethod: http.MethodGet,
+			apiMethod:  httpclient.MethodReboot,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.Reboot(ctx)
+			},
+			want: &httpclient.RebootResponse{IsReboot: true},
+		},
+		{
+			name:       "logout",
+			response:   `{"isLogout":true}`,
+			httpMethod: http.MethodGet,
+			apiMethod:  httpclient.MethodLogout,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.Logout(ctx)
+			},
+			want: &httpclient.LogoutResponse{IsLogout: true},
+		},
+		{
+			name:       "qr",
+			response:   `{"type":"qrCode","message":"iVBORw0KGgo="}`,
+			httpMethod: http.MethodGet,
+			apiMethod:  httpclient.MethodQR,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.QR(ctx)
+			},
+			want: &httpclient.QRResponse{Type: "qrCode", Message: "iVBORw0KGgo="},
+		},
+		{
+			name:       "getAuthorizationCode",
+			response:   `{"status":true,"code":"ABCD1234"}`,
+			httpMethod: http.MethodPost,
+			apiMethod:  httpclient.MethodGetAuthorizationCode,
+			body:       `{"phoneNumber":79876543210}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.GetAuthorizationCode(ctx, &httpclient.AuthorizationCodeRequest{PhoneNumber: 79876543210})
+			},
+			want: &httpclient.AuthorizationCodeResponse{Status: true, Code: "ABCD1234"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, call := newAPIServer(t, http.StatusOK, tt.response)
+
+			got, err := tt.call(httpclient.NewClient(testID, testToken, ts.URL, ts.Client()))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.httpMethod, call.method)
+			assert.Equal(t, "/waInstance"+testID+"/"+tt.apiMethod+"/"+testToken, call.path)
+
+			if tt.body != "" {
+				assert.JSONEq(t, tt.body, call.body)
+			}
+		})
+	}
+}
+
+func TestClient_AccountValidation(t *testing.T) {
+	c := httpclient.NewClient(testID, testToken, "http://127.0.0.1:0", nil)
+
+	_, err := c.SetSettings(context.Background(), nil)
+	require.Error(t, err)
+
+	_, err = c.GetAuthorizationCode(context.Background(), &httpclient.AuthorizationCodeRequest{})
+	require.Error(t, err)
+}
@@ -0,0 +1,249 @@
+// Package httpclient is a typed client for GREEN-API.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	// uploadTimeout bounds sendFileByUpload, large files take longer than ordinary calls.
+	uploadTimeout = 10 * time.Minute
+	maxErrorBody  = 1024
+)
+
+// Client calls GREEN-API methods of a single instance.
+type Client struct {
+	httpClient       *http.Client
+	uploadClient     *http.Client
+	limiter          Limiter
+	baseURL          string
+	mediaURL         string
+	idInstance       string
+	apiTokenInstance string
+}
+
+// NewClient creates a client for the instance idInstance. Empty baseURL falls back to APIURL
+// and nil httpClient to a client with a default timeout.
+func NewClient(idInstance, apiTokenInstance, baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = APIURL
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Timeout: defaultTimeout,
+		}
+	}
+
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	uploadClient := *httpClient
+	uploadClient.Timeout = uploadTimeout
+
+	return &Client{
+		httpClient:       httpClient,
+		uploadClient:     &uploadClient,
+		baseURL:          baseURL,
+		mediaURL:         MediaURL(baseURL),
+		idInstance:       idInstance,
+		apiTokenInstance: apiTokenInstance,
+	}
+}
+
+// Limiter throttles sending methods of instances. Allow takes a token of the instance
+// or reports how long to wait for the next one.
+type Limiter interface {
+	Allow(idInstance string) (bool, time.Duration)
+}
+
+// SetLimiter sets the limiter of sending methods. Without it sends are not throttled.
+func (c *Client) SetLimiter(l Limiter) *Client {
+	c.limiter = l
+	return c
+}
+
+// throttle takes a sending token of the instance, it fails with RateLimitError when there is none.
+func (c *Client) throttle() error {
+	if c.limiter == nil {
+		return nil
+	}
+
+	if ok, retryAfter := c.limiter.Allow(c.idInstance); !ok {
+		return &RateLimitError{
+			IDInstance: c.idInstance,
+			RetryAfter: retryAfter,
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) GetIDInstance() string {
+	return c.idInstance
+}
+
+func (c *Client) GetBaseURL() string {
+	return c.baseURL
+}
+
+func (c *Client) GetMediaURL() string {
+	return c.mediaURL
+}
+
+// MediaURL returns the host of file uploads for the api host: {n}.api.green-api.com
+// uploads to {n}.media.green-api.com. Other hosts are returned as is.
+func MediaURL(baseURL string) string {
+	return strings.Replace(baseURL, ".api.green-api.com", ".media.green-api.com", 1)
+}
+
+// endpoint builds {{baseURL}}/waInstance{{idInstance}}/{{method}}/{{apiTokenInstance}}[/extra...].
+func (c *Client) endpoint(method string, extra ...string) string {
+	parts := append([]string{c.baseURL, "waInstance" + c.idInstance, method, c.apiTokenInstance}, extra...)
+	return strings.Join(parts, "/")
+}
+
+// mediaEndpoint builds endpoint of method on the media host.
+func (c *Client) mediaEndpoint(method string) string {
+	return strings.Join([]string{c.mediaURL, "waInstance" + c.idInstance, method, c.apiTokenInstance}, "/")
+}
+
+// getJSON performs GET request and decodes the answer into out.
+func (c *Client) getJSON(ctx context.Context, method string, query url.Values, out any) error {
+	endpoint := c.endpoint(method)
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	return c.do(ctx, http.MethodGet, method, endpoint, nil, "", out)
+}
+
+// postJSON performs POST request with in encoded as json and decodes the answer into out.
+func (c *Client) postJSON(ctx context.Context, method string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return NewError(err)
+	}
+
+	return c.do(ctx, http.MethodPost, method, c.endpoint(method), bytes.NewReader(body), "application/json", out)
+}
+
+// postMultipart streams fields and file as multipart form to endpoint with the upload client.
+// The file is sent while it is read, it is not buffered.
+func (c *Client) postMultipart(ctx context.Context, endpoint, method string, fields [][2]string,
+	fileName string, file io.Reader, out any) error {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeForm(form, fields, fileName, file))
+	}()
+
+	err := c.doWith(ctx, c.uploadClient, http.MethodPost, method, endpoint, pr, form.FormDataContentType(), out)
+	if err != nil {
+		// unblock the writer when the request failed before the body was read
+		pr.CloseWithError(err)
+	}
+
+	return err
+}
+
+func writeForm(form *multipart.Writer, fields [][2]string, fileName string, file io.Reader) error {
+	for _, f := range fields {
+		if f[1] == "" {
+			continue
+		}
+
+		if err := form.WriteField(f[0], f[1]); err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(part, file); err != nil {
+		return err
+	}
+
+	return form.Close()
+}
+
+func (c *Client) do(ctx context.Context, httpMethod, method, endpoint string, body io.Reader, contentType string, out any) error {
+	return c.doWith(ctx, c.httpClient, httpMethod, method, endpoint, body, contentType, out)
+}
+
+func (c *Client) doWith(ctx context.Context, client *http.Client, httpMethod, method, endpoint string, body io.Reader,
+	contentType string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, httpMethod, endpoint, body)
+	if err != nil {
+		return NewError(redact(err))
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return NewError(redact(err))
+	}
+
+	defer func() {
+		if e := resp.Body.Close(); e != nil {
+			return
+		}
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+		return &APIError{
+			Method:     method,
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(data)),
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return NewError(err)
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return ErrEmptyResponse
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return NewError(fmt.Errorf("%s: %w", method, err))
+	}
+
+	return nil
+}
+
+// redact strips request url from transport errors, it contains apiTokenInstance.
+func redact(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+	}
+
+	return err
+}
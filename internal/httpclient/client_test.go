@@ -0,0 +1,129 @@
+package httpclient_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+const (
+	testID    = "1101000001"
+	testToken = "d75b3a66374942c5b3c019c698abc2067e151558acbd412345"
+)
+
+type apiCall struct {
+	method string
+	path   string
+	query  string
+	body   string
+}
+
+// newAPIServer returns a fake GREEN-API that records the last call and answers with status and response.
+func newAPIServer(t *testing.T, status int, response string) (*httptest.Server, *apiCall) {
+	t.Helper()
+
+	call := &apiCall{}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		call.method = r.Method
+		call.path = r.URL.Path
+		call.query = r.URL.RawQuery
+		call.body = string(body)
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(status)
+
+		_, err = io.WriteString(rw, response)
+		require.NoError(t, err)
+	}))
+
+	t.Cleanup(ts.Close)
+
+	return ts, call
+}
+
+func TestNewClient(t *testing.T) {
+	c := httpclient.NewClient(testID, testToken, "", nil)
+	assert.Equal(t, httpclient.APIURL, c.GetBaseURL())
+	assert.Equal(t, testID, c.GetIDInstance())
+
+	c = httpclient.NewClient(testID, testToken, "http://localhost/", http.DefaultClient)
+	assert.Equal(t, "http://localhost", c.GetBaseURL())
+}
+
+func TestClient_APIError(t *testing.T) {
+	ts, _ := newAPIServer(t, http.StatusUnauthorized, `{"message":"unauthorized"}`)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	_, err := c.GetStateInstance(context.Background())
+	require.Error(t, err)
+
+	var apiErr *httpclient.APIError
+
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, httpclient.MethodGetStateInstance, apiErr.Method)
+	assert.Equal(t, `{"message":"unauthorized"}`, apiErr.Body)
+}
+
+func TestClient_EmptyResponse(t *testing.T) {
+	ts, _ := newAPIServer(t, http.StatusOK, "null")
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	_, err := c.GetSettings(context.Background())
+	require.ErrorIs(t, err, httpclient.ErrEmptyResponse)
+}
+
+func TestClient_InvalidJSON(t *testing.T) {
+	ts, _ := newAPIServer(t, http.StatusOK, "{")
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	_, err := c.GetSettings(context.Background())
+	require.Error(t, err)
+
+	var clientErr *httpclient.Error
+
+	require.True(t, errors.As(err, &clientErr))
+}
+
+func TestClient_TransportErrorHidesToken(t *testing.T) {
+	ts, _ := newAPIServer(t, http.StatusOK, "{}")
+	ts.Close()
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	_, err := c.GetSettings(context.Background())
+	require.Error(t, err)
+	assert.False(t, strings.Contains(err.Error(), testToken), err.Error())
+}
+
+func TestError(t *testing.T) {
+	require.NoError(t, httpclient.NewError(nil))
+
+	err := httpclient.NewError(errors.New("some error"))
+	assert.Equal(t, "[httpclient]: some error", err.Error())
+	assert.Equal(t, "some error", errors.Unwrap(err).Error())
+}
+
+func TestClient_ValidationError(t *testing.T) {
+	c := httpclient.NewClient(testID, testToken, "http://127.0.0.1:0", nil)
+
+	_, err := c.SendMessage(context.Background(), &httpclient.SendMessageRequest{Message: "hi"})
+	require.ErrorIs(t, err, httpclient.ErrInvalidRequest)
+	assert.Equal(t, "[httpclient]: invalid request: chatId is required", err.Error())
+}
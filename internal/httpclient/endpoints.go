@@ -3,3 +3,54 @@ package httpclient
 const (
 	APIURL = "https://1103.api.green-api.com"
 )
+
+// GREEN-API account methods.
+const (
+	MethodGetSettings          = "getSettings"
+	MethodSetSettings          = "setSettings"
+	MethodGetStateInstance     = "getStateInstance"
+	MethodGetStatusInstance    = "getStatusInstance"
+	MethodReboot               = "reboot"
+	MethodLogout               = "logout"
+	MethodQR                   = "qr"
+	MethodGetAuthorizationCode = "getAuthorizationCode"
+)
+
+// GREEN-API sending methods.
+const (
+	MethodSendMessage            = "sendMessage"
+	MethodSendFileByURL          = "sendFileByUrl"
+	MethodSendFileByUpload       = "sendFileByUpload"
+	MethodSendPoll               = "sendPoll"
+	MethodSendLocation           = "sendLocation"
+	MethodSendContact            = "sendContact"
+	MethodForwardMessages        = "forwardMessages"
+	MethodSendInteractiveButtons = "sendInteractiveButtons"
+)
+
+// GREEN-API receiving methods.
+const (
+	MethodReceiveNotification = "receiveNotification"
+	MethodDeleteNotification  = "deleteNotification"
+)
+
+// GREEN-API journal methods.
+const (
+	MethodGetChatHistory       = "getChatHistory"
+	MethodGetMessage           = "getMessage"
+	MethodLastIncomingMessages = "lastIncomingMessages"
+	MethodLastOutgoingMessages = "lastOutgoingMessages"
+)
+
+// GREEN-API group methods.
+const (
+	MethodCreateGroup            = "createGroup"
+	MethodUpdateGroupName        = "updateGroupName"
+	MethodGetGroupData           = "getGroupData"
+	MethodAddGroupParticipant    = "addGroupParticipant"
+	MethodRemoveGroupParticipant = "removeGroupParticipant"
+	MethodSetGroupAdmin          = "setGroupAdmin"
+	MethodRemoveAdmin            = "removeAdmin"
+	MethodSetGroupPicture        = "setGroupPicture"
+	MethodLeaveGroup             = "leaveGroup"
+)
@@ -0,0 +1,75 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrEmptyResponse = &Error{
+	err: errors.New("empty response"),
+}
+
+// ErrInvalidRequest is wrapped by every request validation error.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// ErrRateLimited is wrapped by RateLimitError.
+var ErrRateLimited = errors.New("rate limited")
+
+var (
+	errEmptyRequest = invalid("empty request")
+	errPhoneNumber  = invalid("phoneNumber is required")
+)
+
+func invalid(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRequest, reason)
+}
+
+// Error - custom http client error.
+type Error struct {
+	err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("[httpclient]: %v", e.err)
+}
+
+func NewError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{
+		err: err,
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// APIError is returned when GREEN-API answers with a non 2xx status code.
+type APIError struct {
+	Method     string
+	Body       string
+	StatusCode int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("[httpclient]: %s: unexpected status %d: %s", e.Method, e.StatusCode, e.Body)
+}
+
+// RateLimitError is returned by sending methods when the instance is out of sending tokens.
+// The request is not sent, it can be repeated after RetryAfter.
+type RateLimitError struct {
+	IDInstance string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("[httpclient]: instance %s is %v, retry after %s", e.IDInstance, ErrRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
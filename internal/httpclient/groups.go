@@ -0,0 +1,280 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/ole-larsen/green-api/internal/chatid"
+)
+
+// Chat id suffixes of personal and group chats.
+const (
+	PersonalChatSuffix = chatid.PersonalSuffix
+	GroupChatSuffix    = chatid.GroupSuffix
+)
+
+var (
+	errGroupID       = invalid("groupId must end with @g.us")
+	errGroupName     = invalid("groupName is required")
+	errParticipant   = invalid("participantChatId must end with @c.us")
+	errGroupChatIDs  = invalid("chatIds are required")
+	errGroupChatID   = invalid("chatIds must end with @c.us")
+	errGroupPicture  = invalid("file is required")
+	errGroupNameSize = invalid("groupName is longer than 100 characters")
+)
+
+// maxGroupName is WhatsApp limit of group subject.
+const maxGroupName = 100
+
+// IsGroupChatID reports whether chatID is a group chat id.
+func IsGroupChatID(chatID string) bool {
+	return len(chatID) > len(GroupChatSuffix) && strings.HasSuffix(chatID, GroupChatSuffix)
+}
+
+// IsPersonalChatID reports whether chatID is a personal chat id.
+func IsPersonalChatID(chatID string) bool {
+	return len(chatID) > len(PersonalChatSuffix) && strings.HasSuffix(chatID, PersonalChatSuffix)
+}
+
+type CreateGroupRequest struct {
+	GroupName string   `json:"groupName"`
+	ChatIDs   []string `json:"chatIds"`
+}
+
+type CreateGroupResponse struct {
+	ChatID          string `json:"chatId"`
+	GroupInviteLink string `json:"groupInviteLink"`
+	Created         bool   `json:"created"`
+}
+
+type UpdateGroupNameRequest struct {
+	GroupID   string `json:"groupId"`
+	GroupName string `json:"groupName"`
+}
+
+type UpdateGroupNameResponse struct {
+	UpdateGroupName bool `json:"updateGroupName"`
+}
+
+// GroupRequest identifies a group, it is the request of getGroupData and leaveGroup.
+type GroupRequest struct {
+	GroupID string `json:"groupId"`
+}
+
+type GroupParticipant struct {
+	ID           string `json:"id"`
+	IsAdmin      bool   `json:"isAdmin"`
+	IsSuperAdmin bool   `json:"isSuperAdmin"`
+}
+
+type GroupData struct {
+	GroupID         string             `json:"groupId"`
+	Owner           string             `json:"owner"`
+	Subject         string             `json:"subject"`
+	SubjectOwner    string             `json:"subjectOwner,omitempty"`
+	GroupInviteLink string             `json:"groupInviteLink,omitempty"`
+	Participants    []GroupParticipant `json:"participants"`
+	Creation        int64              `json:"creation"`
+	SubjectTime     int64              `json:"subjectTime,omitempty"`
+}
+
+// GroupParticipantRequest is the request of participant and admin methods.
+type GroupParticipantRequest struct {
+	GroupID           string `json:"groupId"`
+	ParticipantChatID string `json:"participantChatId"`
+}
+
+type AddGroupParticipantResponse struct {
+	AddParticipant bool `json:"addParticipant"`
+}
+
+type RemoveGroupParticipantResponse struct {
+	RemoveParticipant bool `json:"removeParticipant"`
+}
+
+type SetGroupAdminResponse struct {
+	SetGroupAdmin bool `json:"setGroupAdmin"`
+}
+
+type RemoveAdminResponse struct {
+	RemoveAdmin bool `json:"removeAdmin"`
+}
+
+// SetGroupPictureRequest - File is a jpeg image streamed as multipart form.
+type SetGroupPictureRequest struct {
+	File    io.Reader `json:"-"`
+	GroupID string    `json:"groupId"`
+}
+
+type SetGroupPictureResponse struct {
+	URLAvatar       string `json:"urlAvatar"`
+	Reason          string `json:"reason,omitempty"`
+	SetGroupPicture bool   `json:"setGroupPicture"`
+}
+
+type LeaveGroupResponse struct {
+	LeaveGroup  bool `json:"leaveGroup"`
+	RemoveAdmin bool `json:"removeAdmin"`
+}
+
+func (r *CreateGroupRequest) Validate() error {
+	if err := validateGroupName(r.GroupName); err != nil {
+		return err
+	}
+
+	if len(r.ChatIDs) == 0 {
+		return NewError(errGroupChatIDs)
+	}
+
+	for _, id := range r.ChatIDs {
+		if !IsPersonalChatID(id) {
+			return NewError(errGroupChatID)
+		}
+	}
+
+	return nil
+}
+
+func (r *UpdateGroupNameRequest) Validate() error {
+	if !IsGroupChatID(r.GroupID) {
+		return NewError(errGroupID)
+	}
+
+	return validateGroupName(r.GroupName)
+}
+
+func (r *GroupRequest) Validate() error {
+	if !IsGroupChatID(r.GroupID) {
+		return NewError(errGroupID)
+	}
+
+	return nil
+}
+
+func (r *GroupParticipantRequest) Validate() error {
+	if !IsGroupChatID(r.GroupID) {
+		return NewError(errGroupID)
+	}
+
+	if !IsPersonalChatID(r.ParticipantChatID) {
+		return NewError(errParticipant)
+	}
+
+	return nil
+}
+
+func (r *SetGroupPictureRequest) Validate() error {
+	if !IsGroupChatID(r.GroupID) {
+		return NewError(errGroupID)
+	}
+
+	if r.File == nil {
+		return NewError(errGroupPicture)
+	}
+
+	return nil
+}
+
+func validateGroupName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return NewError(errGroupName)
+	}
+
+	if len([]rune(name)) > maxGroupName {
+		return NewError(errGroupNameSize)
+	}
+
+	return nil
+}
+
+// CreateGroup creates a group with the participants.
+func (c *Client) CreateGroup(ctx context.Context, in *CreateGroupRequest) (*CreateGroupResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[CreateGroupResponse](ctx, c, MethodCreateGroup, in)
+}
+
+// UpdateGroupName renames the group.
+func (c *Client) UpdateGroupName(ctx context.Context, in *UpdateGroupNameRequest) (*UpdateGroupNameResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[UpdateGroupNameResponse](ctx, c, MethodUpdateGroupName, in)
+}
+
+// GetGroupData returns the group with participants.
+func (c *Client) GetGroupData(ctx context.Context, in *GroupRequest) (*GroupData, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[GroupData](ctx, c, MethodGetGroupData, in)
+}
+
+// AddGroupParticipant adds the participant to the group.
+func (c *Client) AddGroupParticipant(ctx context.Context, in *GroupParticipantRequest) (*AddGroupParticipantResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[AddGroupParticipantResponse](ctx, c, MethodAddGroupParticipant, in)
+}
+
+// RemoveGroupParticipant removes the participant from the group.
+func (c *Client) RemoveGroupParticipant(ctx context.Context, in *GroupParticipantRequest) (*RemoveGroupParticipantResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[RemoveGroupParticipantResponse](ctx, c, MethodRemoveGroupParticipant, in)
+}
+
+// SetGroupAdmin makes the participant an admin of the group.
+func (c *Client) SetGroupAdmin(ctx context.Context, in *GroupParticipantRequest) (*SetGroupAdminResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[SetGroupAdminResponse](ctx, c, MethodSetGroupAdmin, in)
+}
+
+// RemoveAdmin revokes admin rights of the participant.
+func (c *Client) RemoveAdmin(ctx context.Context, in *GroupParticipantRequest) (*RemoveAdminResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[RemoveAdminResponse](ctx, c, MethodRemoveAdmin, in)
+}
+
+// LeaveGroup makes the instance leave the group.
+func (c *Client) LeaveGroup(ctx context.Context, in *GroupRequest) (*LeaveGroupResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[LeaveGroupResponse](ctx, c, MethodLeaveGroup, in)
+}
+
+// SetGroupPicture uploads a jpeg picture of the group.
+func (c *Client) SetGroupPicture(ctx context.Context, in *SetGroupPictureRequest) (*SetGroupPictureResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	var out SetGroupPictureResponse
+	if err := c.postMultipart(ctx, c.endpoint(MethodSetGroupPicture), MethodSetGroupPicture,
+		[][2]string{{"groupId", in.GroupID}}, "group.jpg", in.File, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
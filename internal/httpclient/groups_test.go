@@ -0,0 +1,297 @@
+package httpclient_test
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+const testGroupID = "120363043968066561@g.us"
+
+func TestClient_GroupMethods(t *testing.T) {
+	ctx := context.Background()
+	participant := &httpclient.GroupParticipantRequest{GroupID: testGroupID, ParticipantChatID: testChatID}
+
+	tests := []struct {
+		call      func(c *httpclient.Client) (any, error)
+		want      any
+		name      string
+		response  string
+		apiMethod string
+		body      string
+	}{
+		{
+			name:      "createGroup",
+			response:  `{"created":true,"chatId":"120363043968066561@g.us","groupInviteLink":"https://chat.whatsapp.com/x"}`,
+			apiMethod: httpclient.MethodCreateGroup,
+			body:      `{"groupName":"Team","chatIds":["79876543210@c.us"]}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.CreateGroup(ctx, &httpclient.CreateGroupRequest{GroupName: "Team", ChatIDs: []string{testChatID}})
+			},
+			want: &httpclient.CreateGroupResponse{Created: true, ChatID: testGroupID, GroupInviteLink: "https://chat.whatsapp.com/x"},
+		},
+		{
+			name:      "updateGroupName",
+			response:  `{"updateGroupName":true}`,
+			apiMethod: httpclient.MethodUpdateGroupName,
+			body:      `{"groupId":"120363043968066561@g.us","groupName":"Team 2"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.UpdateGroupName(ctx, &httpclient.UpdateGroupNameRequest{GroupID: testGroupID, GroupName: "Team 2"})
+			},
+			want: &httpclient.UpdateGroupNameResponse{UpdateGroupName: true},
+		},
+		{
+			name: "getGroupData",
+			response: `{"groupId":"120363043968066561@g.us","owner":"79001234568@c.us","subject":"Team","creation":1671616452,
+				"participants":[{"id":"79001234568@c.us","isAdmin":true,"isSuperAdmin":true},{"id":"79876543210@c.us"}]}`,
+			apiMethod: httpclient.MethodGetGroupData,
+			body:      `{"groupId":"120363043968066561@g.us"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.GetGroupData(ctx, &httpclient.GroupRequest{GroupID: testGroupID})
+			},
+			want: &httpclient.GroupData{
+				GroupID:  testGroupID,
+				Owner:    "79001234568@c.us",
+				Subject:  "Team",
+				Creation: 1671616452,
+				Participants: []httpclient.GroupParticipant{
+					{ID: "79001234568@c.us", IsAdmin: true, IsSuperAdmin: true},
+					{ID: testChatID},
+				},
+			},
+		},
+		{
+			name:      "addGroupParticipant",
+			response:  `{"addParticipant":true}`,
+			apiMethod: httpclient.MethodAddGroupParticipant,
+			body:      `{"groupId":"120363043968066561@g.us","participantChatId":"79876543210@c.us"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.AddGroupParticipant(ctx, participant)
+			},
+			want: &httpclient.AddGroupParticipantResponse{AddParticipant: true},
+		},
+		{
+			name:      "removeGroupParticipant",
+			response:  `{"removeParticipant":true}`,
+			apiMethod: httpclient.MethodRemoveGroupParticipant,
+			body:      `{"groupId":"120363043968066561@g.us","participantChatId":"79876543210@c.us"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.RemoveGroupParticipant(ctx, participant)
+			},
+			want: &httpclient.RemoveGroupParticipantResponse{RemoveParticipant: true},
+		},
+		{
+			name:      "setGroupAdmin",
+			response:  `{"setGroupAdmin":true}`,
+			apiMethod: httpclient.MethodSetGroupAdmin,
+			body:      `{"groupId":"120363043968066561@g.us","participantChatId":"79876543210@c.us"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SetGroupAdmin(ctx, participant)
+			},
+			want: &httpclient.SetGroupAdminResponse{SetGroupAdmin: true},
+		},
+		{
+			name:      "removeAdmin",
+			response:  `{"removeAdmin":true}`,
+			apiMethod: httpclient.MethodRemoveAdmin,
+			body:      `{"groupId":"120363043968066561@g.us","participantChatId":"79876543210@c.us"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.RemoveAdmin(ctx, participant)
+			},
+			want: &httpclient.RemoveAdminResponse{RemoveAdmin: true},
+		},
+		{
+			name:      "leaveGroup",
+			response:  `{"leaveGroup":true,"removeAdmin":false}`,
+			apiMethod: httpclient.MethodLeaveGroup,
+			body:      `{"groupId":"120363043968066561@g.us"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.LeaveGroup(ctx, &httpclient.GroupRequest{GroupID: testGroupID})
+			},
+			want: &httpclient.LeaveGroupResponse{LeaveGroup: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, call := newAPIServer(t, http.StatusOK, tt.response)
+
+			got, err := tt.call(httpclient.NewClient(testID, testToken, ts.URL, ts.Client()))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, http.MethodPost, call.method)
+			assert.Equal(t, "/waInstance"+testID+"/"+tt.apiMethod+"/"+testToken, call.path)
+			assert.JSONEq(t, tt.body, call.body)
+		})
+	}
+}
+
+func TestClient_GroupValidation(t *testing.T) {
+	ctx := context.Background()
+	c := httpclient.NewClient(testID, testToken, "http://127.0.0.1:0", nil)
+
+	tests := []struct {
+		call func() error
+		name string
+		want string
+	}{
+		{
+			name: "create without name",
+			want: "groupName is required",
+			call: func() error {
+				_, err := c.CreateGroup(ctx, &httpclient.CreateGroupRequest{GroupName: " ", ChatIDs: []string{testChatID}})
+				return err
+			},
+		},
+		{
+			name: "create with long name",
+			want: "groupName is longer than 100 characters",
+			call: func() error {
+				_, err := c.CreateGroup(ctx, &httpclient.CreateGroupRequest{GroupName: strings.Repeat("a", 101), ChatIDs: []string{testChatID}})
+				return err
+			},
+		},
+		{
+			name: "create without participants",
+			want: "chatIds are required",
+			call: func() error {
+				_, err := c.CreateGroup(ctx, &httpclient.CreateGroupRequest{GroupName: "Team"})
+				return err
+			},
+		},
+		{
+			name: "create with group participant",
+			want: "chatIds must end with @c.us",
+			call: func() error {
+				_, err := c.CreateGroup(ctx, &httpclient.CreateGroupRequest{GroupName: "Team", ChatIDs: []string{testGroupID}})
+				return err
+			},
+		},
+		{
+			name: "personal chat as group",
+			want: "groupId must end with @g.us",
+			call: func() error {
+				_, err := c.GetGroupData(ctx, &httpclient.GroupRequest{GroupID: testChatID})
+				return err
+			},
+		},
+		{
+			name: "bare suffix",
+			want: "groupId must end with @g.us",
+			call: func() error {
+				_, err := c.LeaveGroup(ctx, &httpclient.GroupRequest{GroupID: "@g.us"})
+				return err
+			},
+		},
+		{
+			name: "rename without name",
+			want: "groupName is required",
+			call: func() error {
+				_, err := c.UpdateGroupName(ctx, &httpclient.UpdateGroupNameRequest{GroupID: testGroupID})
+				return err
+			},
+		},
+		{
+			name: "group as participant",
+			want: "participantChatId must end with @c.us",
+			call: func() error {
+				_, err := c.SetGroupAdmin(ctx, &httpclient.GroupParticipantRequest{GroupID: testGroupID, ParticipantChatID: testGroupID})
+				return err
+			},
+		},
+		{
+			name: "picture without file",
+			want: "file is required",
+			call: func() error {
+				_, err := c.SetGroupPicture(ctx, &httpclient.SetGroupPictureRequest{GroupID: testGroupID})
+				return err
+			},
+		},
+		{
+			name: "nil request",
+			want: "empty request",
+			call: func() error {
+				_, err := c.RemoveAdmin(ctx, nil)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			require.ErrorIs(t, err, httpclient.ErrInvalidRequest)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestClient_SetGroupPicture(t *testing.T) {
+	var path, groupID, file string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+
+		mr := multipart.NewReader(r.Body, params["boundary"])
+
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(part)
+			require.NoError(t, err)
+
+			if part.FormName() == "file" {
+				file = string(data)
+				continue
+			}
+
+			groupID = string(data)
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_, err = io.WriteString(rw, `{"urlAvatar":"https://pps.whatsapp.net/a.jpg","setGroupPicture":true}`)
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	out, err := c.SetGroupPicture(context.Background(), &httpclient.SetGroupPictureRequest{
+		GroupID: testGroupID,
+		File:    strings.NewReader("jpeg"),
+	})
+	require.NoError(t, err)
+
+	assert.True(t, out.SetGroupPicture)
+	assert.Equal(t, "https://pps.whatsapp.net/a.jpg", out.URLAvatar)
+	assert.Equal(t, "/waInstance"+testID+"/"+httpclient.MethodSetGroupPicture+"/"+testToken, path)
+	assert.Equal(t, testGroupID, groupID)
+	assert.Equal(t, "jpeg", file)
+}
+
+func TestIsGroupChatID(t *testing.T) {
+	assert.True(t, httpclient.IsGroupChatID(testGroupID))
+	assert.False(t, httpclient.IsGroupChatID(testChatID))
+	assert.False(t, httpclient.IsGroupChatID("@g.us"))
+	assert.True(t, httpclient.IsPersonalChatID(testChatID))
+	assert.False(t, httpclient.IsPersonalChatID(testGroupID))
+}
@@ -0,0 +1,230 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Message directions of journal messages.
+const (
+	MessageIncoming = "incoming"
+	MessageOutgoing = "outgoing"
+)
+
+// Message types, typeMessage field of journal messages.
+const (
+	TypeTextMessage         = "textMessage"
+	TypeExtendedTextMessage = "extendedTextMessage"
+	TypeImageMessage        = "imageMessage"
+	TypeVideoMessage        = "videoMessage"
+	TypeDocumentMessage     = "documentMessage"
+	TypeAudioMessage        = "audioMessage"
+	TypeLocationMessage     = "locationMessage"
+	TypeContactMessage      = "contactMessage"
+	TypePollMessage         = "pollMessage"
+	TypeReactionMessage     = "reactionMessage"
+	TypeQuotedMessage       = "quotedMessage"
+)
+
+// DefaultJournalMinutes is the period of lastIncomingMessages and lastOutgoingMessages by default, a day.
+const DefaultJournalMinutes = 1440
+
+var (
+	errCount     = invalid("count must be positive")
+	errIDMessage = invalid("idMessage is required")
+	errMinutes   = invalid("minutes must be positive")
+)
+
+type ExtendedTextMessage struct {
+	Text        string `json:"text"`
+	Description string `json:"description,omitempty"`
+	Title       string `json:"title,omitempty"`
+	PreviewType string `json:"previewType,omitempty"`
+	StanzaID    string `json:"stanzaId,omitempty"`
+}
+
+type Location struct {
+	NameLocation string  `json:"nameLocation,omitempty"`
+	Address      string  `json:"address,omitempty"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+}
+
+type ContactCard struct {
+	DisplayName string `json:"displayName"`
+	VCard       string `json:"vcard"`
+}
+
+type PollVote struct {
+	OptionName   string   `json:"optionName"`
+	OptionVoters []string `json:"optionVoters,omitempty"`
+}
+
+type Poll struct {
+	Name            string       `json:"name"`
+	Options         []PollOption `json:"options"`
+	Votes           []PollVote   `json:"votes,omitempty"`
+	MultipleAnswers bool         `json:"multipleAnswers"`
+}
+
+// QuotedMessage is a message the reply or reaction refers to.
+type QuotedMessage struct {
+	StanzaID    string `json:"stanzaId"`
+	Participant string `json:"participant,omitempty"`
+	TypeMessage string `json:"typeMessage,omitempty"`
+	TextMessage string `json:"textMessage,omitempty"`
+}
+
+// Message is a journal message. The content field filled depends on TypeMessage:
+// TextMessage for text and reactions, ExtendedTextMessage for links, DownloadURL and Caption for files,
+// Location, Contact and PollMessageData for the matching types.
+type Message struct {
+	ExtendedTextMessage *ExtendedTextMessage `json:"extendedTextMessage,omitempty"`
+	Location            *Location            `json:"location,omitempty"`
+	Contact             *ContactCard         `json:"contact,omitempty"`
+	PollMessageData     *Poll                `json:"pollMessageData,omitempty"`
+	QuotedMessage       *QuotedMessage       `json:"quotedMessage,omitempty"`
+	Type                string               `json:"type"`
+	IDMessage           string               `json:"idMessage"`
+	TypeMessage         string               `json:"typeMessage"`
+	ChatID              string               `json:"chatId"`
+	SenderID            string               `json:"senderId,omitempty"`
+	SenderName          string               `json:"senderName,omitempty"`
+	SenderContactName   string               `json:"senderContactName,omitempty"`
+	TextMessage         string               `json:"textMessage,omitempty"`
+	DownloadURL         string               `json:"downloadUrl,omitempty"`
+	Caption             string               `json:"caption,omitempty"`
+	FileName            string               `json:"fileName,omitempty"`
+	MimeType            string               `json:"mimeType,omitempty"`
+	StatusMessage       string               `json:"statusMessage,omitempty"`
+	Timestamp           int64                `json:"timestamp"`
+	SendByAPI           bool                 `json:"sendByApi,omitempty"`
+	IsForwarded         bool                 `json:"isForwarded,omitempty"`
+}
+
+// Text returns a human readable content of the message.
+func (m *Message) Text() string {
+	switch m.TypeMessage {
+	case TypeTextMessage, TypeReactionMessage:
+		return m.TextMessage
+	case TypeExtendedTextMessage, TypeQuotedMessage:
+		if m.ExtendedTextMessage != nil {
+			return m.ExtendedTextMessage.Text
+		}
+
+		return m.TextMessage
+	case TypeImageMessage, TypeVideoMessage, TypeDocumentMessage, TypeAudioMessage:
+		if m.Caption != "" {
+			return m.Caption
+		}
+
+		return m.FileName
+	case TypeLocationMessage:
+		if m.Location == nil {
+			return ""
+		}
+
+		return fmt.Sprintf("%g,%g %s", m.Location.Latitude, m.Location.Longitude, m.Location.NameLocation)
+	case TypeContactMessage:
+		if m.Contact == nil {
+			return ""
+		}
+
+		return m.Contact.DisplayName
+	case TypePollMessage:
+		if m.PollMessageData == nil {
+			return ""
+		}
+
+		return m.PollMessageData.Name
+	default:
+		return m.TextMessage
+	}
+}
+
+type GetChatHistoryRequest struct {
+	ChatID string `json:"chatId"`
+	// Count is how many last messages to return, GREEN-API returns 100 when it is 0.
+	Count int `json:"count,omitempty"`
+}
+
+type GetMessageRequest struct {
+	ChatID    string `json:"chatId"`
+	IDMessage string `json:"idMessage"`
+}
+
+func (r *GetChatHistoryRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if r.Count < 0 {
+		return NewError(errCount)
+	}
+
+	return nil
+}
+
+func (r *GetMessageRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if r.IDMessage == "" {
+		return NewError(errIDMessage)
+	}
+
+	return nil
+}
+
+// GetChatHistory returns last messages of the chat, newest first.
+func (c *Client) GetChatHistory(ctx context.Context, in *GetChatHistoryRequest) ([]Message, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	out, err := call[[]Message](ctx, c, MethodGetChatHistory, in)
+	if err != nil {
+		return nil, err
+	}
+
+	return *out, nil
+}
+
+// GetMessage returns a message of the chat by id.
+func (c *Client) GetMessage(ctx context.Context, in *GetMessageRequest) (*Message, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return call[Message](ctx, c, MethodGetMessage, in)
+}
+
+// LastIncomingMessages returns messages received within minutes, DefaultJournalMinutes when it is 0.
+func (c *Client) LastIncomingMessages(ctx context.Context, minutes int) ([]Message, error) {
+	return c.journal(ctx, MethodLastIncomingMessages, minutes)
+}
+
+// LastOutgoingMessages returns messages sent within minutes, DefaultJournalMinutes when it is 0.
+func (c *Client) LastOutgoingMessages(ctx context.Context, minutes int) ([]Message, error) {
+	return c.journal(ctx, MethodLastOutgoingMessages, minutes)
+}
+
+func (c *Client) journal(ctx context.Context, method string, minutes int) ([]Message, error) {
+	if minutes < 0 {
+		return nil, NewError(errMinutes)
+	}
+
+	if minutes == 0 {
+		minutes = DefaultJournalMinutes
+	}
+
+	out := make([]Message, 0)
+	if err := c.getJSON(ctx, method, url.Values{"minutes": {strconv.Itoa(minutes)}}, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
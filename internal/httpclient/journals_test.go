@@ -0,0 +1,107 @@
+package httpclient_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+const chatHistory = `[
+	{"type":"outgoing","idMessage":"A1","timestamp":1617694686,"typeMessage":"textMessage",
+		"chatId":"79876543210@c.us","textMessage":"hello","statusMessage":"read","sendByApi":true},
+	{"type":"incoming","idMessage":"A2","timestamp":1617694687,"typeMessage":"extendedTextMessage",
+		"chatId":"79876543210@c.us","senderId":"79876543210@c.us","senderName":"Ivan",
+		"extendedTextMessage":{"text":"https://green-api.com","title":"GREEN-API"}},
+	{"type":"incoming","idMessage":"A3","timestamp":1617694688,"typeMessage":"imageMessage",
+		"chatId":"79876543210@c.us","downloadUrl":"https://example.com/a.jpg","caption":"photo","mimeType":"image/jpeg"},
+	{"type":"incoming","idMessage":"A4","timestamp":1617694689,"typeMessage":"documentMessage",
+		"chatId":"79876543210@c.us","downloadUrl":"https://example.com/a.pdf","fileName":"a.pdf"},
+	{"type":"incoming","idMessage":"A5","timestamp":1617694690,"typeMessage":"locationMessage",
+		"chatId":"79876543210@c.us","location":{"nameLocation":"Office","latitude":55.75,"longitude":37.61}},
+	{"type":"incoming","idMessage":"A6","timestamp":1617694691,"typeMessage":"contactMessage",
+		"chatId":"79876543210@c.us","contact":{"displayName":"Ivan","vcard":"BEGIN:VCARD"}},
+	{"type":"outgoing","idMessage":"A7","timestamp":1617694692,"typeMessage":"pollMessage",
+		"chatId":"79876543210@c.us","pollMessageData":{"name":"Color?","options":[{"optionName":"red"}],"multipleAnswers":false}},
+	{"type":"incoming","idMessage":"A8","timestamp":1617694693,"typeMessage":"reactionMessage",
+		"chatId":"79876543210@c.us","textMessage":"👍","quotedMessage":{"stanzaId":"A1"}}
+]`
+
+func TestClient_GetChatHistory(t *testing.T) {
+	ts, call := newAPIServer(t, http.StatusOK, chatHistory)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	messages, err := c.GetChatHistory(context.Background(), &httpclient.GetChatHistoryRequest{ChatID: testChatID, Count: 10})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, call.method)
+	assert.Equal(t, "/waInstance"+testID+"/"+httpclient.MethodGetChatHistory+"/"+testToken, call.path)
+	assert.JSONEq(t, `{"chatId":"79876543210@c.us","count":10}`, call.body)
+
+	want := []struct {
+		typeMessage string
+		text        string
+	}{
+		{httpclient.TypeTextMessage, "hello"},
+		{httpclient.TypeExtendedTextMessage, "https://green-api.com"},
+		{httpclient.TypeImageMessage, "photo"},
+		{httpclient.TypeDocumentMessage, "a.pdf"},
+		{httpclient.TypeLocationMessage, "55.75,37.61 Office"},
+		{httpclient.TypeContactMessage, "Ivan"},
+		{httpclient.TypePollMessage, "Color?"},
+		{httpclient.TypeReactionMessage, "👍"},
+	}
+
+	require.Len(t, messages, len(want))
+
+	for i, w := range want {
+		assert.Equal(t, w.typeMessage, messages[i].TypeMessage)
+		assert.Equal(t, w.text, messages[i].Text())
+	}
+
+	assert.Equal(t, httpclient.MessageOutgoing, messages[0].Type)
+	assert.Equal(t, "read", messages[0].StatusMessage)
+	assert.Equal(t, "A1", messages[7].QuotedMessage.StanzaID)
+}
+
+func TestClient_GetMessage(t *testing.T) {
+	ts, call := newAPIServer(t, http.StatusOK,
+		`{"type":"outgoing","idMessage":"A1","typeMessage":"textMessage","chatId":"79876543210@c.us","textMessage":"hello"}`)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	m, err := c.GetMessage(context.Background(), &httpclient.GetMessageRequest{ChatID: testChatID, IDMessage: "A1"})
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{"chatId":"79876543210@c.us","idMessage":"A1"}`, call.body)
+	assert.Equal(t, "hello", m.Text())
+
+	_, err = c.GetMessage(context.Background(), &httpclient.GetMessageRequest{ChatID: testChatID})
+	require.ErrorIs(t, err, httpclient.ErrInvalidRequest)
+}
+
+func TestClient_LastMessages(t *testing.T) {
+	ts, call := newAPIServer(t, http.StatusOK, `[]`)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	messages, err := c.LastIncomingMessages(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+	assert.Equal(t, http.MethodGet, call.method)
+	assert.Equal(t, "/waInstance"+testID+"/"+httpclient.MethodLastIncomingMessages+"/"+testToken, call.path)
+	assert.Equal(t, "minutes=1440", call.query)
+
+	_, err = c.LastOutgoingMessages(context.Background(), 60)
+	require.NoError(t, err)
+	assert.Equal(t, "/waInstance"+testID+"/"+httpclient.MethodLastOutgoingMessages+"/"+testToken, call.path)
+	assert.Equal(t, "minutes=60", call.query)
+
+	_, err = c.LastOutgoingMessages(context.Background(), -1)
+	require.ErrorIs(t, err, httpclient.ErrInvalidRequest)
+}
@@ -0,0 +1,176 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Notification types, typeWebhook field of the notification body.
+const (
+	TypeIncomingMessageReceived    = "incomingMessageReceived"
+	TypeOutgoingMessageReceived    = "outgoingMessageReceived"
+	TypeOutgoingAPIMessageReceived = "outgoingAPIMessageReceived"
+	TypeOutgoingMessageStatus      = "outgoingMessageStatus"
+	TypeStateInstanceChanged       = "stateInstanceChanged"
+	TypeStatusInstanceChanged      = "statusInstanceChanged"
+	TypeDeviceInfo                 = "deviceInfo"
+	TypeIncomingCall               = "incomingCall"
+	TypeIncomingBlock              = "incomingBlock"
+	TypeQuotaExceeded              = "quotaExceeded"
+)
+
+// Notification is a receiveNotification answer. ReceiptID is passed to DeleteNotification.
+type Notification struct {
+	Body      *Webhook `json:"body"`
+	ReceiptID int64    `json:"receiptId"`
+}
+
+type InstanceData struct {
+	Wid          string `json:"wid"`
+	TypeInstance string `json:"typeInstance"`
+	IDInstance   int64  `json:"idInstance"`
+}
+
+type SenderData struct {
+	ChatID            string `json:"chatId"`
+	ChatName          string `json:"chatName"`
+	Sender            string `json:"sender"`
+	SenderName        string `json:"senderName"`
+	SenderContactName string `json:"senderContactName,omitempty"`
+}
+
+type TextMessageData struct {
+	TextMessage string `json:"textMessage"`
+}
+
+type ExtendedTextMessageData struct {
+	Text        string `json:"text"`
+	Description string `json:"description,omitempty"`
+	Title       string `json:"title,omitempty"`
+	StanzaID    string `json:"stanzaId,omitempty"`
+}
+
+type FileMessageData struct {
+	DownloadURL string `json:"downloadUrl"`
+	Caption     string `json:"caption,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type LocationMessageData struct {
+	NameLocation string  `json:"nameLocation,omitempty"`
+	Address      string  `json:"address,omitempty"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+}
+
+// MessageData - content of the message, the filled field depends on TypeMessage.
+type MessageData struct {
+	TextMessageData         *TextMessageData         `json:"textMessageData,omitempty"`
+	ExtendedTextMessageData *ExtendedTextMessageData `json:"extendedTextMessageData,omitempty"`
+	FileMessageData         *FileMessageData         `json:"fileMessageData,omitempty"`
+	LocationMessageData     *LocationMessageData     `json:"locationMessageData,omitempty"`
+	TypeMessage             string                   `json:"typeMessage"`
+}
+
+// Text returns text of the text message or caption of the file message.
+func (m *MessageData) Text() string {
+	switch {
+	case m == nil:
+		return ""
+	case m.TextMessageData != nil:
+		return m.TextMessageData.TextMessage
+	case m.ExtendedTextMessageData != nil:
+		return m.ExtendedTextMessageData.Text
+	case m.FileMessageData != nil:
+		return m.FileMessageData.Caption
+	default:
+		return ""
+	}
+}
+
+// Webhook is a notification body. Fields are filled depending on TypeWebhook:
+// SenderData and MessageData for messages, ChatID and Status for outgoingMessageStatus,
+// StateInstance for stateInstanceChanged, StatusInstance for statusInstanceChanged.
+// Raw keeps the body as received.
+type Webhook struct {
+	InstanceData   *InstanceData   `json:"instanceData,omitempty"`
+	SenderData     *SenderData     `json:"senderData,omitempty"`
+	MessageData    *MessageData    `json:"messageData,omitempty"`
+	TypeWebhook    string          `json:"typeWebhook"`
+	IDMessage      string          `json:"idMessage,omitempty"`
+	ChatID         string          `json:"chatId,omitempty"`
+	Status         string          `json:"status,omitempty"`
+	Description    string          `json:"description,omitempty"`
+	StateInstance  string          `json:"stateInstance,omitempty"`
+	StatusInstance string          `json:"statusInstance,omitempty"`
+	Raw            json.RawMessage `json:"-"`
+	Timestamp      int64           `json:"timestamp"`
+	SendByAPI      bool            `json:"sendByApi,omitempty"`
+}
+
+// UnmarshalJSON decodes the body and keeps a copy in Raw.
+func (w *Webhook) UnmarshalJSON(data []byte) error {
+	type webhook Webhook
+
+	var out webhook
+	if err := json.Unmarshal(data, &out); err != nil {
+		return err
+	}
+
+	*w = Webhook(out)
+	w.Raw = append(json.RawMessage(nil), data...)
+
+	return nil
+}
+
+// GetChatID returns chat of the notification: sender chat for messages or chatId for statuses.
+func (w *Webhook) GetChatID() string {
+	if w.SenderData != nil {
+		return w.SenderData.ChatID
+	}
+
+	return w.ChatID
+}
+
+type DeleteNotificationResponse struct {
+	Result bool `json:"result"`
+}
+
+// ReceiveNotification waits up to receiveTimeout seconds for the next notification in the queue.
+// nil notification without error means the queue is empty.
+func (c *Client) ReceiveNotification(ctx context.Context, receiveTimeout int) (*Notification, error) {
+	var query url.Values
+	if receiveTimeout > 0 {
+		query = url.Values{"receiveTimeout": {strconv.Itoa(receiveTimeout)}}
+	}
+
+	var out Notification
+
+	err := c.getJSON(ctx, MethodReceiveNotification, query, &out)
+	if errors.Is(err, ErrEmptyResponse) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// DeleteNotification removes the received notification from the queue.
+func (c *Client) DeleteNotification(ctx context.Context, receiptID int64) (*DeleteNotificationResponse, error) {
+	var out DeleteNotificationResponse
+
+	endpoint := c.endpoint(MethodDeleteNotification, strconv.FormatInt(receiptID, 10))
+	if err := c.do(ctx, http.MethodDelete, MethodDeleteNotification, endpoint, nil, "", &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
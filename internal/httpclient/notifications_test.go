@@ -0,0 +1,90 @@
+package httpclient_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+const incomingMessage = `{"receiptId":1234567,"body":{
+	"typeWebhook":"incomingMessageReceived",
+	"instanceData":{"idInstance":1101000001,"wid":"79876543210@c.us","typeInstance":"whatsapp"},
+	"timestamp":1588091580,
+	"idMessage":"F7AEC1B7086ECDC7E6E45923F5EDB825",
+	"senderData":{"chatId":"79001234568@c.us","sender":"79001234568@c.us","senderName":"Green API"},
+	"messageData":{"typeMessage":"textMessage","textMessageData":{"textMessage":"I use Green-API"}}
+}}`
+
+func TestClient_ReceiveNotification(t *testing.T) {
+	ts, call := newAPIServer(t, http.StatusOK, incomingMessage)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	n, err := c.ReceiveNotification(context.Background(), 5)
+	require.NoError(t, err)
+	require.NotNil(t, n)
+
+	assert.Equal(t, http.MethodGet, call.method)
+	assert.Equal(t, "/waInstance"+testID+"/"+httpclient.MethodReceiveNotification+"/"+testToken, call.path)
+	assert.Equal(t, "receiveTimeout=5", call.query)
+
+	assert.Equal(t, int64(1234567), n.ReceiptID)
+	assert.Equal(t, httpclient.TypeIncomingMessageReceived, n.Body.TypeWebhook)
+	assert.Equal(t, int64(1101000001), n.Body.InstanceData.IDInstance)
+	assert.Equal(t, "79001234568@c.us", n.Body.GetChatID())
+	assert.Equal(t, "I use Green-API", n.Body.MessageData.Text())
+	assert.JSONEq(t, `{
+		"typeWebhook":"incomingMessageReceived",
+		"instanceData":{"idInstance":1101000001,"wid":"79876543210@c.us","typeInstance":"whatsapp"},
+		"timestamp":1588091580,
+		"idMessage":"F7AEC1B7086ECDC7E6E45923F5EDB825",
+		"senderData":{"chatId":"79001234568@c.us","sender":"79001234568@c.us","senderName":"Green API"},
+		"messageData":{"typeMessage":"textMessage","textMessageData":{"textMessage":"I use Green-API"}}
+	}`, string(n.Body.Raw))
+}
+
+func TestClient_ReceiveNotification_Empty(t *testing.T) {
+	ts, call := newAPIServer(t, http.StatusOK, "null")
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	n, err := c.ReceiveNotification(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Nil(t, n)
+	assert.Empty(t, call.query)
+}
+
+func TestClient_ReceiveNotification_OutgoingStatus(t *testing.T) {
+	ts, _ := newAPIServer(t, http.StatusOK, `{"receiptId":2,"body":{
+		"typeWebhook":"outgoingMessageStatus","chatId":"79001234568@c.us",
+		"idMessage":"BAE5F4886F6F2D05","status":"delivered","sendByApi":true}}`)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	n, err := c.ReceiveNotification(context.Background(), 5)
+	require.NoError(t, err)
+
+	assert.Equal(t, httpclient.TypeOutgoingMessageStatus, n.Body.TypeWebhook)
+	assert.Equal(t, "79001234568@c.us", n.Body.GetChatID())
+	assert.Equal(t, "delivered", n.Body.Status)
+	assert.True(t, n.Body.SendByAPI)
+	assert.Empty(t, n.Body.MessageData.Text())
+}
+
+func TestClient_DeleteNotification(t *testing.T) {
+	ts, call := newAPIServer(t, http.StatusOK, `{"result":true}`)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	out, err := c.DeleteNotification(context.Background(), 1234567)
+	require.NoError(t, err)
+	assert.True(t, out.Result)
+
+	assert.Equal(t, http.MethodDelete, call.method)
+	assert.Equal(t, "/waInstance"+testID+"/"+httpclient.MethodDeleteNotification+"/"+testToken+"/1234567", call.path)
+}
@@ -0,0 +1,76 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var ErrUnknownInstance = &Error{
+	err: errors.New("unknown instance"),
+}
+
+// Provider resolves a client by instance identifier. Credentials stay on the server side.
+type Provider interface {
+	Client(idInstance string) (*Client, error)
+	Instances() []string
+}
+
+// Pool is a Provider over a static set of instances.
+type Pool struct {
+	clients map[string]*Client
+	mu      sync.RWMutex
+}
+
+// NewPool creates clients for instances given as idInstance -> apiTokenInstance.
+func NewPool(baseURL string, httpClient *http.Client, instances map[string]string) *Pool {
+	p := &Pool{
+		clients: make(map[string]*Client, len(instances)),
+	}
+
+	for id, token := range instances {
+		p.clients[id] = NewClient(id, token, baseURL, httpClient)
+	}
+
+	return p
+}
+
+func (p *Pool) Client(idInstance string) (*Client, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	c, ok := p.clients[idInstance]
+	if !ok {
+		return nil, ErrUnknownInstance
+	}
+
+	return c, nil
+}
+
+// SetLimiter throttles sending methods of every client of the pool.
+func (p *Pool) SetLimiter(l Limiter) *Pool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, c := range p.clients {
+		c.SetLimiter(l)
+	}
+
+	return p
+}
+
+// Instances returns sorted instance identifiers.
+func (p *Pool) Instances() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	ids := make([]string, 0, len(p.clients))
+	for id := range p.clients {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
@@ -0,0 +1,477 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/ole-larsen/green-api/internal/chatid"
+)
+
+// GREEN-API limits of sending methods.
+const (
+	MaxMessageLength  = 20000
+	MinPollOptions    = 2
+	MaxPollOptions    = 12
+	MaxPollOptionSize = 100
+	MaxButtons        = 3
+	maxLatitude       = 90
+	maxLongitude      = 180
+)
+
+// Interactive button types.
+const (
+	ButtonCopy = "copy"
+	ButtonCall = "call"
+	ButtonURL  = "url"
+)
+
+var (
+	errMessage        = invalid("message is required")
+	errMessageTooLong = invalid(fmt.Sprintf("message is longer than %d characters", MaxMessageLength))
+	errURLFile        = invalid("urlFile is required")
+	errName           = invalid("fileName is required")
+	errFile           = invalid("file is required")
+	errPollOptions    = invalid(fmt.Sprintf("poll must have from %d to %d options", MinPollOptions, MaxPollOptions))
+	errPollOption     = invalid(fmt.Sprintf("poll option must be from 1 to %d characters", MaxPollOptionSize))
+	errPollDuplicate  = invalid("poll options must be unique")
+	errLatitude       = invalid("latitude must be between -90 and 90")
+	errLongitude      = invalid("longitude must be between -180 and 180")
+	errPhoneContact   = invalid("contact.phoneContact is required")
+	errMessages       = invalid("messages are required")
+	errButtonsBody    = invalid("body is required")
+	errButtons        = invalid(fmt.Sprintf("buttons must have from 1 to %d items", MaxButtons))
+	errButtonText     = invalid("buttonText is required")
+	errButtonType     = invalid("button type must be copy, call or url")
+	errButtonCopyCode = invalid("copyCode is required for copy button")
+	errButtonPhone    = invalid("phoneNumber is required for call button")
+	errButtonURL      = invalid("url is required for url button")
+	errMessageID      = invalid("message id is empty")
+)
+
+type SendMessageRequest struct {
+	// LinkPreview is nil to keep the instance default.
+	LinkPreview     *bool  `json:"linkPreview,omitempty"`
+	ChatID          string `json:"chatId"`
+	Message         string `json:"message"`
+	QuotedMessageID string `json:"quotedMessageId,omitempty"`
+}
+
+type SendFileByURLRequest struct {
+	ChatID          string `json:"chatId"`
+	URLFile         string `json:"urlFile"`
+	FileName        string `json:"fileName"`
+	Caption         string `json:"caption,omitempty"`
+	QuotedMessageID string `json:"quotedMessageId,omitempty"`
+}
+
+// SendFileByUploadRequest - File is streamed as multipart form, it is not buffered.
+type SendFileByUploadRequest struct {
+	File            io.Reader `json:"-"`
+	ChatID          string    `json:"chatId"`
+	FileName        string    `json:"fileName"`
+	Caption         string    `json:"caption,omitempty"`
+	QuotedMessageID string    `json:"quotedMessageId,omitempty"`
+}
+
+type PollOption struct {
+	OptionName string `json:"optionName"`
+}
+
+type SendPollRequest struct {
+	ChatID          string       `json:"chatId"`
+	Message         string       `json:"message"`
+	QuotedMessageID string       `json:"quotedMessageId,omitempty"`
+	Options         []PollOption `json:"options"`
+	MultipleAnswers bool         `json:"multipleAnswers,omitempty"`
+}
+
+type SendLocationRequest struct {
+	ChatID          string  `json:"chatId"`
+	NameLocation    string  `json:"nameLocation,omitempty"`
+	Address         string  `json:"address,omitempty"`
+	QuotedMessageID string  `json:"quotedMessageId,omitempty"`
+	Latitude        float64 `json:"latitude"`
+	Longitude       float64 `json:"longitude"`
+}
+
+type Contact struct {
+	FirstName    string `json:"firstName,omitempty"`
+	MiddleName   string `json:"middleName,omitempty"`
+	LastName     string `json:"lastName,omitempty"`
+	Company      string `json:"company,omitempty"`
+	PhoneContact int64  `json:"phoneContact"`
+}
+
+type SendContactRequest struct {
+	ChatID          string  `json:"chatId"`
+	QuotedMessageID string  `json:"quotedMessageId,omitempty"`
+	Contact         Contact `json:"contact"`
+}
+
+type ForwardMessagesRequest struct {
+	ChatID     string   `json:"chatId"`
+	ChatIDFrom string   `json:"chatIdFrom"`
+	Messages   []string `json:"messages"`
+}
+
+// InteractiveButton - Type is copy, call or url, the matching CopyCode, PhoneNumber or URL is required.
+type InteractiveButton struct {
+	Type        string `json:"type"`
+	ButtonID    string `json:"buttonId,omitempty"`
+	ButtonText  string `json:"buttonText"`
+	CopyCode    string `json:"copyCode,omitempty"`
+	PhoneNumber string `json:"phoneNumber,omitempty"`
+	URL         string `json:"url,omitempty"`
+}
+
+type SendInteractiveButtonsRequest struct {
+	ChatID  string              `json:"chatId"`
+	Header  string              `json:"header,omitempty"`
+	Body    string              `json:"body"`
+	Footer  string              `json:"footer,omitempty"`
+	Buttons []InteractiveButton `json:"buttons"`
+}
+
+type SendMessageResponse struct {
+	IDMessage string `json:"idMessage"`
+}
+
+type SendFileByUploadResponse struct {
+	IDMessage string `json:"idMessage"`
+	URLFile   string `json:"urlFile"`
+}
+
+type ForwardMessagesResponse struct {
+	Messages []string `json:"messages"`
+}
+
+// normalizeChatID validates the chat id of the field and replaces a phone number with its chat id,
+// so "+7 (999) 123-45-67" is sent to 79991234567@c.us.
+func normalizeChatID(field string, value *string) error {
+	id, err := chatid.Normalize(*value)
+	if errors.Is(err, chatid.ErrEmpty) {
+		return NewError(invalid(field + " is required"))
+	}
+
+	if err != nil {
+		return NewError(fmt.Errorf("%w: %s: %w", ErrInvalidRequest, field, err))
+	}
+
+	*value = id
+
+	return nil
+}
+
+func (r *SendMessageRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	return validateMessage(r.Message)
+}
+
+func (r *SendFileByURLRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if r.URLFile == "" {
+		return NewError(errURLFile)
+	}
+
+	if r.FileName == "" {
+		return NewError(errName)
+	}
+
+	return nil
+}
+
+func (r *SendFileByUploadRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if r.File == nil {
+		return NewError(errFile)
+	}
+
+	if r.FileName == "" {
+		return NewError(errName)
+	}
+
+	return nil
+}
+
+func (r *SendPollRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if err := validateMessage(r.Message); err != nil {
+		return err
+	}
+
+	if len(r.Options) < MinPollOptions || len(r.Options) > MaxPollOptions {
+		return NewError(errPollOptions)
+	}
+
+	seen := make(map[string]struct{}, len(r.Options))
+
+	for _, o := range r.Options {
+		if o.OptionName == "" || utf8.RuneCountInString(o.OptionName) > MaxPollOptionSize {
+			return NewError(errPollOption)
+		}
+
+		if _, ok := seen[o.OptionName]; ok {
+			return NewError(errPollDuplicate)
+		}
+
+		seen[o.OptionName] = struct{}{}
+	}
+
+	return nil
+}
+
+func (r *SendLocationRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if r.Latitude < -maxLatitude || r.Latitude > maxLatitude {
+		return NewError(errLatitude)
+	}
+
+	if r.Longitude < -maxLongitude || r.Longitude > maxLongitude {
+		return NewError(errLongitude)
+	}
+
+	return nil
+}
+
+func (r *SendContactRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if r.Contact.PhoneContact <= 0 {
+		return NewError(errPhoneContact)
+	}
+
+	return nil
+}
+
+func (r *ForwardMessagesRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if err := normalizeChatID("chatIdFrom", &r.ChatIDFrom); err != nil {
+		return err
+	}
+
+	if len(r.Messages) == 0 {
+		return NewError(errMessages)
+	}
+
+	for _, id := range r.Messages {
+		if id == "" {
+			return NewError(errMessageID)
+		}
+	}
+
+	return nil
+}
+
+func (r *SendInteractiveButtonsRequest) Validate() error {
+	if err := normalizeChatID("chatId", &r.ChatID); err != nil {
+		return err
+	}
+
+	if r.Body == "" {
+		return NewError(errButtonsBody)
+	}
+
+	if len(r.Buttons) == 0 || len(r.Buttons) > MaxButtons {
+		return NewError(errButtons)
+	}
+
+	for _, b := range r.Buttons {
+		if err := b.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *InteractiveButton) Validate() error {
+	if b.ButtonText == "" {
+		return NewError(errButtonText)
+	}
+
+	switch b.Type {
+	case ButtonCopy:
+		if b.CopyCode == "" {
+			return NewError(errButtonCopyCode)
+		}
+	case ButtonCall:
+		if b.PhoneNumber == "" {
+			return NewError(errButtonPhone)
+		}
+	case ButtonURL:
+		if b.URL == "" {
+			return NewError(errButtonURL)
+		}
+	default:
+		return NewError(errButtonType)
+	}
+
+	return nil
+}
+
+func validateMessage(message string) error {
+	if message == "" {
+		return NewError(errMessage)
+	}
+
+	if utf8.RuneCountInString(message) > MaxMessageLength {
+		return NewError(errMessageTooLong)
+	}
+
+	return nil
+}
+
+// validator is a request checked before the network call.
+type validator interface {
+	Validate() error
+}
+
+// call validates in and posts it as json to method.
+func call[T any](ctx context.Context, c *Client, method string, in validator) (*T, error) {
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	var out T
+	if err := c.postJSON(ctx, method, in, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// send is call of a sending method. A valid request takes a token of the instance limiter
+// before it is posted, a throttled one is not sent at all.
+func send[T any](ctx context.Context, c *Client, method string, in validator) (*T, error) {
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := c.throttle(); err != nil {
+		return nil, err
+	}
+
+	var out T
+	if err := c.postJSON(ctx, method, in, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// SendMessage sends a text message to a personal or a group chat.
+func (c *Client) SendMessage(ctx context.Context, in *SendMessageRequest) (*SendMessageResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return send[SendMessageResponse](ctx, c, MethodSendMessage, in)
+}
+
+// SendFileByURL sends a file that is available by public link.
+func (c *Client) SendFileByURL(ctx context.Context, in *SendFileByURLRequest) (*SendMessageResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return send[SendMessageResponse](ctx, c, MethodSendFileByURL, in)
+}
+
+// SendPoll sends a poll with 2-12 unique options.
+func (c *Client) SendPoll(ctx context.Context, in *SendPollRequest) (*SendMessageResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return send[SendMessageResponse](ctx, c, MethodSendPoll, in)
+}
+
+// SendLocation sends a location by coordinates.
+func (c *Client) SendLocation(ctx context.Context, in *SendLocationRequest) (*SendMessageResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return send[SendMessageResponse](ctx, c, MethodSendLocation, in)
+}
+
+// SendContact sends a contact card.
+func (c *Client) SendContact(ctx context.Context, in *SendContactRequest) (*SendMessageResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return send[SendMessageResponse](ctx, c, MethodSendContact, in)
+}
+
+// ForwardMessages forwards messages of chatIdFrom to chatId.
+func (c *Client) ForwardMessages(ctx context.Context, in *ForwardMessagesRequest) (*ForwardMessagesResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return send[ForwardMessagesResponse](ctx, c, MethodForwardMessages, in)
+}
+
+// SendInteractiveButtons sends a message with up to 3 copy, call or url buttons.
+func (c *Client) SendInteractiveButtons(ctx context.Context, in *SendInteractiveButtonsRequest) (*SendMessageResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	return send[SendMessageResponse](ctx, c, MethodSendInteractiveButtons, in)
+}
+
+// SendFileByUpload uploads in.File as multipart form to the media host. The file is streamed
+// to GREEN-API while it is read.
+func (c *Client) SendFileByUpload(ctx context.Context, in *SendFileByUploadRequest) (*SendFileByUploadResponse, error) {
+	if in == nil {
+		return nil, NewError(errEmptyRequest)
+	}
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := c.throttle(); err != nil {
+		return nil, err
+	}
+
+	fields := [][2]string{
+		{"chatId", in.ChatID},
+		{"fileName", in.FileName},
+		{"caption", in.Caption},
+		{"quotedMessageId", in.QuotedMessageID},
+	}
+
+	var out SendFileByUploadResponse
+	if err := c.postMultipart(ctx, c.mediaEndpoint(MethodSendFileByUpload), MethodSendFileByUpload,
+		fields, in.FileName, in.File, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
@@ -0,0 +1,424 @@
+package httpclient_test
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+const testChatID = "79876543210@c.us"
+
+func TestClient_SendingMethods(t *testing.T) {
+	ctx := context.Background()
+	preview := false
+
+	tests := []struct {
+		call      func(c *httpclient.Client) (any, error)
+		want      any
+		name      string
+		response  string
+		apiMethod string
+		body      string
+	}{
+		{
+			name:      "sendMessage",
+			response:  `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			apiMethod: httpclient.MethodSendMessage,
+			body:      `{"chatId":"79876543210@c.us","message":"hi","quotedMessageId":"361B0BE7F5","linkPreview":false}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SendMessage(ctx, &httpclient.SendMessageRequest{
+					ChatID:          testChatID,
+					Message:         "hi",
+					QuotedMessageID: "361B0BE7F5",
+					LinkPreview:     &preview,
+				})
+			},
+			want: &httpclient.SendMessageResponse{IDMessage: "3EB0C767D097B7C7C030"},
+		},
+		{
+			name:      "sendMessage to a phone number",
+			response:  `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			apiMethod: httpclient.MethodSendMessage,
+			body:      `{"chatId":"79876543210@c.us","message":"hi"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SendMessage(ctx, &httpclient.SendMessageRequest{ChatID: "+7 (987) 654-32-10", Message: "hi"})
+			},
+			want: &httpclient.SendMessageResponse{IDMessage: "3EB0C767D097B7C7C030"},
+		},
+		{
+			name:      "sendFileByUrl",
+			response:  `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			apiMethod: httpclient.MethodSendFileByURL,
+			body:      `{"chatId":"79876543210@c.us","urlFile":"https://example.com/a.png","fileName":"a.png"}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SendFileByURL(ctx, &httpclient.SendFileByURLRequest{
+					ChatID:   testChatID,
+					URLFile:  "https://example.com/a.png",
+					FileName: "a.png",
+				})
+			},
+			want: &httpclient.SendMessageResponse{IDMessage: "3EB0C767D097B7C7C030"},
+		},
+		{
+			name:      "sendPoll",
+			response:  `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			apiMethod: httpclient.MethodSendPoll,
+			body: `{"chatId":"79876543210@c.us","message":"Which color?",
+				"options":[{"optionName":"red"},{"optionName":"green"}],"multipleAnswers":true}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SendPoll(ctx, &httpclient.SendPollRequest{
+					ChatID:          testChatID,
+					Message:         "Which color?",
+					Options:         []httpclient.PollOption{{OptionName: "red"}, {OptionName: "green"}},
+					MultipleAnswers: true,
+				})
+			},
+			want: &httpclient.SendMessageResponse{IDMessage: "3EB0C767D097B7C7C030"},
+		},
+		{
+			name:      "sendLocation",
+			response:  `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			apiMethod: httpclient.MethodSendLocation,
+			body:      `{"chatId":"79876543210@c.us","nameLocation":"Office","latitude":55.75,"longitude":37.61}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SendLocation(ctx, &httpclient.SendLocationRequest{
+					ChatID:       testChatID,
+					NameLocation: "Office",
+					Latitude:     55.75,
+					Longitude:    37.61,
+				})
+			},
+			want: &httpclient.SendMessageResponse{IDMessage: "3EB0C767D097B7C7C030"},
+		},
+		{
+			name:      "sendContact",
+			response:  `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			apiMethod: httpclient.MethodSendContact,
+			body:      `{"chatId":"79876543210@c.us","contact":{"phoneContact":79001234568,"firstName":"Ivan"}}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SendContact(ctx, &httpclient.SendContactRequest{
+					ChatID:  testChatID,
+					Contact: httpclient.Contact{PhoneContact: 79001234568, FirstName: "Ivan"},
+				})
+			},
+			want: &httpclient.SendMessageResponse{IDMessage: "3EB0C767D097B7C7C030"},
+		},
+		{
+			name:      "forwardMessages",
+			response:  `{"messages":["BAE587FA1CECF760"]}`,
+			apiMethod: httpclient.MethodForwardMessages,
+			body:      `{"chatId":"79876543210@c.us","chatIdFrom":"79001234568@c.us","messages":["BAE587FA1CECF760"]}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.ForwardMessages(ctx, &httpclient.ForwardMessagesRequest{
+					ChatID:     testChatID,
+					ChatIDFrom: "79001234568@c.us",
+					Messages:   []string{"BAE587FA1CECF760"},
+				})
+			},
+			want: &httpclient.ForwardMessagesResponse{Messages: []string{"BAE587FA1CECF760"}},
+		},
+		{
+			name:      "sendInteractiveButtons",
+			response:  `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			apiMethod: httpclient.MethodSendInteractiveButtons,
+			body: `{"chatId":"79876543210@c.us","body":"Choose",
+				"buttons":[{"type":"url","buttonId":"1","buttonText":"Site","url":"https://green-api.com"}]}`,
+			call: func(c *httpclient.Client) (any, error) {
+				return c.SendInteractiveButtons(ctx, &httpclient.SendInteractiveButtonsRequest{
+					ChatID: testChatID,
+					Body:   "Choose",
+					Buttons: []httpclient.InteractiveButton{
+						{Type: httpclient.ButtonURL, ButtonID: "1", ButtonText: "Site", URL: "https://green-api.com"},
+					},
+				})
+			},
+			want: &httpclient.SendMessageResponse{IDMessage: "3EB0C767D097B7C7C030"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, call := newAPIServer(t, http.StatusOK, tt.response)
+
+			got, err := tt.call(httpclient.NewClient(testID, testToken, ts.URL, ts.Client()))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, http.MethodPost, call.method)
+			assert.Equal(t, "/waInstance"+testID+"/"+tt.apiMethod+"/"+testToken, call.path)
+			assert.JSONEq(t, tt.body, call.body)
+		})
+	}
+}
+
+func TestClient_SendingValidation(t *testing.T) {
+	ctx := context.Background()
+	c := httpclient.NewClient(testID, testToken, "http://127.0.0.1:0", nil)
+	options := []httpclient.PollOption{{OptionName: "a"}, {OptionName: "b"}}
+
+	tests := []struct {
+		call func() error
+		name string
+		want string
+	}{
+		{
+			name: "message too long",
+			want: "message is longer than 20000 characters",
+			call: func() error {
+				_, err := c.SendMessage(ctx, &httpclient.SendMessageRequest{ChatID: testChatID, Message: strings.Repeat("a", 20001)})
+				return err
+			},
+		},
+		{
+			name: "upload without file",
+			want: "file is required",
+			call: func() error {
+				_, err := c.SendFileByUpload(ctx, &httpclient.SendFileByUploadRequest{ChatID: testChatID, FileName: "a.txt"})
+				return err
+			},
+		},
+		{
+			name: "poll with one option",
+			want: "poll must have from 2 to 12 options",
+			call: func() error {
+				_, err := c.SendPoll(ctx, &httpclient.SendPollRequest{ChatID: testChatID, Message: "?", Options: options[:1]})
+				return err
+			},
+		},
+		{
+			name: "poll with duplicate options",
+			want: "poll options must be unique",
+			call: func() error {
+				_, err := c.SendPoll(ctx, &httpclient.SendPollRequest{
+					ChatID: testChatID, Message: "?", Options: []httpclient.PollOption{{OptionName: "a"}, {OptionName: "a"}},
+				})
+				return err
+			},
+		},
+		{
+			name: "poll without question",
+			want: "message is required",
+			call: func() error {
+				_, err := c.SendPoll(ctx, &httpclient.SendPollRequest{ChatID: testChatID, Options: options})
+				return err
+			},
+		},
+		{
+			name: "location out of range",
+			want: "latitude must be between -90 and 90",
+			call: func() error {
+				_, err := c.SendLocation(ctx, &httpclient.SendLocationRequest{ChatID: testChatID, Latitude: 91})
+				return err
+			},
+		},
+		{
+			name: "contact without phone",
+			want: "contact.phoneContact is required",
+			call: func() error {
+				_, err := c.SendContact(ctx, &httpclient.SendContactRequest{ChatID: testChatID})
+				return err
+			},
+		},
+		{
+			name: "forward without messages",
+			want: "messages are required",
+			call: func() error {
+				_, err := c.ForwardMessages(ctx, &httpclient.ForwardMessagesRequest{ChatID: testChatID, ChatIDFrom: testChatID})
+				return err
+			},
+		},
+		{
+			name: "too many buttons",
+			want: "buttons must have from 1 to 3 items",
+			call: func() error {
+				b := httpclient.InteractiveButton{Type: httpclient.ButtonCopy, ButtonText: "copy", CopyCode: "1"}
+				_, err := c.SendInteractiveButtons(ctx, &httpclient.SendInteractiveButtonsRequest{
+					ChatID: testChatID, Body: "b", Buttons: []httpclient.InteractiveButton{b, b, b, b},
+				})
+
+				return err
+			},
+		},
+		{
+			name: "call button without phone",
+			want: "phoneNumber is required for call button",
+			call: func() error {
+				_, err := c.SendInteractiveButtons(ctx, &httpclient.SendInteractiveButtonsRequest{
+					ChatID: testChatID, Body: "b", Buttons: []httpclient.InteractiveButton{{Type: httpclient.ButtonCall, ButtonText: "call"}},
+				})
+
+				return err
+			},
+		},
+		{
+			name: "malformed chat id",
+			want: `chatId: invalid chat id: "79876543210@s.whatsapp.net" must end with @c.us or @g.us`,
+			call: func() error {
+				_, err := c.SendMessage(ctx, &httpclient.SendMessageRequest{ChatID: "79876543210@s.whatsapp.net", Message: "hi"})
+				return err
+			},
+		},
+		{
+			name: "forward without chatIdFrom",
+			want: "chatIdFrom is required",
+			call: func() error {
+				_, err := c.ForwardMessages(ctx, &httpclient.ForwardMessagesRequest{ChatID: testChatID, Messages: []string{"A1"}})
+				return err
+			},
+		},
+		{
+			name: "nil request",
+			want: "empty request",
+			call: func() error {
+				_, err := c.ForwardMessages(ctx, nil)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			require.ErrorIs(t, err, httpclient.ErrInvalidRequest)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestClient_SendFileByUpload(t *testing.T) {
+	type upload struct {
+		fields map[string]string
+		path   string
+		file   string
+		name   string
+	}
+
+	got := upload{fields: make(map[string]string)}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got.path = r.URL.Path
+
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+
+		mr := multipart.NewReader(r.Body, params["boundary"])
+
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(part)
+			require.NoError(t, err)
+
+			if part.FormName() == "file" {
+				got.file = string(data)
+				got.name = part.FileName()
+
+				continue
+			}
+
+			got.fields[part.FormName()] = string(data)
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_, err = io.WriteString(rw, `{"idMessage":"3EB0C767D097B7C7C030","urlFile":"https://sw-media.storage.greenapi.net/a.txt"}`)
+		require.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	out, err := c.SendFileByUpload(context.Background(), &httpclient.SendFileByUploadRequest{
+		ChatID:   testChatID,
+		FileName: "a.txt",
+		Caption:  "report",
+		File:     strings.NewReader("file content"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "3EB0C767D097B7C7C030", out.IDMessage)
+	assert.Equal(t, "/waInstance"+testID+"/"+httpclient.MethodSendFileByUpload+"/"+testToken, got.path)
+	assert.Equal(t, "file content", got.file)
+	assert.Equal(t, "a.txt", got.name)
+	assert.Equal(t, map[string]string{"chatId": testChatID, "fileName": "a.txt", "caption": "report"}, got.fields)
+}
+
+func TestClient_SendFileByUpload_APIError(t *testing.T) {
+	ts, _ := newAPIServer(t, http.StatusBadRequest, `{"message":"file is too big"}`)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	_, err := c.SendFileByUpload(context.Background(), &httpclient.SendFileByUploadRequest{
+		ChatID:   testChatID,
+		FileName: "a.txt",
+		File:     strings.NewReader(strings.Repeat("a", 1<<20)),
+	})
+	require.Error(t, err)
+}
+
+func TestMediaURL(t *testing.T) {
+	assert.Equal(t, "https://1103.media.green-api.com", httpclient.MediaURL(httpclient.APIURL))
+	assert.Equal(t, "http://127.0.0.1:8080", httpclient.MediaURL("http://127.0.0.1:8080"))
+
+	c := httpclient.NewClient(testID, testToken, "", nil)
+	assert.Equal(t, "https://1103.media.green-api.com", c.GetMediaURL())
+}
+
+// denyLimiter allows the first n sends of an instance.
+type denyLimiter struct {
+	n int
+}
+
+func (l *denyLimiter) Allow(string) (bool, time.Duration) {
+	if l.n > 0 {
+		l.n--
+		return true, 0
+	}
+
+	return false, 1500 * time.Millisecond
+}
+
+func TestClient_RateLimited(t *testing.T) {
+	ts, call := newAPIServer(t, http.StatusOK, `{"idMessage":"3EB0C767D097B7C7C030"}`)
+
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client()).SetLimiter(&denyLimiter{n: 1})
+	req := &httpclient.SendMessageRequest{ChatID: testChatID, Message: "hi"}
+
+	_, err := c.SendMessage(context.Background(), req)
+	require.NoError(t, err)
+
+	*call = apiCall{}
+
+	_, err = c.SendMessage(context.Background(), req)
+	require.ErrorIs(t, err, httpclient.ErrRateLimited)
+
+	var limitErr *httpclient.RateLimitError
+
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, testID, limitErr.IDInstance)
+	assert.Equal(t, 1500*time.Millisecond, limitErr.RetryAfter)
+	assert.Empty(t, call.path, "throttled send must not reach the api")
+
+	// invalid requests fail before they take a token
+	_, err = c.SendMessage(context.Background(), &httpclient.SendMessageRequest{ChatID: testChatID})
+	require.ErrorIs(t, err, httpclient.ErrInvalidRequest)
+
+	// reading methods are not throttled
+	_, err = c.GetStateInstance(context.Background())
+	require.NoError(t, err)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// maxAPIKeyBody limits the body of key requests, they carry a name, scopes and instances.
+const maxAPIKeyBody = 64 << 10
+
+type APIKeysResponse struct {
+	Keys []storage.APIKey `json:"keys"`
+}
+
+// IssueAPIKeyHandler godoc
+// @Tags Keys
+// @Summary issue an API key, the key is returned once and only its hash is stored
+// @Description Send the key as "Authorization: Bearer {key}". Scopes are read, send and admin,
+// @Description empty instances allow every instance.
+// @ID issueAPIKey
+// @Accept  json
+// @Produce json
+// @Param request body auth.APIKeyRequest true "name, scopes, optional instances and expires_at"
+// @Success 201 {object} auth.IssuedAPIKey
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/keys [post].
+func IssueAPIKeyHandler(keys *auth.APIKeys) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, err := decode[auth.APIKeyRequest](io.LimitReader(r.Body, maxAPIKeyBody))
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		createdBy := ""
+		if identity, ok := auth.FromContext(r.Context()); ok {
+			createdBy = identity.Name()
+		}
+
+		k, err := keys.Issue(r.Context(), req, createdBy)
+		if err != nil {
+			writeAPIKeyError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusCreated, k)
+	}
+}
+
+// APIKeysHandler godoc
+// @Tags Keys
+// @Summary API keys, the latest first, by prefix with last use and without secrets
+// @ID apiKeys
+// @Produce json
+// @Success 200 {object} APIKeysResponse
+// @Router /api/v1/keys [get].
+func APIKeysHandler(keys *auth.APIKeys) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		list, err := keys.List(r.Context())
+		if err != nil {
+			writeAPIKeyError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, APIKeysResponse{Keys: list})
+	}
+}
+
+// RevokeAPIKeyHandler godoc
+// @Tags Keys
+// @Summary revoke the API key, it is rejected from now on
+// @ID revokeAPIKey
+// @Param keyID path string true "key id"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/keys/{keyID} [delete].
+func RevokeAPIKeyHandler(keys *auth.APIKeys) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if err := keys.Revoke(r.Context(), chi.URLParam(r, "keyID")); err != nil {
+			writeAPIKeyError(rw, err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeAPIKeyError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrAPIKeyNotFound):
+		WriteError(rw, http.StatusNotFound, err)
+	case errors.Is(err, auth.ErrAPIKeyRequest):
+		WriteError(rw, http.StatusBadRequest, err)
+	default:
+		logger.Errorln(err)
+		WriteError(rw, http.StatusInternalServerError, errors.New("internal server error"))
+	}
+}
@@ -0,0 +1,159 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// memAPIKeys is an in-memory APIKeyStorage.
+type memAPIKeys struct {
+	keys map[string]storage.APIKey
+	mu   sync.Mutex
+}
+
+func (f *memAPIKeys) SaveAPIKey(_ context.Context, k *storage.APIKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.keys[k.ID] = *k
+
+	return nil
+}
+
+func (f *memAPIKeys) GetAPIKeyByPrefix(_ context.Context, prefix string) (*storage.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.keys {
+		if k.Prefix == prefix {
+			return &k, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (f *memAPIKeys) ListAPIKeys(context.Context) ([]storage.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.APIKey{}
+	for _, k := range f.keys {
+		list = append(list, k)
+	}
+
+	return list, nil
+}
+
+func (f *memAPIKeys) RevokeAPIKey(_ context.Context, id string, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k, ok := f.keys[id]
+	if !ok || k.RevokedAt != nil {
+		return storage.ErrNotFound
+	}
+
+	k.RevokedAt = &at
+	f.keys[id] = k
+
+	return nil
+}
+
+func (f *memAPIKeys) TouchAPIKey(_ context.Context, id string, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k := f.keys[id]
+	k.LastUsedAt = &at
+	f.keys[id] = k
+
+	return nil
+}
+
+func newTestAPIKeys() *auth.APIKeys {
+	return auth.NewAPIKeys(&memAPIKeys{keys: make(map[string]storage.APIKey)})
+}
+
+func newAPIKeysServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	keys := newTestAPIKeys()
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/keys", handlers.IssueAPIKeyHandler(keys))
+	r.Get("/api/v1/keys", handlers.APIKeysHandler(keys))
+	r.Delete("/api/v1/keys/{keyID}", handlers.RevokeAPIKeyHandler(keys))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestAPIKeysHandlers(t *testing.T) {
+	ts := newAPIKeysServer(t)
+
+	var issued auth.IssuedAPIKey
+
+	status := getJSON(t, ts, http.MethodPost, "/api/v1/keys", `{"name":"billing","scopes":["send","read"]}`, &issued)
+	require.Equal(t, http.StatusCreated, status)
+	assert.NotEmpty(t, issued.Key)
+	assert.Equal(t, []string{"send", "read"}, []string(issued.Scopes))
+
+	status, body := rawBody(t, ts, http.MethodGet, "/api/v1/keys", "")
+	require.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"prefix":"`+issued.Prefix+`"`)
+	assert.NotContains(t, body, issued.Key, "the secret is shown once")
+	assert.NotContains(t, body, "hash")
+
+	status, _ = rawBody(t, ts, http.MethodDelete, "/api/v1/keys/"+issued.ID, "")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	var list handlers.APIKeysResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/keys", "", &list))
+	require.Len(t, list.Keys, 1)
+	assert.NotNil(t, list.Keys[0].RevokedAt)
+}
+
+func TestAPIKeysHandlers_Errors(t *testing.T) {
+	ts := newAPIKeysServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"no body", http.MethodPost, "/api/v1/keys", ``, http.StatusBadRequest},
+		{"bad json", http.MethodPost, "/api/v1/keys", `{`, http.StatusBadRequest},
+		{"no scopes", http.MethodPost, "/api/v1/keys", `{"name":"billing"}`, http.StatusBadRequest},
+		{"unknown scope", http.MethodPost, "/api/v1/keys", `{"name":"billing","scopes":["write"]}`, http.StatusBadRequest},
+		{"expired", http.MethodPost, "/api/v1/keys", `{"name":"billing","scopes":["read"],"expires_at":"2020-01-01T00:00:00Z"}`,
+			http.StatusBadRequest},
+		{"revoke unknown", http.MethodDelete, "/api/v1/keys/unknown", ``, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp handlers.ErrorResponse
+
+			assert.Equal(t, tt.status, getJSON(t, ts, tt.method, tt.path, tt.body, &resp))
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+// maxLoginBody limits the login form, it carries a username, a password and the page to return to.
+const maxLoginBody = 4 << 10
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Sign in</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            margin: 20px;
+        }
+        form {
+            max-width: 300px;
+        }
+        input[type="text"], input[type="password"] {
+            width: 100%;
+            margin-bottom: 10px;
+            padding: 8px;
+            box-sizing: border-box;
+        }
+        button {
+            width: 100%;
+            padding: 10px;
+            background-color: #007BFF;
+            color: white;
+            border: none;
+            border-radius: 5px;
+            cursor: pointer;
+        }
+        button:hover {
+            background-color: #0056b3;
+        }
+        .error {
+            color: #c00;
+        }
+    </style>
+</head>
+<body>
+    <form method="post" action="/login">
+        <h3>Sign in</h3>
+        {{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+        <input type="text" name="username" placeholder="Username" value="{{.Username}}" autocomplete="username" required autofocus>
+        <input type="password" name="password" placeholder="Password" autocomplete="current-password" required>
+        <input type="hidden" name="next" value="{{.Next}}">
+        <button type="submit">sign in</button>
+    </form>
+</body>
+</html>
+`))
+
+type loginData struct {
+	Error    string
+	Username string
+	Next     string
+}
+
+// LoginPageHandler godoc
+// @Tags Auth
+// @Summary sign in form
+// @ID loginPage
+// @Produce text/html; charset=utf-8
+// @Param next query string false "page opened after sign in"
+// @Success 200 {string} string "value"
+// @Router /login [get].
+func LoginPageHandler(rw http.ResponseWriter, r *http.Request) {
+	writeLoginPage(rw, http.StatusOK, &loginData{Next: safeNext(r.URL.Query().Get("next"))})
+}
+
+// LoginHandler godoc
+// @Tags Auth
+// @Summary sign in, the session cookie is set and the browser is redirected to next
+// @ID login
+// @Accept  x-www-form-urlencoded
+// @Produce text/html; charset=utf-8
+// @Param username formData string true "username"
+// @Param password formData string true "password"
+// @Param next formData string false "page opened after sign in"
+// @Success 303
+// @Failure 401 {string} string "the form with the error"
+// @Router /login [post].
+func LoginHandler(sessions *auth.Sessions) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(rw, r.Body, maxLoginBody)
+
+		if err := r.ParseForm(); err != nil {
+			writeLoginPage(rw, http.StatusBadRequest, &loginData{Error: "wrong form", Next: "/"})
+			return
+		}
+
+		data := &loginData{
+			Username: r.PostForm.Get("username"),
+			Next:     safeNext(r.PostForm.Get("next")),
+		}
+
+		_, err := sessions.Login(r.Context(), rw, data.Username, r.PostForm.Get("password"))
+		if errors.Is(err, auth.ErrCredentials) {
+			data.Error = err.Error()
+			writeLoginPage(rw, http.StatusUnauthorized, data)
+
+			return
+		}
+
+		if err != nil {
+			logger.Errorln(err)
+
+			data.Error = "sign in failed, try again later"
+			writeLoginPage(rw, http.StatusInternalServerError, data)
+
+			return
+		}
+
+		http.Redirect(rw, r, data.Next, http.StatusSeeOther)
+	}
+}
+
+// LogoutHandler godoc
+// @Tags Auth
+// @Summary sign out, the session cookie is deleted
+// @ID logout
+// @Success 303
+// @Router /logout [post].
+func LogoutHandler(sessions *auth.Sessions) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		sessions.Logout(rw)
+		http.Redirect(rw, r, "/login", http.StatusSeeOther)
+	}
+}
+
+// MeHandler godoc
+// @Tags Auth
+// @Summary the signed in user
+// @ID me
+// @Produce json
+// @Success 200 {object} auth.Identity
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/me [get].
+func MeHandler(rw http.ResponseWriter, r *http.Request) {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok {
+		UnauthorizedRequest(rw, r)
+		return
+	}
+
+	WriteJSON(rw, http.StatusOK, identity)
+}
+
+// UnauthorizedRequest writes json error of a request without valid credentials.
+func UnauthorizedRequest(rw http.ResponseWriter, _ *http.Request) {
+	WriteError(rw, http.StatusUnauthorized, errUnauthorized)
+}
+
+// Forbidden writes json error of an identity without the scope on what it asked for.
+func Forbidden(rw http.ResponseWriter, identity *auth.Identity, scope auth.Scope, on string) {
+	WriteError(rw, http.StatusForbidden, fmt.Errorf("%s has no %s access to %s", identity.Name(), scope, on))
+}
+
+// AllowsInstance reports whether the identity of the request has the scope on the instance given by name
+// or idInstance. Requests without an identity are allowed, unknown instances only with the scope on every instance.
+func AllowsInstance(r *http.Request, clients httpclient.Provider, instance string, scope auth.Scope) bool {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok || identity.AllowsInstance(auth.AllInstances, scope) {
+		return true
+	}
+
+	c, err := clients.Client(instance)
+
+	return err == nil && identity.AllowsInstance(c.GetIDInstance(), scope)
+}
+
+// checkInstance writes 403 and returns false unless the identity of the request has the scope on the instance.
+func checkInstance(rw http.ResponseWriter, r *http.Request, clients httpclient.Provider, instance string,
+	scope auth.Scope) bool {
+	if AllowsInstance(r, clients, instance, scope) {
+		return true
+	}
+
+	identity, _ := auth.FromContext(r.Context())
+	Forbidden(rw, identity, scope, "instance "+instance)
+
+	return false
+}
+
+// readable keeps items of instances the identity of the request may read.
+func readable[T any](r *http.Request, clients httpclient.Provider, items []T, instanceOf func(*T) string) []T {
+	if identity, ok := auth.FromContext(r.Context()); !ok || identity.AllowsInstance(auth.AllInstances, auth.ScopeRead) {
+		return items
+	}
+
+	allowed := make([]T, 0, len(items))
+
+	for i := range items {
+		if AllowsInstance(r, clients, instanceOf(&items[i]), auth.ScopeRead) {
+			allowed = append(allowed, items[i])
+		}
+	}
+
+	return allowed
+}
+
+// LoginURL returns the login page opening target after sign in.
+func LoginURL(target string) string {
+	return "/login?next=" + url.QueryEscape(safeNext(target))
+}
+
+func writeLoginPage(rw http.ResponseWriter, status int, data *loginData) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(status)
+
+	if err := loginPage.Execute(rw, data); err != nil {
+		logger.Errorln(err)
+	}
+}
+
+// safeNext keeps redirects after sign in on this server: next must be a local path.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.ContainsAny(next, "\\\r\n") {
+		return "/"
+	}
+
+	return next
+}
@@ -0,0 +1,146 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/httpserver/middlewares"
+)
+
+// newLoginServer serves the login page and /api/v1/me behind the session, its client keeps cookies
+// and does not follow redirects.
+func newLoginServer(t *testing.T) (*httptest.Server, *http.Client) {
+	t.Helper()
+
+	users := newTestUsers()
+
+	_, err := users.Create(context.Background(), &auth.UserRequest{Username: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	sessions, err := auth.NewSessions(users, "secret")
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Get("/login", handlers.LoginPageHandler)
+	r.Post("/login", handlers.LoginHandler(sessions))
+	r.Group(func(r chi.Router) {
+		r.Use(middlewares.AuthMiddleware(sessions, nil))
+		r.Post("/logout", handlers.LogoutHandler(sessions))
+		r.Get("/api/v1/me", handlers.MeHandler)
+	})
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	client := ts.Client()
+	client.Jar = jar
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return ts, client
+}
+
+// postLogin posts the form with the client and returns the response with its body.
+func postLogin(t *testing.T, client *http.Client, target string, form url.Values) (*http.Response, string) {
+	t.Helper()
+
+	resp, err := client.PostForm(target, form)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp, string(data)
+}
+
+func TestLoginHandler(t *testing.T) {
+	ts, client := newLoginServer(t)
+
+	resp, err := client.Get(ts.URL + "/api/v1/me")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, body := postLogin(t, client, ts.URL+"/login",
+		url.Values{"username": {"alice"}, "password": {"wrong horse"}, "next": {"/journal"}})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, body, "wrong username or password")
+	assert.Contains(t, body, `value="/journal"`)
+
+	resp, _ = postLogin(t, client, ts.URL+"/login",
+		url.Values{"username": {"alice"}, "password": {"correct horse"}, "next": {"/journal"}})
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "/journal", resp.Header.Get("Location"))
+
+	resp, err = client.Get(ts.URL + "/api/v1/me")
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(data))
+	assert.Contains(t, string(data), `"username":"alice"`)
+
+	resp, _ = postLogin(t, client, ts.URL+"/logout", nil)
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+
+	resp, err = client.Get(ts.URL + "/api/v1/me")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestLoginHandler_Next(t *testing.T) {
+	ts, client := newLoginServer(t)
+
+	tests := []struct {
+		next string
+		want string
+	}{
+		{"", "/"},
+		{"/campaigns?id=1", "/campaigns?id=1"},
+		{"https://evil.example", "/"},
+		{"//evil.example", "/"},
+		{"/\\evil.example", "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.next, func(t *testing.T) {
+			resp, _ := postLogin(t, client, ts.URL+"/login",
+				url.Values{"username": {"alice"}, "password": {"correct horse"}, "next": {tt.next}})
+			require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+			assert.Equal(t, tt.want, resp.Header.Get("Location"))
+		})
+	}
+}
+
+func TestLoginPageHandler(t *testing.T) {
+	ts, _ := newLoginServer(t)
+
+	status, body := rawBody(t, ts, http.MethodGet, "/login?next="+url.QueryEscape(`/"><script>`), "")
+	require.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `<form method="post" action="/login">`)
+	assert.NotContains(t, body, `"><script>`, "next is escaped")
+
+	assert.Equal(t, "/login?next=%2Fjournal", handlers.LoginURL("/journal"))
+	assert.Equal(t, "/login?next=%2F", handlers.LoginURL("//evil.example"))
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/campaign"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// MaxCampaignFileSize limits csv files of campaigns.
+const MaxCampaignFileSize = 10 << 20
+
+type CampaignsResponse struct {
+	Campaigns []storage.Campaign `json:"campaigns"`
+}
+
+type CampaignPreviewResponse struct {
+	Messages []campaign.Preview `json:"messages"`
+}
+
+// UpdateCampaignRequest changes a draft campaign, empty fields are kept.
+type UpdateCampaignRequest struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+}
+
+// CreateCampaignHandler godoc
+// @Tags Campaigns
+// @Summary create a draft campaign from a csv file of recipients
+// @Description Form fields id_instance, name and template must precede the file part. The file has a header,
+// @Description the phone column is required, every column is a merge field of the template: Hello {{name}}.
+// @ID createCampaign
+// @Accept  multipart/form-data
+// @Produce json
+// @Success 201 {object} storage.Campaign
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Router /api/v1/campaigns [post].
+func CreateCampaignHandler(m *campaign.Manager, clients httpclient.Provider) http.HandlerFunc {
+	const maxSize = MaxCampaignFileSize
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxSize+multipartOverhead {
+			WriteError(rw, http.StatusRequestEntityTooLarge, ErrFileTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(rw, r.Body, maxSize+multipartOverhead)
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, errNotMultipart)
+			return
+		}
+
+		req := &campaign.Request{}
+
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				WriteError(rw, http.StatusBadRequest, errNoFile)
+				return
+			}
+
+			if err != nil {
+				WriteError(rw, http.StatusBadRequest, NewError(err))
+				return
+			}
+
+			if part.FormName() != "file" {
+				data, err := io.ReadAll(io.LimitReader(part, multipartOverhead))
+				if err != nil {
+					WriteError(rw, http.StatusBadRequest, NewError(err))
+					return
+				}
+
+				switch part.FormName() {
+				case "id_instance":
+					req.IDInstance = strings.TrimSpace(string(data))
+				case "name":
+					req.Name = strings.TrimSpace(string(data))
+				case "template":
+					req.Template = string(data)
+				}
+
+				continue
+			}
+
+			if !checkInstance(rw, r, clients, req.IDInstance, auth.ScopeSend) {
+				return
+			}
+
+			req.File = &limitedReader{r: part, left: maxSize}
+
+			c, err := m.Create(r.Context(), req)
+			if err != nil {
+				writeCampaignError(rw, err)
+				return
+			}
+
+			WriteJSON(rw, http.StatusCreated, c)
+
+			return
+		}
+	}
+}
+
+// CampaignsHandler godoc
+// @Tags Campaigns
+// @Summary latest campaigns with their progress
+// @Description Campaigns of instances the user or the key may not read are left out.
+// @ID campaigns
+// @Produce json
+// @Param instance query string false "idInstance"
+// @Param limit query int false "max number of campaigns, 100 by default"
+// @Success 200 {object} CampaignsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/campaigns [get].
+func CampaignsHandler(m *campaign.Manager, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, err := queryLimit(query)
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		instance := query.Get("instance")
+		if instance != "" && !checkInstance(rw, r, clients, instance, auth.ScopeRead) {
+			return
+		}
+
+		campaigns, err := m.List(r.Context(), instance, limit)
+		if err != nil {
+			writeCampaignError(rw, err)
+			return
+		}
+
+		campaigns = readable(r, clients, campaigns, func(c *storage.Campaign) string { return c.IDInstance })
+
+		WriteJSON(rw, http.StatusOK, CampaignsResponse{Campaigns: campaigns})
+	}
+}
+
+// CampaignHandler godoc
+// @Tags Campaigns
+// @Summary campaign with progress: recipients by status
+// @ID campaign
+// @Produce json
+// @Param campaignID path string true "campaign id"
+// @Success 200 {object} storage.Campaign
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/campaigns/{campaignID} [get].
+func CampaignHandler(m *campaign.Manager, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		c, ok := checkCampaign(rw, r, m, clients, auth.ScopeRead)
+		if !ok {
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, c)
+	}
+}
+
+// UpdateCampaignHandler godoc
+// @Tags Campaigns
+// @Summary change name or template of a draft campaign
+// @ID updateCampaign
+// @Accept  json
+// @Produce json
+// @Param campaignID path string true "campaign id"
+// @Param request body UpdateCampaignRequest true "changed fields"
+// @Success 200 {object} storage.Campaign
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/campaigns/{campaignID} [patch].
+func UpdateCampaignHandler(m *campaign.Manager, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if _, ok := checkCampaign(rw, r, m, clients, auth.ScopeSend); !ok {
+			return
+		}
+
+		var req UpdateCampaignRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxQueuedBody)).Decode(&req); err != nil {
+			WriteError(rw, http.StatusBadRequest, NewError(err))
+			return
+		}
+
+		c, err := m.Update(r.Context(), chi.URLParam(r, "campaignID"), req.Name, req.Template)
+		if err != nil {
+			writeCampaignError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, c)
+	}
+}
+
+// CampaignPreviewHandler godoc
+// @Tags Campaigns
+// @Summary messages of the first recipients as they will be sent
+// @ID campaignPreview
+// @Produce json
+// @Param campaignID path string true "campaign id"
+// @Param limit query int false "number of recipients, 5 by default"
+// @Success 200 {object} CampaignPreviewResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/campaigns/{campaignID}/preview [get].
+func CampaignPreviewHandler(m *campaign.Manager, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		limit, err := queryLimit(r.URL.Query())
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		if _, ok := checkCampaign(rw, r, m, clients, auth.ScopeRead); !ok {
+			return
+		}
+
+		messages, err := m.Preview(r.Context(), chi.URLParam(r, "campaignID"), limit)
+		if err != nil {
+			writeCampaignError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, CampaignPreviewResponse{Messages: messages})
+	}
+}
+
+// CampaignActionHandler godoc
+// @Tags Campaigns
+// @Summary start, pause, resume or cancel the campaign
+// @Description A draft is started once, every message is validated before.
+// @ID campaignAction
+// @Produce json
+// @Param campaignID path string true "campaign id"
+// @Param action path string true "start, pause, resume or cancel"
+// @Success 200 {object} storage.Campaign
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/campaigns/{campaignID}/{action} [post].
+func CampaignActionHandler(m *campaign.Manager, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if _, ok := checkCampaign(rw, r, m, clients, auth.ScopeSend); !ok {
+			return
+		}
+
+		c, err := m.Do(r.Context(), chi.URLParam(r, "campaignID"), chi.URLParam(r, "action"))
+		if err != nil {
+			writeCampaignError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, c)
+	}
+}
+
+// CampaignReportHandler godoc
+// @Tags Campaigns
+// @Summary csv report of every recipient: status, id_message and error
+// @ID campaignReport
+// @Produce text/csv
+// @Param campaignID path string true "campaign id"
+// @Success 200 {string} string "csv"
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/campaigns/{campaignID}/report [get].
+func CampaignReportHandler(m *campaign.Manager, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "campaignID")
+
+		if _, ok := checkCampaign(rw, r, m, clients, auth.ScopeRead); !ok {
+			return
+		}
+
+		rw.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		rw.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote("campaign-"+id+".csv"))
+		rw.WriteHeader(http.StatusOK)
+
+		if err := m.Report(r.Context(), id, rw); err != nil {
+			logger.Errorln(err)
+		}
+	}
+}
+
+// checkCampaign returns the campaign of the route, it writes an error and returns false unless the identity
+// of the request has the scope on its instance.
+func checkCampaign(rw http.ResponseWriter, r *http.Request, m *campaign.Manager, clients httpclient.Provider,
+	scope auth.Scope) (*storage.Campaign, bool) {
+	c, err := m.Get(r.Context(), chi.URLParam(r, "campaignID"))
+	if err != nil {
+		writeCampaignError(rw, err)
+		return nil, false
+	}
+
+	return c, checkInstance(rw, r, clients, c.IDInstance, scope)
+}
+
+func writeCampaignError(rw http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, ErrFileTooLarge), errors.As(err, &maxErr):
+		WriteError(rw, http.StatusRequestEntityTooLarge, ErrFileTooLarge)
+	case errors.Is(err, campaign.ErrNotFound), errors.Is(err, httpclient.ErrUnknownInstance):
+		WriteError(rw, http.StatusNotFound, err)
+	case errors.Is(err, campaign.ErrStatus):
+		WriteError(rw, http.StatusConflict, err)
+	case errors.Is(err, campaign.ErrInvalid), errors.Is(err, httpclient.ErrInvalidRequest):
+		WriteError(rw, http.StatusBadRequest, err)
+	default:
+		logger.Errorln(err)
+		WriteError(rw, http.StatusInternalServerError, errors.New("internal server error"))
+	}
+}
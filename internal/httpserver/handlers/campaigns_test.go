@@ -0,0 +1,236 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/campaign"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// memCampaigns is an in-memory CampaignStorage.
+type memCampaigns struct {
+	campaigns  map[string]storage.Campaign
+	recipients map[string][]storage.Recipient
+	mu         sync.Mutex
+}
+
+func (f *memCampaigns) SaveCampaign(_ context.Context, c *storage.Campaign, recipients []storage.Recipient) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.campaigns[c.ID] = *c
+	f.recipients[c.ID] = recipients
+
+	return nil
+}
+
+func (f *memCampaigns) UpdateCampaign(_ context.Context, c *storage.Campaign, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if stored, ok := f.campaigns[c.ID]; !ok || stored.Status != status {
+		return storage.ErrNotFound
+	}
+
+	f.campaigns[c.ID] = *c
+
+	return nil
+}
+
+func (f *memCampaigns) GetCampaign(_ context.Context, id string) (*storage.Campaign, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.campaigns[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &c, nil
+}
+
+func (f *memCampaigns) ListCampaigns(context.Context, string, int) ([]storage.Campaign, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	campaigns := []storage.Campaign{}
+	for _, c := range f.campaigns {
+		campaigns = append(campaigns, c)
+	}
+
+	return campaigns, nil
+}
+
+func (f *memCampaigns) ActiveCampaigns(context.Context) ([]storage.Campaign, error) {
+	return nil, nil
+}
+
+func (f *memCampaigns) CampaignProgress(_ context.Context, id string) (map[string]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	progress := make(map[string]int)
+	for _, r := range f.recipients[id] {
+		progress[r.Status]++
+	}
+
+	return progress, nil
+}
+
+func (f *memCampaigns) CampaignRecipients(_ context.Context, id, status string, _ int) ([]storage.Recipient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	recipients := []storage.Recipient{}
+
+	for _, r := range f.recipients[id] {
+		if status == "" || r.Status == status {
+			recipients = append(recipients, r)
+		}
+	}
+
+	return recipients, nil
+}
+
+func (f *memCampaigns) UpdateRecipient(context.Context, *storage.Recipient, string) error {
+	return nil
+}
+
+func (f *memCampaigns) CancelRecipients(context.Context, string, time.Time) error {
+	return nil
+}
+
+func newCampaignServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	clients := httpclient.NewPool("http://127.0.0.1:1", nil, map[string]string{testID: testToken})
+	m := campaign.New(&memCampaigns{
+		campaigns:  make(map[string]storage.Campaign),
+		recipients: make(map[string][]storage.Recipient),
+	}, queue.New(clients))
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/campaigns", handlers.CreateCampaignHandler(m, clients))
+	r.Get("/api/v1/campaigns", handlers.CampaignsHandler(m, clients))
+	r.Get("/api/v1/campaigns/{campaignID}", handlers.CampaignHandler(m, clients))
+	r.Patch("/api/v1/campaigns/{campaignID}", handlers.UpdateCampaignHandler(m, clients))
+	r.Get("/api/v1/campaigns/{campaignID}/preview", handlers.CampaignPreviewHandler(m, clients))
+	r.Get("/api/v1/campaigns/{campaignID}/report", handlers.CampaignReportHandler(m, clients))
+	r.Post("/api/v1/campaigns/{campaignID}/{action}", handlers.CampaignActionHandler(m, clients))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func campaignForm(template, file string) []formField {
+	return []formField{
+		{name: "id_instance", value: testID},
+		{name: "name", value: "orders"},
+		{name: "template", value: template},
+		{name: "file", fileName: "recipients.csv", data: []byte(file)},
+	}
+}
+
+func TestCampaignHandlers(t *testing.T) {
+	ts := newCampaignServer(t)
+
+	status, out := postFormTo(t, ts.Client(), ts.URL+"/api/v1/campaigns",
+		campaignForm("Hello {{name}}", "phone,name\n+7 999 123-45-67,Anna\n12,Bob\n"))
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, storage.CampaignDraft, out["status"])
+	assert.InDelta(t, 2, out["total"], 0)
+
+	id, _ := out["id"].(string)
+	require.NotEmpty(t, id)
+
+	var c storage.Campaign
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodPatch, "/api/v1/campaigns/"+id,
+		`{"template":"Hi {{.name}}!"}`, &c))
+	assert.Equal(t, "Hi {{.name}}!", c.Template)
+	assert.Equal(t, "orders", c.Name)
+
+	var preview handlers.CampaignPreviewResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/campaigns/"+id+"/preview", "", &preview))
+	require.Len(t, preview.Messages, 2)
+	assert.Equal(t, "Hi Anna!", preview.Messages[0].Message)
+	assert.Equal(t, "79991234567@c.us", preview.Messages[0].ChatID)
+	assert.Equal(t, storage.RecipientSkipped, preview.Messages[1].Status)
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodPost, "/api/v1/campaigns/"+id+"/start", "", &c))
+	assert.Equal(t, storage.CampaignRunning, c.Status)
+	assert.Equal(t, map[string]int{storage.RecipientPending: 1, storage.RecipientSkipped: 1}, c.Progress)
+
+	var list handlers.CampaignsResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/campaigns", "", &list))
+	assert.Len(t, list.Campaigns, 1)
+
+	resp, err := ts.Client().Get(ts.URL + "/api/v1/campaigns/" + id + "/report")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	report, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), "campaign-"+id+".csv")
+	assert.Contains(t, string(report), "line,phone,chat_id,status,id_message,error,updated_at\n")
+	assert.Contains(t, string(report), "2,+7 999 123-45-67,79991234567@c.us,pending,")
+}
+
+func TestCampaignHandlers_Errors(t *testing.T) {
+	ts := newCampaignServer(t)
+
+	tests := []struct {
+		name   string
+		fields []formField
+		status int
+	}{
+		{"no file", campaignForm("Hello", "")[:3], http.StatusBadRequest},
+		{"no phone column", campaignForm("Hello", "name\nAnna\n"), http.StatusBadRequest},
+		{"bad template", campaignForm("Hello {{.name", "phone\n79991234567\n"), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, out := postFormTo(t, ts.Client(), ts.URL+"/api/v1/campaigns", tt.fields)
+			assert.Equal(t, tt.status, status)
+			assert.NotEmpty(t, out["error"])
+		})
+	}
+
+	status, out := postFormTo(t, ts.Client(), ts.URL+"/api/v1/campaigns",
+		campaignForm("Hello {{.name}}", "phone\n79991234567\n"))
+	require.Equal(t, http.StatusCreated, status)
+
+	id, _ := out["id"].(string)
+
+	var resp handlers.ErrorResponse
+
+	assert.Equal(t, http.StatusNotFound, getJSON(t, ts, http.MethodGet, "/api/v1/campaigns/unknown", "", &resp))
+	assert.Equal(t, http.StatusConflict, getJSON(t, ts, http.MethodPost, "/api/v1/campaigns/"+id+"/pause", "", &resp))
+	assert.Equal(t, http.StatusBadRequest, getJSON(t, ts, http.MethodPost, "/api/v1/campaigns/"+id+"/launch", "", &resp))
+	// the name field is missing in the row
+	assert.Equal(t, http.StatusBadRequest, getJSON(t, ts, http.MethodPost, "/api/v1/campaigns/"+id+"/start", "", &resp))
+	assert.Equal(t, http.StatusNotFound, getJSON(t, ts, http.MethodGet, "/api/v1/campaigns/unknown/report", "", &resp))
+}
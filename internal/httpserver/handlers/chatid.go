@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/ole-larsen/green-api/internal/chatid"
+)
+
+// ChatIDHandler godoc
+// @Tags Proxy
+// @Summary chat id of a phone number or a chat id typed by the user, the page shows it as a hint
+// @ID chatId
+// @Produce json
+// @Param value query string true "phone number like +7 (999) 123-45-67 or chat id"
+// @Success 200 {object} chatid.ID
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/chatid [get].
+func ChatIDHandler(rw http.ResponseWriter, r *http.Request) {
+	id, err := chatid.Parse(r.URL.Query().Get("value"))
+	if err != nil {
+		WriteError(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	WriteJSON(rw, http.StatusOK, id)
+}
@@ -0,0 +1,39 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+)
+
+func TestChatIDHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   string
+		status int
+	}{
+		{"phone", "+7 (999) 123-45-67", `{"chat_id":"79991234567@c.us","phone":"+79991234567","group":false}`, http.StatusOK},
+		{"group", "120363043968066561@g.us", `{"chat_id":"120363043968066561@g.us","group":true}`, http.StatusOK},
+		{"empty", "", `{"error":"chat id is empty"}`, http.StatusBadRequest},
+		{
+			"letters", "7999abc", `{"error":"invalid chat id: phone \"7999abc\" has unexpected 'a' at position 5"}`,
+			http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			handlers.ChatIDHandler(rw, httptest.NewRequest(http.MethodGet, "/api/v1/chatid?value="+url.QueryEscape(tt.value), nil))
+
+			assert.Equal(t, tt.status, rw.Code)
+			assert.JSONEq(t, tt.want, rw.Body.String())
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+// MaxGroupPictureSize limits pictures uploaded by setGroupPicture.
+const MaxGroupPictureSize = 5 << 20
+
+// GroupPictureHandler godoc
+// @Tags Proxy
+// @Summary upload a jpeg picture of the group and stream it to GREEN-API setGroupPicture
+// @Description Form field groupId must precede the file part.
+// @ID setGroupPicture
+// @Accept  multipart/form-data
+// @Produce json
+// @Param id path string true "idInstance"
+// @Success 200 {object} httpclient.SetGroupPictureResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/v1/instances/{id}/setGroupPicture [post].
+func GroupPictureHandler(clients httpclient.Provider) http.HandlerFunc {
+	const maxSize = MaxGroupPictureSize
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		c, err := clients.Client(chi.URLParam(r, "id"))
+		if err != nil {
+			WriteError(rw, http.StatusNotFound, err)
+			return
+		}
+
+		if r.ContentLength > maxSize+multipartOverhead {
+			WriteError(rw, http.StatusRequestEntityTooLarge, ErrFileTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(rw, r.Body, maxSize+multipartOverhead)
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, errNotMultipart)
+			return
+		}
+
+		in := &httpclient.SetGroupPictureRequest{}
+
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				WriteError(rw, http.StatusBadRequest, errNoFile)
+				return
+			}
+
+			if err != nil {
+				WriteError(rw, http.StatusBadRequest, NewError(err))
+				return
+			}
+
+			if part.FormName() != "file" {
+				if part.FormName() == "groupId" {
+					data, err := io.ReadAll(io.LimitReader(part, 1<<10))
+					if err != nil {
+						WriteError(rw, http.StatusBadRequest, NewError(err))
+						return
+					}
+
+					in.GroupID = strings.TrimSpace(string(data))
+				}
+
+				continue
+			}
+
+			file := &limitedReader{r: part, left: maxSize}
+			br := bufio.NewReaderSize(file, sniffLen)
+
+			head, err := br.Peek(sniffLen)
+			if err != nil && !errors.Is(err, io.EOF) {
+				writeUploadError(rw, err)
+				return
+			}
+
+			// GREEN-API accepts only jpeg group pictures
+			if contentType := http.DetectContentType(head); contentType != "image/jpeg" {
+				WriteError(rw, http.StatusUnsupportedMediaType, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType))
+				return
+			}
+
+			in.File = br
+
+			out, err := c.SetGroupPicture(r.Context(), in)
+			if err != nil {
+				if file.exceeded {
+					err = ErrFileTooLarge
+				}
+
+				writeUploadError(rw, err)
+
+				return
+			}
+
+			WriteJSON(rw, http.StatusOK, out)
+
+			return
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package handlers_test
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+)
+
+const testGroupID = "120363043968066561@g.us"
+
+// jpegHeader is enough for http.DetectContentType to report image/jpeg.
+var jpegHeader = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+
+func TestProxyHandler_GroupMethods(t *testing.T) {
+	tests := []struct {
+		method     string
+		body       string
+		wantCalls  int
+		wantStatus int
+	}{
+		{
+			method:     httpclient.MethodGetGroupData,
+			body:       `{"groupId":"120363043968066561@g.us"}`,
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			method:     httpclient.MethodAddGroupParticipant,
+			body:       `{"groupId":"120363043968066561@g.us","participantChatId":"79876543210@c.us"}`,
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			method:     httpclient.MethodLeaveGroup,
+			body:       `{"groupId":"79876543210@c.us"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			method:     httpclient.MethodSetGroupAdmin,
+			body:       `{"groupId":"120363043968066561@g.us","participantChatId":"120363043968066561@g.us"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			ts, calls := newProxyServer(t, http.StatusOK, `{}`)
+
+			resp, err := ts.Client().Post(ts.URL+"/api/v1/instances/"+testID+"/"+tt.method, "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Len(t, *calls, tt.wantCalls)
+		})
+	}
+}
+
+func newGroupPictureServer(t *testing.T) (*httptest.Server, map[string]string) {
+	t.Helper()
+
+	got := make(map[string]string)
+
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+
+		mr := multipart.NewReader(r.Body, params["boundary"])
+
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+
+			data, err := io.ReadAll(part)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			got[part.FormName()] = string(data)
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_, err = io.WriteString(rw, `{"urlAvatar":"https://pps.whatsapp.net/a.jpg","setGroupPicture":true}`)
+		require.NoError(t, err)
+	}))
+	t.Cleanup(api.Close)
+
+	clients := httpclient.NewPool(api.URL, api.Client(), map[string]string{testID: testToken})
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/instances/{id}/setGroupPicture", handlers.GroupPictureHandler(clients))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts, got
+}
+
+func TestGroupPictureHandler(t *testing.T) {
+	ts, got := newGroupPictureServer(t)
+
+	picture := append(append([]byte{}, jpegHeader...), 1, 2, 3)
+
+	status, out := postFormTo(t, ts.Client(), ts.URL+"/api/v1/instances/"+testID+"/setGroupPicture", []formField{
+		{name: "groupId", value: testGroupID},
+		{name: "file", fileName: "a.jpg", data: picture},
+	})
+	require.Equal(t, http.StatusOK, status, out)
+
+	assert.Equal(t, "https://pps.whatsapp.net/a.jpg", out["urlAvatar"])
+	assert.Equal(t, testGroupID, got["groupId"])
+	assert.Equal(t, string(picture), got["file"])
+}
+
+func TestGroupPictureHandler_Errors(t *testing.T) {
+	picture := append(append([]byte{}, jpegHeader...), 1, 2, 3)
+
+	tests := []struct {
+		name       string
+		wantError  string
+		fields     []formField
+		wantStatus int
+	}{
+		{
+			name: "personal chat",
+			fields: []formField{
+				{name: "groupId", value: "79876543210@c.us"},
+				{name: "file", fileName: "a.jpg", data: picture},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "[httpclient]: invalid request: groupId must end with @g.us",
+		},
+		{
+			name: "png picture",
+			fields: []formField{
+				{name: "groupId", value: testGroupID},
+				{name: "file", fileName: "a.png", data: append(append([]byte{}, pngHeader...), 1, 2, 3)},
+			},
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantError:  "unsupported file type: image/png",
+		},
+		{
+			name:       "no file",
+			fields:     []formField{{name: "groupId", value: testGroupID}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "file is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, got := newGroupPictureServer(t)
+
+			status, out := postFormTo(t, ts.Client(), ts.URL+"/api/v1/instances/"+testID+"/setGroupPicture", tt.fields)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantError, out["error"])
+			assert.Empty(t, got)
+		})
+	}
+}
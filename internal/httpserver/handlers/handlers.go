@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-
-	"github.com/ole-larsen/green-api/internal/httpclient"
 )
 
 type StatusResponse struct {
@@ -52,6 +50,12 @@ func ForbiddenRequest(rw http.ResponseWriter, _ *http.Request) {
 	http.Error(rw, fmt.Sprintf("%d", http.StatusForbidden)+" forbidden", http.StatusForbidden)
 }
 
+func TooLargeRequest(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.Error(rw, fmt.Sprintf("%d", http.StatusRequestEntityTooLarge)+" request entity too large",
+		http.StatusRequestEntityTooLarge)
+}
+
 func InternalServerErrorRequest(rw http.ResponseWriter, _ *http.Request) {
 	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	http.Error(rw, fmt.Sprintf("%d", http.StatusInternalServerError)+" internal server error", http.StatusInternalServerError)
@@ -69,10 +73,20 @@ func InternalServerErrorRequest(rw http.ResponseWriter, _ *http.Request) {
 // @Router / [get].
 func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
-		getSettingsURL := httpclient.APIURL + "/waInstance{{idInstance}}/{{method}}/{{apiTokenInstance}}"
-		getStateInstanceURL := httpclient.APIURL + "/waInstance{{idInstance}}/{{method}}/{{apiTokenInstance}}"
-		postMessageURL := httpclient.APIURL + "/waInstance{{idInstance}}/{{method}}/{{apiTokenInstance}}"
-		postFileURL := httpclient.APIURL + "/waInstance{{idInstance}}/{{method}}/{{apiTokenInstance}}"
+		instancesURL := "/api/v1/instances"
+		getSettingsURL := instancesURL + "/{{idInstance}}/{{method}}"
+		getStateInstanceURL := instancesURL + "/{{idInstance}}/{{method}}"
+		postMessageURL := instancesURL + "/{{idInstance}}/{{method}}"
+		postFileURL := instancesURL + "/{{idInstance}}/{{method}}"
+		uploadFileURL := instancesURL + "/{{idInstance}}/{{method}}"
+		journalURL := instancesURL + "/{{idInstance}}/{{method}}"
+		groupURL := instancesURL + "/{{idInstance}}/{{method}}"
+		scheduledURL := "/api/v1/scheduled"
+		campaignsURL := "/api/v1/campaigns"
+		templatesURL := "/api/v1/templates"
+		chatIDURL := "/api/v1/chatid"
+		registryURL := "/api/v1/registry"
+		meURL := "/api/v1/me"
 
 		template := `<!DOCTYPE html>
 <html lang="en">
@@ -101,7 +115,7 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
             background-color: #f9f9f9;
             word-wrap: break-word;
         }
-        input[type="text"] {
+        input[type="text"], input[type="password"], input[type="datetime-local"], select {
             width: 100%;
             margin-bottom: 10px;
             padding: 8px;
@@ -120,81 +134,290 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
         button:hover {
             background-color: #0056b3;
         }
+        input[type="file"], progress {
+            width: 100%;
+            margin-bottom: 10px;
+        }
+        input[type="number"] {
+            width: 100%;
+            margin-bottom: 10px;
+            padding: 8px;
+            box-sizing: border-box;
+        }
+        .conversation {
+            display: flex;
+            flex-direction: column;
+            gap: 8px;
+            margin-top: 10px;
+        }
+        .message {
+            max-width: 70%;
+            padding: 8px 10px;
+            border-radius: 8px;
+            white-space: pre-wrap;
+        }
+        .message.incoming {
+            align-self: flex-start;
+            background-color: #ffffff;
+            border: 1px solid #ddd;
+        }
+        .message.outgoing {
+            align-self: flex-end;
+            background-color: #dcf8c6;
+        }
+        .message .meta {
+            font-size: 11px;
+            color: #777;
+            margin-bottom: 4px;
+        }
+        .message img {
+            max-width: 100%;
+        }
+        .hint {
+            display: block;
+            margin: -6px 0 10px;
+            font-size: 12px;
+            color: #555;
+        }
+        .hint.error {
+            color: #c00;
+        }
     </style>
 </head>
 <body>
     <h1>Web Interface</h1>
+    <form id="logout" class="form-section" method="post" action="/logout" hidden>
+        <span id="username"></span>
+        <button type="submit">sign out</button>
+    </form>
     <div class="container">
         <div class="form-section">
-            <input type="text" id="idInstance" placeholder="idInstance">
-            <input type="text" id="apiTokenInstance" placeholder="ApiTokenInstance">
+            <select id="idInstance"></select>
+            <input type="text" id="instanceName" placeholder="Instance name, e.g. sales">
+            <input type="text" id="instanceIdInstance" placeholder="idInstance">
+            <input type="password" id="instanceToken" placeholder="apiTokenInstance" autocomplete="off">
+            <button id="saveInstance">save instance</button>
+            <button id="deleteInstance">delete selected instance</button>
             <button id="getSettings">getSettings</button>
             <button id="getStateInstance">getStateInstance</button>
             
             <input type="text" id="chatId" placeholder="Chat ID">
+            <select id="messageTemplate">
+                <option value="">no template, type the message</option>
+            </select>
+            <div id="templateVariables"></div>
             <input type="text" id="chatMessage" placeholder="Message">
+            <label><input type="checkbox" id="sendLater"> send later</label>
+            <input type="datetime-local" id="sendAt">
+            <input type="text" id="sendTimezone" placeholder="Timezone, e.g. Europe/Moscow">
             <button id="sendMessage">sendMessage</button>
+            <button id="scheduledMessages">scheduled messages</button>
+            <input type="text" id="scheduledId" placeholder="Scheduled message ID">
+            <button id="rescheduleMessage">reschedule</button>
+            <button id="cancelScheduled">cancel scheduled</button>
+            <input type="text" id="templateName" placeholder="Template name">
+            <input type="text" id="templateBody" placeholder="Template, e.g. Hello {{name}}">
+            <button id="saveTemplate">save template</button>
+            <button id="deleteTemplate">delete selected template</button>
             
             <input type="text" id="fileChatId" placeholder="Chat ID">
             <input type="text" id="fileUrl" placeholder="File URL">
             <button id="sendFileByUrl">sendFileByUrl</button>
+
+            <input type="text" id="uploadChatId" placeholder="Chat ID">
+            <input type="text" id="uploadCaption" placeholder="Caption">
+            <input type="file" id="uploadFile">
+            <progress id="uploadProgress" value="0" max="100"></progress>
+            <button id="sendFileByUpload">sendFileByUpload</button>
+
+            <input type="text" id="historyChatId" placeholder="Chat ID">
+            <input type="number" id="historyCount" placeholder="Count" value="20" min="1">
+            <button id="getChatHistory">getChatHistory</button>
+            <input type="text" id="historyIdMessage" placeholder="Message ID">
+            <button id="getMessage">getMessage</button>
+            <button id="lastIncomingMessages">lastIncomingMessages</button>
+            <button id="lastOutgoingMessages">lastOutgoingMessages</button>
+
+            <input type="text" id="groupName" placeholder="Group name">
+            <input type="text" id="groupChatIds" placeholder="Participant chat IDs, comma separated">
+            <button id="createGroup">createGroup</button>
+            <input type="text" id="groupId" placeholder="Group ID (...@g.us)">
+            <button id="getGroupData">getGroupData</button>
+            <button id="updateGroupName">updateGroupName</button>
+            <input type="text" id="groupParticipant" placeholder="Participant chat ID">
+            <button id="addGroupParticipant">addGroupParticipant</button>
+            <button id="removeGroupParticipant">removeGroupParticipant</button>
+            <button id="setGroupAdmin">setGroupAdmin</button>
+            <button id="removeAdmin">removeAdmin</button>
+            <input type="file" id="groupPicture" accept="image/jpeg">
+            <button id="setGroupPicture">setGroupPicture</button>
+            <button id="leaveGroup">leaveGroup</button>
+
+            <input type="text" id="campaignName" placeholder="Campaign name">
+            <input type="text" id="campaignTemplate" placeholder="Template, e.g. Hello {{name}}">
+            <input type="file" id="campaignFile" accept=".csv,text/csv">
+            <button id="createCampaign">create campaign</button>
+            <input type="text" id="campaignId" placeholder="Campaign ID">
+            <button id="previewCampaign">preview</button>
+            <button id="startCampaign">start</button>
+            <button id="pauseCampaign">pause</button>
+            <button id="resumeCampaign">resume</button>
+            <button id="cancelCampaign">cancel campaign</button>
+            <button id="campaignProgress">progress</button>
+            <button id="campaignReport">download report</button>
         </div>
-        <div class="output-section" id="output">
-            <pre>{ "idMessage": "" }</pre>
+        <div class="output-section">
+            <div id="output">
+                <pre>{}</pre>
+            </div>
+            <div class="conversation" id="conversation"></div>
         </div>
     </div>
     <script>
-		async function getData(url) {
-			try {
-				const response = await fetch(url);
-				if (!response.ok) {
-					throw new Error('Response status: ' + response.status);
+		async function readResponse(response) {
+			// the session is over, sign in again and come back
+			if (response.status === 401) {
+				window.location.href = '/login?next=' + encodeURIComponent(window.location.pathname);
+			}
+			if (!response.ok) {
+				let reason = '';
+				try {
+					reason = (await response.json()).error;
+				} catch (e) {
+					reason = '';
 				}
-				return await response.json()
-			} catch (e) {
-				throw e;
+				throw new Error('Response status: ' + response.status + (reason ? ': ' + reason : ''));
 			}
+			return await response.json()
+		}
+		async function getData(url) {
+			const response = await fetch(url);
+			return readResponse(response);
+		}
+		async function sendData(url, body, method = 'POST') {
+			const response = await fetch(url, {
+				method,
+				headers: {'Content-Type': 'application/json'},
+				body: JSON.stringify(body),
+			});
+			return readResponse(response);
 		}
-		async function sendData(url, body) {
-			try {
-				const response = await fetch(url, {
-					method: 'POST',
-  					body: JSON.stringify(body),
+		// the user is shown when the server requires sign in
+		getData('` + meURL + `').then(me => {
+			document.getElementById('username').textContent = 'signed in as ' + me.username;
+			document.getElementById('logout').hidden = false;
+		}).catch(() => {});
+		// registered instances are picked by name, their tokens stay on the server
+		let registered = {};
+		function loadInstances(selected = '') {
+			Promise.all([
+				getData('` + instancesURL + `'),
+				getData('` + registryURL + `').catch(() => ({instances: []})),
+			]).then(([response, registry]) => {
+				const select = document.getElementById('idInstance');
+				select.replaceChildren();
+				registered = {};
+				(registry.instances || []).forEach(i => { registered[i.name] = i; });
+				(response.instances || []).forEach(id => {
+					const option = document.createElement('option');
+					option.value = id;
+					option.textContent = registered[id] ? id + ' (' + registered[id].id_instance + ')' : id;
+					select.appendChild(option);
 				});
-				if (!response.ok) {
-					throw new Error('Response status: ' + response.status);
+				if (selected !== '') {
+					select.value = selected;
 				}
-				return await response.json()
-			} catch (e) {
-				throw e;
+			}).catch(e => {
+				document.getElementById('output').innerHTML = "<pre>" + formatOutput(e.message) + "</pre>";
+			});
+		}
+		loadInstances();
+		document.getElementById('saveInstance').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			const name = document.getElementById('instanceName').value,
+				id_instance = document.getElementById('instanceIdInstance').value,
+				token = document.getElementById('instanceToken');
+
+			if (name === '') {
+				showOutput('Please fill instance name!');
+				return;
 			}
+
+			// a registered instance keeps its token unless a new one is typed
+			const save = registered[name]
+				? sendData('` + registryURL + `/' + encodeURIComponent(name), {id_instance, api_token_instance: token.value}, 'PATCH')
+				: sendData('` + registryURL + `', {name, id_instance, api_token_instance: token.value});
+
+			save.then(response => {
+				token.value = '';
+				loadInstances(response.name);
+				showOutput(response);
+			}).catch(showError);
+		});
+		document.getElementById('deleteInstance').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			const name = document.getElementById('idInstance').value;
+
+			if (!registered[name]) {
+				showOutput('Please select a registered instance!');
+				return;
+			}
+
+			fetch('` + registryURL + `/' + encodeURIComponent(name), {method: 'DELETE'})
+				.then(response => {
+					if (!response.ok) {
+						return readResponse(response);
+					}
+					loadInstances();
+					showOutput('instance ' + name + ' deleted');
+				})
+				.catch(showError);
+		});
+		// phone numbers typed into chat id fields are shown as the chat id the server sends to
+		['chatId', 'fileChatId', 'uploadChatId', 'historyChatId', 'groupParticipant'].forEach(id => {
+			const input = document.getElementById(id),
+				hint = document.createElement('small');
+
+			hint.className = 'hint';
+			input.after(hint);
+			input.addEventListener('change', () => {
+				if (input.value === '') {
+					hint.textContent = '';
+					return;
+				}
+
+				fetch('` + chatIDURL + `?value=' + encodeURIComponent(input.value))
+					.then(response => response.json())
+					.then(response => {
+						hint.classList.toggle('error', !!response.error);
+						hint.textContent = response.error || (response.chat_id === input.value ? '' : '→ ' + response.chat_id);
+					})
+					.catch(() => { hint.textContent = ''; });
+			});
+		});
+		// messages are scheduled in the browser timezone unless another one is given
+		document.getElementById('sendTimezone').value = Intl.DateTimeFormat().resolvedOptions().timeZone || '';
+		// instances are picked by idInstance or by registered name
+		function isInstance(val) {
+			return /^(\d+|[A-Za-z][A-Za-z0-9_.-]*)$/.test(val);
 		}
-		function getRandomInt(min, max) {
-			min = Math.ceil(min);
-			max = Math.floor(max);
-			return Math.floor(Math.random() * (max - min + 1)) + min;
+		function escapeHTML(text) {
+			const div = document.createElement('div');
+			div.textContent = text;
+			return div.innerHTML;
 		}
-		function isNumber(val) {
-			return /^\d+$/.test(val);
-		} 
-		function formatOutput(message, chatId = '') {
-			const idMessage = "GeneratedMessageId" + getRandomInt(1, 1000000);
-			chatId = chatId ? chatId : "chatId" + getRandomInt(1, 1000000);
-			return JSON.stringify({
-				idMessage,
-				chatId,
-				message
-			}, null, 4);
+		function formatOutput(message) {
+			return escapeHTML(typeof message === 'string' ? message : JSON.stringify(message, null, 4));
 		}
-		function checkErrors(id, token, chatId = null, chatMessage = null, fileUrl = null) {
+		function checkErrors(id, chatId = null, chatMessage = null, fileUrl = null) {
 			let message = '';
 			if (!id) {
-			    message = 'Please fill in idInstance!';
-			} else  if (!token) {
-			    message = 'Please fill in apiTokenInstance!';
+			    message = 'Please select idInstance!';
 			}
 
-			if (!isNumber(id)) {
+			if (!isInstance(id)) {
     			message = 'idInstance is incorrect!';
 			}
 			if (chatId !== null && chatId === '') {
@@ -214,8 +437,7 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 			e.preventDefault();
 
 			let idInstance = document.getElementById('idInstance').value,
-				apiTokenInstance = document.getElementById('apiTokenInstance').value,
-			    message = checkErrors(idInstance, apiTokenInstance);
+			    message = checkErrors(idInstance);
 
 			if (message !== '') {
 				document.getElementById('output').innerHTML = "<pre>" + formatOutput(message) + "</pre>";
@@ -224,10 +446,8 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 			
 			const getSettingsUrl = '` + getSettingsURL + `'
 				.replace("{{idInstance}}", idInstance)
-				.replace("{{method}}", "getSettings")
-				.replace("{{apiTokenInstance}}", apiTokenInstance);
+				.replace("{{method}}", "getSettings");
 
-					
 			getData(getSettingsUrl).then(response => {
 				document.getElementById('output').innerHTML = "<pre>" + formatOutput(response) + "</pre>";
 			}).catch(e => {
@@ -239,8 +459,7 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 			e.preventDefault();
 
 			let idInstance = document.getElementById('idInstance').value,
-				apiTokenInstance = document.getElementById('apiTokenInstance').value,
-			    message = checkErrors(idInstance, apiTokenInstance);
+			    message = checkErrors(idInstance);
 
 			if (message !== '') {
 				document.getElementById('output').innerHTML = "<pre>" + formatOutput(message) + "</pre>";
@@ -249,8 +468,7 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 			
 			const getStateInstance = '` + getStateInstanceURL + `'
 				.replace("{{idInstance}}", idInstance)
-				.replace("{{method}}", "getStateInstance")
-				.replace("{{apiTokenInstance}}", apiTokenInstance);
+				.replace("{{method}}", "getStateInstance");
 
 			getData(getStateInstance).then(response => {
 				document.getElementById('output').innerHTML = "<pre>" + formatOutput(response) + "</pre>";
@@ -258,15 +476,91 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 				document.getElementById('output').innerHTML = "<pre>" + formatOutput(e.message) + "</pre>";
 			});
         });
+		// templates are kept in the database, the picker stays empty without it
+		let messageTemplates = {};
+		function loadTemplates(selected = '') {
+			getData('` + templatesURL + `').then(response => {
+				const select = document.getElementById('messageTemplate');
+				select.replaceChildren(select.options[0]);
+				messageTemplates = {};
+				(response.templates || []).forEach(t => {
+					const option = document.createElement('option');
+					option.value = t.id;
+					option.textContent = t.name;
+					select.appendChild(option);
+					messageTemplates[t.id] = t;
+				});
+				select.value = selected;
+				showVariables();
+			}).catch(() => {});
+		}
+		function showVariables() {
+			const t = messageTemplates[document.getElementById('messageTemplate').value],
+				div = document.getElementById('templateVariables');
+
+			div.replaceChildren();
+			document.getElementById('chatMessage').disabled = !!t;
+
+			(t ? t.variables : []).forEach(name => {
+				const input = document.createElement('input');
+				input.type = 'text';
+				input.placeholder = name;
+				input.dataset.variable = name;
+				div.appendChild(input);
+			});
+		}
+		function templateVariables() {
+			const variables = {};
+			document.querySelectorAll('#templateVariables input').forEach(input => {
+				variables[input.dataset.variable] = input.value;
+			});
+			return variables;
+		}
+		loadTemplates();
+		document.getElementById('messageTemplate').addEventListener('change', showVariables);
+		document.getElementById('saveTemplate').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			const name = document.getElementById('templateName').value,
+				body = document.getElementById('templateBody').value;
+
+			if (name === '' || body === '') {
+				showOutput('Please fill template name and text!');
+				return;
+			}
+
+			sendData('` + templatesURL + `', {name, body}).then(response => {
+				loadTemplates(response.id);
+				showOutput(response);
+			}).catch(showError);
+		});
+		document.getElementById('deleteTemplate').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			const id = document.getElementById('messageTemplate').value;
+
+			if (id === '') {
+				showOutput('Please select template!');
+				return;
+			}
+
+			fetch('` + templatesURL + `/' + encodeURIComponent(id), {method: 'DELETE'}).then(response => {
+				if (!response.ok) {
+					return readResponse(response);
+				}
+				loadTemplates();
+				showOutput('template deleted');
+			}).catch(showError);
+		});
 		document.getElementById('sendMessage').addEventListener('click', (e) => {
             
 			e.preventDefault();
 
 			let idInstance = document.getElementById('idInstance').value,
-				apiTokenInstance = document.getElementById('apiTokenInstance').value,
 				chatId = document.getElementById('chatId').value,
 				chatMessage = document.getElementById('chatMessage').value,
-			    message = checkErrors(idInstance, apiTokenInstance, chatId, chatMessage);
+				templateId = document.getElementById('messageTemplate').value,
+			    message = checkErrors(idInstance, chatId, templateId === '' ? chatMessage : null);
 
 			if (message !== '') {
 				document.getElementById('output').innerHTML = "<pre>" + formatOutput(message) + "</pre>";
@@ -275,12 +569,35 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 			
 			const sendMessageUrl = '` + postMessageURL + `'
 				.replace("{{idInstance}}", idInstance)
-				.replace("{{method}}", "sendMessage")
-				.replace("{{apiTokenInstance}}", apiTokenInstance);
+				.replace("{{method}}", "sendMessage");
 
-			const body = {
-				chatId,
-				message: chatMessage
+			const body = templateId === ''
+				? {chatId, message: chatMessage}
+				: {chatId, templateId, variables: templateVariables()};
+
+			if (document.getElementById('sendLater').checked) {
+				const sendAt = document.getElementById('sendAt').value,
+					timezone = document.getElementById('sendTimezone').value;
+
+				if (sendAt === '') {
+					showOutput('Please fill send time!');
+					return;
+				}
+
+				// scheduled messages keep the text, the template is rendered now
+				const payload = templateId === ''
+					? Promise.resolve(body)
+					: sendData('` + templatesURL + `/' + encodeURIComponent(templateId) + '/render', {variables: body.variables})
+						.then(response => ({chatId, message: response.message}));
+
+				payload
+					.then(payload => sendData('` + scheduledURL + `', {id_instance: idInstance, send_at: sendAt, timezone, payload}))
+					.then(response => {
+						document.getElementById('scheduledId').value = response.id;
+						showOutput(response);
+					})
+					.catch(showError);
+				return;
 			}
 		
 			sendData(sendMessageUrl, body).then(response => {
@@ -295,10 +612,9 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 			e.preventDefault();
 
 			let idInstance = document.getElementById('idInstance').value,
-				apiTokenInstance = document.getElementById('apiTokenInstance').value,
 				chatId = document.getElementById('fileChatId').value,
 				urlFile = document.getElementById('fileUrl').value,
-			    message = checkErrors(idInstance, apiTokenInstance, chatId, null, urlFile);
+			    message = checkErrors(idInstance, chatId, null, urlFile);
 
 			if (message !== '') {
 				document.getElementById('output').innerHTML = "<pre>" + formatOutput(message) + "</pre>";
@@ -307,8 +623,7 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 			
 			const sendFileUrl = '` + postFileURL + `'
 				.replace("{{idInstance}}", idInstance)
-				.replace("{{method}}", "sendFileByUrl")
-				.replace("{{apiTokenInstance}}", apiTokenInstance);
+				.replace("{{method}}", "sendFileByUrl");
 
 			const parts = urlFile.split("/")	
 			const filename = parts[parts.length-1];
@@ -325,6 +640,477 @@ func HTMLHandler(_ chan struct{}) http.HandlerFunc {
 				document.getElementById('output').innerHTML = "<pre>" + formatOutput(e.message) + "</pre>";
 			});
 
+        });
+		function messageContent(m) {
+			const content = document.createElement('div');
+			const link = (href, text) => {
+				const a = document.createElement('a');
+				a.href = href;
+				a.target = '_blank';
+				a.rel = 'noopener noreferrer';
+				a.textContent = text;
+				return a;
+			};
+			switch (m.typeMessage) {
+			case 'textMessage':
+				content.textContent = m.textMessage || '';
+				break;
+			case 'extendedTextMessage':
+			case 'quotedMessage':
+				content.textContent = (m.extendedTextMessage && m.extendedTextMessage.text) || m.textMessage || '';
+				break;
+			case 'imageMessage':
+				if (m.downloadUrl) {
+					const img = document.createElement('img');
+					img.src = m.downloadUrl;
+					img.alt = m.caption || '';
+					content.appendChild(img);
+				}
+				if (m.caption) {
+					content.appendChild(document.createTextNode(m.caption));
+				}
+				break;
+			case 'videoMessage':
+			case 'audioMessage':
+			case 'documentMessage':
+				content.appendChild(link(m.downloadUrl || '#', m.fileName || m.typeMessage));
+				if (m.caption) {
+					content.appendChild(document.createTextNode(' ' + m.caption));
+				}
+				break;
+			case 'locationMessage':
+				if (m.location) {
+					const name = m.location.nameLocation || (m.location.latitude + ', ' + m.location.longitude);
+					content.appendChild(link('https://maps.google.com/?q=' + m.location.latitude + ',' + m.location.longitude, name));
+				}
+				break;
+			case 'contactMessage':
+				content.textContent = 'Contact: ' + ((m.contact && m.contact.displayName) || '');
+				break;
+			case 'pollMessage':
+				if (m.pollMessageData) {
+					const options = (m.pollMessageData.options || []).map(o => '- ' + o.optionName).join('\n');
+					content.textContent = 'Poll: ' + m.pollMessageData.name + '\n' + options;
+				}
+				break;
+			case 'reactionMessage':
+				content.textContent = 'Reaction: ' + (m.textMessage || '');
+				break;
+			default:
+				content.textContent = m.textMessage || m.typeMessage;
+			}
+			return content;
+		}
+		function renderMessages(messages) {
+			const conversation = document.getElementById('conversation');
+			conversation.replaceChildren();
+			(messages || [])
+				.slice()
+				.sort((a, b) => a.timestamp - b.timestamp)
+				.forEach(m => {
+					const item = document.createElement('div');
+					item.className = 'message ' + (m.type === 'outgoing' ? 'outgoing' : 'incoming');
+					const meta = document.createElement('div');
+					meta.className = 'meta';
+					meta.textContent = [
+						m.type === 'outgoing' ? 'me' : (m.senderName || m.senderId || m.chatId),
+						new Date(m.timestamp * 1000).toLocaleString(),
+						m.statusMessage || '',
+					].filter(Boolean).join(' · ');
+					item.appendChild(meta);
+					item.appendChild(messageContent(m));
+					conversation.appendChild(item);
+				});
+			document.getElementById('output').innerHTML = "<pre>" + formatOutput((messages || []).length + ' messages') + "</pre>";
+		}
+		function showError(e) {
+			document.getElementById('conversation').replaceChildren();
+			document.getElementById('output').innerHTML = "<pre>" + formatOutput(e.message) + "</pre>";
+		}
+		function journalUrl(idInstance, method) {
+			return '` + journalURL + `'
+				.replace("{{idInstance}}", idInstance)
+				.replace("{{method}}", method);
+		}
+		document.getElementById('getChatHistory').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let idInstance = document.getElementById('idInstance').value,
+				chatId = document.getElementById('historyChatId').value,
+				count = parseInt(document.getElementById('historyCount').value, 10) || 0,
+			    message = checkErrors(idInstance, chatId);
+
+			if (message !== '') {
+				document.getElementById('output').innerHTML = "<pre>" + formatOutput(message) + "</pre>";
+				return;
+			}
+
+			sendData(journalUrl(idInstance, 'getChatHistory'), {chatId, count}).then(renderMessages).catch(showError);
+		});
+		document.getElementById('getMessage').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let idInstance = document.getElementById('idInstance').value,
+				chatId = document.getElementById('historyChatId').value,
+				idMessage = document.getElementById('historyIdMessage').value,
+			    message = checkErrors(idInstance, chatId);
+
+			if (message === '' && idMessage === '') {
+				message = 'Please fill message ID!';
+			}
+
+			if (message !== '') {
+				document.getElementById('output').innerHTML = "<pre>" + formatOutput(message) + "</pre>";
+				return;
+			}
+
+			sendData(journalUrl(idInstance, 'getMessage'), {chatId, idMessage}).then(m => renderMessages([m])).catch(showError);
+		});
+		['lastIncomingMessages', 'lastOutgoingMessages'].forEach(method => {
+			document.getElementById(method).addEventListener('click', (e) => {
+				e.preventDefault();
+
+				let idInstance = document.getElementById('idInstance').value,
+				    message = checkErrors(idInstance);
+
+				if (message !== '') {
+					document.getElementById('output').innerHTML = "<pre>" + formatOutput(message) + "</pre>";
+					return;
+				}
+
+				getData(journalUrl(idInstance, method)).then(renderMessages).catch(showError);
+			});
+		});
+		function scheduledUrl(id) {
+			return '` + scheduledURL + `/' + encodeURIComponent(id);
+		}
+		document.getElementById('scheduledMessages').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let idInstance = document.getElementById('idInstance').value,
+			    message = checkErrors(idInstance);
+
+			if (message !== '') {
+				showOutput(message);
+				return;
+			}
+
+			getData('` + scheduledURL + `?status=scheduled&instance=' + idInstance).then(showOutput).catch(showError);
+		});
+		document.getElementById('rescheduleMessage').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let id = document.getElementById('scheduledId').value,
+				sendAt = document.getElementById('sendAt').value,
+				timezone = document.getElementById('sendTimezone').value;
+
+			if (id === '') {
+				showOutput('Please fill scheduled message ID!');
+				return;
+			}
+
+			if (sendAt === '' && timezone === '') {
+				showOutput('Please fill send time or timezone!');
+				return;
+			}
+
+			sendData(scheduledUrl(id), {send_at: sendAt, timezone}, 'PATCH').then(showOutput).catch(showError);
+		});
+		document.getElementById('cancelScheduled').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let id = document.getElementById('scheduledId').value;
+
+			if (id === '') {
+				showOutput('Please fill scheduled message ID!');
+				return;
+			}
+
+			fetch(scheduledUrl(id), {method: 'DELETE'})
+				.then(readResponse)
+				.then(showOutput)
+				.catch(showError);
+		});
+		function campaignUrl(id, action = '') {
+			return '` + campaignsURL + `/' + encodeURIComponent(id) + (action ? '/' + action : '');
+		}
+		function campaignID() {
+			const id = document.getElementById('campaignId').value;
+			if (id === '') {
+				showOutput('Please fill campaign ID!');
+			}
+			return id;
+		}
+		document.getElementById('createCampaign').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let idInstance = document.getElementById('idInstance').value,
+				name = document.getElementById('campaignName').value,
+				template = document.getElementById('campaignTemplate').value,
+				file = document.getElementById('campaignFile').files[0],
+			    message = checkErrors(idInstance);
+
+			if (message === '' && template === '') {
+				message = 'Please fill template!';
+			}
+
+			if (message === '' && !file) {
+				message = 'Please choose csv file!';
+			}
+
+			if (message !== '') {
+				showOutput(message);
+				return;
+			}
+
+			// fields go before the file, the server reads recipients as soon as it is reached
+			const form = new FormData();
+			form.append('id_instance', idInstance);
+			form.append('name', name);
+			form.append('template', template);
+			form.append('file', file);
+
+			fetch('` + campaignsURL + `', {method: 'POST', body: form})
+				.then(readResponse)
+				.then(response => {
+					document.getElementById('campaignId').value = response.id;
+					showOutput(response);
+				})
+				.catch(showError);
+		});
+		document.getElementById('previewCampaign').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			const id = campaignID();
+			if (id !== '') {
+				getData(campaignUrl(id, 'preview')).then(showOutput).catch(showError);
+			}
+		});
+		// progress is refreshed while the campaign is running or its messages are in the queue
+		let campaignTimer = null;
+		function watchCampaign(id) {
+			clearTimeout(campaignTimer);
+			getData(campaignUrl(id)).then(campaign => {
+				showOutput(campaign);
+				if (campaign.status === 'running' || (campaign.progress || {}).queued > 0) {
+					campaignTimer = setTimeout(() => watchCampaign(id), 2000);
+				}
+			}).catch(showError);
+		}
+		['start', 'pause', 'resume', 'cancel'].forEach(action => {
+			const button = action === 'cancel' ? 'cancelCampaign' : action + 'Campaign';
+			document.getElementById(button).addEventListener('click', (e) => {
+				e.preventDefault();
+
+				const id = campaignID();
+				if (id !== '') {
+					sendData(campaignUrl(id, action), {}).then(() => watchCampaign(id)).catch(showError);
+				}
+			});
+		});
+		document.getElementById('campaignProgress').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			const id = campaignID();
+			if (id !== '') {
+				watchCampaign(id);
+			}
+		});
+		document.getElementById('campaignReport').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			const id = campaignID();
+			if (id !== '') {
+				window.location.href = campaignUrl(id, 'report');
+			}
+		});
+		function groupUrl(idInstance, method) {
+			return '` + groupURL + `'
+				.replace("{{idInstance}}", idInstance)
+				.replace("{{method}}", method);
+		}
+		function showOutput(output) {
+			document.getElementById('output').innerHTML = "<pre>" + formatOutput(output) + "</pre>";
+		}
+		// checkGroup validates the selected instance and the group id, group chats end with @g.us
+		function checkGroup(idInstance, groupId) {
+			let message = checkErrors(idInstance);
+			if (message === '' && !groupId.endsWith('@g.us')) {
+				message = 'Group ID must end with @g.us!';
+			}
+			return message;
+		}
+		function groupParticipants() {
+			return document.getElementById('groupChatIds').value
+				.split(',')
+				.map(id => id.trim())
+				.filter(id => id !== '');
+		}
+		document.getElementById('createGroup').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let idInstance = document.getElementById('idInstance').value,
+				groupName = document.getElementById('groupName').value,
+				chatIds = groupParticipants(),
+			    message = checkErrors(idInstance);
+
+			if (message === '' && groupName === '') {
+				message = 'Please fill group name!';
+			}
+
+			if (message === '' && chatIds.length === 0) {
+				message = 'Please fill participant chat IDs!';
+			}
+
+			if (message === '' && chatIds.some(id => !id.endsWith('@c.us'))) {
+				message = 'Participant chat IDs must end with @c.us!';
+			}
+
+			if (message !== '') {
+				showOutput(message);
+				return;
+			}
+
+			sendData(groupUrl(idInstance, 'createGroup'), {groupName, chatIds}).then(showOutput).catch(showError);
+		});
+		['getGroupData', 'leaveGroup'].forEach(method => {
+			document.getElementById(method).addEventListener('click', (e) => {
+				e.preventDefault();
+
+				let idInstance = document.getElementById('idInstance').value,
+					groupId = document.getElementById('groupId').value,
+				    message = checkGroup(idInstance, groupId);
+
+				if (message !== '') {
+					showOutput(message);
+					return;
+				}
+
+				sendData(groupUrl(idInstance, method), {groupId}).then(showOutput).catch(showError);
+			});
+		});
+		document.getElementById('updateGroupName').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let idInstance = document.getElementById('idInstance').value,
+				groupId = document.getElementById('groupId').value,
+				groupName = document.getElementById('groupName').value,
+			    message = checkGroup(idInstance, groupId);
+
+			if (message === '' && groupName === '') {
+				message = 'Please fill group name!';
+			}
+
+			if (message !== '') {
+				showOutput(message);
+				return;
+			}
+
+			sendData(groupUrl(idInstance, 'updateGroupName'), {groupId, groupName}).then(showOutput).catch(showError);
+		});
+		['addGroupParticipant', 'removeGroupParticipant', 'setGroupAdmin', 'removeAdmin'].forEach(method => {
+			document.getElementById(method).addEventListener('click', (e) => {
+				e.preventDefault();
+
+				let idInstance = document.getElementById('idInstance').value,
+					groupId = document.getElementById('groupId').value,
+					participantChatId = document.getElementById('groupParticipant').value,
+				    message = checkGroup(idInstance, groupId);
+
+				if (message === '' && !participantChatId.endsWith('@c.us')) {
+					message = 'Participant chat ID must end with @c.us!';
+				}
+
+				if (message !== '') {
+					showOutput(message);
+					return;
+				}
+
+				sendData(groupUrl(idInstance, method), {groupId, participantChatId}).then(showOutput).catch(showError);
+			});
+		});
+		document.getElementById('setGroupPicture').addEventListener('click', (e) => {
+			e.preventDefault();
+
+			let idInstance = document.getElementById('idInstance').value,
+				groupId = document.getElementById('groupId').value,
+				file = document.getElementById('groupPicture').files[0],
+			    message = checkGroup(idInstance, groupId);
+
+			if (message === '' && !file) {
+				message = 'Please choose jpeg picture!';
+			}
+
+			if (message !== '') {
+				showOutput(message);
+				return;
+			}
+
+			const form = new FormData();
+			form.append('groupId', groupId);
+			form.append('file', file);
+
+			fetch(groupUrl(idInstance, 'setGroupPicture'), {method: 'POST', body: form})
+				.then(readResponse)
+				.then(showOutput)
+				.catch(showError);
+		});
+        document.getElementById('sendFileByUpload').addEventListener('click', (e) => {
+
+			e.preventDefault();
+
+			let idInstance = document.getElementById('idInstance').value,
+				chatId = document.getElementById('uploadChatId').value,
+				caption = document.getElementById('uploadCaption').value,
+				file = document.getElementById('uploadFile').files[0],
+			    message = checkErrors(idInstance, chatId);
+
+			if (message === '' && !file) {
+				message = 'Please choose file!';
+			}
+
+			if (message !== '') {
+				document.getElementById('output').innerHTML = "<pre>" + formatOutput(message) + "</pre>";
+				return;
+			}
+
+			const uploadUrl = '` + uploadFileURL + `'
+				.replace("{{idInstance}}", idInstance)
+				.replace("{{method}}", "sendFileByUpload");
+
+			// fields go before the file, the server streams the file as soon as it is reached
+			const form = new FormData();
+			form.append('chatId', chatId);
+			form.append('fileName', file.name);
+			form.append('caption', caption);
+			form.append('file', file);
+
+			const progress = document.getElementById('uploadProgress');
+			progress.value = 0;
+
+			const xhr = new XMLHttpRequest();
+			xhr.open('POST', uploadUrl);
+			xhr.upload.onprogress = (event) => {
+				if (event.lengthComputable) {
+					progress.value = Math.round(event.loaded * 100 / event.total);
+				}
+			};
+			xhr.onload = () => {
+				let response = {};
+				try {
+					response = JSON.parse(xhr.responseText);
+				} catch (e) {
+					response = {};
+				}
+				const output = xhr.status === 200
+					? response
+					: 'Response status: ' + xhr.status + (response.error ? ': ' + response.error : '');
+				document.getElementById('output').innerHTML = "<pre>" + formatOutput(output) + "</pre>";
+			};
+			xhr.onerror = () => {
+				document.getElementById('output').innerHTML = "<pre>" + formatOutput('upload failed') + "</pre>";
+			};
+			xhr.send(form);
         });
     </script>
 </body>
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/instances"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// maxInstanceBody limits the body of registry requests, they carry a name, an id and a token.
+const maxInstanceBody = 64 << 10
+
+type RegistryResponse struct {
+	Instances []storage.Instance `json:"instances"`
+}
+
+// CreateInstanceHandler godoc
+// @Tags Registry
+// @Summary register an instance under a name, the token is stored encrypted and is never returned
+// @ID createInstance
+// @Accept  json
+// @Produce json
+// @Param request body instances.Request true "name, id_instance and api_token_instance"
+// @Success 201 {object} storage.Instance
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/registry [post].
+func CreateInstanceHandler(registry *instances.Registry) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, err := readInstanceRequest(r)
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		i, err := registry.Create(r.Context(), req)
+		if err != nil {
+			writeInstanceError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusCreated, i)
+	}
+}
+
+// RegistryHandler godoc
+// @Tags Registry
+// @Summary registered instances by name, without tokens
+// @ID registry
+// @Produce json
+// @Success 200 {object} RegistryResponse
+// @Router /api/v1/registry [get].
+func RegistryHandler(registry *instances.Registry) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		list, err := registry.List(r.Context())
+		if err != nil {
+			writeInstanceError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, RegistryResponse{Instances: list})
+	}
+}
+
+// InstanceHandler godoc
+// @Tags Registry
+// @Summary registered instance by name or idInstance, without the token
+// @ID instance
+// @Produce json
+// @Param name path string true "instance name or idInstance"
+// @Success 200 {object} storage.Instance
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/registry/{name} [get].
+func InstanceHandler(registry *instances.Registry) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		i, err := registry.Get(r.Context(), chi.URLParam(r, "name"))
+		if err != nil {
+			writeInstanceError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, i)
+	}
+}
+
+// UpdateInstanceHandler godoc
+// @Tags Registry
+// @Summary change idInstance or token of the instance
+// @ID updateInstance
+// @Accept  json
+// @Produce json
+// @Param name path string true "instance name"
+// @Param request body instances.Request true "changed fields"
+// @Success 200 {object} storage.Instance
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/registry/{name} [patch].
+func UpdateInstanceHandler(registry *instances.Registry) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, err := readInstanceRequest(r)
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		i, err := registry.Update(r.Context(), chi.URLParam(r, "name"), req)
+		if err != nil {
+			writeInstanceError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, i)
+	}
+}
+
+// DeleteInstanceHandler godoc
+// @Tags Registry
+// @Summary delete the instance from the registry
+// @ID deleteInstance
+// @Param name path string true "instance name"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/registry/{name} [delete].
+func DeleteInstanceHandler(registry *instances.Registry) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if err := registry.Delete(r.Context(), chi.URLParam(r, "name")); err != nil {
+			writeInstanceError(rw, err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func readInstanceRequest(r *http.Request) (*instances.Request, error) {
+	var req instances.Request
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxInstanceBody)).Decode(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrNoBody
+		}
+
+		return nil, NewError(err)
+	}
+
+	return &req, nil
+}
+
+// writeInstanceError hides details of server errors, they may be about tokens.
+func writeInstanceError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, instances.ErrNotFound):
+		WriteError(rw, http.StatusNotFound, err)
+	case errors.Is(err, instances.ErrExists):
+		WriteError(rw, http.StatusConflict, err)
+	case errors.Is(err, instances.ErrInvalid):
+		WriteError(rw, http.StatusBadRequest, err)
+	case errors.Is(err, encryption.ErrCiphertext):
+		logger.Errorln(err)
+		WriteError(rw, http.StatusConflict, errors.New("token can't be decrypted with the current secret, set a new one"))
+	default:
+		logger.Errorln(err)
+		WriteError(rw, http.StatusInternalServerError, errors.New("internal server error"))
+	}
+}
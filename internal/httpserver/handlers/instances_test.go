@@ -0,0 +1,254 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/instances"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// memInstances is an in-memory InstanceStorage.
+type memInstances struct {
+	instances map[string]storage.Instance
+	mu        sync.Mutex
+}
+
+func (f *memInstances) SaveInstance(_ context.Context, i *storage.Instance) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, other := range f.instances {
+		if other.Name == i.Name || other.IDInstance == i.IDInstance {
+			return storage.ErrDuplicate
+		}
+	}
+
+	f.instances[i.Name] = *i
+
+	return nil
+}
+
+func (f *memInstances) UpdateInstance(_ context.Context, i *storage.Instance) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.instances[i.Name]; !ok {
+		return storage.ErrNotFound
+	}
+
+	f.instances[i.Name] = *i
+
+	return nil
+}
+
+func (f *memInstances) GetInstance(_ context.Context, key string) (*storage.Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, i := range f.instances {
+		if i.Name == key || i.IDInstance == key {
+			return &i, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (f *memInstances) ListInstances(context.Context) ([]storage.Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.Instance{}
+	for _, i := range f.instances {
+		list = append(list, i)
+	}
+
+	return list, nil
+}
+
+func (f *memInstances) ListInstancesAfter(_ context.Context, after string, limit int) ([]storage.Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.Instance{}
+	for _, i := range f.instances {
+		if i.Name > after {
+			list = append(list, i)
+		}
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+
+	if len(list) > limit {
+		list = list[:limit]
+	}
+
+	return list, nil
+}
+
+func (f *memInstances) UpdateInstanceToken(_ context.Context, name string, old, token []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i, ok := f.instances[name]
+	if !ok || !bytes.Equal(i.Token, old) {
+		return storage.ErrNotFound
+	}
+
+	i.Token = token
+	f.instances[name] = i
+
+	return nil
+}
+
+func (f *memInstances) DeleteInstance(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.instances[name]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(f.instances, name)
+
+	return nil
+}
+
+// newRegistryServer serves registry routes and the proxy resolving instances by name over a fake GREEN-API.
+func newRegistryServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	calls := []string{}
+
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		_, _ = io.WriteString(rw, `{"stateInstance":"authorized"}`)
+	}))
+	t.Cleanup(api.Close)
+
+	sealer, err := encryption.NewSealer("secret")
+	require.NoError(t, err)
+
+	registry := instances.New(&memInstances{instances: make(map[string]storage.Instance)}, sealer, api.URL, api.Client())
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/instances", handlers.InstancesHandler(registry))
+	r.Get("/api/v1/instances/{id}/{method}", handlers.ProxyHandler(registry, nil, nil))
+	r.Post("/api/v1/registry", handlers.CreateInstanceHandler(registry))
+	r.Get("/api/v1/registry", handlers.RegistryHandler(registry))
+	r.Get("/api/v1/registry/{name}", handlers.InstanceHandler(registry))
+	r.Patch("/api/v1/registry/{name}", handlers.UpdateInstanceHandler(registry))
+	r.Delete("/api/v1/registry/{name}", handlers.DeleteInstanceHandler(registry))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts, &calls
+}
+
+// rawBody requests the path and returns the status with the whole response body.
+func rawBody(t *testing.T, ts *httptest.Server, method, path, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, string(data)
+}
+
+func TestRegistryHandlers(t *testing.T) {
+	ts, calls := newRegistryServer(t)
+
+	status, body := rawBody(t, ts, http.MethodPost, "/api/v1/registry",
+		`{"name":"sales","id_instance":"`+testID+`","api_token_instance":"`+testToken+`"}`)
+	require.Equal(t, http.StatusCreated, status, body)
+	assert.Contains(t, body, `"name":"sales"`)
+
+	status, body = rawBody(t, ts, http.MethodPatch, "/api/v1/registry/sales", `{"api_token_instance":"new-token"}`)
+	require.Equal(t, http.StatusOK, status, body)
+
+	// tokens are never returned
+	for _, path := range []string{"/api/v1/registry", "/api/v1/registry/sales", "/api/v1/registry/" + testID} {
+		status, body = rawBody(t, ts, http.MethodGet, path, "")
+		require.Equal(t, http.StatusOK, status, path)
+		assert.Contains(t, body, `"id_instance":"`+testID+`"`)
+		assert.NotContains(t, body, "token", path)
+	}
+
+	var list handlers.InstancesResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/instances", "", &list))
+	assert.Equal(t, []string{"sales"}, list.Instances)
+
+	status, body = rawBody(t, ts, http.MethodGet, "/api/v1/instances/sales/getStateInstance", "")
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, []string{"/waInstance" + testID + "/getStateInstance/new-token"}, *calls)
+
+	status, _ = rawBody(t, ts, http.MethodDelete, "/api/v1/registry/sales", "")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	status, _ = rawBody(t, ts, http.MethodGet, "/api/v1/instances/sales/getStateInstance", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestRegistryHandlers_Errors(t *testing.T) {
+	ts, _ := newRegistryServer(t)
+
+	status, body := rawBody(t, ts, http.MethodPost, "/api/v1/registry",
+		`{"name":"sales","id_instance":"`+testID+`","api_token_instance":"`+testToken+`"}`)
+	require.Equal(t, http.StatusCreated, status, body)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"no body", http.MethodPost, "/api/v1/registry", ``, http.StatusBadRequest},
+		{"bad json", http.MethodPost, "/api/v1/registry", `{`, http.StatusBadRequest},
+		{"numeric name", http.MethodPost, "/api/v1/registry",
+			`{"name":"123","id_instance":"123","api_token_instance":"t"}`, http.StatusBadRequest},
+		{"no token", http.MethodPost, "/api/v1/registry", `{"name":"support","id_instance":"123"}`, http.StatusBadRequest},
+		{"taken", http.MethodPost, "/api/v1/registry",
+			`{"name":"sales","id_instance":"123","api_token_instance":"t"}`, http.StatusConflict},
+		{"unknown", http.MethodGet, "/api/v1/registry/unknown", ``, http.StatusNotFound},
+		{"rename", http.MethodPatch, "/api/v1/registry/sales", `{"name":"support"}`, http.StatusBadRequest},
+		{"update unknown", http.MethodPatch, "/api/v1/registry/unknown", `{"id_instance":"123"}`, http.StatusNotFound},
+		{"delete unknown", http.MethodDelete, "/api/v1/registry/unknown", ``, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp handlers.ErrorResponse
+
+			assert.Equal(t, tt.status, getJSON(t, ts, tt.method, tt.path, tt.body, &resp))
+			assert.NotEmpty(t, resp.Error)
+			assert.NotContains(t, resp.Error, testToken)
+		})
+	}
+}
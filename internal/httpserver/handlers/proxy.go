@@ -0,0 +1,632 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/log"
+	"github.com/ole-larsen/green-api/internal/storage"
+	"github.com/ole-larsen/green-api/internal/templates"
+)
+
+var logger = log.NewLogger("info", log.DefaultBuildLogger)
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type InstancesResponse struct {
+	Instances []string `json:"instances"`
+}
+
+// proxyCall calls GREEN-API method with the request query or body.
+type proxyCall func(ctx context.Context, env *proxyEnv, c *httpclient.Client, r *http.Request) (any, error)
+
+// proxyEnv holds dependencies of proxy calls.
+type proxyEnv struct {
+	store     storage.Storage
+	templates *templates.Manager
+}
+
+// SendMessageRequest is sendMessage of GREEN-API whose message can be rendered from a saved template:
+// TemplateID with Variables is sent instead of Message.
+type SendMessageRequest struct {
+	httpclient.SendMessageRequest
+	Variables  map[string]string `json:"variables,omitempty"`
+	TemplateID string            `json:"templateId,omitempty"`
+}
+
+// errNoTemplates is returned for templated messages when the database is not configured.
+var errNoTemplates = errors.New("templates require a database")
+
+// render sets the message rendered from the template of the request.
+func (e *proxyEnv) render(ctx context.Context, in *SendMessageRequest) error {
+	if in.TemplateID == "" {
+		return nil
+	}
+
+	if in.Message != "" {
+		return NewError(errors.New("message and templateId are mutually exclusive"))
+	}
+
+	if e.templates == nil {
+		return NewError(errNoTemplates)
+	}
+
+	message, err := e.templates.Render(ctx, in.TemplateID, in.Variables)
+	if errors.Is(err, templates.ErrNotFound) || errors.Is(err, templates.ErrInvalid) {
+		return NewError(err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	in.Message = message
+
+	return nil
+}
+
+// record persists outgoing message. Requests rejected by validation or throttled by the limiter
+// were never sent and are skipped.
+func (e *proxyEnv) record(ctx context.Context, c *httpclient.Client, method, chatID, body, idMessage string, err error) {
+	if e.store == nil || errors.Is(err, httpclient.ErrInvalidRequest) || errors.Is(err, httpclient.ErrRateLimited) {
+		return
+	}
+
+	m := &storage.Message{
+		IDInstance: c.GetIDInstance(),
+		Method:     method,
+		ChatID:     chatID,
+		Body:       body,
+		Status:     storage.StatusSent,
+	}
+
+	if err != nil {
+		m.Status = storage.StatusFailed
+		m.Error = err.Error()
+	} else {
+		m.IDMessage = idMessage
+	}
+
+	if _, e := e.store.SaveMessage(ctx, m); e != nil {
+		logger.Errorln(e)
+	}
+}
+
+// maxProxyBody limits json bodies of proxied methods, files are sent by url or uploaded by sendFileByUpload.
+const maxProxyBody = 1 << 20
+
+type proxyMethod struct {
+	call       proxyCall
+	httpMethod string
+	// scope is required from API keys to call the method.
+	scope auth.Scope
+}
+
+var proxyMethods = map[string]proxyMethod{
+	httpclient.MethodGetSettings: {
+		scope:      auth.ScopeRead,
+		httpMethod: http.MethodGet,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, _ *http.Request) (any, error) {
+			return c.GetSettings(ctx)
+		},
+	},
+	httpclient.MethodSetSettings: {
+		scope:      auth.ScopeAdmin,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.Settings](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.SetSettings(ctx, in)
+		},
+	},
+	httpclient.MethodGetStateInstance: {
+		scope:      auth.ScopeRead,
+		httpMethod: http.MethodGet,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, _ *http.Request) (any, error) {
+			return c.GetStateInstance(ctx)
+		},
+	},
+	httpclient.MethodGetStatusInstance: {
+		scope:      auth.ScopeRead,
+		httpMethod: http.MethodGet,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, _ *http.Request) (any, error) {
+			return c.GetStatusInstance(ctx)
+		},
+	},
+	httpclient.MethodReboot: {
+		scope:      auth.ScopeAdmin,
+		httpMethod: http.MethodGet,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, _ *http.Request) (any, error) {
+			return c.Reboot(ctx)
+		},
+	},
+	httpclient.MethodLogout: {
+		scope:      auth.ScopeAdmin,
+		httpMethod: http.MethodGet,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, _ *http.Request) (any, error) {
+			return c.Logout(ctx)
+		},
+	},
+	httpclient.MethodQR: {
+		scope:      auth.ScopeAdmin,
+		httpMethod: http.MethodGet,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, _ *http.Request) (any, error) {
+			return c.QR(ctx)
+		},
+	},
+	httpclient.MethodGetAuthorizationCode: {
+		scope:      auth.ScopeAdmin,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.AuthorizationCodeRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.GetAuthorizationCode(ctx, in)
+		},
+	},
+	httpclient.MethodSendMessage: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, env *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[SendMessageRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := env.render(ctx, in); err != nil {
+				return nil, err
+			}
+
+			out, err := c.SendMessage(ctx, &in.SendMessageRequest)
+			env.record(ctx, c, httpclient.MethodSendMessage, in.ChatID, in.Message, idMessage(out), err)
+
+			return out, err
+		},
+	},
+	httpclient.MethodSendFileByURL: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, env *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.SendFileByURLRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := c.SendFileByURL(ctx, in)
+			env.record(ctx, c, httpclient.MethodSendFileByURL, in.ChatID, in.URLFile, idMessage(out), err)
+
+			return out, err
+		},
+	},
+	httpclient.MethodSendPoll: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, env *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.SendPollRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := c.SendPoll(ctx, in)
+			env.record(ctx, c, httpclient.MethodSendPoll, in.ChatID, in.Message, idMessage(out), err)
+
+			return out, err
+		},
+	},
+	httpclient.MethodSendLocation: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, env *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.SendLocationRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			location := fmt.Sprintf("%g,%g %s", in.Latitude, in.Longitude, in.NameLocation)
+
+			out, err := c.SendLocation(ctx, in)
+			env.record(ctx, c, httpclient.MethodSendLocation, in.ChatID, strings.TrimSpace(location), idMessage(out), err)
+
+			return out, err
+		},
+	},
+	httpclient.MethodSendContact: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, env *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.SendContactRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := c.SendContact(ctx, in)
+			env.record(ctx, c, httpclient.MethodSendContact, in.ChatID,
+				strconv.FormatInt(in.Contact.PhoneContact, 10), idMessage(out), err)
+
+			return out, err
+		},
+	},
+	httpclient.MethodForwardMessages: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, env *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.ForwardMessagesRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := c.ForwardMessages(ctx, in)
+			if err != nil {
+				env.record(ctx, c, httpclient.MethodForwardMessages, in.ChatID, in.ChatIDFrom, "", err)
+				return nil, err
+			}
+
+			// every forwarded copy gets own id and own delivery status
+			for _, id := range out.Messages {
+				env.record(ctx, c, httpclient.MethodForwardMessages, in.ChatID, in.ChatIDFrom, id, nil)
+			}
+
+			return out, nil
+		},
+	},
+	httpclient.MethodSendInteractiveButtons: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, env *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.SendInteractiveButtonsRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			out, err := c.SendInteractiveButtons(ctx, in)
+			env.record(ctx, c, httpclient.MethodSendInteractiveButtons, in.ChatID, in.Body, idMessage(out), err)
+
+			return out, err
+		},
+	},
+	httpclient.MethodGetChatHistory: {
+		scope:      auth.ScopeRead,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.GetChatHistoryRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.GetChatHistory(ctx, in)
+		},
+	},
+	httpclient.MethodGetMessage: {
+		scope:      auth.ScopeRead,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.GetMessageRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.GetMessage(ctx, in)
+		},
+	},
+	httpclient.MethodLastIncomingMessages: {
+		scope:      auth.ScopeRead,
+		httpMethod: http.MethodGet,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			minutes, err := journalMinutes(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.LastIncomingMessages(ctx, minutes)
+		},
+	},
+	httpclient.MethodLastOutgoingMessages: {
+		scope:      auth.ScopeRead,
+		httpMethod: http.MethodGet,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			minutes, err := journalMinutes(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.LastOutgoingMessages(ctx, minutes)
+		},
+	},
+	httpclient.MethodCreateGroup: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.CreateGroupRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.CreateGroup(ctx, in)
+		},
+	},
+	httpclient.MethodUpdateGroupName: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.UpdateGroupNameRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.UpdateGroupName(ctx, in)
+		},
+	},
+	httpclient.MethodGetGroupData: {
+		scope:      auth.ScopeRead,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.GroupRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.GetGroupData(ctx, in)
+		},
+	},
+	httpclient.MethodAddGroupParticipant: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.GroupParticipantRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.AddGroupParticipant(ctx, in)
+		},
+	},
+	httpclient.MethodRemoveGroupParticipant: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.GroupParticipantRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.RemoveGroupParticipant(ctx, in)
+		},
+	},
+	httpclient.MethodSetGroupAdmin: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.GroupParticipantRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.SetGroupAdmin(ctx, in)
+		},
+	},
+	httpclient.MethodRemoveAdmin: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.GroupParticipantRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.RemoveAdmin(ctx, in)
+		},
+	},
+	httpclient.MethodLeaveGroup: {
+		scope:      auth.ScopeSend,
+		httpMethod: http.MethodPost,
+		call: func(ctx context.Context, _ *proxyEnv, c *httpclient.Client, r *http.Request) (any, error) {
+			in, err := decode[httpclient.GroupRequest](r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			return c.LeaveGroup(ctx, in)
+		},
+	},
+}
+
+// journalMinutes reads optional minutes query parameter of journal methods.
+func journalMinutes(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("minutes")
+	if value == "" {
+		return 0, nil
+	}
+
+	m, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, NewError(fmt.Errorf("minutes: %w", err))
+	}
+
+	return m, nil
+}
+
+func idMessage(out *httpclient.SendMessageResponse) string {
+	if out == nil {
+		return ""
+	}
+
+	return out.IDMessage
+}
+
+// ProxyScope returns the scope required to call GREEN-API method of the request, unknown methods require admin.
+func ProxyScope(r *http.Request) auth.Scope {
+	pm, ok := proxyMethods[chi.URLParam(r, "method")]
+	if !ok {
+		return auth.ScopeAdmin
+	}
+
+	return pm.scope
+}
+
+// ProxyHandler godoc
+// @Tags Proxy
+// @Summary call GREEN-API method of the instance from the server
+// @Description sendMessage takes templateId and variables instead of message to send a saved template.
+// @ID proxy
+// @Accept  json
+// @Produce json
+// @Param id path string true "idInstance"
+// @Param method path string true "GREEN-API method"
+// @Success 200 {object} object
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/v1/instances/{id}/{method} [post].
+func ProxyHandler(clients httpclient.Provider, store storage.Storage, tpl *templates.Manager) http.HandlerFunc {
+	env := &proxyEnv{
+		store:     store,
+		templates: tpl,
+	}
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		pm, ok := proxyMethods[chi.URLParam(r, "method")]
+		if !ok {
+			WriteError(rw, http.StatusNotFound, errors.New("unknown method"))
+			return
+		}
+
+		if r.Method != pm.httpMethod {
+			WriteError(rw, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		c, err := clients.Client(chi.URLParam(r, "id"))
+		if err != nil {
+			WriteError(rw, http.StatusNotFound, err)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(rw, r.Body, maxProxyBody)
+
+		out, err := pm.call(r.Context(), env, c, r)
+		if err != nil {
+			WriteClientError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, out)
+	}
+}
+
+// InstancesHandler godoc
+// @Tags Proxy
+// @Summary list of instances available on the server, those the user or the key may read
+// @ID instances
+// @Produce json
+// @Success 200 {object} InstancesResponse
+// @Router /api/v1/instances [get].
+func InstancesHandler(clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		list := readable(r, clients, clients.Instances(), func(key *string) string { return *key })
+
+		WriteJSON(rw, http.StatusOK, InstancesResponse{
+			Instances: list,
+		})
+	}
+}
+
+// WriteJSON writes v as json with the status code.
+func WriteJSON(rw http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		WriteError(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	if _, err := rw.Write(data); err != nil {
+		return
+	}
+}
+
+// WriteError writes json error with the status code.
+func WriteError(rw http.ResponseWriter, status int, err error) {
+	data, e := json.Marshal(ErrorResponse{Error: err.Error()})
+	if e != nil {
+		InternalServerErrorRequest(rw, nil)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	if _, e := rw.Write(data); e != nil {
+		return
+	}
+}
+
+// WriteClientError maps GREEN-API client errors to the response status.
+func WriteClientError(rw http.ResponseWriter, err error) {
+	var (
+		apiErr   *httpclient.APIError
+		limitErr *httpclient.RateLimitError
+		maxErr   *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &limitErr):
+		writeRateLimited(rw, limitErr)
+	case errors.As(err, &maxErr):
+		WriteError(rw, http.StatusRequestEntityTooLarge, err)
+	case errors.Is(err, ErrNoBody), errors.Is(err, httpclient.ErrInvalidRequest):
+		WriteError(rw, http.StatusBadRequest, err)
+	case errors.As(err, &apiErr):
+		switch apiErr.StatusCode {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusTooManyRequests:
+			WriteError(rw, apiErr.StatusCode, err)
+		default:
+			WriteError(rw, http.StatusBadGateway, err)
+		}
+	default:
+		var handlerErr *Error
+		if errors.As(err, &handlerErr) {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		WriteError(rw, http.StatusBadGateway, err)
+	}
+}
+
+// decode reads json request body into T.
+func decode[T any](body io.Reader) (*T, error) {
+	if body == nil || body == http.NoBody {
+		return nil, ErrNoBody
+	}
+
+	var in T
+	if err := json.NewDecoder(body).Decode(&in); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrNoBody
+		}
+
+		return nil, NewError(err)
+	}
+
+	return &in, nil
+}
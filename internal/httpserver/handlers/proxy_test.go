@@ -0,0 +1,381 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+const (
+	testID    = "1101000001"
+	testToken = "d75b3a66374942c5b3c019c698abc2067e151558acbd412345"
+)
+
+type fakeStorage struct {
+	messages []*storage.Message
+}
+
+func (f *fakeStorage) Ping(context.Context) error { return nil }
+
+func (f *fakeStorage) Close() error { return nil }
+
+func (f *fakeStorage) SaveMessage(_ context.Context, m *storage.Message) (*storage.Message, error) {
+	f.messages = append(f.messages, m)
+	return m, nil
+}
+
+func (f *fakeStorage) UpdateMessageStatus(context.Context, string, string, string) error { return nil }
+
+func (f *fakeStorage) SaveNotification(_ context.Context, n *storage.Notification) (*storage.Notification, error) {
+	return n, nil
+}
+
+func newProxyServer(t *testing.T, apiStatus int, apiResponse string) (ts *httptest.Server, paths *[]string) {
+	t.Helper()
+
+	return newProxyServerWithStorage(t, apiStatus, apiResponse, nil)
+}
+
+func newProxyServerWithStorage(t *testing.T, apiStatus int, apiResponse string, store storage.Storage) (ts *httptest.Server, paths *[]string) {
+	t.Helper()
+
+	calls := make([]string, 0)
+
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(apiStatus)
+
+		_, err := io.WriteString(rw, apiResponse)
+		require.NoError(t, err)
+	}))
+	t.Cleanup(api.Close)
+
+	clients := httpclient.NewPool(api.URL, api.Client(), map[string]string{testID: testToken})
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/instances", handlers.InstancesHandler(clients))
+	r.Get("/api/v1/instances/{id}/{method}", handlers.ProxyHandler(clients, store, nil))
+	r.Post("/api/v1/instances/{id}/{method}", handlers.ProxyHandler(clients, store, nil))
+
+	ts = httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts, &calls
+}
+
+func TestProxyHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		apiResponse string
+		want        string
+		wantPath    string
+		apiStatus   int
+		status      int
+	}{
+		{
+			name:        "getStateInstance",
+			method:      http.MethodGet,
+			path:        "/api/v1/instances/" + testID + "/getStateInstance",
+			apiStatus:   http.StatusOK,
+			apiResponse: `{"stateInstance":"authorized"}`,
+			status:      http.StatusOK,
+			want:        `{"stateInstance":"authorized"}`,
+			wantPath:    "/waInstance" + testID + "/getStateInstance/" + testToken,
+		},
+		{
+			name:        "sendMessage",
+			method:      http.MethodPost,
+			path:        "/api/v1/instances/" + testID + "/sendMessage",
+			body:        `{"chatId":"79876543210@c.us","message":"hello"}`,
+			apiStatus:   http.StatusOK,
+			apiResponse: `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			status:      http.StatusOK,
+			want:        `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			wantPath:    "/waInstance" + testID + "/sendMessage/" + testToken,
+		},
+		{
+			name:     "sendMessage without chatId",
+			method:   http.MethodPost,
+			path:     "/api/v1/instances/" + testID + "/sendMessage",
+			body:     `{"message":"hello"}`,
+			status:   http.StatusBadRequest,
+			want:     `{"error":"[httpclient]: invalid request: chatId is required"}`,
+			wantPath: "",
+		},
+		{
+			name:   "sendMessage without body",
+			method: http.MethodPost,
+			path:   "/api/v1/instances/" + testID + "/sendMessage",
+			status: http.StatusBadRequest,
+			want:   `{"error":"[handlers]: empty body"}`,
+		},
+		{
+			name:   "sendMessage with too large body",
+			method: http.MethodPost,
+			path:   "/api/v1/instances/" + testID + "/sendMessage",
+			body:   `{"chatId":"79876543210@c.us","message":"` + strings.Repeat("a", 1<<20) + `"}`,
+			status: http.StatusRequestEntityTooLarge,
+			want:   `{"error":"[handlers]: http: request body too large"}`,
+		},
+		{
+			name:   "unknown instance",
+			method: http.MethodGet,
+			path:   "/api/v1/instances/1101000002/getStateInstance",
+			status: http.StatusNotFound,
+			want:   `{"error":"[httpclient]: unknown instance"}`,
+		},
+		{
+			name:   "unknown method",
+			method: http.MethodGet,
+			path:   "/api/v1/instances/" + testID + "/deleteAccount",
+			status: http.StatusNotFound,
+			want:   `{"error":"unknown method"}`,
+		},
+		{
+			name:   "wrong http method",
+			method: http.MethodPost,
+			path:   "/api/v1/instances/" + testID + "/getStateInstance",
+			status: http.StatusMethodNotAllowed,
+			want:   `{"error":"method not allowed"}`,
+		},
+		{
+			name:        "getChatHistory",
+			method:      http.MethodPost,
+			path:        "/api/v1/instances/" + testID + "/getChatHistory",
+			body:        `{"chatId":"79876543210@c.us","count":10}`,
+			apiStatus:   http.StatusOK,
+			apiResponse: `[{"type":"incoming","idMessage":"A1","typeMessage":"textMessage","chatId":"79876543210@c.us","textMessage":"hi","timestamp":1}]`,
+			status:      http.StatusOK,
+			want:        `[{"type":"incoming","idMessage":"A1","typeMessage":"textMessage","chatId":"79876543210@c.us","textMessage":"hi","timestamp":1}]`,
+			wantPath:    "/waInstance" + testID + "/getChatHistory/" + testToken,
+		},
+		{
+			name:        "lastIncomingMessages",
+			method:      http.MethodGet,
+			path:        "/api/v1/instances/" + testID + "/lastIncomingMessages?minutes=60",
+			apiStatus:   http.StatusOK,
+			apiResponse: `[]`,
+			status:      http.StatusOK,
+			want:        `[]`,
+			wantPath:    "/waInstance" + testID + "/lastIncomingMessages/" + testToken,
+		},
+		{
+			name:   "lastOutgoingMessages with wrong minutes",
+			method: http.MethodGet,
+			path:   "/api/v1/instances/" + testID + "/lastOutgoingMessages?minutes=day",
+			status: http.StatusBadRequest,
+			want:   `{"error":"[handlers]: minutes: strconv.Atoi: parsing \"day\": invalid syntax"}`,
+		},
+		{
+			name:        "GREEN-API failure",
+			method:      http.MethodGet,
+			path:        "/api/v1/instances/" + testID + "/getSettings",
+			apiStatus:   http.StatusInternalServerError,
+			apiResponse: `oops`,
+			status:      http.StatusBadGateway,
+			want:        `{"error":"[httpclient]: getSettings: unexpected status 500: oops"}`,
+			wantPath:    "/waInstance" + testID + "/getSettings/" + testToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, calls := newProxyServer(t, tt.apiStatus, tt.apiResponse)
+
+			var body io.Reader = http.NoBody
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, body)
+			require.NoError(t, err)
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+
+			defer func() {
+				e := resp.Body.Close()
+				require.NoError(t, e)
+			}()
+
+			got, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.JSONEq(t, tt.want, string(got))
+			assert.NotContains(t, string(got), testToken)
+
+			if tt.wantPath != "" {
+				require.Len(t, *calls, 1)
+				assert.Equal(t, tt.wantPath, (*calls)[0])
+			} else {
+				assert.Empty(t, *calls)
+			}
+		})
+	}
+}
+
+func TestInstancesHandler(t *testing.T) {
+	ts, _ := newProxyServer(t, http.StatusOK, "")
+
+	resp, err := ts.Client().Get(ts.URL + "/api/v1/instances")
+	require.NoError(t, err)
+
+	defer func() {
+		e := resp.Body.Close()
+		require.NoError(t, e)
+	}()
+
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"instances":["`+testID+`"]}`, string(got))
+}
+
+func TestProxyHandler_PersistsMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		apiResponse string
+		want        *storage.Message
+		apiStatus   int
+	}{
+		{
+			name:        "sent message",
+			body:        `{"chatId":"79876543210@c.us","message":"hello"}`,
+			apiStatus:   http.StatusOK,
+			apiResponse: `{"idMessage":"3EB0C767D097B7C7C030"}`,
+			want: &storage.Message{
+				IDInstance: testID,
+				Method:     httpclient.MethodSendMessage,
+				ChatID:     "79876543210@c.us",
+				Body:       "hello",
+				IDMessage:  "3EB0C767D097B7C7C030",
+				Status:     storage.StatusSent,
+			},
+		},
+		{
+			name:        "failed message",
+			body:        `{"chatId":"79876543210@c.us","message":"hello"}`,
+			apiStatus:   http.StatusInternalServerError,
+			apiResponse: `oops`,
+			want: &storage.Message{
+				IDInstance: testID,
+				Method:     httpclient.MethodSendMessage,
+				ChatID:     "79876543210@c.us",
+				Body:       "hello",
+				Status:     storage.StatusFailed,
+				Error:      "[httpclient]: sendMessage: unexpected status 500: oops",
+			},
+		},
+		{
+			name: "invalid message is not persisted",
+			body: `{"message":"hello"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStorage{}
+			ts, _ := newProxyServerWithStorage(t, tt.apiStatus, tt.apiResponse, store)
+
+			resp, err := ts.Client().Post(ts.URL+"/api/v1/instances/"+testID+"/sendMessage", "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			if tt.want == nil {
+				assert.Empty(t, store.messages)
+				return
+			}
+
+			require.Len(t, store.messages, 1)
+			assert.Equal(t, tt.want, store.messages[0])
+		})
+	}
+}
+
+func TestProxyHandler_SendingMethods(t *testing.T) {
+	tests := []struct {
+		method      string
+		body        string
+		apiResponse string
+		wantBodies  []string
+		wantIDs     []string
+	}{
+		{
+			method:      httpclient.MethodSendPoll,
+			body:        `{"chatId":"79876543210@c.us","message":"Color?","options":[{"optionName":"red"},{"optionName":"green"}]}`,
+			apiResponse: `{"idMessage":"A1"}`,
+			wantBodies:  []string{"Color?"},
+			wantIDs:     []string{"A1"},
+		},
+		{
+			method:      httpclient.MethodSendLocation,
+			body:        `{"chatId":"79876543210@c.us","nameLocation":"Office","latitude":55.75,"longitude":37.61}`,
+			apiResponse: `{"idMessage":"A2"}`,
+			wantBodies:  []string{"55.75,37.61 Office"},
+			wantIDs:     []string{"A2"},
+		},
+		{
+			method:      httpclient.MethodSendContact,
+			body:        `{"chatId":"79876543210@c.us","contact":{"phoneContact":79001234568}}`,
+			apiResponse: `{"idMessage":"A3"}`,
+			wantBodies:  []string{"79001234568"},
+			wantIDs:     []string{"A3"},
+		},
+		{
+			method:      httpclient.MethodForwardMessages,
+			body:        `{"chatId":"79876543210@c.us","chatIdFrom":"79001234568@c.us","messages":["B1","B2"]}`,
+			apiResponse: `{"messages":["C1","C2"]}`,
+			wantBodies:  []string{"79001234568@c.us", "79001234568@c.us"},
+			wantIDs:     []string{"C1", "C2"},
+		},
+		{
+			method: httpclient.MethodSendInteractiveButtons,
+			body: `{"chatId":"79876543210@c.us","body":"Choose",
+				"buttons":[{"type":"copy","buttonText":"Copy","copyCode":"42"}]}`,
+			apiResponse: `{"idMessage":"A4"}`,
+			wantBodies:  []string{"Choose"},
+			wantIDs:     []string{"A4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			store := &fakeStorage{}
+			ts, calls := newProxyServerWithStorage(t, http.StatusOK, tt.apiResponse, store)
+
+			resp, err := ts.Client().Post(ts.URL+"/api/v1/instances/"+testID+"/"+tt.method, "application/json", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, []string{"/waInstance" + testID + "/" + tt.method + "/" + testToken}, *calls)
+
+			require.Len(t, store.messages, len(tt.wantIDs))
+
+			for i, m := range store.messages {
+				assert.Equal(t, tt.method, m.Method)
+				assert.Equal(t, tt.wantBodies[i], m.Body)
+				assert.Equal(t, tt.wantIDs[i], m.IDMessage)
+			}
+		})
+	}
+}
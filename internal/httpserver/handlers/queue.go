@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// maxQueuedBody limits json payloads of queued messages.
+const maxQueuedBody = 1 << 20
+
+type JobsResponse struct {
+	Jobs []storage.Job `json:"jobs"`
+}
+
+// EnqueueHandler godoc
+// @Tags Queue
+// @Summary queue a message to be sent in background with retries
+// @Description The body is the json request of the GREEN-API method. The job id is returned at once,
+// @Description its status is available at /api/v1/jobs/{jobID}.
+// @ID enqueue
+// @Accept  json
+// @Produce json
+// @Param id path string true "idInstance"
+// @Param method path string true "sendMessage, sendFileByUrl, sendPoll, sendLocation, sendContact or sendInteractiveButtons"
+// @Success 202 {object} storage.Job
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/instances/{id}/queue/{method} [post].
+func EnqueueHandler(q *queue.Queue) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxQueuedBody))
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, NewError(err))
+			return
+		}
+
+		if len(body) == 0 {
+			WriteError(rw, http.StatusBadRequest, ErrNoBody)
+			return
+		}
+
+		job, err := q.Enqueue(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "method"), body)
+		if err != nil {
+			writeQueueError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusAccepted, job)
+	}
+}
+
+// JobHandler godoc
+// @Tags Queue
+// @Summary status of the queued job
+// @ID job
+// @Produce json
+// @Param jobID path string true "job id"
+// @Success 200 {object} storage.Job
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/jobs/{jobID} [get].
+func JobHandler(q *queue.Queue, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		job, err := q.Get(r.Context(), chi.URLParam(r, "jobID"))
+		if err != nil {
+			writeQueueError(rw, err)
+			return
+		}
+
+		if !checkInstance(rw, r, clients, job.IDInstance, auth.ScopeRead) {
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, job)
+	}
+}
+
+// JobsHandler godoc
+// @Tags Queue
+// @Summary latest queued jobs, status=dead lists the dead-letter jobs
+// @Description Jobs of instances the user or the key may not read are left out.
+// @ID jobs
+// @Produce json
+// @Param instance query string false "idInstance or the name of a registered instance"
+// @Param status query string false "queued, sending, retrying, sent or dead"
+// @Param limit query int false "max number of jobs, 100 by default"
+// @Success 200 {object} JobsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/jobs [get].
+func JobsHandler(q *queue.Queue, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, err := queryLimit(query)
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		instance := query.Get("instance")
+		if instance != "" {
+			if !checkInstance(rw, r, clients, instance, auth.ScopeRead) {
+				return
+			}
+
+			// jobs keep idInstance of registered instances, the filter may be the name
+			if c, err := clients.Client(instance); err == nil {
+				instance = c.GetIDInstance()
+			}
+		}
+
+		jobs, err := q.List(r.Context(), instance, query.Get("status"), limit)
+		if err != nil {
+			writeQueueError(rw, err)
+			return
+		}
+
+		jobs = readable(r, clients, jobs, func(j *storage.Job) string { return j.IDInstance })
+
+		WriteJSON(rw, http.StatusOK, JobsResponse{Jobs: jobs})
+	}
+}
+
+// RetryJobHandler godoc
+// @Tags Queue
+// @Summary queue a dead job again
+// @ID retryJob
+// @Produce json
+// @Param jobID path string true "job id"
+// @Success 202 {object} storage.Job
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/jobs/{jobID}/retry [post].
+func RetryJobHandler(q *queue.Queue, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		job, err := q.Get(r.Context(), chi.URLParam(r, "jobID"))
+		if err != nil {
+			writeQueueError(rw, err)
+			return
+		}
+
+		if !checkInstance(rw, r, clients, job.IDInstance, auth.ScopeSend) {
+			return
+		}
+
+		job, err = q.Retry(r.Context(), job.ID)
+		if err != nil {
+			writeQueueError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusAccepted, job)
+	}
+}
+
+// queryLimit parses optional limit of list routes, 0 when it is not set.
+func queryLimit(query url.Values) (int, error) {
+	value := query.Get("limit")
+	if value == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, NewError(errors.New("limit must be a positive number"))
+	}
+
+	return limit, nil
+}
+
+func writeQueueError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, queue.ErrNotFound), errors.Is(err, queue.ErrUnknownMethod),
+		errors.Is(err, httpclient.ErrUnknownInstance):
+		WriteError(rw, http.StatusNotFound, err)
+	case errors.Is(err, queue.ErrNotDead):
+		WriteError(rw, http.StatusConflict, err)
+	case errors.Is(err, httpclient.ErrInvalidRequest):
+		WriteError(rw, http.StatusBadRequest, err)
+	default:
+		logger.Errorln(err)
+		WriteError(rw, http.StatusInternalServerError, errors.New("internal server error"))
+	}
+}
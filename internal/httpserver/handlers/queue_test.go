@@ -0,0 +1,191 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+func newQueueServer(t *testing.T, apiStatus int) (*httptest.Server, *queue.Queue) {
+	t.Helper()
+
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(apiStatus)
+		_, _ = io.WriteString(rw, `{"idMessage":"3EB0C767D097B7C7C030"}`)
+	}))
+	t.Cleanup(api.Close)
+
+	clients := httpclient.NewPool(api.URL, api.Client(), map[string]string{testID: testToken})
+	q := queue.New(clients).
+		SetPolicy(queue.Policy{MaxAttempts: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/instances/{id}/queue/{method}", handlers.EnqueueHandler(q))
+	r.Get("/api/v1/jobs", handlers.JobsHandler(q, clients))
+	r.Get("/api/v1/jobs/{jobID}", handlers.JobHandler(q, clients))
+	r.Post("/api/v1/jobs/{jobID}/retry", handlers.RetryJobHandler(q, clients))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts, q
+}
+
+func getJSON(t *testing.T, ts *httptest.Server, method, path, body string, out any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+
+	return resp.StatusCode
+}
+
+func TestEnqueueHandler(t *testing.T) {
+	ts, _ := newQueueServer(t, http.StatusOK)
+
+	var job storage.Job
+
+	status := getJSON(t, ts, http.MethodPost, "/api/v1/instances/"+testID+"/queue/sendMessage",
+		`{"chatId":"79876543210@c.us","message":"hello"}`, &job)
+	require.Equal(t, http.StatusAccepted, status)
+
+	assert.NotEmpty(t, job.ID)
+	assert.Equal(t, storage.JobQueued, job.Status)
+	assert.Equal(t, httpclient.MethodSendMessage, job.Method)
+
+	var got storage.Job
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/jobs/"+job.ID, "", &got))
+	assert.Equal(t, job.ID, got.ID)
+
+	var list handlers.JobsResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/jobs?status=queued&instance="+testID, "", &list))
+	require.Len(t, list.Jobs, 1)
+
+	var errResp handlers.ErrorResponse
+
+	require.Equal(t, http.StatusConflict, getJSON(t, ts, http.MethodPost, "/api/v1/jobs/"+job.ID+"/retry", "", &errResp))
+	assert.Equal(t, queue.ErrNotDead.Error(), errResp.Error)
+}
+
+func TestEnqueueHandler_Errors(t *testing.T) {
+	ts, _ := newQueueServer(t, http.StatusOK)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "unknown method",
+			method:     http.MethodPost,
+			path:       "/api/v1/instances/" + testID + "/queue/getSettings",
+			body:       `{}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown instance",
+			method:     http.MethodPost,
+			path:       "/api/v1/instances/1101000002/queue/sendMessage",
+			body:       `{"chatId":"79876543210@c.us","message":"hello"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid request",
+			method:     http.MethodPost,
+			path:       "/api/v1/instances/" + testID + "/queue/sendMessage",
+			body:       `{"chatId":"79876543210@c.us"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "empty body",
+			method:     http.MethodPost,
+			path:       "/api/v1/instances/" + testID + "/queue/sendMessage",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown job",
+			method:     http.MethodGet,
+			path:       "/api/v1/jobs/unknown",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "wrong limit",
+			method:     http.MethodGet,
+			path:       "/api/v1/jobs?limit=many",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errResp handlers.ErrorResponse
+
+			assert.Equal(t, tt.wantStatus, getJSON(t, ts, tt.method, tt.path, tt.body, &errResp))
+			assert.NotEmpty(t, errResp.Error)
+		})
+	}
+}
+
+func TestRetryJobHandler(t *testing.T) {
+	ts, q := newQueueServer(t, http.StatusBadRequest)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		q.Run(done)
+	}()
+
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	var job storage.Job
+
+	require.Equal(t, http.StatusAccepted, getJSON(t, ts, http.MethodPost, "/api/v1/instances/"+testID+"/queue/sendMessage",
+		`{"chatId":"79876543210@c.us","message":"hello"}`, &job))
+
+	require.Eventually(t, func() bool {
+		var got storage.Job
+
+		getJSON(t, ts, http.MethodGet, "/api/v1/jobs/"+job.ID, "", &got)
+
+		return got.Status == storage.JobDead
+	}, 2*time.Second, time.Millisecond)
+
+	var retried storage.Job
+
+	require.Equal(t, http.StatusAccepted, getJSON(t, ts, http.MethodPost, "/api/v1/jobs/"+job.ID+"/retry", "", &retried))
+	assert.Equal(t, job.ID, retried.ID)
+	assert.Equal(t, 0, retried.Attempts)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/ratelimit"
+)
+
+type RateLimitResponse struct {
+	Instances []ratelimit.Status `json:"instances"`
+}
+
+// RateLimitHandler godoc
+// @Tags Proxy
+// @Summary sending limits of instances and their token buckets
+// @ID rateLimit
+// @Produce json
+// @Success 200 {object} RateLimitResponse
+// @Router /api/v1/ratelimit [get].
+func RateLimitHandler(clients httpclient.Provider, limiter *ratelimit.Limiter) http.HandlerFunc {
+	return func(rw http.ResponseWriter, _ *http.Request) {
+		// instances may be listed by name, buckets are kept by idInstance
+		ids := make([]string, 0)
+
+		for _, key := range clients.Instances() {
+			if c, err := clients.Client(key); err == nil {
+				ids = append(ids, c.GetIDInstance())
+			}
+		}
+
+		WriteJSON(rw, http.StatusOK, RateLimitResponse{
+			Instances: limiter.Status(ids),
+		})
+	}
+}
+
+// writeRateLimited answers 429 with Retry-After in whole seconds, at least one.
+func writeRateLimited(rw http.ResponseWriter, err *httpclient.RateLimitError) {
+	seconds := int(math.Ceil(err.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	rw.Header().Set("Retry-After", strconv.Itoa(seconds))
+	WriteError(rw, http.StatusTooManyRequests, err)
+}
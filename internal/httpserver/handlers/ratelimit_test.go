@@ -0,0 +1,77 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/ratelimit"
+)
+
+func newRateLimitServer(t *testing.T, limit ratelimit.Limit, store *fakeStorage) (*httptest.Server, *int) {
+	t.Helper()
+
+	calls := 0
+
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		calls++
+
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write([]byte(`{"idMessage":"3EB0C767D097B7C7C030"}`))
+	}))
+	t.Cleanup(api.Close)
+
+	limiter := ratelimit.New(limit)
+	clients := httpclient.NewPool(api.URL, api.Client(), map[string]string{testID: testToken}).SetLimiter(limiter)
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/ratelimit", handlers.RateLimitHandler(clients, limiter))
+	r.Post("/api/v1/instances/{id}/{method}", handlers.ProxyHandler(clients, store, nil))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts, &calls
+}
+
+func TestProxyHandler_RateLimited(t *testing.T) {
+	store := &fakeStorage{}
+	ts, calls := newRateLimitServer(t, ratelimit.Limit{Rate: 0.1, Burst: 1}, store)
+
+	send := func() *http.Response {
+		resp, err := ts.Client().Post(ts.URL+"/api/v1/instances/"+testID+"/sendMessage", "application/json",
+			strings.NewReader(`{"chatId":"79876543210@c.us","message":"hello"}`))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, send().StatusCode)
+
+	resp := send()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("Retry-After"))
+
+	assert.Equal(t, 1, *calls)
+	assert.Len(t, store.messages, 1, "throttled send is not recorded")
+
+	var got handlers.RateLimitResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/ratelimit", "", &got))
+	require.Len(t, got.Instances, 1)
+
+	status := got.Instances[0]
+	assert.Equal(t, testID, status.IDInstance)
+	assert.Equal(t, ratelimit.Limit{Rate: 0.1, Burst: 1}, status.Limit)
+	assert.Equal(t, int64(1), status.Allowed)
+	assert.Equal(t, int64(1), status.Throttled)
+	assert.Greater(t, status.RetryAfter, 9.0)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+type RolesResponse struct {
+	Roles []storage.UserRole `json:"roles"`
+}
+
+// RolesHandler godoc
+// @Tags Users
+// @Summary roles of the user by instance, "*" is every instance
+// @ID roles
+// @Produce json
+// @Param username path string true "username"
+// @Success 200 {object} RolesResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/users/{username}/roles [get].
+func RolesHandler(users *auth.Users) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		list, err := users.Roles(r.Context(), chi.URLParam(r, "username"))
+		if err != nil {
+			writeUserError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, RolesResponse{Roles: list})
+	}
+}
+
+// GrantRoleHandler godoc
+// @Tags Users
+// @Summary give the user a role on the instance, the previous role on it is replaced
+// @Description Roles are viewer, operator and admin. The instance is a name, idInstance or "*" for every instance.
+// @ID grantRole
+// @Accept  json
+// @Produce json
+// @Param username path string true "username"
+// @Param instance path string true "name, idInstance or *"
+// @Param request body auth.RoleRequest true "role"
+// @Success 200 {object} storage.UserRole
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/users/{username}/roles/{instance} [put].
+func GrantRoleHandler(users *auth.Users) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, err := decode[auth.RoleRequest](io.LimitReader(r.Body, maxUserBody))
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		role, err := users.Grant(r.Context(), chi.URLParam(r, "username"), chi.URLParam(r, "instance"), req.Role)
+		if err != nil {
+			writeUserError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, role)
+	}
+}
+
+// RevokeRoleHandler godoc
+// @Tags Users
+// @Summary take the role on the instance from the user
+// @ID revokeRole
+// @Param username path string true "username"
+// @Param instance path string true "name, idInstance or *"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/users/{username}/roles/{instance} [delete].
+func RevokeRoleHandler(users *auth.Users) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if err := users.Revoke(r.Context(), chi.URLParam(r, "username"), chi.URLParam(r, "instance")); err != nil {
+			writeUserError(rw, err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
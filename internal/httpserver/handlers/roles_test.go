@@ -0,0 +1,135 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// memRoles is an in-memory RoleStorage.
+type memRoles struct {
+	roles map[[2]string]string
+	mu    sync.Mutex
+}
+
+func (f *memRoles) SaveUserRole(_ context.Context, r *storage.UserRole) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.roles[[2]string{r.UserID, r.Instance}] = r.Role
+
+	return nil
+}
+
+func (f *memRoles) ListUserRoles(_ context.Context, userID string) ([]storage.UserRole, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.UserRole{}
+
+	for k, role := range f.roles {
+		if k[0] == userID {
+			list = append(list, storage.UserRole{UserID: userID, Instance: k[1], Role: role})
+		}
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Instance < list[b].Instance })
+
+	return list, nil
+}
+
+func (f *memRoles) DeleteUserRole(_ context.Context, userID, instance string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.roles[[2]string{userID, instance}]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(f.roles, [2]string{userID, instance})
+
+	return nil
+}
+
+func newRolesServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	clients := httpclient.NewPool("http://127.0.0.1:1", nil, map[string]string{testID: testToken})
+	users := newTestUsers().SetRoles(&memRoles{roles: make(map[[2]string]string)}).SetInstances(clients)
+
+	_, err := users.Create(context.Background(), &auth.UserRequest{Username: "alice", Password: "correct horse"})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Get("/api/v1/users/{username}/roles", handlers.RolesHandler(users))
+	r.Put("/api/v1/users/{username}/roles/{instance}", handlers.GrantRoleHandler(users))
+	r.Delete("/api/v1/users/{username}/roles/{instance}", handlers.RevokeRoleHandler(users))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestRolesHandlers(t *testing.T) {
+	ts := newRolesServer(t)
+
+	status, body := rawBody(t, ts, http.MethodPut, "/api/v1/users/alice/roles/"+testID, `{"role":"operator"}`)
+	require.Equal(t, http.StatusOK, status, body)
+	assert.JSONEq(t, `{"instance":"`+testID+`","role":"operator"}`, body)
+
+	status, body = rawBody(t, ts, http.MethodPut, "/api/v1/users/alice/roles/*", `{"role":"viewer"}`)
+	require.Equal(t, http.StatusOK, status, body)
+
+	var list handlers.RolesResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/users/alice/roles", "", &list))
+	assert.Equal(t, []storage.UserRole{
+		{Instance: auth.AllInstances, Role: "viewer"},
+		{Instance: testID, Role: "operator"},
+	}, list.Roles)
+
+	status, _ = rawBody(t, ts, http.MethodDelete, "/api/v1/users/alice/roles/"+testID, "")
+	assert.Equal(t, http.StatusNoContent, status)
+}
+
+func TestRolesHandlers_Errors(t *testing.T) {
+	ts := newRolesServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"no body", http.MethodPut, "/api/v1/users/alice/roles/*", ``, http.StatusBadRequest},
+		{"unknown role", http.MethodPut, "/api/v1/users/alice/roles/*", `{"role":"owner"}`, http.StatusBadRequest},
+		{"unknown instance", http.MethodPut, "/api/v1/users/alice/roles/1101000002", `{"role":"viewer"}`,
+			http.StatusBadRequest},
+		{"unknown user", http.MethodPut, "/api/v1/users/bob/roles/*", `{"role":"viewer"}`, http.StatusNotFound},
+		{"roles of unknown user", http.MethodGet, "/api/v1/users/bob/roles", ``, http.StatusNotFound},
+		{"revoke missing role", http.MethodDelete, "/api/v1/users/alice/roles/*", ``, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp handlers.ErrorResponse
+
+			assert.Equal(t, tt.status, getJSON(t, ts, tt.method, tt.path, tt.body, &resp))
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+}
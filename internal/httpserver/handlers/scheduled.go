@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/scheduler"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+type ScheduledResponse struct {
+	Scheduled []storage.ScheduledMessage `json:"scheduled"`
+}
+
+// ScheduleHandler godoc
+// @Tags Scheduled
+// @Summary schedule a message to be sent later
+// @Description send_at is RFC 3339 time or wall clock time "2006-01-02T15:04" of timezone (UTC by default).
+// @Description payload is the json request of method, sendMessage by default. When it is due the message
+// @Description is sent through the outbound queue, id_job is the queued job.
+// @ID schedule
+// @Accept  json
+// @Produce json
+// @Param request body scheduler.Request true "scheduled message"
+// @Success 201 {object} storage.ScheduledMessage
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/scheduled [post].
+func ScheduleHandler(s *scheduler.Scheduler, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var req scheduler.Request
+		if !readScheduleRequest(rw, r, &req) {
+			return
+		}
+
+		if !checkInstance(rw, r, clients, req.IDInstance, auth.ScopeSend) {
+			return
+		}
+
+		m, err := s.Schedule(r.Context(), &req)
+		if err != nil {
+			writeScheduledError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusCreated, m)
+	}
+}
+
+// ScheduledHandler godoc
+// @Tags Scheduled
+// @Summary scheduled message
+// @ID scheduled
+// @Produce json
+// @Param scheduledID path string true "scheduled message id"
+// @Success 200 {object} storage.ScheduledMessage
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/scheduled/{scheduledID} [get].
+func ScheduledHandler(s *scheduler.Scheduler, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		m, err := s.Get(r.Context(), chi.URLParam(r, "scheduledID"))
+		if err != nil {
+			writeScheduledError(rw, err)
+			return
+		}
+
+		if !checkInstance(rw, r, clients, m.IDInstance, auth.ScopeRead) {
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, m)
+	}
+}
+
+// ScheduledListHandler godoc
+// @Tags Scheduled
+// @Summary scheduled messages, the latest send time first
+// @Description Messages of instances the user or the key may not read are left out.
+// @ID scheduledList
+// @Produce json
+// @Param instance query string false "idInstance"
+// @Param status query string false "scheduled, dispatched, cancelled or failed"
+// @Param limit query int false "max number of messages, 100 by default"
+// @Success 200 {object} ScheduledResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/scheduled [get].
+func ScheduledListHandler(s *scheduler.Scheduler, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, err := queryLimit(query)
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		instance := query.Get("instance")
+		if instance != "" && !checkInstance(rw, r, clients, instance, auth.ScopeRead) {
+			return
+		}
+
+		messages, err := s.List(r.Context(), instance, query.Get("status"), limit)
+		if err != nil {
+			writeScheduledError(rw, err)
+			return
+		}
+
+		messages = readable(r, clients, messages, func(m *storage.ScheduledMessage) string { return m.IDInstance })
+
+		WriteJSON(rw, http.StatusOK, ScheduledResponse{Scheduled: messages})
+	}
+}
+
+// UpdateScheduledHandler godoc
+// @Tags Scheduled
+// @Summary change payload, send_at or timezone of a message which is not sent yet
+// @ID updateScheduled
+// @Accept  json
+// @Produce json
+// @Param scheduledID path string true "scheduled message id"
+// @Param request body scheduler.Request true "changed fields"
+// @Success 200 {object} storage.ScheduledMessage
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/scheduled/{scheduledID} [patch].
+func UpdateScheduledHandler(s *scheduler.Scheduler, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if !checkScheduled(rw, r, s, clients) {
+			return
+		}
+
+		var req scheduler.Request
+		if !readScheduleRequest(rw, r, &req) {
+			return
+		}
+
+		m, err := s.Update(r.Context(), chi.URLParam(r, "scheduledID"), &req)
+		if err != nil {
+			writeScheduledError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, m)
+	}
+}
+
+// CancelScheduledHandler godoc
+// @Tags Scheduled
+// @Summary cancel a message which is not sent yet
+// @ID cancelScheduled
+// @Produce json
+// @Param scheduledID path string true "scheduled message id"
+// @Success 200 {object} storage.ScheduledMessage
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/scheduled/{scheduledID} [delete].
+func CancelScheduledHandler(s *scheduler.Scheduler, clients httpclient.Provider) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if !checkScheduled(rw, r, s, clients) {
+			return
+		}
+
+		m, err := s.Cancel(r.Context(), chi.URLParam(r, "scheduledID"))
+		if err != nil {
+			writeScheduledError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, m)
+	}
+}
+
+// checkScheduled writes an error and returns false unless the identity of the request may send
+// with the instance of the scheduled message.
+func checkScheduled(rw http.ResponseWriter, r *http.Request, s *scheduler.Scheduler, clients httpclient.Provider) bool {
+	m, err := s.Get(r.Context(), chi.URLParam(r, "scheduledID"))
+	if err != nil {
+		writeScheduledError(rw, err)
+		return false
+	}
+
+	return checkInstance(rw, r, clients, m.IDInstance, auth.ScopeSend)
+}
+
+func readScheduleRequest(rw http.ResponseWriter, r *http.Request, req *scheduler.Request) bool {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxQueuedBody))
+	if err != nil {
+		WriteError(rw, http.StatusBadRequest, NewError(err))
+		return false
+	}
+
+	if len(body) == 0 {
+		WriteError(rw, http.StatusBadRequest, ErrNoBody)
+		return false
+	}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		WriteError(rw, http.StatusBadRequest, NewError(err))
+		return false
+	}
+
+	return true
+}
+
+func writeScheduledError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound), errors.Is(err, queue.ErrUnknownMethod),
+		errors.Is(err, httpclient.ErrUnknownInstance):
+		WriteError(rw, http.StatusNotFound, err)
+	case errors.Is(err, scheduler.ErrNotPending):
+		WriteError(rw, http.StatusConflict, err)
+	case errors.Is(err, scheduler.ErrInvalid), errors.Is(err, httpclient.ErrInvalidRequest):
+		WriteError(rw, http.StatusBadRequest, err)
+	default:
+		logger.Errorln(err)
+		WriteError(rw, http.StatusInternalServerError, errors.New("internal server error"))
+	}
+}
@@ -0,0 +1,290 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/scheduler"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// memScheduled is an in-memory ScheduledStorage.
+type memScheduled struct {
+	messages map[string]storage.ScheduledMessage
+	mu       sync.Mutex
+}
+
+func (f *memScheduled) SaveScheduled(_ context.Context, m *storage.ScheduledMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages[m.ID] = *m
+
+	return nil
+}
+
+func (f *memScheduled) UpdateScheduled(_ context.Context, m *storage.ScheduledMessage, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if stored, ok := f.messages[m.ID]; !ok || stored.Status != status {
+		return storage.ErrNotFound
+	}
+
+	f.messages[m.ID] = *m
+
+	return nil
+}
+
+func (f *memScheduled) GetScheduled(_ context.Context, id string) (*storage.ScheduledMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m, ok := f.messages[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &m, nil
+}
+
+func (f *memScheduled) ListScheduled(_ context.Context, _, status string, _ int) ([]storage.ScheduledMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	messages := []storage.ScheduledMessage{}
+
+	for _, m := range f.messages {
+		if status == "" || m.Status == status {
+			messages = append(messages, m)
+		}
+	}
+
+	return messages, nil
+}
+
+func (f *memScheduled) DueScheduled(context.Context, time.Time, int) ([]storage.ScheduledMessage, error) {
+	return nil, nil
+}
+
+func (f *memScheduled) RestoreScheduled(context.Context, time.Time, time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newScheduledServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	clients := httpclient.NewPool("http://127.0.0.1:1", nil, map[string]string{testID: testToken})
+	s := scheduler.New(&memScheduled{messages: make(map[string]storage.ScheduledMessage)}, queue.New(clients)).
+		SetClock(func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) })
+
+	ts := httptest.NewServer(scheduledRouter(s, clients, nil))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// scheduledRouter routes scheduled messages for the identity, nil is a server without accounts.
+func scheduledRouter(s *scheduler.Scheduler, clients httpclient.Provider, identity *auth.Identity) chi.Router {
+	r := chi.NewRouter()
+	r.Use(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if identity != nil {
+				r = r.WithContext(auth.WithIdentity(r.Context(), identity))
+			}
+
+			h.ServeHTTP(rw, r)
+		})
+	})
+	r.Post("/api/v1/scheduled", handlers.ScheduleHandler(s, clients))
+	r.Get("/api/v1/scheduled", handlers.ScheduledListHandler(s, clients))
+	r.Get("/api/v1/scheduled/{scheduledID}", handlers.ScheduledHandler(s, clients))
+	r.Patch("/api/v1/scheduled/{scheduledID}", handlers.UpdateScheduledHandler(s, clients))
+	r.Delete("/api/v1/scheduled/{scheduledID}", handlers.CancelScheduledHandler(s, clients))
+
+	return r
+}
+
+func TestScheduledHandlers(t *testing.T) {
+	ts := newScheduledServer(t)
+
+	var m storage.ScheduledMessage
+
+	status := getJSON(t, ts, http.MethodPost, "/api/v1/scheduled", `{"id_instance":"`+testID+`",
+		"send_at":"2026-10-17T09:00","timezone":"Europe/Moscow",
+		"payload":{"chatId":"79876543210@c.us","message":"hello"}}`, &m)
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, storage.ScheduledPending, m.Status)
+	assert.Equal(t, "2026-10-17T09:00:00+03:00", m.SendAt.Format(time.RFC3339))
+
+	var got storage.ScheduledMessage
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/scheduled/"+m.ID, "", &got))
+	assert.Equal(t, m.ID, got.ID)
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodPatch, "/api/v1/scheduled/"+m.ID,
+		`{"send_at":"2026-10-17T10:15"}`, &got))
+	assert.Equal(t, "2026-10-17T10:15:00+03:00", got.SendAt.Format(time.RFC3339))
+
+	var list handlers.ScheduledResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/scheduled?status=scheduled", "", &list))
+	require.Len(t, list.Scheduled, 1)
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodDelete, "/api/v1/scheduled/"+m.ID, "", &got))
+	assert.Equal(t, storage.ScheduledCancelled, got.Status)
+
+	var errResp handlers.ErrorResponse
+
+	require.Equal(t, http.StatusConflict, getJSON(t, ts, http.MethodDelete, "/api/v1/scheduled/"+m.ID, "", &errResp))
+}
+
+func TestScheduledHandlers_Errors(t *testing.T) {
+	ts := newScheduledServer(t)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "no body",
+			method:     http.MethodPost,
+			path:       "/api/v1/scheduled",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not json",
+			method:     http.MethodPost,
+			path:       "/api/v1/scheduled",
+			body:       `send it tomorrow`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "past",
+			method: http.MethodPost,
+			path:   "/api/v1/scheduled",
+			body: `{"id_instance":"` + testID + `","send_at":"2026-10-01T09:00",
+				"payload":{"chatId":"79876543210@c.us","message":"hello"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid payload",
+			method: http.MethodPost,
+			path:   "/api/v1/scheduled",
+			body: `{"id_instance":"` + testID + `","send_at":"2026-10-17T09:00",
+				"payload":{"chatId":"79876543210@c.us"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown instance",
+			method: http.MethodPost,
+			path:   "/api/v1/scheduled",
+			body: `{"id_instance":"1","send_at":"2026-10-17T09:00",
+				"payload":{"chatId":"79876543210@c.us","message":"hello"}}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown message",
+			method:     http.MethodGet,
+			path:       "/api/v1/scheduled/unknown",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "wrong limit",
+			method:     http.MethodGet,
+			path:       "/api/v1/scheduled?limit=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errResp handlers.ErrorResponse
+
+			assert.Equal(t, tt.wantStatus, getJSON(t, ts, tt.method, tt.path, tt.body, &errResp))
+			assert.NotEmpty(t, errResp.Error)
+		})
+	}
+}
+
+func TestScheduledHandlers_InstanceRoles(t *testing.T) {
+	const otherID = "1101000002"
+
+	clients := httpclient.NewPool("http://127.0.0.1:1", nil, map[string]string{testID: testToken, otherID: testToken})
+	s := scheduler.New(&memScheduled{messages: make(map[string]storage.ScheduledMessage)}, queue.New(clients)).
+		SetClock(func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) })
+
+	// scheduled by an admin of every instance
+	other, err := s.Schedule(context.Background(), &scheduler.Request{
+		IDInstance: otherID,
+		SendAt:     "2026-10-17T09:00",
+		Payload:    json.RawMessage(`{"chatId":"79876543210@c.us","message":"hello"}`),
+	})
+	require.NoError(t, err)
+
+	operator := &auth.Identity{UserID: "u1", Username: "anna", Roles: map[string]auth.Role{testID: auth.RoleOperator}}
+
+	ts := httptest.NewServer(scheduledRouter(s, clients, operator))
+	t.Cleanup(ts.Close)
+
+	body := func(idInstance string) string {
+		return `{"id_instance":"` + idInstance + `","send_at":"2026-10-17T09:00",
+			"payload":{"chatId":"79876543210@c.us","message":"hello"}}`
+	}
+
+	var own storage.ScheduledMessage
+
+	require.Equal(t, http.StatusCreated, getJSON(t, ts, http.MethodPost, "/api/v1/scheduled", body(testID), &own),
+		"the operator schedules with its instance")
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodPatch, "/api/v1/scheduled/"+own.ID,
+		`{"send_at":"2026-10-17T10:00"}`, nil))
+
+	var list handlers.ScheduledResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/scheduled", "", &list))
+	require.Len(t, list.Scheduled, 1, "messages of other instances are left out")
+	assert.Equal(t, own.ID, list.Scheduled[0].ID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"schedule with another instance", http.MethodPost, "/api/v1/scheduled", body(otherID)},
+		{"list of another instance", http.MethodGet, "/api/v1/scheduled?instance=" + otherID, ""},
+		{"message of another instance", http.MethodGet, "/api/v1/scheduled/" + other.ID, ""},
+		{"change message of another instance", http.MethodPatch, "/api/v1/scheduled/" + other.ID,
+			`{"send_at":"2026-10-17T10:00"}`},
+		{"cancel message of another instance", http.MethodDelete, "/api/v1/scheduled/" + other.ID, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp handlers.ErrorResponse
+
+			assert.Equal(t, http.StatusForbidden, getJSON(t, ts, tt.method, tt.path, tt.body, &resp))
+			assert.Contains(t, resp.Error, "anna has no")
+		})
+	}
+
+	got, err := s.Get(context.Background(), other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduledPending, got.Status, "the message of another instance is kept")
+}
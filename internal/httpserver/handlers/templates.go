@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+	"github.com/ole-larsen/green-api/internal/templates"
+)
+
+type TemplatesResponse struct {
+	Templates []storage.Template `json:"templates"`
+}
+
+type RenderTemplateRequest struct {
+	Variables map[string]string `json:"variables"`
+}
+
+type RenderTemplateResponse struct {
+	Message string `json:"message"`
+}
+
+// CreateTemplateHandler godoc
+// @Tags Templates
+// @Summary save a message template with placeholders like {{name}}
+// @ID createTemplate
+// @Accept  json
+// @Produce json
+// @Param request body templates.Request true "name and body"
+// @Success 201 {object} storage.Template
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/templates [post].
+func CreateTemplateHandler(m *templates.Manager) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, err := readTemplateRequest(r)
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		t, err := m.Create(r.Context(), req)
+		if err != nil {
+			writeTemplateError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusCreated, t)
+	}
+}
+
+// TemplatesHandler godoc
+// @Tags Templates
+// @Summary templates by name with their variables
+// @ID templates
+// @Produce json
+// @Param limit query int false "max number of templates, 100 by default"
+// @Success 200 {object} TemplatesResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/v1/templates [get].
+func TemplatesHandler(m *templates.Manager) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		limit, err := queryLimit(r.URL.Query())
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		list, err := m.List(r.Context(), limit)
+		if err != nil {
+			writeTemplateError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, TemplatesResponse{Templates: list})
+	}
+}
+
+// TemplateHandler godoc
+// @Tags Templates
+// @Summary template with its variables
+// @ID template
+// @Produce json
+// @Param templateID path string true "template id"
+// @Success 200 {object} storage.Template
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/templates/{templateID} [get].
+func TemplateHandler(m *templates.Manager) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		t, err := m.Get(r.Context(), chi.URLParam(r, "templateID"))
+		if err != nil {
+			writeTemplateError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, t)
+	}
+}
+
+// UpdateTemplateHandler godoc
+// @Tags Templates
+// @Summary change name or body of the template
+// @ID updateTemplate
+// @Accept  json
+// @Produce json
+// @Param templateID path string true "template id"
+// @Param request body templates.Request true "changed fields"
+// @Success 200 {object} storage.Template
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/templates/{templateID} [patch].
+func UpdateTemplateHandler(m *templates.Manager) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, err := readTemplateRequest(r)
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		t, err := m.Update(r.Context(), chi.URLParam(r, "templateID"), req)
+		if err != nil {
+			writeTemplateError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, t)
+	}
+}
+
+// DeleteTemplateHandler godoc
+// @Tags Templates
+// @Summary delete the template
+// @ID deleteTemplate
+// @Param templateID path string true "template id"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/templates/{templateID} [delete].
+func DeleteTemplateHandler(m *templates.Manager) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if err := m.Delete(r.Context(), chi.URLParam(r, "templateID")); err != nil {
+			writeTemplateError(rw, err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RenderTemplateHandler godoc
+// @Tags Templates
+// @Summary message of the template with the variables, every placeholder must have a value
+// @ID renderTemplate
+// @Accept  json
+// @Produce json
+// @Param templateID path string true "template id"
+// @Param request body RenderTemplateRequest true "variables"
+// @Success 200 {object} RenderTemplateResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/templates/{templateID}/render [post].
+func RenderTemplateHandler(m *templates.Manager) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		in, err := decode[RenderTemplateRequest](io.LimitReader(r.Body, maxQueuedBody))
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		message, err := m.Render(r.Context(), chi.URLParam(r, "templateID"), in.Variables)
+		if err != nil {
+			writeTemplateError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, RenderTemplateResponse{Message: message})
+	}
+}
+
+func readTemplateRequest(r *http.Request) (*templates.Request, error) {
+	var req templates.Request
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxQueuedBody)).Decode(&req); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrNoBody
+		}
+
+		return nil, NewError(err)
+	}
+
+	return &req, nil
+}
+
+func writeTemplateError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, templates.ErrNotFound):
+		WriteError(rw, http.StatusNotFound, err)
+	case errors.Is(err, templates.ErrInvalid):
+		WriteError(rw, http.StatusBadRequest, err)
+	default:
+		logger.Errorln(err)
+		WriteError(rw, http.StatusInternalServerError, errors.New("internal server error"))
+	}
+}
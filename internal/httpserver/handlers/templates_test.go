@@ -0,0 +1,225 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/storage"
+	"github.com/ole-larsen/green-api/internal/templates"
+)
+
+// memTemplates is an in-memory TemplateStorage.
+type memTemplates struct {
+	templates map[string]storage.Template
+	mu        sync.Mutex
+}
+
+func (f *memTemplates) SaveTemplate(_ context.Context, t *storage.Template) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.templates[t.ID] = *t
+
+	return nil
+}
+
+func (f *memTemplates) UpdateTemplate(_ context.Context, t *storage.Template) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.templates[t.ID]; !ok {
+		return storage.ErrNotFound
+	}
+
+	f.templates[t.ID] = *t
+
+	return nil
+}
+
+func (f *memTemplates) GetTemplate(_ context.Context, id string) (*storage.Template, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.templates[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &t, nil
+}
+
+func (f *memTemplates) ListTemplates(context.Context, int) ([]storage.Template, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.Template{}
+	for _, t := range f.templates {
+		list = append(list, t)
+	}
+
+	return list, nil
+}
+
+func (f *memTemplates) DeleteTemplate(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.templates[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(f.templates, id)
+
+	return nil
+}
+
+// newTemplateServer serves template routes and sendMessage over a fake GREEN-API which keeps sent messages.
+func newTemplateServer(t *testing.T) (*httptest.Server, *[]httpclient.SendMessageRequest) {
+	t.Helper()
+
+	sent := []httpclient.SendMessageRequest{}
+
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var in httpclient.SendMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		sent = append(sent, in)
+		_, _ = io.WriteString(rw, `{"idMessage":"3EB0C767D097B7C7C030"}`)
+	}))
+	t.Cleanup(api.Close)
+
+	clients := httpclient.NewPool(api.URL, api.Client(), map[string]string{testID: testToken})
+	m := templates.New(&memTemplates{templates: make(map[string]storage.Template)})
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/instances/{id}/{method}", handlers.ProxyHandler(clients, nil, m))
+	r.Post("/api/v1/templates", handlers.CreateTemplateHandler(m))
+	r.Get("/api/v1/templates", handlers.TemplatesHandler(m))
+	r.Get("/api/v1/templates/{templateID}", handlers.TemplateHandler(m))
+	r.Patch("/api/v1/templates/{templateID}", handlers.UpdateTemplateHandler(m))
+	r.Delete("/api/v1/templates/{templateID}", handlers.DeleteTemplateHandler(m))
+	r.Post("/api/v1/templates/{templateID}/render", handlers.RenderTemplateHandler(m))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts, &sent
+}
+
+func TestTemplateHandlers(t *testing.T) {
+	ts, sent := newTemplateServer(t)
+
+	var tpl storage.Template
+
+	status := getJSON(t, ts, http.MethodPost, "/api/v1/templates",
+		`{"name":"order ready","body":"Hello {{name}}, order {{order_id}} is ready"}`, &tpl)
+	require.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, []string{"name", "order_id"}, tpl.Variables)
+
+	var list handlers.TemplatesResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/templates", "", &list))
+	assert.Len(t, list.Templates, 1)
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodPatch, "/api/v1/templates/"+tpl.ID,
+		`{"body":"Hi {{name}}, order {{order_id}}"}`, &tpl))
+	assert.Equal(t, "order ready", tpl.Name)
+
+	var out httpclient.SendMessageResponse
+
+	status = getJSON(t, ts, http.MethodPost, "/api/v1/instances/"+testID+"/sendMessage",
+		`{"chatId":"79876543210@c.us","templateId":"`+tpl.ID+`","variables":{"name":"Anna","order_id":"1024"}}`, &out)
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, *sent, 1)
+	assert.Equal(t, "Hi Anna, order 1024", (*sent)[0].Message)
+
+	var rendered handlers.RenderTemplateResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodPost, "/api/v1/templates/"+tpl.ID+"/render",
+		`{"variables":{"name":"Boris","order_id":"1025"}}`, &rendered))
+	assert.Equal(t, "Hi Boris, order 1025", rendered.Message)
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/templates/"+tpl.ID, "", &tpl))
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/api/v1/templates/"+tpl.ID, http.NoBody)
+	require.NoError(t, err)
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestTemplateHandlers_Errors(t *testing.T) {
+	ts, sent := newTemplateServer(t)
+
+	var tpl storage.Template
+
+	require.Equal(t, http.StatusCreated, getJSON(t, ts, http.MethodPost, "/api/v1/templates",
+		`{"name":"greeting","body":"Hello {{name}}"}`, &tpl))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"no name", http.MethodPost, "/api/v1/templates", `{"body":"Hello"}`, http.StatusBadRequest},
+		{"bad body", http.MethodPost, "/api/v1/templates", `{"name":"x","body":"Hello {{name"}`, http.StatusBadRequest},
+		{"no body", http.MethodPost, "/api/v1/templates", ``, http.StatusBadRequest},
+		{"unknown", http.MethodGet, "/api/v1/templates/unknown", ``, http.StatusNotFound},
+		{"update unknown", http.MethodPatch, "/api/v1/templates/unknown", `{"name":"x"}`, http.StatusNotFound},
+		{"delete unknown", http.MethodDelete, "/api/v1/templates/unknown", ``, http.StatusNotFound},
+		{"render missing", http.MethodPost, "/api/v1/templates/" + tpl.ID + "/render", `{}`, http.StatusBadRequest},
+		{
+			"missing variable", http.MethodPost, "/api/v1/instances/" + testID + "/sendMessage",
+			`{"chatId":"79876543210@c.us","templateId":"` + tpl.ID + `"}`, http.StatusBadRequest,
+		},
+		{
+			"unknown template", http.MethodPost, "/api/v1/instances/" + testID + "/sendMessage",
+			`{"chatId":"79876543210@c.us","templateId":"unknown","variables":{"name":"Anna"}}`, http.StatusBadRequest,
+		},
+		{
+			"message and template", http.MethodPost, "/api/v1/instances/" + testID + "/sendMessage",
+			`{"chatId":"79876543210@c.us","message":"hi","templateId":"` + tpl.ID + `"}`, http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp handlers.ErrorResponse
+
+			assert.Equal(t, tt.status, getJSON(t, ts, tt.method, tt.path, tt.body, &resp))
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+
+	assert.Empty(t, *sent)
+}
+
+func TestProxyHandler_TemplatesWithoutDatabase(t *testing.T) {
+	ts, calls := newProxyServer(t, http.StatusOK, `{"idMessage":"3EB0C767D097B7C7C030"}`)
+
+	var resp handlers.ErrorResponse
+
+	status := getJSON(t, ts, http.MethodPost, "/api/v1/instances/"+testID+"/sendMessage",
+		`{"chatId":"79876543210@c.us","templateId":"t1"}`, &resp)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "[handlers]: templates require a database", resp.Error)
+	assert.Empty(t, *calls)
+}
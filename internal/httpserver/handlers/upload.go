@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// DefaultMaxUploadSize is GREEN-API limit of sendFileByUpload.
+const DefaultMaxUploadSize = 100 << 20
+
+// sniffLen is how many bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// multipartOverhead is allowed on top of the file size for form fields and boundaries.
+const multipartOverhead = 64 << 10
+
+var (
+	ErrFileTooLarge    = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("unsupported file type")
+
+	errNotMultipart = errors.New("multipart/form-data is expected")
+	errNoFile       = errors.New("file is required")
+)
+
+// allowedTypes are detected content types accepted for upload. Unknown binaries
+// are detected as application/octet-stream and rejected.
+var allowedTypes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"text/plain",
+	"application/pdf",
+	"application/zip",
+	"application/x-gzip",
+	"application/x-rar-compressed",
+	"application/ogg",
+}
+
+// UploadHandler godoc
+// @Tags Proxy
+// @Summary upload a file from the page and stream it to GREEN-API sendFileByUpload
+// @Description Form fields chatId, fileName, caption and quotedMessageId must precede the file part.
+// @ID sendFileByUpload
+// @Accept  multipart/form-data
+// @Produce json
+// @Param id path string true "idInstance"
+// @Success 200 {object} httpclient.SendFileByUploadResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /api/v1/instances/{id}/sendFileByUpload [post].
+func UploadHandler(clients httpclient.Provider, store storage.Storage, maxSize int64) http.HandlerFunc {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxUploadSize
+	}
+
+	env := &proxyEnv{
+		store: store,
+	}
+
+	return func(rw http.ResponseWriter, r *http.Request) {
+		c, err := clients.Client(chi.URLParam(r, "id"))
+		if err != nil {
+			WriteError(rw, http.StatusNotFound, err)
+			return
+		}
+
+		if r.ContentLength > maxSize+multipartOverhead {
+			WriteError(rw, http.StatusRequestEntityTooLarge, ErrFileTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(rw, r.Body, maxSize+multipartOverhead)
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, errNotMultipart)
+			return
+		}
+
+		in := &httpclient.SendFileByUploadRequest{}
+
+		for {
+			part, err := mr.NextPart()
+			if errors.Is(err, io.EOF) {
+				WriteError(rw, http.StatusBadRequest, errNoFile)
+				return
+			}
+
+			if err != nil {
+				WriteError(rw, http.StatusBadRequest, NewError(err))
+				return
+			}
+
+			if part.FormName() != "file" {
+				if err := readField(in, part); err != nil {
+					WriteError(rw, http.StatusBadRequest, NewError(err))
+					return
+				}
+
+				continue
+			}
+
+			if in.FileName == "" {
+				in.FileName = part.FileName()
+			}
+
+			file := &limitedReader{r: part, left: maxSize}
+
+			// peek the head of the file without buffering the rest
+			br := bufio.NewReaderSize(file, sniffLen)
+
+			head, err := br.Peek(sniffLen)
+			if err != nil && !errors.Is(err, io.EOF) {
+				writeUploadError(rw, err)
+				return
+			}
+
+			contentType := http.DetectContentType(head)
+			if !allowed(contentType) {
+				WriteError(rw, http.StatusUnsupportedMediaType, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType))
+				return
+			}
+
+			in.File = br
+
+			out, err := c.SendFileByUpload(r.Context(), in)
+			env.record(r.Context(), c, httpclient.MethodSendFileByUpload, in.ChatID, in.FileName, uploadID(out), err)
+
+			if err != nil {
+				if file.exceeded {
+					err = ErrFileTooLarge
+				}
+
+				writeUploadError(rw, err)
+
+				return
+			}
+
+			WriteJSON(rw, http.StatusOK, out)
+
+			return
+		}
+	}
+}
+
+func readField(in *httpclient.SendFileByUploadRequest, part *multipart.Part) error {
+	const maxField = 4 << 10
+
+	data, err := io.ReadAll(io.LimitReader(part, maxField))
+	if err != nil {
+		return err
+	}
+
+	value := strings.TrimSpace(string(data))
+
+	switch part.FormName() {
+	case "chatId":
+		in.ChatID = value
+	case "fileName":
+		in.FileName = value
+	case "caption":
+		in.Caption = value
+	case "quotedMessageId":
+		in.QuotedMessageID = value
+	}
+
+	return nil
+}
+
+func writeUploadError(rw http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, ErrFileTooLarge), errors.As(err, &maxErr):
+		WriteError(rw, http.StatusRequestEntityTooLarge, ErrFileTooLarge)
+	default:
+		WriteClientError(rw, err)
+	}
+}
+
+func allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range allowedTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func uploadID(out *httpclient.SendFileByUploadResponse) string {
+	if out == nil {
+		return ""
+	}
+
+	return out.IDMessage
+}
+
+// limitedReader fails with ErrFileTooLarge once more than left bytes are read.
+type limitedReader struct {
+	r        io.Reader
+	left     int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+
+	if l.left < 0 {
+		l.exceeded = true
+		return n, ErrFileTooLarge
+	}
+
+	return n, err
+}
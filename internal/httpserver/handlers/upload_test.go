@@ -0,0 +1,237 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+)
+
+// pngHeader is enough for http.DetectContentType to report image/png.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+type uploaded struct {
+	fields map[string]string
+	file   []byte
+	calls  int
+}
+
+func newUploadServer(t *testing.T, maxSize int64) (*httptest.Server, *uploaded, *fakeStorage) {
+	t.Helper()
+
+	got := &uploaded{fields: make(map[string]string)}
+
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got.calls++
+
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+
+		mr := multipart.NewReader(r.Body, params["boundary"])
+
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+
+			data, err := io.ReadAll(part)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if part.FormName() == "file" {
+				got.file = data
+				continue
+			}
+
+			got.fields[part.FormName()] = string(data)
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		_, err = io.WriteString(rw, `{"idMessage":"3EB0C767D097B7C7C030","urlFile":"https://sw-media.storage.greenapi.net/a.png"}`)
+		require.NoError(t, err)
+	}))
+	t.Cleanup(api.Close)
+
+	store := &fakeStorage{}
+	clients := httpclient.NewPool(api.URL, api.Client(), map[string]string{testID: testToken})
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/instances/{id}/sendFileByUpload", handlers.UploadHandler(clients, store, maxSize))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts, got, store
+}
+
+type formField struct {
+	name     string
+	value    string
+	fileName string
+	data     []byte
+}
+
+func postForm(t *testing.T, ts *httptest.Server, idInstance string, fields []formField) (int, map[string]any) {
+	t.Helper()
+
+	return postFormTo(t, ts.Client(), ts.URL+"/api/v1/instances/"+idInstance+"/sendFileByUpload", fields)
+}
+
+func postFormTo(t *testing.T, client *http.Client, url string, fields []formField) (int, map[string]any) {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	form := multipart.NewWriter(&buf)
+
+	for _, f := range fields {
+		if f.fileName != "" {
+			part, err := form.CreateFormFile(f.name, f.fileName)
+			require.NoError(t, err)
+
+			_, err = part.Write(f.data)
+			require.NoError(t, err)
+
+			continue
+		}
+
+		require.NoError(t, form.WriteField(f.name, f.value))
+	}
+
+	require.NoError(t, form.Close())
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	out := make(map[string]any)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+
+	return resp.StatusCode, out
+}
+
+func TestUploadHandler(t *testing.T) {
+	ts, got, store := newUploadServer(t, 1<<20)
+
+	file := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{1}, 100<<10)...)
+
+	status, out := postForm(t, ts, testID, []formField{
+		{name: "chatId", value: "79876543210@c.us"},
+		{name: "caption", value: "photo"},
+		{name: "file", fileName: "a.png", data: file},
+	})
+	require.Equal(t, http.StatusOK, status, out)
+
+	assert.Equal(t, "3EB0C767D097B7C7C030", out["idMessage"])
+	assert.Equal(t, file, got.file)
+	assert.Equal(t, map[string]string{"chatId": "79876543210@c.us", "fileName": "a.png", "caption": "photo"}, got.fields)
+
+	require.Len(t, store.messages, 1)
+	assert.Equal(t, httpclient.MethodSendFileByUpload, store.messages[0].Method)
+	assert.Equal(t, "a.png", store.messages[0].Body)
+	assert.Equal(t, "3EB0C767D097B7C7C030", store.messages[0].IDMessage)
+}
+
+func TestUploadHandler_Errors(t *testing.T) {
+	png := append(append([]byte{}, pngHeader...), 1, 2, 3)
+
+	tests := []struct {
+		name       string
+		idInstance string
+		wantError  string
+		fields     []formField
+		wantStatus int
+	}{
+		{
+			name:       "unknown instance",
+			idInstance: "1101000002",
+			fields:     []formField{{name: "file", fileName: "a.png", data: png}},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "no file",
+			idInstance: testID,
+			fields:     []formField{{name: "chatId", value: "79876543210@c.us"}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "file is required",
+		},
+		{
+			name:       "chatId after file",
+			idInstance: testID,
+			fields: []formField{
+				{name: "file", fileName: "a.png", data: png},
+				{name: "chatId", value: "79876543210@c.us"},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "[httpclient]: invalid request: chatId is required",
+		},
+		{
+			name:       "unsupported type",
+			idInstance: testID,
+			fields: []formField{
+				{name: "chatId", value: "79876543210@c.us"},
+				{name: "file", fileName: "a.exe", data: []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff")},
+			},
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantError:  "unsupported file type: application/octet-stream",
+		},
+		{
+			name:       "too large",
+			idInstance: testID,
+			fields: []formField{
+				{name: "chatId", value: "79876543210@c.us"},
+				{name: "file", fileName: "a.png", data: append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{1}, 2<<10)...)},
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantError:  "file is too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, _, _ := newUploadServer(t, 1<<10)
+
+			status, out := postForm(t, ts, tt.idInstance, tt.fields)
+			assert.Equal(t, tt.wantStatus, status)
+
+			if tt.wantError != "" {
+				assert.Equal(t, tt.wantError, out["error"])
+			}
+		})
+	}
+}
+
+func TestUploadHandler_NotMultipart(t *testing.T) {
+	ts, got, _ := newUploadServer(t, 1<<20)
+
+	resp, err := ts.Client().Post(ts.URL+"/api/v1/instances/"+testID+"/sendFileByUpload", "application/json",
+		strings.NewReader(`{"chatId":"79876543210@c.us"}`))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, 0, got.calls)
+}
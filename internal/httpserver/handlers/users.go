@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// maxUserBody limits the body of user requests, they carry a username and a password.
+const maxUserBody = 4 << 10
+
+type UsersResponse struct {
+	Users []storage.User `json:"users"`
+}
+
+// CreateUserHandler godoc
+// @Tags Users
+// @Summary create an account of the web interface, the password is stored as bcrypt hash
+// @ID createUser
+// @Accept  json
+// @Produce json
+// @Param request body auth.UserRequest true "username and password of 8 to 72 bytes"
+// @Success 201 {object} storage.User
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/users [post].
+func CreateUserHandler(users *auth.Users) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, err := decode[auth.UserRequest](io.LimitReader(r.Body, maxUserBody))
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		u, err := users.Create(r.Context(), req)
+		if err != nil {
+			writeUserError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusCreated, u)
+	}
+}
+
+// UsersHandler godoc
+// @Tags Users
+// @Summary accounts by username, without password hashes
+// @ID users
+// @Produce json
+// @Success 200 {object} UsersResponse
+// @Router /api/v1/users [get].
+func UsersHandler(users *auth.Users) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		list, err := users.List(r.Context())
+		if err != nil {
+			writeUserError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, UsersResponse{Users: list})
+	}
+}
+
+// UpdateUserHandler godoc
+// @Tags Users
+// @Summary change the password, sessions of the user are ended
+// @ID updateUser
+// @Accept  json
+// @Produce json
+// @Param username path string true "username"
+// @Param request body auth.UserRequest true "new password"
+// @Success 200 {object} storage.User
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/users/{username} [patch].
+func UpdateUserHandler(users *auth.Users) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		req, err := decode[auth.UserRequest](io.LimitReader(r.Body, maxUserBody))
+		if err != nil {
+			WriteError(rw, http.StatusBadRequest, err)
+			return
+		}
+
+		u, err := users.SetPassword(r.Context(), chi.URLParam(r, "username"), req.Password)
+		if err != nil {
+			writeUserError(rw, err)
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, u)
+	}
+}
+
+// DeleteUserHandler godoc
+// @Tags Users
+// @Summary delete the account, its sessions are ended
+// @ID deleteUser
+// @Param username path string true "username"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/users/{username} [delete].
+func DeleteUserHandler(users *auth.Users) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if err := users.Delete(r.Context(), chi.URLParam(r, "username")); err != nil {
+			writeUserError(rw, err)
+			return
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeUserError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrNotFound), errors.Is(err, auth.ErrRoleNotFound):
+		WriteError(rw, http.StatusNotFound, err)
+	case errors.Is(err, auth.ErrExists):
+		WriteError(rw, http.StatusConflict, err)
+	case errors.Is(err, auth.ErrInvalid), errors.Is(err, auth.ErrRole):
+		WriteError(rw, http.StatusBadRequest, err)
+	default:
+		logger.Errorln(err)
+		WriteError(rw, http.StatusInternalServerError, errors.New("internal server error"))
+	}
+}
@@ -0,0 +1,178 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// memUsers is an in-memory UserStorage.
+type memUsers struct {
+	users map[string]storage.User
+	mu    sync.Mutex
+}
+
+func (f *memUsers) SaveUser(_ context.Context, u *storage.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, other := range f.users {
+		if other.Username == u.Username {
+			return storage.ErrDuplicate
+		}
+	}
+
+	f.users[u.ID] = *u
+
+	return nil
+}
+
+func (f *memUsers) GetUser(_ context.Context, id string) (*storage.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &u, nil
+}
+
+func (f *memUsers) GetUserByName(_ context.Context, username string) (*storage.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range f.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (f *memUsers) ListUsers(context.Context) ([]storage.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.User{}
+	for _, u := range f.users {
+		list = append(list, u)
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Username < list[b].Username })
+
+	return list, nil
+}
+
+func (f *memUsers) UpdateUserPassword(_ context.Context, u *storage.User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.users[u.ID]; !ok {
+		return storage.ErrNotFound
+	}
+
+	f.users[u.ID] = *u
+
+	return nil
+}
+
+func (f *memUsers) DeleteUser(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.users[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(f.users, id)
+
+	return nil
+}
+
+func newTestUsers() *auth.Users {
+	return auth.NewUsers(&memUsers{users: make(map[string]storage.User)}).SetCost(bcrypt.MinCost)
+}
+
+func newUsersServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	users := newTestUsers()
+
+	r := chi.NewRouter()
+	r.Post("/api/v1/users", handlers.CreateUserHandler(users))
+	r.Get("/api/v1/users", handlers.UsersHandler(users))
+	r.Patch("/api/v1/users/{username}", handlers.UpdateUserHandler(users))
+	r.Delete("/api/v1/users/{username}", handlers.DeleteUserHandler(users))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestUsersHandlers(t *testing.T) {
+	ts := newUsersServer(t)
+
+	status, body := rawBody(t, ts, http.MethodPost, "/api/v1/users", `{"username":"alice","password":"correct horse"}`)
+	require.Equal(t, http.StatusCreated, status, body)
+	assert.Contains(t, body, `"username":"alice"`)
+	assert.NotContains(t, body, "password")
+
+	status, body = rawBody(t, ts, http.MethodPatch, "/api/v1/users/alice", `{"password":"battery staple"}`)
+	require.Equal(t, http.StatusOK, status, body)
+
+	var list handlers.UsersResponse
+
+	require.Equal(t, http.StatusOK, getJSON(t, ts, http.MethodGet, "/api/v1/users", "", &list))
+	require.Len(t, list.Users, 1)
+	assert.Equal(t, "alice", list.Users[0].Username)
+
+	status, _ = rawBody(t, ts, http.MethodDelete, "/api/v1/users/alice", "")
+	assert.Equal(t, http.StatusNoContent, status)
+}
+
+func TestUsersHandlers_Errors(t *testing.T) {
+	ts := newUsersServer(t)
+
+	status, body := rawBody(t, ts, http.MethodPost, "/api/v1/users", `{"username":"alice","password":"correct horse"}`)
+	require.Equal(t, http.StatusCreated, status, body)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"no body", http.MethodPost, "/api/v1/users", ``, http.StatusBadRequest},
+		{"bad json", http.MethodPost, "/api/v1/users", `{`, http.StatusBadRequest},
+		{"short password", http.MethodPost, "/api/v1/users", `{"username":"bob","password":"short"}`, http.StatusBadRequest},
+		{"taken", http.MethodPost, "/api/v1/users", `{"username":"alice","password":"correct horse"}`, http.StatusConflict},
+		{"update unknown", http.MethodPatch, "/api/v1/users/bob", `{"password":"correct horse"}`, http.StatusNotFound},
+		{"delete unknown", http.MethodDelete, "/api/v1/users/bob", ``, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp handlers.ErrorResponse
+
+			assert.Equal(t, tt.status, getJSON(t, ts, tt.method, tt.path, tt.body, &resp))
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/notifications"
+)
+
+// maxWebhookBody limits webhook payload size, notifications carry links to files, not files.
+const maxWebhookBody = 1 << 20
+
+type WebhookResponse struct {
+	Status string `json:"status"`
+}
+
+var (
+	errUnauthorized      = errors.New("unauthorized")
+	errInstanceMismatch  = errors.New("instanceData.idInstance does not match the url")
+	errEmptyNotification = errors.New("typeWebhook is empty")
+	errWebhookFailed     = errors.New("failed to handle webhook")
+)
+
+// WebhookHandler godoc
+// @Tags Notifications
+// @Summary receive GREEN-API webhook of the instance
+// @ID webhook
+// @Accept  json
+// @Produce json
+// @Param idInstance path string true "idInstance"
+// @Param Authorization header string true "Bearer webhookUrlToken"
+// @Success 200 {object} WebhookResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks/greenapi/{idInstance} [post].
+func WebhookHandler(clients httpclient.Provider, token string, dispatcher *notifications.Dispatcher,
+	dedup *notifications.Deduplicator) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			WriteError(rw, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+
+		idInstance := chi.URLParam(r, "idInstance")
+
+		if _, err := clients.Client(idInstance); err != nil {
+			WriteError(rw, http.StatusNotFound, err)
+			return
+		}
+
+		var w httpclient.Webhook
+		if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxWebhookBody)).Decode(&w); err != nil {
+			WriteError(rw, http.StatusBadRequest, NewError(err))
+			return
+		}
+
+		if w.TypeWebhook == "" {
+			WriteError(rw, http.StatusBadRequest, errEmptyNotification)
+			return
+		}
+
+		if w.InstanceData != nil && strconv.FormatInt(w.InstanceData.IDInstance, 10) != idInstance {
+			WriteError(rw, http.StatusBadRequest, errInstanceMismatch)
+			return
+		}
+
+		key := notifications.Key(idInstance, &w)
+
+		if dedup != nil {
+			// duplicates are acknowledged, otherwise GREEN-API keeps retrying them
+			seen, err := dedup.Seen(r.Context(), key)
+			if err != nil {
+				logger.Warnw("failed to check repeated webhook", "instance", idInstance, "error", err)
+			}
+
+			if seen {
+				WriteJSON(rw, http.StatusOK, WebhookResponse{Status: "duplicate"})
+				return
+			}
+		}
+
+		// failed notification is forgotten and answered with an error, so GREEN-API delivers it again
+		if err := dispatcher.Dispatch(r.Context(), idInstance, &w); err != nil {
+			logger.Errorw("failed to handle webhook", "instance", idInstance, "error", err)
+
+			if dedup != nil {
+				if err := dedup.Forget(context.WithoutCancel(r.Context()), key); err != nil {
+					logger.Warnw("failed to forget webhook", "instance", idInstance, "error", err)
+				}
+			}
+
+			WriteError(rw, http.StatusInternalServerError, errWebhookFailed)
+
+			return
+		}
+
+		WriteJSON(rw, http.StatusOK, WebhookResponse{Status: "ok"})
+	}
+}
+
+// authorized checks "Authorization: Bearer {webhookUrlToken}". Empty token rejects every webhook.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	want := []byte("Bearer " + token)
+	got := []byte(r.Header.Get("Authorization"))
+
+	return subtle.ConstantTimeCompare(want, got) == 1
+}
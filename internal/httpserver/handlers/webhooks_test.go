@@ -0,0 +1,210 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/notifications"
+)
+
+const webhookToken = "webhook-secret"
+
+const webhookPayload = `{
+	"typeWebhook":"incomingMessageReceived",
+	"instanceData":{"idInstance":1101000001,"wid":"79876543210@c.us","typeInstance":"whatsapp"},
+	"timestamp":1588091580,
+	"idMessage":"F7AEC1B7086ECDC7E6E45923F5EDB825",
+	"senderData":{"chatId":"79001234568@c.us","sender":"79001234568@c.us","senderName":"Green API"},
+	"messageData":{"typeMessage":"textMessage","textMessageData":{"textMessage":"I use Green-API"}}
+}`
+
+func newWebhookServer(t *testing.T, token string) (*httptest.Server, *[]*httpclient.Webhook) {
+	t.Helper()
+
+	received := make([]*httpclient.Webhook, 0)
+
+	d := notifications.NewDispatcher().HandleFunc("", func(_ context.Context, idInstance string, w *httpclient.Webhook) error {
+		assert.Equal(t, testID, idInstance)
+
+		received = append(received, w)
+
+		return nil
+	})
+
+	clients := httpclient.NewPool("", nil, map[string]string{testID: testToken})
+
+	r := chi.NewRouter()
+	r.Post("/webhooks/greenapi/{idInstance}", handlers.WebhookHandler(clients, token, d,
+		notifications.NewDeduplicator(notifications.DefaultDedupTTL)))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return ts, &received
+}
+
+func postWebhook(t *testing.T, ts *httptest.Server, idInstance, authorization, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+		ts.URL+"/webhooks/greenapi/"+idInstance, strings.NewReader(body))
+	require.NoError(t, err)
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, string(data)
+}
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		idInstance    string
+		authorization string
+		body          string
+		wantBody      string
+		wantStatus    int
+	}{
+		{
+			name:       "no authorization",
+			idInstance: testID,
+			body:       webhookPayload,
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `{"error":"unauthorized"}`,
+		},
+		{
+			name:          "wrong token",
+			idInstance:    testID,
+			authorization: "Bearer nope",
+			body:          webhookPayload,
+			wantStatus:    http.StatusUnauthorized,
+			wantBody:      `{"error":"unauthorized"}`,
+		},
+		{
+			name:          "unknown instance",
+			idInstance:    "1101000002",
+			authorization: "Bearer " + webhookToken,
+			body:          webhookPayload,
+			wantStatus:    http.StatusNotFound,
+		},
+		{
+			name:          "broken json",
+			idInstance:    testID,
+			authorization: "Bearer " + webhookToken,
+			body:          `{"typeWebhook":`,
+			wantStatus:    http.StatusBadRequest,
+		},
+		{
+			name:          "no type",
+			idInstance:    testID,
+			authorization: "Bearer " + webhookToken,
+			body:          `{"idMessage":"1"}`,
+			wantStatus:    http.StatusBadRequest,
+			wantBody:      `{"error":"typeWebhook is empty"}`,
+		},
+		{
+			name:          "instance mismatch",
+			idInstance:    testID,
+			authorization: "Bearer " + webhookToken,
+			body:          `{"typeWebhook":"stateInstanceChanged","instanceData":{"idInstance":1101000002}}`,
+			wantStatus:    http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, received := newWebhookServer(t, webhookToken)
+
+			status, body := postWebhook(t, ts, tt.idInstance, tt.authorization, tt.body)
+			assert.Equal(t, tt.wantStatus, status)
+
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, body)
+			}
+
+			assert.Empty(t, *received)
+		})
+	}
+}
+
+func TestWebhookHandler_Dispatch(t *testing.T) {
+	ts, received := newWebhookServer(t, webhookToken)
+
+	status, body := postWebhook(t, ts, testID, "Bearer "+webhookToken, webhookPayload)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"status":"ok"}`, body)
+
+	require.Len(t, *received, 1)
+	assert.Equal(t, "I use Green-API", (*received)[0].MessageData.Text())
+	assert.JSONEq(t, webhookPayload, string((*received)[0].Raw))
+
+	status, body = postWebhook(t, ts, testID, "Bearer "+webhookToken, webhookPayload)
+	assert.Equal(t, http.StatusOK, status, "duplicate must be acknowledged")
+	assert.JSONEq(t, `{"status":"duplicate"}`, body)
+	assert.Len(t, *received, 1, "duplicate must not be dispatched")
+}
+
+func TestWebhookHandler_Failed(t *testing.T) {
+	calls := 0
+
+	d := notifications.NewDispatcher().HandleFunc("", func(context.Context, string, *httpclient.Webhook) error {
+		calls++
+		if calls == 1 {
+			return errors.New("database is down")
+		}
+
+		return nil
+	})
+
+	clients := httpclient.NewPool("", nil, map[string]string{testID: testToken})
+
+	r := chi.NewRouter()
+	r.Post("/webhooks/greenapi/{idInstance}", handlers.WebhookHandler(clients, webhookToken, d,
+		notifications.NewDeduplicator(notifications.DefaultDedupTTL)))
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	status, body := postWebhook(t, ts, testID, "Bearer "+webhookToken, webhookPayload)
+	assert.Equal(t, http.StatusInternalServerError, status, "failed notification must be delivered again")
+	assert.JSONEq(t, `{"error":"failed to handle webhook"}`, body)
+
+	status, body = postWebhook(t, ts, testID, "Bearer "+webhookToken, webhookPayload)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"status":"ok"}`, body)
+	assert.Equal(t, 2, calls, "repeated delivery of failed notification must be dispatched")
+
+	status, body = postWebhook(t, ts, testID, "Bearer "+webhookToken, webhookPayload)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"status":"duplicate"}`, body)
+	assert.Equal(t, 2, calls)
+}
+
+func TestWebhookHandler_EmptyToken(t *testing.T) {
+	ts, received := newWebhookServer(t, "")
+
+	status, _ := postWebhook(t, ts, testID, "Bearer ", webhookPayload)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Empty(t, *received)
+}
@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
+	"github.com/ole-larsen/green-api/internal/log"
+)
+
+// AuthMiddleware passes requests with a valid session or API key in "Authorization: Bearer" header and
+// puts the identity into the request context. Pages opened without a session are redirected to the login
+// page, other requests are 401. Keys can be nil, then only sessions are accepted.
+func AuthMiddleware(sessions *auth.Sessions, keys *auth.APIKeys) Middleware {
+	return func(h http.Handler) http.Handler {
+		logFn := func(rw http.ResponseWriter, r *http.Request) {
+			var (
+				identity *auth.Identity
+				err      error
+			)
+
+			if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && keys != nil {
+				identity, err = keys.Authenticate(r.Context(), key)
+			} else {
+				identity, err = sessions.Authenticate(rw, r)
+			}
+
+			if errors.Is(err, auth.ErrAPIKey) {
+				handlers.UnauthorizedRequest(rw, r)
+				return
+			}
+
+			if errors.Is(err, auth.ErrSession) {
+				if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+					http.Redirect(rw, r, handlers.LoginURL(r.URL.RequestURI()), http.StatusFound)
+					return
+				}
+
+				handlers.UnauthorizedRequest(rw, r)
+
+				return
+			}
+
+			if err != nil {
+				log.NewLogger("info", log.DefaultBuildLogger).Errorln(err)
+				handlers.InternalServerErrorRequest(rw, r)
+
+				return
+			}
+
+			h.ServeHTTP(rw, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+		}
+
+		return http.HandlerFunc(logFn)
+	}
+}
+
+// ScopeMiddleware rejects identities without the scope on any instance with 403, for routes that do not
+// use instances.
+func ScopeMiddleware(scope auth.Scope) Middleware {
+	return func(h http.Handler) http.Handler {
+		logFn := func(rw http.ResponseWriter, r *http.Request) {
+			if identity, ok := auth.FromContext(r.Context()); ok && !identity.Allows(scope) {
+				handlers.Forbidden(rw, identity, scope, "any instance")
+				return
+			}
+
+			h.ServeHTTP(rw, r)
+		}
+
+		return http.HandlerFunc(logFn)
+	}
+}
+
+// AllInstancesMiddleware rejects identities without the scope on every instance with 403, for routes
+// that serve all of them: jobs, campaigns, the registry, users and keys.
+func AllInstancesMiddleware(scope auth.Scope) Middleware {
+	return func(h http.Handler) http.Handler {
+		logFn := func(rw http.ResponseWriter, r *http.Request) {
+			if identity, ok := auth.FromContext(r.Context()); ok && !identity.AllowsInstance(auth.AllInstances, scope) {
+				handlers.Forbidden(rw, identity, scope, "every instance")
+				return
+			}
+
+			h.ServeHTTP(rw, r)
+		}
+
+		return http.HandlerFunc(logFn)
+	}
+}
+
+// InstanceMiddleware rejects identities without the scope on the instance {id} of the route with 403.
+// The instance is resolved by clients, so roles and keys given by idInstance apply to its registered name.
+func InstanceMiddleware(clients httpclient.Provider, scope auth.Scope) Middleware {
+	return instanceMiddleware(clients, func(*http.Request) auth.Scope {
+		return scope
+	})
+}
+
+// ProxyInstanceMiddleware rejects identities without the scope of the proxied GREEN-API method on
+// the instance {id} of the route with 403, e.g. viewers can't send and operators can't reboot.
+func ProxyInstanceMiddleware(clients httpclient.Provider) Middleware {
+	return instanceMiddleware(clients, handlers.ProxyScope)
+}
+
+func instanceMiddleware(clients httpclient.Provider, scopeOf func(*http.Request) auth.Scope) Middleware {
+	return func(h http.Handler) http.Handler {
+		logFn := func(rw http.ResponseWriter, r *http.Request) {
+			scope := scopeOf(r)
+			key := chi.URLParam(r, "id")
+
+			// unknown instances are reported by the handler to those who may use every instance
+			if identity, ok := auth.FromContext(r.Context()); ok && !handlers.AllowsInstance(r, clients, key, scope) {
+				handlers.Forbidden(rw, identity, scope, "instance "+key)
+				return
+			}
+
+			h.ServeHTTP(rw, r)
+		}
+
+		return http.HandlerFunc(logFn)
+	}
+}
@@ -0,0 +1,107 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/httpserver/middlewares"
+)
+
+const (
+	instanceA = "1101000001"
+	instanceB = "1101000002"
+)
+
+// withIdentity puts the identity into requests as AuthMiddleware does, nil leaves them without one.
+func withIdentity(identity *auth.Identity) middlewares.Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if identity != nil {
+				r = r.WithContext(auth.WithIdentity(r.Context(), identity))
+			}
+
+			h.ServeHTTP(rw, r)
+		})
+	}
+}
+
+func okHandler(rw http.ResponseWriter, _ *http.Request) {
+	rw.WriteHeader(http.StatusOK)
+}
+
+func TestInstanceMiddlewares(t *testing.T) {
+	clients := httpclient.NewPool("", nil, map[string]string{instanceA: "token-a", instanceB: "token-b"})
+
+	user := func(roles map[string]auth.Role) *auth.Identity {
+		return &auth.Identity{UserID: "u1", Username: "anna", Roles: roles}
+	}
+
+	operatorA := user(map[string]auth.Role{instanceA: auth.RoleOperator})
+	viewer := user(map[string]auth.Role{auth.AllInstances: auth.RoleViewer, instanceA: auth.RoleAdmin})
+	admin := user(map[string]auth.Role{auth.AllInstances: auth.RoleAdmin})
+	key := &auth.Identity{KeyID: "k1", KeyName: "billing", Scopes: []auth.Scope{auth.ScopeSend},
+		Instances: []string{instanceB}}
+
+	tests := []struct {
+		identity *auth.Identity
+		name     string
+		method   string
+		path     string
+		status   int
+	}{
+		{nil, "auth is disabled", http.MethodGet, "/instances/" + instanceB + "/getChatHistory", http.StatusOK},
+		{operatorA, "operator reads its instance", http.MethodPost, "/instances/" + instanceA + "/getChatHistory",
+			http.StatusOK},
+		{operatorA, "operator sends with its instance", http.MethodPost, "/instances/" + instanceA + "/sendMessage",
+			http.StatusOK},
+		{operatorA, "operator can't reboot", http.MethodGet, "/instances/" + instanceA + "/reboot", http.StatusForbidden},
+		{operatorA, "operator of another instance", http.MethodPost, "/instances/" + instanceB + "/getChatHistory",
+			http.StatusForbidden},
+		{operatorA, "unknown instance", http.MethodPost, "/instances/unknown/getChatHistory", http.StatusForbidden},
+		{operatorA, "upload to its instance", http.MethodPost, "/instances/" + instanceA + "/upload", http.StatusOK},
+		{operatorA, "upload to another instance", http.MethodPost, "/instances/" + instanceB + "/upload",
+			http.StatusForbidden},
+		{operatorA, "jobs of every instance", http.MethodGet, "/jobs", http.StatusForbidden},
+		{operatorA, "chat ids", http.MethodGet, "/chatid", http.StatusOK},
+		{viewer, "viewer of every instance reads", http.MethodGet, "/instances/" + instanceB + "/getChatHistory",
+			http.StatusOK},
+		{viewer, "viewer can't send", http.MethodPost, "/instances/" + instanceB + "/sendMessage", http.StatusForbidden},
+		{viewer, "admin of the instance reboots it", http.MethodGet, "/instances/" + instanceA + "/reboot",
+			http.StatusOK},
+		{viewer, "viewer reads jobs", http.MethodGet, "/jobs", http.StatusOK},
+		{viewer, "admin of the instance can't manage users", http.MethodGet, "/users", http.StatusForbidden},
+		{admin, "admin manages users", http.MethodGet, "/users", http.StatusOK},
+		{admin, "admin gets unknown instances to the handler", http.MethodGet, "/instances/unknown/reboot",
+			http.StatusOK},
+		{user(nil), "user without roles", http.MethodGet, "/chatid", http.StatusForbidden},
+		{key, "key sends with its instance", http.MethodPost, "/instances/" + instanceB + "/sendMessage", http.StatusOK},
+		{key, "key without read scope", http.MethodPost, "/instances/" + instanceB + "/getChatHistory",
+			http.StatusForbidden},
+		{key, "key of another instance", http.MethodPost, "/instances/" + instanceA + "/sendMessage",
+			http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Use(withIdentity(tt.identity))
+			r.With(middlewares.ScopeMiddleware(auth.ScopeRead)).Get("/chatid", okHandler)
+			r.With(middlewares.AllInstancesMiddleware(auth.ScopeRead)).Get("/jobs", okHandler)
+			r.With(middlewares.AllInstancesMiddleware(auth.ScopeAdmin)).Get("/users", okHandler)
+			r.With(middlewares.InstanceMiddleware(clients, auth.ScopeSend)).Post("/instances/{id}/upload", okHandler)
+			r.With(middlewares.ProxyInstanceMiddleware(clients)).Get("/instances/{id}/{method}", okHandler)
+			r.With(middlewares.ProxyInstanceMiddleware(clients)).Post("/instances/{id}/{method}", okHandler)
+
+			rw := httptest.NewRecorder()
+			r.ServeHTTP(rw, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.status, rw.Code, rw.Body.String())
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/hash"
+	"github.com/ole-larsen/green-api/internal/httpserver/middlewares"
+)
+
+const testSecret = "supersecret"
+
+func echo(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+
+	if _, err := rw.Write(body); err != nil {
+		logger.Errorln(err)
+	}
+}
+
+func TestHashMiddleware(t *testing.T) {
+	body := []byte(`{"chatId":"79876543210@c.us","message":"hello"}`)
+
+	tests := []struct {
+		name       string
+		secret     string
+		method     string
+		signature  string
+		want       string
+		status     int
+		wantSigned bool
+	}{
+		{
+			name:       "valid signature",
+			secret:     testSecret,
+			method:     http.MethodPost,
+			signature:  hash.Sign(testSecret, body),
+			status:     http.StatusCreated,
+			want:       string(body),
+			wantSigned: true,
+		},
+		{
+			name:       "wrong signature",
+			secret:     testSecret,
+			method:     http.MethodPost,
+			signature:  hash.Sign("othersecret", body),
+			status:     http.StatusBadRequest,
+			want:       "400 bad request\n",
+			wantSigned: false,
+		},
+		{
+			name:       "unsigned request",
+			secret:     testSecret,
+			method:     http.MethodPost,
+			status:     http.StatusCreated,
+			want:       string(body),
+			wantSigned: true,
+		},
+		{
+			name:       "disabled without secret",
+			method:     http.MethodPost,
+			signature:  "deadbeef",
+			status:     http.StatusCreated,
+			want:       string(body),
+			wantSigned: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", bytes.NewReader(body))
+			if tt.signature != "" {
+				r.Header.Set(hash.Header, tt.signature)
+			}
+
+			w := httptest.NewRecorder()
+			middlewares.HashMiddleware(tt.secret, 0)(http.HandlerFunc(echo)).ServeHTTP(w, r)
+
+			resp := w.Result()
+
+			defer func() {
+				require.NoError(t, resp.Body.Close())
+			}()
+
+			got, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.want, string(got))
+
+			if tt.wantSigned {
+				assert.True(t, hash.Verify(tt.secret, got, resp.Header.Get(hash.Header)))
+			} else {
+				assert.Empty(t, resp.Header.Get(hash.Header))
+			}
+		})
+	}
+}
+
+func TestHashMiddleware_Streaming(t *testing.T) {
+	stream := func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(rw, "first ")
+		_ = http.NewResponseController(rw).Flush()
+		_, _ = io.WriteString(rw, "second")
+	}
+
+	tests := []struct {
+		handler http.HandlerFunc
+		name    string
+		path    string
+	}{
+		{name: "flushed response", path: "/events", handler: stream},
+		{name: "unsigned path", path: "/debug/pprof/", handler: echo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h := middlewares.HashMiddleware(testSecret, 0, "/debug/")(middlewares.LoggingMiddleware(tt.handler))
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, http.NoBody))
+
+			assert.Empty(t, w.Header().Get(hash.Header), "streamed responses are not signed")
+		})
+	}
+
+	w := httptest.NewRecorder()
+	middlewares.HashMiddleware(testSecret, 0)(http.HandlerFunc(stream)).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", http.NoBody))
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, "first second", w.Body.String())
+}
+
+func TestHashMiddleware_Limits(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 64)
+	upload := "--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nhello\r\n--b--\r\n"
+
+	tests := []struct {
+		name        string
+		contentType string
+		signature   string
+		want        string
+		body        []byte
+		status      int
+		wantSigned  bool
+	}{
+		{
+			name:       "too large request",
+			signature:  hash.Sign(testSecret, large),
+			body:       large,
+			status:     http.StatusRequestEntityTooLarge,
+			want:       "413 request entity too large\n",
+			wantSigned: false,
+		},
+		{
+			name:        "upload is streamed unverified",
+			contentType: "multipart/form-data; boundary=b",
+			signature:   hash.Sign("othersecret", []byte(upload)),
+			body:        []byte(upload),
+			status:      http.StatusCreated,
+			want:        upload,
+			wantSigned:  false,
+		},
+		{
+			name:       "small response is signed",
+			body:       []byte(`{"ok":true}`),
+			status:     http.StatusCreated,
+			want:       `{"ok":true}`,
+			wantSigned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.signature != "" {
+				r.Header.Set(hash.Header, tt.signature)
+			}
+
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			w := httptest.NewRecorder()
+			middlewares.HashMiddleware(testSecret, 32)(http.HandlerFunc(echo)).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.want, w.Body.String())
+
+			if tt.wantSigned {
+				assert.True(t, hash.Verify(testSecret, w.Body.Bytes(), w.Header().Get(hash.Header)))
+			} else {
+				assert.Empty(t, w.Header().Get(hash.Header))
+			}
+		})
+	}
+}
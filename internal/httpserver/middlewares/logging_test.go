@@ -0,0 +1,53 @@
+package middlewares_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpserver/middlewares"
+)
+
+// countingReader counts bytes read from the request body.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+
+	return n, err
+}
+
+func TestLoggingMiddleware_StreamsBody(t *testing.T) {
+	payload := strings.Repeat("a", 1<<20)
+	body := &countingReader{r: strings.NewReader(payload)}
+
+	var got int
+
+	h := middlewares.LoggingMiddleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, 0, body.read, "body must not be read before the handler")
+
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		got = len(data)
+
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	rw := httptest.NewRecorder()
+
+	h.ServeHTTP(rw, req)
+
+	assert.Equal(t, len(payload), got)
+	assert.Equal(t, http.StatusInternalServerError, rw.Code)
+}
@@ -4,13 +4,19 @@ package middlewares
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/hash"
+	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
 	"github.com/ole-larsen/green-api/internal/log"
 )
 
@@ -28,38 +34,37 @@ func Conveyor(h http.Handler, ms ...Middleware) http.Handler {
 	return h
 }
 
+// LoggingMiddleware logs failed requests. The body is not buffered: it is streamed to the handler
+// and only the first maxLoggedBody bytes read by the handler are kept for the log.
 func LoggingMiddleware(next http.Handler) http.Handler {
 	logFn := func(rw http.ResponseWriter, r *http.Request) {
 		logger := log.NewLogger("info", log.DefaultBuildLogger)
-		body, err := io.ReadAll(r.Body)
-
-		defer func() {
-			e := r.Body.Close()
-			if e != nil {
-				logger.Errorln(e)
-				return
-			}
-		}()
 
 		start := time.Now()
 
+		captured := &headBuffer{limit: maxLoggedBody}
+
 		lw := LoggingResponseWriter{
 			ResponseWriter: rw,
 			ResponseData: &ResponseData{
 				RequestURI: r.RequestURI,
-				Body:       body,
 				Status:     0,
 				Size:       0,
 			},
 		}
 
-		if err == nil {
-			r.Body = io.NopCloser(bytes.NewReader(body))
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &teeReadCloser{
+				Reader: io.TeeReader(r.Body, captured),
+				Closer: r.Body,
+			}
 		}
 
 		next.ServeHTTP(&lw, r)
 
-		err = dumpRequest(logger, &lw, r, start)
+		lw.ResponseData.Body = captured.Bytes()
+
+		err := dumpRequest(logger, &lw, r, start)
 		if err != nil {
 			logger.Errorln(err)
 		}
@@ -106,54 +111,138 @@ func LengthContentMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func HashMiddleware(h http.Handler) http.Handler {
-	logFn := func(rw http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.ServeHTTP(rw, r)
-			return
-		}
+// HashMiddleware verifies HashSHA256 header of the request as HMAC-SHA256 of the body keyed with secret
+// and signs the response the same way. Requests without the header are passed as is.
+// Bodies are signed uncompressed, so the middleware goes inside GzipMiddleware. Signed bodies are read
+// up to maxSize, the upload limit, larger ones get 413; responses over it are streamed unsigned.
+// Multipart uploads are streamed to GREEN-API and not verified. Responses of paths under unsigned
+// prefixes are streamed without the signature. Empty secret disables the middleware.
+func HashMiddleware(secret string, maxSize int64, unsigned ...string) Middleware {
+	if maxSize <= 0 {
+		maxSize = handlers.DefaultMaxUploadSize
+	}
 
-		encrypted := r.Header.Get("HashSHA256")
-		if encrypted == "" {
-			h.ServeHTTP(rw, r)
-			return
-		}
+	return func(h http.Handler) http.Handler {
+		logFn := func(rw http.ResponseWriter, r *http.Request) {
+			if secret == "" {
+				h.ServeHTTP(rw, r)
+				return
+			}
 
-		var body = make([]byte, 0)
+			for _, prefix := range unsigned {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					h.ServeHTTP(rw, r)
+					return
+				}
+			}
 
-		// modify request body
-		r.Body = io.NopCloser(bytes.NewReader(body))
+			if sum := r.Header.Get(hash.Header); sum != "" && !multipartRequest(r) {
+				body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxSize))
+				if err != nil {
+					var maxErr *http.MaxBytesError
+					if errors.As(err, &maxErr) {
+						handlers.TooLargeRequest(rw, r)
+						return
+					}
 
-		// serve next
-		h.ServeHTTP(rw, r)
-	}
+					handlers.BadRequest(rw, r)
+					return
+				}
 
-	return http.HandlerFunc(logFn)
-}
+				if !hash.Verify(secret, body, sum) {
+					handlers.BadRequest(rw, r)
+					return
+				}
 
-func RSAMiddleware(h http.Handler) http.Handler {
-	logFn := func(rw http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.ServeHTTP(rw, r)
-			return
+				// restore request body
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			hw := &HashResponseWriter{
+				ResponseWriter: rw,
+				secret:         secret,
+				limit:          maxSize,
+			}
+
+			// serve next
+			h.ServeHTTP(hw, r)
+
+			if err := hw.flush(); err != nil {
+				return
+			}
 		}
 
-		var (
-			body = make([]byte, 0)
-		)
+		return http.HandlerFunc(logFn)
+	}
+}
 
-		// modify request body
-		r.Body = io.NopCloser(bytes.NewReader(body))
+// multipartRequest reports whether r is a multipart upload, its body is streamed and never buffered.
+func multipartRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "multipart/")
+}
 
-		// serve next
-		h.ServeHTTP(rw, r)
+// encryptedOverhead is added to the body limit of RSAMiddleware: multipart framing of uploads,
+// the encrypted session key, the nonce and the tag of the hybrid scheme.
+const encryptedOverhead = 64 << 10
+
+// RSAMiddleware decrypts request bodies marked with X-Encryption header using the server private key.
+// Requests without the header are passed unchanged. Encrypted bodies are read up to maxSize, the upload
+// limit, with encryptedOverhead; larger ones get 413. A key that fails to parse is logged and encrypted
+// requests get 400 as without a key.
+func RSAMiddleware(key []byte, maxSize int64) Middleware {
+	priv, err := encryption.ParsePrivateKey(key)
+	if err != nil && len(key) > 0 {
+		log.NewLogger("info", log.DefaultBuildLogger).
+			Warnw("...encrypted requests are rejected, the server key is not a valid RSA key", "error", err)
 	}
 
-	return http.HandlerFunc(logFn)
+	if maxSize <= 0 {
+		maxSize = handlers.DefaultMaxUploadSize
+	}
+
+	return func(h http.Handler) http.Handler {
+		logFn := func(rw http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(encryption.Header)
+			if scheme == "" {
+				h.ServeHTTP(rw, r)
+				return
+			}
+
+			ciphertext, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxSize+encryptedOverhead))
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					handlers.TooLargeRequest(rw, r)
+					return
+				}
+
+				handlers.BadRequest(rw, r)
+				return
+			}
+
+			body, err := encryption.Decrypt(priv, scheme, ciphertext)
+			if err != nil {
+				handlers.BadRequest(rw, r)
+				return
+			}
+
+			// modify request body
+			r.Header.Del(encryption.Header)
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			r.ContentLength = int64(len(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// serve next
+			h.ServeHTTP(rw, r)
+		}
+
+		return http.HandlerFunc(logFn)
+	}
 }
 
 func dumpRequest(logger *log.Logger, lrw *LoggingResponseWriter, r *http.Request, start time.Time) error {
-	data, err := httputil.DumpRequest(r, true)
+	data, err := httputil.DumpRequest(r, false)
 
 	if err != nil {
 		return err
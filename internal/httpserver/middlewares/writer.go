@@ -1,7 +1,11 @@
 package middlewares
 
 import (
+	"bytes"
+	"io"
 	"net/http"
+
+	"github.com/ole-larsen/green-api/internal/hash"
 )
 
 type (
@@ -16,6 +20,17 @@ type (
 		http.ResponseWriter // встраиваем оригинальный http.ResponseWriter
 		ResponseData        *ResponseData
 	}
+
+	// HashResponseWriter buffers the response to sign it before headers are sent.
+	// A flushed response or one larger than limit is streamed unsigned, its body is not known in advance.
+	HashResponseWriter struct {
+		http.ResponseWriter
+		secret    string
+		body      bytes.Buffer
+		limit     int64
+		status    int
+		streaming bool
+	}
 )
 
 func (r *LoggingResponseWriter) Write(b []byte) (int, error) {
@@ -29,3 +44,110 @@ func (r *LoggingResponseWriter) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode)
 	r.ResponseData.Status = statusCode // захватываем код статуса
 }
+
+func (r *LoggingResponseWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *LoggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (h *HashResponseWriter) Write(b []byte) (int, error) {
+	if !h.streaming && h.limit > 0 && int64(h.body.Len()+len(b)) > h.limit {
+		h.stream()
+	}
+
+	if h.streaming {
+		return h.ResponseWriter.Write(b)
+	}
+
+	return h.body.Write(b)
+}
+
+func (h *HashResponseWriter) WriteHeader(statusCode int) {
+	if h.streaming {
+		h.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	if h.status == 0 {
+		h.status = statusCode
+	}
+}
+
+// Flush sends the buffered response unsigned and streams the rest of it.
+func (h *HashResponseWriter) Flush() {
+	if !h.streaming {
+		h.stream()
+	}
+
+	if f, ok := h.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (h *HashResponseWriter) Unwrap() http.ResponseWriter {
+	return h.ResponseWriter
+}
+
+// stream writes the buffered response without the signature and passes later writes through.
+func (h *HashResponseWriter) stream() {
+	h.streaming = true
+
+	if h.status != 0 {
+		h.ResponseWriter.WriteHeader(h.status)
+	}
+
+	if h.body.Len() > 0 {
+		_, _ = h.ResponseWriter.Write(h.body.Bytes())
+		h.body.Reset()
+	}
+}
+
+// flush signs buffered body and writes the response.
+func (h *HashResponseWriter) flush() error {
+	if h.streaming {
+		return nil
+	}
+
+	if h.status == 0 {
+		h.status = http.StatusOK
+	}
+
+	h.ResponseWriter.Header().Set(hash.Header, hash.Sign(h.secret, h.body.Bytes()))
+	h.ResponseWriter.WriteHeader(h.status)
+
+	_, err := h.ResponseWriter.Write(h.body.Bytes())
+
+	return err
+}
+
+// maxLoggedBody is how much of the request body is kept for the log.
+const maxLoggedBody = 1024
+
+// headBuffer keeps the first limit bytes written to it and discards the rest.
+type headBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	if rest := h.limit - h.buf.Len(); rest > 0 {
+		h.buf.Write(p[:min(rest, len(p))])
+	}
+
+	return len(p), nil
+}
+
+func (h *headBuffer) Bytes() []byte {
+	return h.buf.Bytes()
+}
+
+// teeReadCloser reads through Reader and closes the original body.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -6,12 +6,38 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/campaign"
+	"github.com/ole-larsen/green-api/internal/httpclient"
 	"github.com/ole-larsen/green-api/internal/httpserver/handlers"
 	"github.com/ole-larsen/green-api/internal/httpserver/middlewares"
+	"github.com/ole-larsen/green-api/internal/instances"
+	"github.com/ole-larsen/green-api/internal/notifications"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/ratelimit"
+	"github.com/ole-larsen/green-api/internal/scheduler"
+	"github.com/ole-larsen/green-api/internal/storage"
+	"github.com/ole-larsen/green-api/internal/templates"
 )
 
 type Mux struct {
-	Router chi.Router
+	Router        chi.Router
+	clients       httpclient.Provider
+	store         storage.Storage
+	notifications *notifications.Dispatcher
+	queue         *queue.Queue
+	limiter       *ratelimit.Limiter
+	scheduler     *scheduler.Scheduler
+	campaigns     *campaign.Manager
+	templates     *templates.Manager
+	registry      *instances.Registry
+	users         *auth.Users
+	sessions      *auth.Sessions
+	keys          *auth.APIKeys
+	secret        string
+	webhookToken  string
+	key           []byte
+	maxUploadSize int64
 }
 
 func NewMux() *Mux {
@@ -20,28 +46,247 @@ func NewMux() *Mux {
 	}
 }
 
+// SetClients sets GREEN-API clients used by the proxy routes.
+func (m *Mux) SetClients(clients httpclient.Provider) *Mux {
+	m.clients = clients
+	return m
+}
+
+// SetStorage sets storage of sent messages. It can be nil when database is not configured.
+func (m *Mux) SetStorage(store storage.Storage) *Mux {
+	m.store = store
+	return m
+}
+
+// SetSecret sets the key of request and response HMAC signatures.
+func (m *Mux) SetSecret(secret string) *Mux {
+	m.secret = secret
+	return m
+}
+
+// SetPrivateKey sets PEM encoded RSA key to decrypt request bodies.
+func (m *Mux) SetPrivateKey(key []byte) *Mux {
+	m.key = key
+	return m
+}
+
+// SetNotifications sets dispatcher of notifications received by webhooks.
+func (m *Mux) SetNotifications(d *notifications.Dispatcher) *Mux {
+	m.notifications = d
+	return m
+}
+
+// SetWebhookToken sets webhookUrlToken expected in Authorization header of webhooks.
+func (m *Mux) SetWebhookToken(token string) *Mux {
+	m.webhookToken = token
+	return m
+}
+
+// SetQueue sets the outbound queue. Queue routes are not registered without it.
+func (m *Mux) SetQueue(q *queue.Queue) *Mux {
+	m.queue = q
+	return m
+}
+
+// SetLimiter sets the rate limiter of sending methods. Its status route is not registered without it.
+func (m *Mux) SetLimiter(l *ratelimit.Limiter) *Mux {
+	m.limiter = l
+	return m
+}
+
+// SetScheduler sets the scheduler of messages sent later. Scheduled routes are not registered without it.
+func (m *Mux) SetScheduler(s *scheduler.Scheduler) *Mux {
+	m.scheduler = s
+	return m
+}
+
+// SetCampaigns sets the manager of bulk campaigns. Campaign routes are not registered without it.
+func (m *Mux) SetCampaigns(c *campaign.Manager) *Mux {
+	m.campaigns = c
+	return m
+}
+
+// SetTemplates sets the manager of message templates. Template routes are not registered without it,
+// and sendMessage does not accept templateId.
+func (m *Mux) SetTemplates(t *templates.Manager) *Mux {
+	m.templates = t
+	return m
+}
+
+// SetRegistry sets the registry of instances. Registry routes are not registered without it.
+func (m *Mux) SetRegistry(r *instances.Registry) *Mux {
+	m.registry = r
+	return m
+}
+
+// SetAuth sets accounts and their sessions. Without it the server is open to anyone, otherwise only
+// /status, webhooks and the login page are served without a session.
+func (m *Mux) SetAuth(users *auth.Users, sessions *auth.Sessions) *Mux {
+	m.users = users
+	m.sessions = sessions
+
+	return m
+}
+
+// SetAPIKeys sets API keys of machine clients, they are accepted with accounts only.
+// Key routes are not registered without it.
+func (m *Mux) SetAPIKeys(keys *auth.APIKeys) *Mux {
+	m.keys = keys
+	return m
+}
+
+// SetMaxUploadSize sets the size limit of files uploaded by sendFileByUpload.
+func (m *Mux) SetMaxUploadSize(size int64) *Mux {
+	m.maxUploadSize = size
+	return m
+}
+
 func (m *Mux) SetMiddlewares() *Mux {
 	// A good base middleware stack
 	m.Router.Use(middleware.RequestID)
 	m.Router.Use(middleware.RealIP)
 	m.Router.Use(middleware.Recoverer)
-	m.Router.Use(middlewares.RSAMiddleware)
-	m.Router.Use(middlewares.HashMiddleware)
+	m.Router.Use(middlewares.RSAMiddleware(m.key, m.maxUploadSize))
+	// the signature is of the uncompressed body, the profiler streams its responses unsigned
 	m.Router.Use(middlewares.GzipMiddleware)
+	m.Router.Use(middlewares.HashMiddleware(m.secret, m.maxUploadSize, "/debug/"))
 	m.Router.Use(middlewares.LoggingMiddleware)
 
 	return m
 }
 
 func (m *Mux) SetHandlers() *Mux {
-	m.Router.Get("/", handlers.HTMLHandler(make(chan struct{})))
-
 	m.Router.Get("/status", handlers.StatusHandler)
 
-	m.Router.Mount("/debug", middleware.Profiler())
-	m.Router.Get("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL("http://localhost:8080/swagger/doc.json"), // The url pointing to API definition
-	))
+	clients := m.clients
+	if clients == nil {
+		clients = httpclient.NewPool("", nil, nil)
+	}
+
+	dispatcher := m.notifications
+	if dispatcher == nil {
+		dispatcher = notifications.NewDispatcher()
+	}
+
+	dedup := notifications.NewDeduplicator(notifications.DefaultDedupTTL)
+	if keys, ok := m.store.(storage.WebhookKeyStorage); ok {
+		dedup.SetStorage(keys)
+	}
+
+	m.Router.Post("/webhooks/greenapi/{idInstance}", handlers.WebhookHandler(clients, m.webhookToken, dispatcher, dedup))
+
+	if m.sessions != nil {
+		m.Router.Get("/login", handlers.LoginPageHandler)
+		m.Router.Post("/login", handlers.LoginHandler(m.sessions))
+	}
+
+	// everything else requires a session or an API key when accounts are enabled, profiler and docs too
+	m.Router.Group(func(r chi.Router) {
+		if m.sessions != nil {
+			r.Use(middlewares.AuthMiddleware(m.sessions, m.keys))
+			r.Post("/logout", handlers.LogoutHandler(m.sessions))
+		}
+
+		m.setProtectedHandlers(r, clients)
+	})
 
 	return m
 }
+
+// setProtectedHandlers registers routes by scopes they need. Routes of an instance check the role of the user
+// or the key on it, routes of all instances need the scope on every instance.
+func (m *Mux) setProtectedHandlers(router chi.Router, clients httpclient.Provider) {
+	admin := router.With(middlewares.AllInstancesMiddleware(auth.ScopeAdmin))
+
+	router.With(middlewares.ScopeMiddleware(auth.ScopeRead)).Get("/", handlers.HTMLHandler(make(chan struct{})))
+
+	router.Route("/api/v1", func(r chi.Router) {
+		read := r.With(middlewares.ScopeMiddleware(auth.ScopeRead))
+		send := r.With(middlewares.InstanceMiddleware(clients, auth.ScopeSend))
+		proxy := r.With(middlewares.ProxyInstanceMiddleware(clients))
+		readAll := r.With(middlewares.AllInstancesMiddleware(auth.ScopeRead))
+		admin := r.With(middlewares.AllInstancesMiddleware(auth.ScopeAdmin))
+
+		// jobs, scheduled messages and campaigns are checked by handlers against the instance they are of
+		sendAny := r.With(middlewares.ScopeMiddleware(auth.ScopeSend))
+
+		read.Get("/instances", handlers.InstancesHandler(clients))
+		read.Get("/chatid", handlers.ChatIDHandler)
+		send.Post("/instances/{id}/"+httpclient.MethodSendFileByUpload,
+			handlers.UploadHandler(clients, m.store, m.maxUploadSize))
+		send.Post("/instances/{id}/"+httpclient.MethodSetGroupPicture, handlers.GroupPictureHandler(clients))
+		proxy.Get("/instances/{id}/{method}", handlers.ProxyHandler(clients, m.store, m.templates))
+		proxy.Post("/instances/{id}/{method}", handlers.ProxyHandler(clients, m.store, m.templates))
+
+		if m.queue != nil {
+			send.Post("/instances/{id}/queue/{method}", handlers.EnqueueHandler(m.queue))
+			read.Get("/jobs", handlers.JobsHandler(m.queue, clients))
+			read.Get("/jobs/{jobID}", handlers.JobHandler(m.queue, clients))
+			sendAny.Post("/jobs/{jobID}/retry", handlers.RetryJobHandler(m.queue, clients))
+		}
+
+		if m.scheduler != nil {
+			sendAny.Post("/scheduled", handlers.ScheduleHandler(m.scheduler, clients))
+			read.Get("/scheduled", handlers.ScheduledListHandler(m.scheduler, clients))
+			read.Get("/scheduled/{scheduledID}", handlers.ScheduledHandler(m.scheduler, clients))
+			sendAny.Patch("/scheduled/{scheduledID}", handlers.UpdateScheduledHandler(m.scheduler, clients))
+			sendAny.Delete("/scheduled/{scheduledID}", handlers.CancelScheduledHandler(m.scheduler, clients))
+		}
+
+		if m.campaigns != nil {
+			sendAny.Post("/campaigns", handlers.CreateCampaignHandler(m.campaigns, clients))
+			read.Get("/campaigns", handlers.CampaignsHandler(m.campaigns, clients))
+			read.Get("/campaigns/{campaignID}", handlers.CampaignHandler(m.campaigns, clients))
+			sendAny.Patch("/campaigns/{campaignID}", handlers.UpdateCampaignHandler(m.campaigns, clients))
+			read.Get("/campaigns/{campaignID}/preview", handlers.CampaignPreviewHandler(m.campaigns, clients))
+			read.Get("/campaigns/{campaignID}/report", handlers.CampaignReportHandler(m.campaigns, clients))
+			sendAny.Post("/campaigns/{campaignID}/{action}", handlers.CampaignActionHandler(m.campaigns, clients))
+		}
+
+		if m.templates != nil {
+			admin.Post("/templates", handlers.CreateTemplateHandler(m.templates))
+			read.Get("/templates", handlers.TemplatesHandler(m.templates))
+			read.Get("/templates/{templateID}", handlers.TemplateHandler(m.templates))
+			admin.Patch("/templates/{templateID}", handlers.UpdateTemplateHandler(m.templates))
+			admin.Delete("/templates/{templateID}", handlers.DeleteTemplateHandler(m.templates))
+			read.Post("/templates/{templateID}/render", handlers.RenderTemplateHandler(m.templates))
+		}
+
+		if m.registry != nil {
+			admin.Post("/registry", handlers.CreateInstanceHandler(m.registry))
+			readAll.Get("/registry", handlers.RegistryHandler(m.registry))
+			readAll.Get("/registry/{name}", handlers.InstanceHandler(m.registry))
+			admin.Patch("/registry/{name}", handlers.UpdateInstanceHandler(m.registry))
+			admin.Delete("/registry/{name}", handlers.DeleteInstanceHandler(m.registry))
+		}
+
+		if m.limiter != nil {
+			readAll.Get("/ratelimit", handlers.RateLimitHandler(clients, m.limiter))
+		}
+
+		if m.users != nil {
+			r.Get("/me", handlers.MeHandler)
+			admin.Post("/users", handlers.CreateUserHandler(m.users))
+			admin.Get("/users", handlers.UsersHandler(m.users))
+			admin.Patch("/users/{username}", handlers.UpdateUserHandler(m.users))
+			admin.Delete("/users/{username}", handlers.DeleteUserHandler(m.users))
+
+			if m.users.RolesEnabled() {
+				admin.Get("/users/{username}/roles", handlers.RolesHandler(m.users))
+				admin.Put("/users/{username}/roles/{instance}", handlers.GrantRoleHandler(m.users))
+				admin.Delete("/users/{username}/roles/{instance}", handlers.RevokeRoleHandler(m.users))
+			}
+		}
+
+		if m.keys != nil {
+			admin.Post("/keys", handlers.IssueAPIKeyHandler(m.keys))
+			admin.Get("/keys", handlers.APIKeysHandler(m.keys))
+			admin.Delete("/keys/{keyID}", handlers.RevokeAPIKeyHandler(m.keys))
+		}
+	})
+
+	admin.Mount("/debug", middleware.Profiler())
+	admin.Get("/swagger/*", httpSwagger.Handler(
+		httpSwagger.URL("http://localhost:8080/swagger/doc.json"), // The url pointing to API definition
+	))
+}
@@ -2,14 +2,21 @@ package router_test
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/hash"
+	"github.com/ole-larsen/green-api/internal/httpclient"
 	"github.com/ole-larsen/green-api/internal/httpserver/router"
+	"github.com/ole-larsen/green-api/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -71,6 +78,8 @@ func TestRouter(t *testing.T) {
 	}{
 		// {"/", "ok", http.StatusOK},
 		{"/status", http.MethodGet, `{"status":"ok"}`, nil, http.StatusOK},
+		{"/api/v1/instances", http.MethodGet, `{"instances":[]}`, nil, http.StatusOK},
+		{"/webhooks/greenapi/1101000001", http.MethodPost, `{"error":"unauthorized"}`, []byte(`{}`), http.StatusUnauthorized},
 	}
 
 	for _, v := range testTable {
@@ -93,3 +102,241 @@ func TestRouter(t *testing.T) {
 		}
 	}
 }
+
+func TestRouter_SignedGzip(t *testing.T) {
+	const secret = "secret"
+
+	ts := httptest.NewServer(router.NewMux().SetSecret(secret).SetMiddlewares().SetHandlers().Router)
+	defer ts.Close()
+
+	// the transport asks for gzip and decompresses the response transparently
+	resp, body := testRequest(t, ts, http.MethodGet, "/status", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, resp.Uncompressed, "the response is compressed")
+	assert.JSONEq(t, `{"status":"ok"}`, body)
+	assert.True(t, hash.Verify(secret, []byte(body), resp.Header.Get(hash.Header)),
+		"the signature is of the body the client reads")
+
+	resp, _ = testRequest(t, ts, http.MethodGet, "/debug/pprof/cmdline", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(hash.Header), "the profiler is not buffered")
+}
+
+func TestRouter_Auth(t *testing.T) {
+	users := auth.NewUsers(nil)
+
+	sessions, err := auth.NewSessions(users, "secret")
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(router.NewMux().
+		SetAuth(users, sessions).
+		SetWebhookToken("webhook-token").
+		SetMiddlewares().
+		SetHandlers().Router)
+	defer ts.Close()
+
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		accept   string
+		location string
+		status   int
+	}{
+		{"status is public", http.MethodGet, "/status", "", "", http.StatusOK},
+		{"login page is public", http.MethodGet, "/login", "text/html", "", http.StatusOK},
+		{"webhooks check their token", http.MethodPost, "/webhooks/greenapi/1101000001", "", "", http.StatusNotFound},
+		{"page redirects to login", http.MethodGet, "/", "text/html", "/login?next=%2F", http.StatusFound},
+		{"api", http.MethodGet, "/api/v1/instances", "", "", http.StatusUnauthorized},
+		{"api from a browser", http.MethodPost, "/api/v1/instances/1101000001/sendMessage", "text/html", "",
+			http.StatusUnauthorized},
+		{"users", http.MethodGet, "/api/v1/users", "", "", http.StatusUnauthorized},
+		{"profiler", http.MethodGet, "/debug/pprof/", "", "", http.StatusUnauthorized},
+		{"swagger", http.MethodGet, "/swagger/index.html", "", "", http.StatusUnauthorized},
+		{"logout", http.MethodPost, "/logout", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(`{}`))
+			require.NoError(t, err)
+
+			req.Header.Set("Accept", tt.accept)
+			req.Header.Set("Authorization", "Bearer webhook-token")
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.location, resp.Header.Get("Location"))
+		})
+	}
+}
+
+// memAPIKeys is an in-memory APIKeyStorage.
+type memAPIKeys struct {
+	keys map[string]storage.APIKey
+	mu   sync.Mutex
+}
+
+func (f *memAPIKeys) SaveAPIKey(_ context.Context, k *storage.APIKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.keys[k.ID] = *k
+
+	return nil
+}
+
+func (f *memAPIKeys) GetAPIKeyByPrefix(_ context.Context, prefix string) (*storage.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range f.keys {
+		if k.Prefix == prefix {
+			return &k, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (f *memAPIKeys) ListAPIKeys(context.Context) ([]storage.APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.APIKey{}
+	for _, k := range f.keys {
+		list = append(list, k)
+	}
+
+	return list, nil
+}
+
+func (f *memAPIKeys) RevokeAPIKey(_ context.Context, id string, at time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k, ok := f.keys[id]
+	if !ok {
+		return storage.ErrNotFound
+	}
+
+	k.RevokedAt = &at
+	f.keys[id] = k
+
+	return nil
+}
+
+func (f *memAPIKeys) TouchAPIKey(context.Context, string, time.Time) error {
+	return nil
+}
+
+func TestRouter_APIKeys(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(rw, `{}`)
+	}))
+	defer api.Close()
+
+	clients := httpclient.NewPool(api.URL, api.Client(), map[string]string{
+		"1101000001": "token-a",
+		"1101000002": "token-b",
+	})
+
+	users := auth.NewUsers(nil)
+
+	sessions, err := auth.NewSessions(users, "secret")
+	require.NoError(t, err)
+
+	keys := auth.NewAPIKeys(&memAPIKeys{keys: make(map[string]storage.APIKey)}).SetInstances(clients)
+
+	issue := func(scope auth.Scope, instances ...string) string {
+		issued, err := keys.Issue(context.Background(), &auth.APIKeyRequest{
+			Name:      string(scope),
+			Scopes:    []auth.Scope{scope},
+			Instances: instances,
+		}, "anna")
+		require.NoError(t, err)
+
+		return issued.Key
+	}
+
+	reader := issue(auth.ScopeRead, "1101000001")
+	sender := issue(auth.ScopeSend)
+	admin := issue(auth.ScopeAdmin)
+
+	revoked, err := keys.Issue(context.Background(), &auth.APIKeyRequest{Name: "old", Scopes: []auth.Scope{auth.ScopeAdmin}}, "anna")
+	require.NoError(t, err)
+	require.NoError(t, keys.Revoke(context.Background(), revoked.ID))
+
+	ts := httptest.NewServer(router.NewMux().
+		SetClients(clients).
+		SetAuth(users, sessions).
+		SetAPIKeys(keys).
+		SetMiddlewares().
+		SetHandlers().Router)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		status int
+	}{
+		{"unknown key", "gapi_unknown_secret", http.MethodGet, "/api/v1/instances", http.StatusUnauthorized},
+		{"revoked key", revoked.Key, http.MethodGet, "/api/v1/instances", http.StatusUnauthorized},
+		{"read its instance", reader, http.MethodGet, "/api/v1/instances/1101000001/getStateInstance", http.StatusOK},
+		{"read another instance", reader, http.MethodGet, "/api/v1/instances/1101000002/getStateInstance",
+			http.StatusForbidden},
+		{"send without scope", reader, http.MethodPost, "/api/v1/instances/1101000001/sendMessage", http.StatusForbidden},
+		{"restricted key lists its instances", reader, http.MethodGet, "/api/v1/instances", http.StatusOK},
+		{"restricted key lists keys", issue(auth.ScopeAdmin, "1101000001"), http.MethodGet, "/api/v1/keys",
+			http.StatusForbidden},
+		{"send", sender, http.MethodPost, "/api/v1/instances/1101000002/sendMessage", http.StatusOK},
+		{"read without scope", sender, http.MethodGet, "/api/v1/instances/1101000002/getChatHistory",
+			http.StatusForbidden},
+		{"reboot without scope", sender, http.MethodGet, "/api/v1/instances/1101000002/reboot", http.StatusForbidden},
+		{"keys without scope", sender, http.MethodGet, "/api/v1/keys", http.StatusForbidden},
+		{"admin reads", admin, http.MethodGet, "/api/v1/instances", http.StatusOK},
+		{"admin lists keys", admin, http.MethodGet, "/api/v1/keys", http.StatusOK},
+		{"me", reader, http.MethodGet, "/api/v1/me", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path,
+				strings.NewReader(`{"chatId":"79001234567@c.us","message":"hi","count":10}`))
+			require.NoError(t, err)
+
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+
+			assert.Equal(t, tt.status, resp.StatusCode, string(data))
+		})
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/instances", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+reader)
+
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.JSONEq(t, `{"instances":["1101000001"]}`, string(data), "instances of other keys are hidden")
+}
@@ -3,17 +3,32 @@
 package httpserver
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/ole-larsen/green-api/internal/common"
 	"github.com/ole-larsen/green-api/internal/httpserver/router"
 )
 
 type HTTPServer struct {
-	Router *router.Mux
-	Host   string
-	Port   int
+	Router       *router.Mux
+	server       *http.Server
+	redirect     *http.Server
+	Host         string
+	Protocol     string
+	ServerCrt    []byte
+	ServerKey    []byte
+	Port         int
+	RedirectPort int
+	mu           sync.Mutex
+	closed       bool
 }
 
 func NewHTTPServer() *HTTPServer {
@@ -35,6 +50,26 @@ func (s *HTTPServer) SetRouter(r *router.Mux) *HTTPServer {
 	return s
 }
 
+// SetProtocol sets common.HTTPProtocol or common.HTTPSProtocol.
+func (s *HTTPServer) SetProtocol(p string) *HTTPServer {
+	s.Protocol = p
+	return s
+}
+
+// SetCertificates sets PEM encoded certificate and private key for https.
+func (s *HTTPServer) SetCertificates(crt, key []byte) *HTTPServer {
+	s.ServerCrt = crt
+	s.ServerKey = key
+
+	return s
+}
+
+// SetRedirectPort sets port of the plain http listener that redirects to https. 0 disables it.
+func (s *HTTPServer) SetRedirectPort(p int) *HTTPServer {
+	s.RedirectPort = p
+	return s
+}
+
 func (s *HTTPServer) GetHost() string {
 	return s.Host // it can be ""
 }
@@ -47,6 +82,36 @@ func (s *HTTPServer) GetRouter() *router.Mux {
 	return s.Router
 }
 
+func (s *HTTPServer) GetProtocol() string {
+	return s.Protocol
+}
+
+func (s *HTTPServer) GetRedirectPort() int {
+	return s.RedirectPort
+}
+
+// IsTLS reports whether the server is served over https.
+func (s *HTTPServer) IsTLS() bool {
+	return s.Protocol == common.HTTPSProtocol
+}
+
+// TLSConfig builds tls config from PEM certificate and key.
+func (s *HTTPServer) TLSConfig() (*tls.Config, error) {
+	if len(s.ServerCrt) == 0 || len(s.ServerKey) == 0 {
+		return nil, errors.New("certificate or key is missing")
+	}
+
+	cert, err := tls.X509KeyPair(s.ServerCrt, s.ServerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key pair: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
 func (s *HTTPServer) ListenAndServe() error {
 	const defaultTimeout = 3
 
@@ -56,5 +121,106 @@ func (s *HTTPServer) ListenAndServe() error {
 		ReadHeaderTimeout: defaultTimeout * time.Second,
 	}
 
-	return server.ListenAndServe()
+	if !s.IsTLS() {
+		if err := s.track(server, nil); err != nil {
+			return err
+		}
+
+		return server.ListenAndServe()
+	}
+
+	tlsConfig, err := s.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	server.TLSConfig = tlsConfig
+
+	if s.RedirectPort == 0 {
+		if err := s.track(server, nil); err != nil {
+			return err
+		}
+
+		return server.ListenAndServeTLS("", "")
+	}
+
+	redirect := &http.Server{
+		Addr:              s.Host + ":" + fmt.Sprintf("%d", s.RedirectPort),
+		Handler:           RedirectHandler(s.Port),
+		ReadHeaderTimeout: defaultTimeout * time.Second,
+	}
+
+	if err := s.track(server, redirect); err != nil {
+		return err
+	}
+
+	const listeners = 2
+
+	errs := make(chan error, listeners)
+
+	go func() {
+		errs <- redirect.ListenAndServe()
+	}()
+
+	go func() {
+		errs <- server.ListenAndServeTLS("", "")
+	}()
+
+	return <-errs
+}
+
+// Shutdown stops accepting new connections and waits until in-flight requests are finished
+// or ctx is done. ListenAndServe returns http.ErrServerClosed after Shutdown.
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	server, redirect := s.server, s.redirect
+	s.mu.Unlock()
+
+	var errs []error
+
+	if redirect != nil {
+		errs = append(errs, redirect.Shutdown(ctx))
+	}
+
+	if server != nil {
+		errs = append(errs, server.Shutdown(ctx))
+	}
+
+	return errors.Join(errs...)
+}
+
+// track keeps running servers for Shutdown.
+func (s *HTTPServer) track(server, redirect *http.Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return http.ErrServerClosed
+	}
+
+	s.server = server
+	s.redirect = redirect
+
+	return nil
+}
+
+// RedirectHandler redirects plain http requests to the same url over https on port.
+func RedirectHandler(port int) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+
+		const defaultPort = 443
+
+		if port != defaultPort {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+
+		target := common.HTTPSProtocol + "://" + host + r.URL.RequestURI()
+
+		http.Redirect(rw, r, target, http.StatusMovedPermanently)
+	})
 }
@@ -1,11 +1,19 @@
 package httpserver_test
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/ole-larsen/green-api/internal/common"
 	"github.com/ole-larsen/green-api/internal/httpserver"
 	"github.com/ole-larsen/green-api/internal/httpserver/router"
 )
@@ -61,3 +69,209 @@ func TestNewHttpServer(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPServer_TLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		crt     string
+		key     string
+		wantErr bool
+	}{
+		{
+			name: "valid key pair",
+			crt:  common.ServerMockCert,
+			key:  common.ServerMockKey,
+		},
+		{
+			name:    "invalid certificate",
+			crt:     common.ServerMockCertInvalid,
+			key:     common.ServerMockKey,
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			crt:     common.ServerMockCert,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httpserver.NewHTTPServer().
+				SetProtocol(common.HTTPSProtocol).
+				SetCertificates([]byte(tt.crt), []byte(tt.key))
+
+			require.True(t, s.IsTLS())
+
+			cfg, err := s.TLSConfig()
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, cfg.Certificates, 1)
+			require.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+		})
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	return port
+}
+
+func TestHTTPServer_ListenAndServeTLS(t *testing.T) {
+	port := freePort(t)
+	redirectPort := freePort(t)
+
+	s := httpserver.NewHTTPServer().
+		SetHost("127.0.0.1").
+		SetPort(port).
+		SetProtocol(common.HTTPSProtocol).
+		SetCertificates([]byte(common.ServerMockCert), []byte(common.ServerMockKey)).
+		SetRedirectPort(redirectPort).
+		SetRouter(router.NewMux().SetHandlers())
+
+	go func() {
+		_ = s.ListenAndServe()
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // self-signed test certificate
+		},
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	url := fmt.Sprintf("https://127.0.0.1:%d/status", port)
+
+	require.Eventually(t, func() bool {
+		resp, err := client.Get(url)
+		if err != nil {
+			return false
+		}
+
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		return resp.StatusCode == http.StatusOK && resp.TLS != nil
+	}, 3*time.Second, 50*time.Millisecond)
+
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/status?a=1", redirectPort))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, resp.Body.Close())
+	}()
+
+	require.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	require.Equal(t, fmt.Sprintf("https://127.0.0.1:%d/status?a=1", port), resp.Header.Get("Location"))
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   string
+		port   int
+	}{
+		{
+			name:   "default https port",
+			target: "http://example.com:8081/path?q=1",
+			port:   443,
+			want:   "https://example.com/path?q=1",
+		},
+		{
+			name:   "custom https port",
+			target: "http://example.com/",
+			port:   8443,
+			want:   "https://example.com:8443/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			httpserver.RedirectHandler(tt.port).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, http.NoBody))
+
+			require.Equal(t, http.StatusMovedPermanently, w.Code)
+			require.Equal(t, tt.want, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestHTTPServer_Shutdown(t *testing.T) {
+	port := freePort(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	mux := router.NewMux()
+	mux.Router.Get("/slow", func(rw http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	s := httpserver.NewHTTPServer().
+		SetHost("127.0.0.1").
+		SetPort(port).
+		SetRouter(mux)
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- s.ListenAndServe()
+	}()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/slow", port)
+	status := make(chan int, 1)
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return false
+		}
+
+		return conn.Close() == nil
+	}, 3*time.Second, 50*time.Millisecond)
+
+	go func() {
+		resp, err := http.Get(url) //nolint:noctx // test request
+		if err != nil {
+			status <- 0
+			return
+		}
+
+		_ = resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-started
+
+	shutdown := make(chan error, 1)
+
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	require.NoError(t, <-shutdown)
+	require.Equal(t, http.StatusOK, <-status)
+	require.ErrorIs(t, <-served, http.ErrServerClosed)
+
+	require.ErrorIs(t, s.ListenAndServe(), http.ErrServerClosed)
+}
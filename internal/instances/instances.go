@@ -0,0 +1,377 @@
+// Package instances keeps the registry of GREEN-API instances in the database. An instance is
+// registered under a name, its apiTokenInstance is stored encrypted and never leaves the server.
+// Registry is an httpclient.Provider: clients are resolved by instance name or by idInstance,
+// instances of the static configuration are resolved as well.
+package instances
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/log"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var logger = log.NewLogger("info", log.DefaultBuildLogger)
+
+var (
+	ErrNotFound = errors.New("instance not found")
+	ErrExists   = errors.New("instance already exists")
+	ErrInvalid  = errors.New("invalid instance")
+)
+
+// lookupTimeout limits reading an instance which is not cached yet, it may be registered by another replica.
+const lookupTimeout = 5 * time.Second
+
+var (
+	// names start with a letter, so they never look like idInstance.
+	namePattern       = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,63}$`)
+	idInstancePattern = regexp.MustCompile(`^[0-9]{1,20}$`)
+)
+
+// Request registers an instance or changes it, empty fields keep their values on Update.
+type Request struct {
+	Name             string `json:"name"`
+	IDInstance       string `json:"id_instance"`
+	APITokenInstance string `json:"api_token_instance"`
+}
+
+// Registry keeps instances in the storage and clients of them in memory.
+type Registry struct {
+	store      storage.InstanceStorage
+	sealer     *encryption.Sealer
+	static     httpclient.Provider
+	limiter    httpclient.Limiter
+	httpClient *http.Client
+	clients    map[string]*httpclient.Client
+	names      map[string]string
+	now        func() time.Time
+	baseURL    string
+	mu         sync.RWMutex
+}
+
+// New creates a registry, tokens are sealed by sealer. Clients call baseURL with httpClient,
+// both can be empty like in httpclient.NewClient.
+func New(store storage.InstanceStorage, sealer *encryption.Sealer, baseURL string, httpClient *http.Client) *Registry {
+	return &Registry{
+		store:      store,
+		sealer:     sealer,
+		baseURL:    baseURL,
+		httpClient: httpClient,
+		clients:    make(map[string]*httpclient.Client),
+		names:      make(map[string]string),
+		now:        time.Now,
+	}
+}
+
+// SetStatic sets instances of the configuration, they are resolved when the registry has no such instance.
+func (r *Registry) SetStatic(p httpclient.Provider) *Registry {
+	r.static = p
+	return r
+}
+
+// SetLimiter throttles sending methods of registered instances.
+func (r *Registry) SetLimiter(l httpclient.Limiter) *Registry {
+	r.limiter = l
+	return r
+}
+
+// SetClock replaces time source, for tests.
+func (r *Registry) SetClock(now func() time.Time) *Registry {
+	r.now = now
+	return r
+}
+
+// Load reads every instance into memory. Instances whose tokens can't be decrypted are logged and skipped.
+func (r *Registry) Load(ctx context.Context) error {
+	instances, err := r.store.ListInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range instances {
+		if _, err := r.add(&instances[i]); err != nil {
+			logger.Errorln(err)
+		}
+	}
+
+	return nil
+}
+
+// Create validates the instance, encrypts its token and saves it.
+func (r *Registry) Create(ctx context.Context, req *Request) (*storage.Instance, error) {
+	now := r.now()
+	i := &storage.Instance{
+		Name:       strings.TrimSpace(req.Name),
+		IDInstance: strings.TrimSpace(req.IDInstance),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err := validate(i); err != nil {
+		return nil, err
+	}
+
+	token := strings.TrimSpace(req.APITokenInstance)
+	if token == "" {
+		return nil, fmt.Errorf("%w: api_token_instance is required", ErrInvalid)
+	}
+
+	if err := r.seal(i, token); err != nil {
+		return nil, err
+	}
+
+	err := r.store.SaveInstance(ctx, i)
+	if errors.Is(err, storage.ErrDuplicate) {
+		return nil, fmt.Errorf("%w: name %s or idInstance %s is taken", ErrExists, i.Name, i.IDInstance)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.put(i, httpclient.NewClient(i.IDInstance, token, r.baseURL, r.httpClient))
+
+	return i, nil
+}
+
+// Get returns the instance by name or by idInstance.
+func (r *Registry) Get(ctx context.Context, key string) (*storage.Instance, error) {
+	i, err := r.store.GetInstance(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// List returns registered instances by name.
+func (r *Registry) List(ctx context.Context) ([]storage.Instance, error) {
+	return r.store.ListInstances(ctx)
+}
+
+// Update changes idInstance and token of the instance, empty values are kept. The name can't be changed.
+func (r *Registry) Update(ctx context.Context, name string, req *Request) (*storage.Instance, error) {
+	i, err := r.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the instance is found by idInstance too, but only its name identifies it here
+	if i.Name != name {
+		return nil, ErrNotFound
+	}
+
+	if n := strings.TrimSpace(req.Name); n != "" && n != i.Name {
+		return nil, fmt.Errorf("%w: name can't be changed", ErrInvalid)
+	}
+
+	if id := strings.TrimSpace(req.IDInstance); id != "" && id != i.IDInstance {
+		if other, err := r.Get(ctx, id); err == nil && other.Name != i.Name {
+			return nil, fmt.Errorf("%w: idInstance %s is registered as %s", ErrExists, id, other.Name)
+		}
+
+		i.IDInstance = id
+	}
+
+	if err := validate(i); err != nil {
+		return nil, err
+	}
+
+	token := strings.TrimSpace(req.APITokenInstance)
+	if token == "" {
+		token, err = r.open(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.seal(i, token); err != nil {
+		return nil, err
+	}
+
+	i.UpdatedAt = r.now()
+
+	err = r.store.UpdateInstance(ctx, i)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	r.put(i, httpclient.NewClient(i.IDInstance, token, r.baseURL, r.httpClient))
+
+	return i, nil
+}
+
+// Delete deletes the instance by name.
+func (r *Registry) Delete(ctx context.Context, name string) error {
+	err := r.store.DeleteInstance(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.clients[name]; ok {
+		delete(r.names, c.GetIDInstance())
+		delete(r.clients, name)
+	}
+
+	return nil
+}
+
+// Client resolves the client by instance name or by idInstance. Instances registered by other replicas
+// are read from the storage on first use.
+func (r *Registry) Client(key string) (*httpclient.Client, error) {
+	if c, ok := r.cached(key); ok {
+		return c, nil
+	}
+
+	if r.static != nil {
+		if c, err := r.static.Client(key); err == nil {
+			return c, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	i, err := r.store.GetInstance(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, httpclient.ErrUnknownInstance
+	}
+
+	if err != nil {
+		logger.Errorln(err)
+		return nil, httpclient.ErrUnknownInstance
+	}
+
+	c, err := r.add(i)
+	if err != nil {
+		logger.Errorln(err)
+		return nil, httpclient.ErrUnknownInstance
+	}
+
+	return c, nil
+}
+
+// Instances returns sorted names of registered instances and identifiers of static instances
+// which are not registered.
+func (r *Registry) Instances() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]string, 0, len(r.clients))
+	for name := range r.clients {
+		keys = append(keys, name)
+	}
+
+	if r.static != nil {
+		for _, id := range r.static.Instances() {
+			if _, ok := r.names[id]; !ok {
+				keys = append(keys, id)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (r *Registry) cached(key string) (*httpclient.Client, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name, ok := r.names[key]; ok {
+		key = name
+	}
+
+	c, ok := r.clients[key]
+
+	return c, ok
+}
+
+// add decrypts the token of the stored instance and keeps its client.
+func (r *Registry) add(i *storage.Instance) (*httpclient.Client, error) {
+	token, err := r.open(i)
+	if err != nil {
+		return nil, err
+	}
+
+	c := httpclient.NewClient(i.IDInstance, token, r.baseURL, r.httpClient)
+	r.put(i, c)
+
+	return c, nil
+}
+
+func (r *Registry) put(i *storage.Instance, c *httpclient.Client) {
+	if r.limiter != nil {
+		c.SetLimiter(r.limiter)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if old, ok := r.clients[i.Name]; ok {
+		delete(r.names, old.GetIDInstance())
+	}
+
+	r.clients[i.Name] = c
+	r.names[i.IDInstance] = i.Name
+}
+
+// seal encrypts the token bound to the instance name.
+func (r *Registry) seal(i *storage.Instance, token string) error {
+	sealed, err := r.sealer.Seal([]byte(token), []byte(i.Name))
+	if err != nil {
+		return err
+	}
+
+	i.Token = sealed
+
+	return nil
+}
+
+func (r *Registry) open(i *storage.Instance) (string, error) {
+	token, err := r.sealer.Open(i.Token, []byte(i.Name))
+	if err != nil {
+		return "", fmt.Errorf("token of instance %s: %w", i.Name, err)
+	}
+
+	return string(token), nil
+}
+
+func validate(i *storage.Instance) error {
+	if !namePattern.MatchString(i.Name) {
+		return fmt.Errorf("%w: name %q must start with a letter and have up to 64 letters, digits, '.', '_' or '-'",
+			ErrInvalid, i.Name)
+	}
+
+	if !idInstancePattern.MatchString(i.IDInstance) {
+		return fmt.Errorf("%w: id_instance %q must be digits", ErrInvalid, i.IDInstance)
+	}
+
+	return nil
+}
@@ -0,0 +1,326 @@
+package instances_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/instances"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// fakeInstances is an in-memory InstanceStorage.
+type fakeInstances struct {
+	instances map[string]storage.Instance
+	mu        sync.Mutex
+}
+
+func newFakeInstances() *fakeInstances {
+	return &fakeInstances{instances: make(map[string]storage.Instance)}
+}
+
+func (f *fakeInstances) SaveInstance(_ context.Context, i *storage.Instance) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, other := range f.instances {
+		if other.Name == i.Name || other.IDInstance == i.IDInstance {
+			return storage.ErrDuplicate
+		}
+	}
+
+	f.instances[i.Name] = *i
+
+	return nil
+}
+
+func (f *fakeInstances) UpdateInstance(_ context.Context, i *storage.Instance) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.instances[i.Name]; !ok {
+		return storage.ErrNotFound
+	}
+
+	f.instances[i.Name] = *i
+
+	return nil
+}
+
+func (f *fakeInstances) GetInstance(_ context.Context, key string) (*storage.Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, i := range f.instances {
+		if i.Name == key || i.IDInstance == key {
+			return &i, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (f *fakeInstances) ListInstances(context.Context) ([]storage.Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.Instance{}
+	for _, i := range f.instances {
+		list = append(list, i)
+	}
+
+	return list, nil
+}
+
+func (f *fakeInstances) ListInstancesAfter(_ context.Context, after string, limit int) ([]storage.Instance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.Instance{}
+	for _, i := range f.instances {
+		if i.Name > after {
+			list = append(list, i)
+		}
+	}
+
+	sort.Slice(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+
+	if len(list) > limit {
+		list = list[:limit]
+	}
+
+	return list, nil
+}
+
+func (f *fakeInstances) UpdateInstanceToken(_ context.Context, name string, old, token []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i, ok := f.instances[name]
+	if !ok || !bytes.Equal(i.Token, old) {
+		return storage.ErrNotFound
+	}
+
+	i.Token = token
+	f.instances[name] = i
+
+	return nil
+}
+
+func (f *fakeInstances) DeleteInstance(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.instances[name]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(f.instances, name)
+
+	return nil
+}
+
+func newSealer(t *testing.T, secret string, previous ...string) *encryption.Sealer {
+	t.Helper()
+
+	s, err := encryption.NewSealer(secret, previous...)
+	require.NoError(t, err)
+
+	return s
+}
+
+// newAPI is a fake GREEN-API which keeps requested paths, they carry idInstance and token.
+func newAPI(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var (
+		paths []string
+		mu    sync.Mutex
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+
+		_, _ = io.WriteString(rw, `{"stateInstance":"authorized"}`)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts, &paths
+}
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	api, paths := newAPI(t)
+	store := newFakeInstances()
+	r := instances.New(store, newSealer(t, "secret"), api.URL, api.Client())
+
+	i, err := r.Create(ctx, &instances.Request{Name: " sales ", IDInstance: "1101000001", APITokenInstance: "token-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "sales", i.Name)
+	assert.NotContains(t, string(store.instances["sales"].Token), "token-1")
+
+	for _, key := range []string{"sales", "1101000001"} {
+		c, err := r.Client(key)
+		require.NoError(t, err)
+
+		_, err = c.GetStateInstance(ctx)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{
+		"/waInstance1101000001/getStateInstance/token-1",
+		"/waInstance1101000001/getStateInstance/token-1",
+	}, *paths)
+
+	// the token is kept when only idInstance changes
+	_, err = r.Update(ctx, "sales", &instances.Request{IDInstance: "1101000002"})
+	require.NoError(t, err)
+
+	c, err := r.Client("sales")
+	require.NoError(t, err)
+	assert.Equal(t, "1101000002", c.GetIDInstance())
+
+	_, err = c.GetStateInstance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "/waInstance1101000002/getStateInstance/token-1", (*paths)[2])
+
+	_, err = r.Client("1101000001")
+	require.ErrorIs(t, err, httpclient.ErrUnknownInstance)
+
+	_, err = r.Update(ctx, "sales", &instances.Request{APITokenInstance: "token-2"})
+	require.NoError(t, err)
+
+	c, err = r.Client("sales")
+	require.NoError(t, err)
+
+	_, err = c.GetStateInstance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "/waInstance1101000002/getStateInstance/token-2", (*paths)[3])
+
+	require.NoError(t, r.Delete(ctx, "sales"))
+	require.ErrorIs(t, r.Delete(ctx, "sales"), instances.ErrNotFound)
+
+	_, err = r.Client("sales")
+	require.ErrorIs(t, err, httpclient.ErrUnknownInstance)
+}
+
+func TestRegistry_Errors(t *testing.T) {
+	ctx := context.Background()
+	r := instances.New(newFakeInstances(), newSealer(t, "secret"), "", nil)
+
+	_, err := r.Create(ctx, &instances.Request{Name: "sales", IDInstance: "1101000001", APITokenInstance: "token"})
+	require.NoError(t, err)
+
+	_, err = r.Create(ctx, &instances.Request{Name: "support", IDInstance: "1101000002", APITokenInstance: "token"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		req  instances.Request
+		want error
+	}{
+		{"numeric name", instances.Request{Name: "1101000003", IDInstance: "1101000003", APITokenInstance: "t"},
+			instances.ErrInvalid},
+		{"spaces in name", instances.Request{Name: "sales team", IDInstance: "1101000003", APITokenInstance: "t"},
+			instances.ErrInvalid},
+		{"bad id", instances.Request{Name: "marketing", IDInstance: "abc", APITokenInstance: "t"}, instances.ErrInvalid},
+		{"no token", instances.Request{Name: "marketing", IDInstance: "1101000003"}, instances.ErrInvalid},
+		{"taken name", instances.Request{Name: "sales", IDInstance: "1101000003", APITokenInstance: "t"},
+			instances.ErrExists},
+		{"taken id", instances.Request{Name: "marketing", IDInstance: "1101000001", APITokenInstance: "t"},
+			instances.ErrExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := r.Create(ctx, &tt.req)
+			require.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	_, err = r.Update(ctx, "sales", &instances.Request{IDInstance: "1101000002"})
+	require.ErrorIs(t, err, instances.ErrExists)
+
+	_, err = r.Update(ctx, "sales", &instances.Request{Name: "renamed"})
+	require.ErrorIs(t, err, instances.ErrInvalid)
+
+	_, err = r.Update(ctx, "1101000001", &instances.Request{APITokenInstance: "token"})
+	require.ErrorIs(t, err, instances.ErrNotFound)
+
+	_, err = r.Update(ctx, "unknown", &instances.Request{APITokenInstance: "token"})
+	require.ErrorIs(t, err, instances.ErrNotFound)
+}
+
+func TestRegistry_Resolve(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeInstances()
+	sealer := newSealer(t, "secret")
+
+	// registered by another replica
+	_, err := instances.New(store, sealer, "", nil).
+		Create(ctx, &instances.Request{Name: "sales", IDInstance: "1101000001", APITokenInstance: "token"})
+	require.NoError(t, err)
+
+	static := httpclient.NewPool("", nil, map[string]string{"1101000001": "old", "1101000009": "static"})
+	r := instances.New(store, sealer, "", nil).SetStatic(static)
+
+	assert.Equal(t, []string{"1101000001", "1101000009"}, r.Instances())
+
+	require.NoError(t, r.Load(ctx))
+	assert.Equal(t, []string{"1101000009", "sales"}, r.Instances(), "registered instances shadow static ones")
+
+	c, err := r.Client("1101000009")
+	require.NoError(t, err)
+	assert.Equal(t, "1101000009", c.GetIDInstance())
+
+	// another replica registers one more instance after Load
+	_, err = instances.New(store, sealer, "", nil).
+		Create(ctx, &instances.Request{Name: "support", IDInstance: "1101000002", APITokenInstance: "token"})
+	require.NoError(t, err)
+
+	c, err = r.Client("support")
+	require.NoError(t, err)
+	assert.Equal(t, "1101000002", c.GetIDInstance())
+
+	_, err = r.Client("unknown")
+	require.ErrorIs(t, err, httpclient.ErrUnknownInstance)
+}
+
+func TestRegistry_WrongSecret(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeInstances()
+
+	_, err := instances.New(store, newSealer(t, "secret"), "", nil).
+		Create(ctx, &instances.Request{Name: "sales", IDInstance: "1101000001", APITokenInstance: "token"})
+	require.NoError(t, err)
+
+	r := instances.New(store, newSealer(t, "another secret"), "", nil)
+	require.NoError(t, r.Load(ctx))
+	assert.Empty(t, r.Instances())
+
+	_, err = r.Client("sales")
+	require.ErrorIs(t, err, httpclient.ErrUnknownInstance)
+
+	_, err = r.Update(ctx, "sales", &instances.Request{IDInstance: "1101000002"})
+	require.ErrorIs(t, err, encryption.ErrCiphertext)
+
+	// a new token is sealed with the current secret
+	_, err = r.Update(ctx, "sales", &instances.Request{APITokenInstance: "token"})
+	require.NoError(t, err)
+
+	_, err = r.Client("sales")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sales"}, r.Instances())
+}
@@ -0,0 +1,395 @@
+package instances
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// DefaultRotateBatch is how many instances Rotate reads at once when batch is not set.
+const DefaultRotateBatch = 100
+
+var ErrRotateUsage = errors.New("usage: rotate-keys [batch size]")
+
+// RotateStorage keeps the data sealed with keys of the secret: instance tokens, message bodies and payloads.
+type RotateStorage interface {
+	storage.InstanceStorage
+	storage.SealedMessageStorage
+	storage.SealedPayloadStorage
+}
+
+// RotateResult counts instances, messages or payloads by outcome of the rotation.
+type RotateResult struct {
+	// Failed are names of instances, ids of messages or table/key of payloads no key opens.
+	Failed []string
+	// Rotated are sealed again with the current key, bodies and payloads saved in plaintext are sealed for the first time.
+	Rotated int
+	// Current were sealed with the current key already, empty message bodies are current too.
+	Current int
+	// Changed were updated or deleted during the rotation, they don't need it anymore.
+	Changed int
+}
+
+// Finished reports whether everything is sealed with the current key, so previous secrets can be removed.
+func (r *RotateResult) Finished() bool {
+	return len(r.Failed) == 0
+}
+
+// Rotate seals tokens of every instance with the current key of sealer, batch instances at once.
+// Tokens are decrypted by previous keys, a token changed meanwhile is left as is.
+func Rotate(ctx context.Context, store storage.InstanceStorage, sealer *encryption.Sealer, batch int) (*RotateResult, error) {
+	if batch <= 0 {
+		batch = DefaultRotateBatch
+	}
+
+	result := &RotateResult{Failed: []string{}}
+	after := ""
+
+	for {
+		list, err := store.ListInstancesAfter(ctx, after, batch)
+		if err != nil {
+			return result, err
+		}
+
+		for i := range list {
+			if err := rotate(ctx, store, sealer, &list[i], result); err != nil {
+				return result, err
+			}
+		}
+
+		if len(list) < batch {
+			return result, nil
+		}
+
+		after = list[len(list)-1].Name
+	}
+}
+
+func rotate(ctx context.Context, store storage.InstanceStorage, sealer *encryption.Sealer, i *storage.Instance,
+	result *RotateResult) error {
+	if sealer.Current(i.Token) {
+		result.Current++
+		return nil
+	}
+
+	token, err := sealer.Open(i.Token, []byte(i.Name))
+	if err != nil {
+		logger.Errorln(fmt.Errorf("token of instance %s: %w", i.Name, err))
+		result.Failed = append(result.Failed, i.Name)
+
+		return nil
+	}
+
+	sealed, err := sealer.Seal(token, []byte(i.Name))
+	if err != nil {
+		return err
+	}
+
+	err = store.UpdateInstanceToken(ctx, i.Name, i.Token, sealed)
+	if errors.Is(err, storage.ErrNotFound) {
+		result.Changed++
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result.Rotated++
+
+	return nil
+}
+
+// RotateMessages seals bodies of every message with the current key of sealer, batch messages at once.
+// Bodies saved in plaintext before they were sealed are sealed as well and their plaintext is cleared.
+func RotateMessages(ctx context.Context, store storage.SealedMessageStorage, sealer *encryption.Sealer,
+	batch int) (*RotateResult, error) {
+	if batch <= 0 {
+		batch = DefaultRotateBatch
+	}
+
+	result := &RotateResult{Failed: []string{}}
+
+	err := rotatePages(batch, func(last *storage.Message) ([]storage.Message, error) {
+		after := int64(0)
+		if last != nil {
+			after = last.ID
+		}
+
+		return store.ListMessagesAfter(ctx, after, batch)
+	}, func(m *storage.Message) error {
+		return rotateValue(sealer, result, &sealedValue{
+			id:        strconv.FormatInt(m.ID, 10),
+			what:      "body of message",
+			plaintext: []byte(m.Body),
+			sealed:    m.SealedBody,
+			data:      m.SealingData(),
+			update: func(sealed []byte) error {
+				return store.UpdateMessageBody(ctx, m.ID, m.SealedBody, sealed)
+			},
+		})
+	})
+
+	return result, err
+}
+
+// RotatePayloads seals payloads of notifications, jobs and scheduled messages and fields of campaign recipients
+// with the current key of sealer, batch rows at once. Payloads saved in plaintext are sealed as well.
+func RotatePayloads(ctx context.Context, store storage.SealedPayloadStorage, sealer *encryption.Sealer,
+	batch int) (*RotateResult, error) {
+	if batch <= 0 {
+		batch = DefaultRotateBatch
+	}
+
+	result := &RotateResult{Failed: []string{}}
+
+	err := rotatePages(batch, func(last *storage.Notification) ([]storage.Notification, error) {
+		after := int64(0)
+		if last != nil {
+			after = last.ID
+		}
+
+		return store.ListNotificationsAfter(ctx, after, batch)
+	}, func(n *storage.Notification) error {
+		return rotateValue(sealer, result, &sealedValue{
+			id:        "notifications/" + strconv.FormatInt(n.ID, 10),
+			what:      "payload of",
+			plaintext: n.Payload,
+			sealed:    n.SealedPayload,
+			data:      n.SealingData(),
+			update: func(sealed []byte) error {
+				return store.UpdateNotificationPayload(ctx, n.ID, n.SealedPayload, sealed)
+			},
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = rotatePages(batch, func(last *storage.Job) ([]storage.Job, error) {
+		after := ""
+		if last != nil {
+			after = last.ID
+		}
+
+		return store.ListJobsAfter(ctx, after, batch)
+	}, func(j *storage.Job) error {
+		return rotateValue(sealer, result, &sealedValue{
+			id:        "jobs/" + j.ID,
+			what:      "payload of",
+			plaintext: j.Payload,
+			sealed:    j.SealedPayload,
+			data:      j.SealingData(),
+			update: func(sealed []byte) error {
+				return store.UpdateJobPayload(ctx, j.ID, j.SealedPayload, sealed)
+			},
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = rotatePages(batch, func(last *storage.ScheduledMessage) ([]storage.ScheduledMessage, error) {
+		after := ""
+		if last != nil {
+			after = last.ID
+		}
+
+		return store.ListScheduledAfter(ctx, after, batch)
+	}, func(m *storage.ScheduledMessage) error {
+		return rotateValue(sealer, result, &sealedValue{
+			id:        "scheduled_messages/" + m.ID,
+			what:      "payload of",
+			plaintext: m.Payload,
+			sealed:    m.SealedPayload,
+			data:      m.SealingData(),
+			update: func(sealed []byte) error {
+				return store.UpdateScheduledPayload(ctx, m, sealed)
+			},
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = rotatePages(batch, func(last *storage.Recipient) ([]storage.Recipient, error) {
+		if last == nil {
+			return store.ListRecipientsAfter(ctx, "", 0, batch)
+		}
+
+		return store.ListRecipientsAfter(ctx, last.CampaignID, last.Line, batch)
+	}, func(r *storage.Recipient) error {
+		return rotateValue(sealer, result, &sealedValue{
+			id:        "campaign_recipients/" + r.CampaignID + "/" + strconv.Itoa(r.Line),
+			what:      "fields of",
+			plaintext: r.Fields,
+			sealed:    r.SealedFields,
+			data:      r.SealingData(),
+			update: func(sealed []byte) error {
+				return store.UpdateRecipientFields(ctx, r, sealed)
+			},
+		})
+	})
+
+	return result, err
+}
+
+// rotatePages lists rows page by page after the last row of the previous page and rotates each of them.
+func rotatePages[T any](batch int, list func(last *T) ([]T, error), rotate func(row *T) error) error {
+	var last *T
+
+	for {
+		page, err := list(last)
+		if err != nil {
+			return err
+		}
+
+		for i := range page {
+			if err := rotate(&page[i]); err != nil {
+				return err
+			}
+		}
+
+		if len(page) < batch {
+			return nil
+		}
+
+		last = &page[len(page)-1]
+	}
+}
+
+// sealedValue is a value sealed in a row of the database. Plaintext is the value saved before it was
+// sealed, update saves the value sealed again if the row is not changed meanwhile.
+type sealedValue struct {
+	update    func(sealed []byte) error
+	id        string
+	what      string
+	plaintext []byte
+	sealed    []byte
+	data      []byte
+}
+
+func rotateValue(sealer *encryption.Sealer, result *RotateResult, v *sealedValue) error {
+	plaintext := v.plaintext
+
+	switch {
+	case len(v.sealed) == 0 && len(v.plaintext) == 0:
+		result.Current++
+		return nil
+	case len(v.sealed) == 0:
+	case sealer.Current(v.sealed):
+		result.Current++
+		return nil
+	default:
+		opened, err := sealer.Open(v.sealed, v.data)
+		if err != nil {
+			logger.Errorln(fmt.Errorf("%s %s: %w", v.what, v.id, err))
+			result.Failed = append(result.Failed, v.id)
+
+			return nil
+		}
+
+		plaintext = opened
+	}
+
+	sealed, err := sealer.Seal(plaintext, v.data)
+	if err != nil {
+		return err
+	}
+
+	err = v.update(sealed)
+	if errors.Is(err, storage.ErrNotFound) {
+		result.Changed++
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result.Rotated++
+
+	return nil
+}
+
+// RotateCommand runs rotate-keys subcommand with optional batch size: tokens of instances, bodies
+// of messages and payloads are sealed with the current key, the result is printed to w. It fails when
+// some of them can't be decrypted, previous secrets must be kept until it succeeds.
+func RotateCommand(ctx context.Context, store RotateStorage, sealer *encryption.Sealer, args []string,
+	w io.Writer) error {
+	batch := DefaultRotateBatch
+
+	switch len(args) {
+	case 0:
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return ErrRotateUsage
+		}
+
+		batch = n
+	default:
+		return ErrRotateUsage
+	}
+
+	tokens, err := Rotate(ctx, store, sealer, batch)
+	if err != nil {
+		return err
+	}
+
+	if err := printRotated(w, "tokens", sealer, tokens); err != nil {
+		return err
+	}
+
+	messages, err := RotateMessages(ctx, store, sealer, batch)
+	if err != nil {
+		return err
+	}
+
+	if err := printRotated(w, "message bodies", sealer, messages); err != nil {
+		return err
+	}
+
+	payloads, err := RotatePayloads(ctx, store, sealer, batch)
+	if err != nil {
+		return err
+	}
+
+	if err := printRotated(w, "payloads", sealer, payloads); err != nil {
+		return err
+	}
+
+	var errs []error
+
+	if !tokens.Finished() {
+		errs = append(errs, fmt.Errorf("tokens of %v can't be decrypted by any key, register them again", tokens.Failed))
+	}
+
+	if !messages.Finished() {
+		errs = append(errs, fmt.Errorf("bodies of messages %v can't be decrypted by any key", messages.Failed))
+	}
+
+	if !payloads.Finished() {
+		errs = append(errs, fmt.Errorf("payloads of %v can't be decrypted by any key", payloads.Failed))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, "rotation finished, previous secrets can be removed")
+
+	return err
+}
+
+func printRotated(w io.Writer, what string, sealer *encryption.Sealer, result *RotateResult) error {
+	_, err := fmt.Fprintf(w, "%s, key %s: rotated %d, already current %d, changed meanwhile %d, failed %d\n",
+		what, sealer.KeyID(), result.Rotated, result.Current, result.Changed, len(result.Failed))
+
+	return err
+}
@@ -0,0 +1,378 @@
+package instances_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/instances"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// fakeMessages is an in-memory SealedMessageStorage.
+type fakeMessages struct {
+	sealer   storage.Sealer
+	messages []storage.Message
+	mu       sync.Mutex
+}
+
+func (f *fakeMessages) SetSealer(sealer storage.Sealer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sealer = sealer
+}
+
+// save keeps the message as Postgres.SaveMessage does and returns its id.
+func (f *fakeMessages) save(t *testing.T, body string) int64 {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := storage.Message{ID: int64(len(f.messages) + 1), IDInstance: "1101000001", ChatID: "79876543210@c.us", Body: body}
+
+	if f.sealer != nil && body != "" {
+		sealed, err := f.sealer.Seal([]byte(body), m.SealingData())
+		require.NoError(t, err)
+
+		m.Body, m.SealedBody = "", sealed
+	}
+
+	f.messages = append(f.messages, m)
+
+	return m.ID
+}
+
+func (f *fakeMessages) ListMessagesAfter(_ context.Context, after int64, limit int) ([]storage.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []storage.Message{}
+	for _, m := range f.messages {
+		if m.ID > after && len(list) < limit {
+			list = append(list, m)
+		}
+	}
+
+	return list, nil
+}
+
+func (f *fakeMessages) UpdateMessageBody(_ context.Context, id int64, old, sealed []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, m := range f.messages {
+		if m.ID == id && bytes.Equal(m.SealedBody, old) {
+			f.messages[i].Body, f.messages[i].SealedBody = "", sealed
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
+
+// fakePayloads is an in-memory SealedPayloadStorage, rows are kept in order of their keys.
+type fakePayloads struct {
+	notifications []storage.Notification
+	jobs          []storage.Job
+	scheduled     []storage.ScheduledMessage
+	recipients    []storage.Recipient
+}
+
+func (f *fakePayloads) ListNotificationsAfter(_ context.Context, after int64,
+	limit int) ([]storage.Notification, error) {
+	list := []storage.Notification{}
+	for _, n := range f.notifications {
+		if n.ID > after && len(list) < limit {
+			list = append(list, n)
+		}
+	}
+
+	return list, nil
+}
+
+func (f *fakePayloads) UpdateNotificationPayload(_ context.Context, id int64, old, sealed []byte) error {
+	for i, n := range f.notifications {
+		if n.ID == id && bytes.Equal(n.SealedPayload, old) {
+			f.notifications[i].Payload, f.notifications[i].SealedPayload = json.RawMessage("null"), sealed
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
+
+func (f *fakePayloads) ListJobsAfter(_ context.Context, after string, limit int) ([]storage.Job, error) {
+	list := []storage.Job{}
+	for _, j := range f.jobs {
+		if j.ID > after && len(list) < limit {
+			list = append(list, j)
+		}
+	}
+
+	return list, nil
+}
+
+func (f *fakePayloads) UpdateJobPayload(_ context.Context, id string, old, sealed []byte) error {
+	for i, j := range f.jobs {
+		if j.ID == id && bytes.Equal(j.SealedPayload, old) {
+			f.jobs[i].Payload, f.jobs[i].SealedPayload = json.RawMessage("null"), sealed
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
+
+func (f *fakePayloads) ListScheduledAfter(_ context.Context, after string,
+	limit int) ([]storage.ScheduledMessage, error) {
+	list := []storage.ScheduledMessage{}
+	for _, m := range f.scheduled {
+		if m.ID > after && len(list) < limit {
+			list = append(list, m)
+		}
+	}
+
+	return list, nil
+}
+
+func (f *fakePayloads) UpdateScheduledPayload(_ context.Context, m *storage.ScheduledMessage, sealed []byte) error {
+	for i, saved := range f.scheduled {
+		if saved.ID == m.ID && bytes.Equal(saved.SealedPayload, m.SealedPayload) && saved.UpdatedAt.Equal(m.UpdatedAt) {
+			f.scheduled[i].Payload, f.scheduled[i].SealedPayload = json.RawMessage("null"), sealed
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
+
+func (f *fakePayloads) ListRecipientsAfter(_ context.Context, campaignID string, line,
+	limit int) ([]storage.Recipient, error) {
+	list := []storage.Recipient{}
+	for _, r := range f.recipients {
+		after := r.CampaignID > campaignID || r.CampaignID == campaignID && r.Line > line
+		if after && len(list) < limit {
+			list = append(list, r)
+		}
+	}
+
+	return list, nil
+}
+
+func (f *fakePayloads) UpdateRecipientFields(_ context.Context, r *storage.Recipient, sealed []byte) error {
+	for i, saved := range f.recipients {
+		if saved.CampaignID == r.CampaignID && saved.Line == r.Line && bytes.Equal(saved.SealedFields, r.SealedFields) {
+			f.recipients[i].Fields, f.recipients[i].SealedFields = json.RawMessage("null"), sealed
+			return nil
+		}
+	}
+
+	return storage.ErrNotFound
+}
+
+// rotateStore keeps instances, messages and payloads as the database does.
+type rotateStore struct {
+	*fakeInstances
+	*fakeMessages
+	*fakePayloads
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeInstances()
+
+	old := instances.New(store, newSealer(t, "old secret"), "", nil)
+	for _, req := range []instances.Request{
+		{Name: "a", IDInstance: "1101000001", APITokenInstance: "token-a"},
+		{Name: "b", IDInstance: "1101000002", APITokenInstance: "token-b"},
+		{Name: "c", IDInstance: "1101000003", APITokenInstance: "token-c"},
+	} {
+		_, err := old.Create(ctx, &req)
+		require.NoError(t, err)
+	}
+
+	sealer := newSealer(t, "new secret", "old secret")
+	r := instances.New(store, sealer, "", nil)
+
+	// saved with the new secret before rotation
+	_, err := r.Update(ctx, "c", &instances.Request{APITokenInstance: "token-c"})
+	require.NoError(t, err)
+
+	result, err := instances.Rotate(ctx, store, sealer, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Rotated)
+	assert.Equal(t, 1, result.Current)
+	assert.True(t, result.Finished())
+
+	// previous secrets are not needed anymore
+	r = instances.New(store, newSealer(t, "new secret"), "", nil)
+	require.NoError(t, r.Load(ctx))
+	assert.Equal(t, []string{"a", "b", "c"}, r.Instances())
+
+	result, err = instances.Rotate(ctx, store, sealer, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Rotated)
+	assert.Equal(t, 3, result.Current)
+}
+
+func TestRotateMessages(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeMessages{}
+
+	plain := store.save(t, "saved before bodies were sealed")
+	empty := store.save(t, "")
+
+	store.SetSealer(newSealer(t, "old secret"))
+	old := store.save(t, "sealed with the old secret")
+
+	sealer := newSealer(t, "new secret", "old secret")
+	store.SetSealer(sealer)
+	current := store.save(t, "sealed with the new secret")
+
+	result, err := instances.RotateMessages(ctx, store, sealer, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Rotated)
+	assert.Equal(t, 2, result.Current)
+	assert.True(t, result.Finished())
+
+	// previous secrets are not needed anymore
+	only := newSealer(t, "new secret")
+	want := map[int64]string{
+		plain:   "saved before bodies were sealed",
+		empty:   "",
+		old:     "sealed with the old secret",
+		current: "sealed with the new secret",
+	}
+
+	for _, m := range store.messages {
+		assert.Empty(t, m.Body, "the plaintext is cleared")
+
+		if want[m.ID] == "" {
+			assert.Empty(t, m.SealedBody)
+			continue
+		}
+
+		body, err := only.Open(m.SealedBody, m.SealingData())
+		require.NoError(t, err)
+		assert.Equal(t, want[m.ID], string(body))
+	}
+
+	store.SetSealer(newSealer(t, "lost secret"))
+	lost := store.save(t, "sealed with a lost secret")
+
+	result, err = instances.RotateMessages(ctx, store, sealer, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Rotated)
+	assert.Equal(t, 4, result.Current)
+	assert.Equal(t, []string{strconv.FormatInt(lost, 10)}, result.Failed)
+}
+
+func TestRotatePayloads(t *testing.T) {
+	ctx := context.Background()
+	old := newSealer(t, "old secret")
+	sealer := newSealer(t, "new secret", "old secret")
+	payload := json.RawMessage(`{"message":"hello"}`)
+
+	seal := func(data []byte) []byte {
+		sealed, err := old.Seal(payload, data)
+		require.NoError(t, err)
+
+		return sealed
+	}
+
+	store := &fakePayloads{
+		notifications: []storage.Notification{{ID: 1, IDInstance: "1101000001", Payload: payload}},
+		jobs:          []storage.Job{{ID: "a1", IDInstance: "1101000001", Payload: payload}},
+		scheduled:     []storage.ScheduledMessage{{ID: "s1", IDInstance: "1101000001", Payload: payload}},
+		recipients: []storage.Recipient{
+			{CampaignID: "c1", Line: 2, Fields: payload},
+			{CampaignID: "c1", Line: 3, Fields: json.RawMessage("null")},
+		},
+	}
+
+	store.jobs = append(store.jobs, storage.Job{ID: "a2", IDInstance: "1101000001", Payload: json.RawMessage("null")})
+	store.jobs[1].SealedPayload = seal(store.jobs[1].SealingData())
+	store.recipients[1].SealedFields = seal(store.recipients[1].SealingData())
+
+	result, err := instances.RotatePayloads(ctx, store, sealer, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 6, result.Rotated)
+	assert.True(t, result.Finished())
+
+	// previous secrets are not needed anymore
+	only := newSealer(t, "new secret")
+	opened := []struct {
+		sealed []byte
+		data   []byte
+	}{
+		{store.notifications[0].SealedPayload, store.notifications[0].SealingData()},
+		{store.jobs[0].SealedPayload, store.jobs[0].SealingData()},
+		{store.jobs[1].SealedPayload, store.jobs[1].SealingData()},
+		{store.scheduled[0].SealedPayload, store.scheduled[0].SealingData()},
+		{store.recipients[0].SealedFields, store.recipients[0].SealingData()},
+		{store.recipients[1].SealedFields, store.recipients[1].SealingData()},
+	}
+
+	for _, v := range opened {
+		plaintext, err := only.Open(v.sealed, v.data)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(payload), string(plaintext))
+	}
+
+	assert.JSONEq(t, "null", string(store.jobs[0].Payload), "the plaintext is cleared")
+
+	lost, err := newSealer(t, "lost secret").Seal(payload, store.jobs[0].SealingData())
+	require.NoError(t, err)
+
+	store.jobs[0].SealedPayload = lost
+
+	result, err = instances.RotatePayloads(ctx, store, sealer, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Rotated)
+	assert.Equal(t, 5, result.Current)
+	assert.Equal(t, []string{"jobs/a1"}, result.Failed)
+}
+
+func TestRotateCommand(t *testing.T) {
+	ctx := context.Background()
+	messages := &fakeMessages{}
+	store := &rotateStore{fakeInstances: newFakeInstances(), fakeMessages: messages, fakePayloads: &fakePayloads{}}
+
+	_, err := instances.New(store, newSealer(t, "old secret"), "", nil).
+		Create(ctx, &instances.Request{Name: "sales", IDInstance: "1101000001", APITokenInstance: "token"})
+	require.NoError(t, err)
+
+	messages.SetSealer(newSealer(t, "old secret"))
+	messages.save(t, "hello")
+
+	var out strings.Builder
+
+	// the old secret is not given, the token can't be rotated
+	err = instances.RotateCommand(ctx, store, newSealer(t, "new secret"), nil, &out)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tokens of [sales]")
+	assert.Contains(t, err.Error(), "bodies of messages [1]")
+	assert.Contains(t, out.String(), "failed 1")
+
+	out.Reset()
+
+	sealer := newSealer(t, "new secret", "old secret")
+	require.NoError(t, instances.RotateCommand(ctx, store, sealer, []string{"10"}, &out))
+	assert.Equal(t, "tokens, key "+sealer.KeyID()+": rotated 1, already current 0, changed meanwhile 0, failed 0\n"+
+		"message bodies, key "+sealer.KeyID()+": rotated 1, already current 0, changed meanwhile 0, failed 0\n"+
+		"payloads, key "+sealer.KeyID()+": rotated 0, already current 0, changed meanwhile 0, failed 0\n"+
+		"rotation finished, previous secrets can be removed\n", out.String())
+
+	for _, args := range [][]string{{"0"}, {"ten"}, {"1", "2"}} {
+		require.ErrorIs(t, instances.RotateCommand(ctx, store, sealer, args, &out), instances.ErrRotateUsage)
+	}
+}
@@ -0,0 +1,128 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// DefaultDedupTTL is how long delivered notifications are remembered. GREEN-API retries
+// undelivered webhooks within minutes.
+const DefaultDedupTTL = time.Hour
+
+// Deduplicator remembers notification keys for ttl to skip repeated deliveries. Keys are kept in memory
+// of the replica, or in the database shared by replicas when it is set.
+type Deduplicator struct {
+	store     storage.WebhookKeyStorage
+	seen      map[string]time.Time
+	now       func() time.Time
+	lastSweep time.Time
+	ttl       time.Duration
+	mu        sync.Mutex
+}
+
+func NewDeduplicator(ttl time.Duration) *Deduplicator {
+	return &Deduplicator{
+		seen: make(map[string]time.Time),
+		now:  time.Now,
+		ttl:  ttl,
+	}
+}
+
+// SetClock replaces time source, used in tests.
+func (d *Deduplicator) SetClock(now func() time.Time) *Deduplicator {
+	d.now = now
+	return d
+}
+
+// SetStorage keeps keys in the database, so a delivery repeated to another replica is skipped too.
+func (d *Deduplicator) SetStorage(store storage.WebhookKeyStorage) *Deduplicator {
+	d.store = store
+	return d
+}
+
+// Seen marks key as delivered and reports whether it was already delivered within ttl.
+// The key is forgotten with Forget when the delivery fails.
+func (d *Deduplicator) Seen(ctx context.Context, key string) (bool, error) {
+	d.mu.Lock()
+
+	now := d.now()
+	sweep := now.Sub(d.lastSweep) > d.ttl
+
+	if sweep {
+		d.lastSweep = now
+	}
+
+	if d.store == nil {
+		defer d.mu.Unlock()
+
+		return d.seenLocally(key, now, sweep), nil
+	}
+
+	d.mu.Unlock()
+
+	if sweep {
+		if err := d.store.DeleteWebhookKeysBefore(ctx, now.Add(-d.ttl)); err != nil {
+			return false, err
+		}
+	}
+
+	err := d.store.ClaimWebhookKey(ctx, key, now, now.Add(-d.ttl))
+	if errors.Is(err, storage.ErrDuplicate) {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// Forget removes the key of a delivery that failed, so its repetition is handled again.
+func (d *Deduplicator) Forget(ctx context.Context, key string) error {
+	if d.store != nil {
+		return d.store.DeleteWebhookKey(ctx, key)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.seen, key)
+
+	return nil
+}
+
+func (d *Deduplicator) seenLocally(key string, now time.Time, sweep bool) bool {
+	if sweep {
+		for k, at := range d.seen {
+			if now.Sub(at) > d.ttl {
+				delete(d.seen, k)
+			}
+		}
+	}
+
+	if at, ok := d.seen[key]; ok && now.Sub(at) <= d.ttl {
+		return true
+	}
+
+	d.seen[key] = now
+
+	return false
+}
+
+// Key identifies the notification of the instance. Webhooks have no receiptId,
+// so the key is built from the fields that differ between notifications.
+func Key(idInstance string, w *httpclient.Webhook) string {
+	return strings.Join([]string{
+		idInstance,
+		w.TypeWebhook,
+		w.IDMessage,
+		w.Status,
+		w.StateInstance,
+		w.StatusInstance,
+		strconv.FormatInt(w.Timestamp, 10),
+	}, "|")
+}
@@ -0,0 +1,99 @@
+package notifications_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/notifications"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+func TestDeduplicator_Seen(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	d := notifications.NewDeduplicator(time.Minute).SetClock(func() time.Time { return now })
+
+	seen := func(key string) bool {
+		ok, err := d.Seen(ctx, key)
+		require.NoError(t, err)
+
+		return ok
+	}
+
+	assert.False(t, seen("a"))
+	assert.True(t, seen("a"))
+	assert.False(t, seen("b"))
+
+	require.NoError(t, d.Forget(ctx, "b"))
+	assert.False(t, seen("b"), "forgotten key is delivered again")
+
+	now = now.Add(2 * time.Minute)
+
+	assert.False(t, seen("a"), "expired key is delivered again")
+	assert.True(t, seen("a"))
+}
+
+type memKeys struct {
+	seen  map[string]time.Time
+	swept time.Time
+}
+
+func (m *memKeys) ClaimWebhookKey(_ context.Context, key string, now, expired time.Time) error {
+	if at, ok := m.seen[key]; ok && !at.Before(expired) {
+		return storage.ErrDuplicate
+	}
+
+	m.seen[key] = now
+
+	return nil
+}
+
+func (m *memKeys) DeleteWebhookKey(_ context.Context, key string) error {
+	delete(m.seen, key)
+	return nil
+}
+
+func (m *memKeys) DeleteWebhookKeysBefore(_ context.Context, before time.Time) error {
+	m.swept = before
+	return nil
+}
+
+func TestDeduplicator_Seen_Storage(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	keys := &memKeys{seen: make(map[string]time.Time)}
+
+	// replicas share keys through the database
+	first := notifications.NewDeduplicator(time.Minute).SetClock(func() time.Time { return now }).SetStorage(keys)
+	second := notifications.NewDeduplicator(time.Minute).SetClock(func() time.Time { return now }).SetStorage(keys)
+
+	ok, err := first.Seen(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, now.Add(-time.Minute), keys.swept)
+
+	ok, err = second.Seen(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok, "delivery repeated to another replica is skipped")
+
+	require.NoError(t, second.Forget(ctx, "a"))
+
+	ok, err = first.Seen(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, ok, "forgotten key is delivered again")
+}
+
+func TestKey(t *testing.T) {
+	delivered := &httpclient.Webhook{TypeWebhook: httpclient.TypeOutgoingMessageStatus, IDMessage: "A1", Status: "delivered"}
+	read := &httpclient.Webhook{TypeWebhook: httpclient.TypeOutgoingMessageStatus, IDMessage: "A1", Status: "read"}
+
+	assert.Equal(t, notifications.Key(testID, delivered), notifications.Key(testID, delivered))
+	assert.NotEqual(t, notifications.Key(testID, delivered), notifications.Key(testID, read))
+	assert.NotEqual(t, notifications.Key(testID, delivered), notifications.Key("1101000002", delivered))
+}
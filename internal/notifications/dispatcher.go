@@ -0,0 +1,96 @@
+// Package notifications delivers incoming GREEN-API notifications to registered handlers.
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/log"
+)
+
+var logger = log.NewLogger("info", log.DefaultBuildLogger)
+
+// Handler processes a notification of the instance idInstance.
+type Handler interface {
+	Handle(ctx context.Context, idInstance string, w *httpclient.Webhook) error
+}
+
+// HandlerFunc is an adapter to use ordinary functions as Handler.
+type HandlerFunc func(ctx context.Context, idInstance string, w *httpclient.Webhook) error
+
+func (f HandlerFunc) Handle(ctx context.Context, idInstance string, w *httpclient.Webhook) error {
+	return f(ctx, idInstance, w)
+}
+
+type receiptKey struct{}
+
+// WithReceiptID stores receiptId of the polled notification in ctx.
+func WithReceiptID(ctx context.Context, receiptID int64) context.Context {
+	return context.WithValue(ctx, receiptKey{}, receiptID)
+}
+
+// ReceiptID returns receiptId of the notification being dispatched, 0 for webhooks.
+func ReceiptID(ctx context.Context) int64 {
+	id, _ := ctx.Value(receiptKey{}).(int64)
+	return id
+}
+
+// Dispatcher routes notifications to handlers by typeWebhook.
+type Dispatcher struct {
+	byType map[string][]Handler
+	all    []Handler
+	mu     sync.RWMutex
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		byType: make(map[string][]Handler),
+	}
+}
+
+// Handle registers h for notifications of typeWebhook. Empty typeWebhook registers h for all notifications.
+func (d *Dispatcher) Handle(typeWebhook string, h Handler) *Dispatcher {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if typeWebhook == "" {
+		d.all = append(d.all, h)
+		return d
+	}
+
+	d.byType[typeWebhook] = append(d.byType[typeWebhook], h)
+
+	return d
+}
+
+// HandleFunc registers fn for notifications of typeWebhook.
+func (d *Dispatcher) HandleFunc(typeWebhook string, fn HandlerFunc) *Dispatcher {
+	return d.Handle(typeWebhook, fn)
+}
+
+// Dispatch calls handlers registered for all notifications and then handlers of w.TypeWebhook.
+// Every handler is called, errors are joined.
+func (d *Dispatcher) Dispatch(ctx context.Context, idInstance string, w *httpclient.Webhook) error {
+	if w == nil {
+		return nil
+	}
+
+	d.mu.RLock()
+	handlers := make([]Handler, 0, len(d.all)+len(d.byType[w.TypeWebhook]))
+	handlers = append(handlers, d.all...)
+	handlers = append(handlers, d.byType[w.TypeWebhook]...)
+	d.mu.RUnlock()
+
+	var errs []error
+
+	for _, h := range handlers {
+		if err := h.Handle(ctx, idInstance, w); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", w.TypeWebhook, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,55 @@
+package notifications_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/notifications"
+)
+
+const testID = "1101000001"
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	var calls []string
+
+	record := func(name string, err error) notifications.HandlerFunc {
+		return func(_ context.Context, idInstance string, _ *httpclient.Webhook) error {
+			assert.Equal(t, testID, idInstance)
+
+			calls = append(calls, name)
+
+			return err
+		}
+	}
+
+	d := notifications.NewDispatcher().
+		HandleFunc("", record("all", nil)).
+		HandleFunc(httpclient.TypeIncomingMessageReceived, record("incoming", errors.New("boom"))).
+		HandleFunc(httpclient.TypeIncomingMessageReceived, record("incoming 2", nil)).
+		HandleFunc(httpclient.TypeOutgoingMessageStatus, record("status", nil))
+
+	err := d.Dispatch(context.Background(), testID, &httpclient.Webhook{TypeWebhook: httpclient.TypeIncomingMessageReceived})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "incomingMessageReceived: boom")
+	assert.Equal(t, []string{"all", "incoming", "incoming 2"}, calls, "failed handler must not stop others")
+
+	calls = nil
+
+	require.NoError(t, d.Dispatch(context.Background(), testID, &httpclient.Webhook{TypeWebhook: httpclient.TypeStateInstanceChanged}))
+	assert.Equal(t, []string{"all"}, calls)
+
+	calls = nil
+
+	require.NoError(t, d.Dispatch(context.Background(), testID, nil))
+	assert.Empty(t, calls)
+}
+
+func TestReceiptID(t *testing.T) {
+	assert.Equal(t, int64(0), notifications.ReceiptID(context.Background()))
+	assert.Equal(t, int64(42), notifications.ReceiptID(notifications.WithReceiptID(context.Background(), 42)))
+}
@@ -0,0 +1,163 @@
+package notifications
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+const (
+	// defaultReceiveTimeout is how long receiveNotification waits for a notification, seconds.
+	// It stays below the client timeout.
+	defaultReceiveTimeout = 20
+	defaultRetryDelay     = 5 * time.Second
+	// defaultRefresh is how often instances are read again, so added ones are polled and removed ones are not.
+	defaultRefresh = 10 * time.Second
+)
+
+// Poller long-polls receiveNotification for every instance, dispatches notifications
+// and deletes them from the queue.
+type Poller struct {
+	clients        httpclient.Provider
+	dispatcher     *Dispatcher
+	receiveTimeout int
+	retryDelay     time.Duration
+	refresh        time.Duration
+}
+
+func NewPoller(clients httpclient.Provider, dispatcher *Dispatcher) *Poller {
+	return &Poller{
+		clients:        clients,
+		dispatcher:     dispatcher,
+		receiveTimeout: defaultReceiveTimeout,
+		retryDelay:     defaultRetryDelay,
+		refresh:        defaultRefresh,
+	}
+}
+
+// SetReceiveTimeout sets receiveTimeout of receiveNotification in seconds.
+func (p *Poller) SetReceiveTimeout(seconds int) *Poller {
+	p.receiveTimeout = seconds
+	return p
+}
+
+// SetRetryDelay sets pause after a failed receiveNotification or deleteNotification.
+func (p *Poller) SetRetryDelay(d time.Duration) *Poller {
+	p.retryDelay = d
+	return p
+}
+
+// SetRefresh sets how often instances are read again.
+func (p *Poller) SetRefresh(d time.Duration) *Poller {
+	p.refresh = d
+	return p
+}
+
+// Run polls every instance until done is closed. Instances are read again every refresh interval,
+// added ones are polled and polling of removed ones is stopped. A pending long-poll is cancelled on done.
+func (p *Poller) Run(done <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	polls := make(map[string]context.CancelFunc)
+
+	ticker := time.NewTicker(p.refresh)
+	defer ticker.Stop()
+
+	for {
+		current := make(map[string]bool)
+
+		for _, idInstance := range p.clients.Instances() {
+			current[idInstance] = true
+
+			if _, ok := polls[idInstance]; ok {
+				continue
+			}
+
+			pollCtx, stop := context.WithCancel(ctx)
+			polls[idInstance] = stop
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				p.poll(pollCtx, idInstance)
+			}()
+		}
+
+		for idInstance, stop := range polls {
+			if !current[idInstance] {
+				stop()
+				delete(polls, idInstance)
+			}
+		}
+
+		select {
+		case <-done:
+			cancel()
+			wg.Wait()
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll receives notifications of the instance until ctx is done. The client is resolved on every
+// receive, so a changed token is picked up.
+func (p *Poller) poll(ctx context.Context, idInstance string) {
+	for ctx.Err() == nil {
+		c, err := p.clients.Client(idInstance)
+		if err != nil {
+			logger.Errorw("failed to resolve instance", "instance", idInstance, "error", err)
+			p.wait(ctx)
+
+			continue
+		}
+
+		if err := p.Next(ctx, c); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			logger.Errorw("failed to receive notification", "instance", c.GetIDInstance(), "error", err)
+			p.wait(ctx)
+		}
+	}
+}
+
+// Next receives one notification of c, dispatches it and deletes it from the queue.
+// ctx cancels waiting only: a received notification is handled and deleted anyway, so shutdown
+// does not make it processed twice. Handler errors are logged, the notification is deleted
+// so it is not redelivered forever.
+func (p *Poller) Next(ctx context.Context, c *httpclient.Client) error {
+	n, err := c.ReceiveNotification(ctx, p.receiveTimeout)
+	if err != nil || n == nil {
+		return err
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	if err := p.dispatcher.Dispatch(WithReceiptID(ctx, n.ReceiptID), c.GetIDInstance(), n.Body); err != nil {
+		logger.Errorw("failed to handle notification", "instance", c.GetIDInstance(),
+			"receiptId", n.ReceiptID, "error", err)
+	}
+
+	_, err = c.DeleteNotification(ctx, n.ReceiptID)
+
+	return err
+}
+
+func (p *Poller) wait(ctx context.Context) {
+	t := time.NewTimer(p.retryDelay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
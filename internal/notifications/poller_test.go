@@ -0,0 +1,219 @@
+package notifications_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/notifications"
+)
+
+const testToken = "d75b3a66374942c5b3c019c698abc2067e151558acbd412345"
+
+// fakeQueue is a GREEN-API notification queue of a single instance.
+type fakeQueue struct {
+	queue   []string
+	deleted []string
+	mu      sync.Mutex
+}
+
+func newQueueServer(t *testing.T, q *fakeQueue) *httptest.Server {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		rw.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case strings.Contains(r.URL.Path, "/"+httpclient.MethodReceiveNotification+"/"):
+			if len(q.queue) == 0 {
+				_, _ = io.WriteString(rw, "null")
+				return
+			}
+
+			_, _ = io.WriteString(rw, q.queue[0])
+		case strings.Contains(r.URL.Path, "/"+httpclient.MethodDeleteNotification+"/") && r.Method == http.MethodDelete:
+			q.queue = q.queue[1:]
+			q.deleted = append(q.deleted, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+			_, _ = io.WriteString(rw, `{"result":true}`)
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestPoller_Next(t *testing.T) {
+	q := &fakeQueue{queue: []string{
+		`{"receiptId":1,"body":{"typeWebhook":"incomingMessageReceived","idMessage":"A1"}}`,
+	}}
+	ts := newQueueServer(t, q)
+	c := httpclient.NewClient(testID, testToken, ts.URL, ts.Client())
+
+	var got []int64
+
+	d := notifications.NewDispatcher().HandleFunc(httpclient.TypeIncomingMessageReceived,
+		func(ctx context.Context, _ string, w *httpclient.Webhook) error {
+			assert.Equal(t, "A1", w.IDMessage)
+
+			got = append(got, notifications.ReceiptID(ctx))
+
+			return nil
+		})
+
+	p := notifications.NewPoller(httpclient.NewPool(ts.URL, ts.Client(), nil), d)
+
+	require.NoError(t, p.Next(context.Background(), c))
+	require.NoError(t, p.Next(context.Background(), c), "empty queue is not an error")
+
+	assert.Equal(t, []int64{1}, got)
+	assert.Equal(t, []string{"1"}, q.deleted)
+}
+
+func TestPoller_Run(t *testing.T) {
+	q := &fakeQueue{queue: []string{
+		`{"receiptId":1,"body":{"typeWebhook":"incomingMessageReceived","idMessage":"A1"}}`,
+		`{"receiptId":2,"body":{"typeWebhook":"outgoingMessageStatus","idMessage":"A2","status":"read"}}`,
+	}}
+	ts := newQueueServer(t, q)
+	pool := httpclient.NewPool(ts.URL, ts.Client(), map[string]string{testID: testToken})
+
+	handled := make(chan string, 2)
+
+	d := notifications.NewDispatcher().HandleFunc("", func(_ context.Context, _ string, w *httpclient.Webhook) error {
+		handled <- w.TypeWebhook
+		return nil
+	})
+
+	p := notifications.NewPoller(pool, d).SetReceiveTimeout(1).SetRetryDelay(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		p.Run(done)
+		close(exited)
+	}()
+
+	for _, want := range []string{httpclient.TypeIncomingMessageReceived, httpclient.TypeOutgoingMessageStatus} {
+		select {
+		case got := <-handled:
+			assert.Equal(t, want, got)
+		case <-time.After(3 * time.Second):
+			t.Fatal("notification was not dispatched")
+		}
+	}
+
+	close(done)
+
+	select {
+	case <-exited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("poller did not stop")
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	assert.Equal(t, []string{"1", "2"}, q.deleted)
+}
+
+// instancesProvider is a Provider whose instances change, as those of the registry.
+type instancesProvider struct {
+	pool      *httpclient.Pool
+	instances []string
+	mu        sync.Mutex
+}
+
+func (p *instancesProvider) Client(idInstance string) (*httpclient.Client, error) {
+	return p.pool.Client(idInstance)
+}
+
+func (p *instancesProvider) Instances() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.instances...)
+}
+
+func (p *instancesProvider) set(instances ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.instances = instances
+}
+
+func TestPoller_Run_Refresh(t *testing.T) {
+	q := &fakeQueue{queue: []string{
+		`{"receiptId":1,"body":{"typeWebhook":"incomingMessageReceived","idMessage":"A1"}}`,
+	}}
+	ts := newQueueServer(t, q)
+	provider := &instancesProvider{pool: httpclient.NewPool(ts.URL, ts.Client(), map[string]string{testID: testToken})}
+
+	handled := make(chan string, 2)
+
+	d := notifications.NewDispatcher().HandleFunc("", func(_ context.Context, _ string, w *httpclient.Webhook) error {
+		handled <- w.IDMessage
+		return nil
+	})
+
+	p := notifications.NewPoller(provider, d).
+		SetReceiveTimeout(1).
+		SetRetryDelay(10 * time.Millisecond).
+		SetRefresh(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		p.Run(done)
+		close(exited)
+	}()
+
+	defer func() {
+		close(done)
+		<-exited
+	}()
+
+	select {
+	case got := <-handled:
+		t.Fatalf("notification %s of an unknown instance is dispatched", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	provider.set(testID)
+
+	select {
+	case got := <-handled:
+		assert.Equal(t, "A1", got, "an instance added later is polled")
+	case <-time.After(3 * time.Second):
+		t.Fatal("notification was not dispatched")
+	}
+
+	provider.set()
+	time.Sleep(50 * time.Millisecond)
+
+	q.mu.Lock()
+	q.queue = append(q.queue, `{"receiptId":2,"body":{"typeWebhook":"incomingMessageReceived","idMessage":"A2"}}`)
+	q.mu.Unlock()
+
+	select {
+	case got := <-handled:
+		t.Fatalf("notification %s of a removed instance is dispatched", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,50 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+// StorageHandler persists every notification and updates status of outgoing messages
+// from outgoingMessageStatus notifications.
+func StorageHandler(store storage.Storage) HandlerFunc {
+	return func(ctx context.Context, idInstance string, w *httpclient.Webhook) error {
+		_, err := store.SaveNotification(ctx, &storage.Notification{
+			IDInstance:  idInstance,
+			TypeWebhook: w.TypeWebhook,
+			IDMessage:   w.IDMessage,
+			ChatID:      w.GetChatID(),
+			Payload:     w.Raw,
+			ReceiptID:   ReceiptID(ctx),
+		})
+		if err != nil {
+			return err
+		}
+
+		if w.TypeWebhook != httpclient.TypeOutgoingMessageStatus || w.IDMessage == "" {
+			return nil
+		}
+
+		err = store.UpdateMessageStatus(ctx, idInstance, w.IDMessage, MessageStatus(w.Status))
+		if errors.Is(err, storage.ErrNotFound) {
+			// message was sent bypassing the server
+			return nil
+		}
+
+		return err
+	}
+}
+
+// MessageStatus maps outgoingMessageStatus status to storage status.
+// noAccount, notInGroup, yellowCard and unknown statuses mean the message is not delivered.
+func MessageStatus(status string) string {
+	switch status {
+	case storage.StatusSent, storage.StatusDelivered, storage.StatusRead:
+		return status
+	default:
+		return storage.StatusFailed
+	}
+}
@@ -0,0 +1,87 @@
+package notifications_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/notifications"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+type fakeStorage struct {
+	statuses      map[string]string
+	notifications []*storage.Notification
+}
+
+func (s *fakeStorage) Ping(context.Context) error { return nil }
+
+func (s *fakeStorage) Close() error { return nil }
+
+func (s *fakeStorage) SaveMessage(_ context.Context, m *storage.Message) (*storage.Message, error) {
+	return m, nil
+}
+
+func (s *fakeStorage) UpdateMessageStatus(_ context.Context, _, idMessage, status string) error {
+	if _, ok := s.statuses[idMessage]; !ok {
+		return storage.ErrNotFound
+	}
+
+	s.statuses[idMessage] = status
+
+	return nil
+}
+
+func (s *fakeStorage) SaveNotification(_ context.Context, n *storage.Notification) (*storage.Notification, error) {
+	s.notifications = append(s.notifications, n)
+	return n, nil
+}
+
+func TestStorageHandler(t *testing.T) {
+	store := &fakeStorage{statuses: map[string]string{"A1": storage.StatusSent}}
+	h := notifications.StorageHandler(store)
+	ctx := notifications.WithReceiptID(context.Background(), 7)
+
+	incoming := &httpclient.Webhook{
+		TypeWebhook: httpclient.TypeIncomingMessageReceived,
+		IDMessage:   "B1",
+		SenderData:  &httpclient.SenderData{ChatID: "79001234568@c.us"},
+		Raw:         []byte(`{"typeWebhook":"incomingMessageReceived"}`),
+	}
+	require.NoError(t, h.Handle(ctx, testID, incoming))
+
+	require.Len(t, store.notifications, 1)
+	assert.Equal(t, testID, store.notifications[0].IDInstance)
+	assert.Equal(t, "79001234568@c.us", store.notifications[0].ChatID)
+	assert.Equal(t, int64(7), store.notifications[0].ReceiptID)
+	assert.JSONEq(t, `{"typeWebhook":"incomingMessageReceived"}`, string(store.notifications[0].Payload))
+
+	status := &httpclient.Webhook{TypeWebhook: httpclient.TypeOutgoingMessageStatus, IDMessage: "A1", Status: "noAccount"}
+	require.NoError(t, h.Handle(ctx, testID, status))
+	assert.Equal(t, storage.StatusFailed, store.statuses["A1"])
+
+	unknown := &httpclient.Webhook{TypeWebhook: httpclient.TypeOutgoingMessageStatus, IDMessage: "C1", Status: "read"}
+	require.NoError(t, h.Handle(ctx, testID, unknown), "messages sent bypassing the server are skipped")
+}
+
+func TestMessageStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{status: "sent", want: storage.StatusSent},
+		{status: "delivered", want: storage.StatusDelivered},
+		{status: "read", want: storage.StatusRead},
+		{status: "failed", want: storage.StatusFailed},
+		{status: "noAccount", want: storage.StatusFailed},
+		{status: "yellowCard", want: storage.StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			assert.Equal(t, tt.want, notifications.MessageStatus(tt.status))
+		})
+	}
+}
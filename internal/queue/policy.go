@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+// DefaultPolicy retries a message for about a minute before it is dead.
+var DefaultPolicy = Policy{
+	MaxAttempts: 5,
+	BaseDelay:   2 * time.Second,
+	MaxDelay:    5 * time.Minute,
+}
+
+// Policy defines how failed jobs are retried.
+type Policy struct {
+	// BaseDelay is the delay after the first failed attempt, it is doubled after every next one.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+	// MaxAttempts is how many times a job is sent before it is dead.
+	MaxAttempts int
+}
+
+// Backoff returns the delay after attempt failed attempts. The exponential delay is jittered
+// into [d/2, d) by jitter from [0, 1), so jobs failed together are not retried together.
+func (p Policy) Backoff(attempt int, jitter float64) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	half := d / 2
+
+	return half + time.Duration(jitter*float64(half))
+}
+
+// Retryable reports whether a failed attempt may succeed later. GREEN-API rate limits,
+// server errors and network failures are retried, invalid requests and other client errors are not.
+func Retryable(err error) bool {
+	if errors.Is(err, httpclient.ErrInvalidRequest) || errors.Is(err, httpclient.ErrUnknownInstance) {
+		return false
+	}
+
+	var apiErr *httpclient.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	return true
+}
+
+// Rejected reports whether Enqueue refused the message for good: the method can not be queued,
+// the instance is unknown or the payload is invalid. Other errors are failures of the job storage.
+func Rejected(err error) bool {
+	return errors.Is(err, ErrUnknownMethod) || errors.Is(err, httpclient.ErrInvalidRequest) ||
+		errors.Is(err, httpclient.ErrUnknownInstance)
+}
@@ -0,0 +1,64 @@
+package queue_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/queue"
+)
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := queue.Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tests := []struct {
+		attempt int
+		jitter  float64
+		want    time.Duration
+	}{
+		{attempt: 1, jitter: 0, want: 500 * time.Millisecond},
+		{attempt: 1, jitter: 0.5, want: 750 * time.Millisecond},
+		{attempt: 2, jitter: 0, want: time.Second},
+		{attempt: 3, jitter: 0.99, want: 3980 * time.Millisecond},
+		{attempt: 4, jitter: 0, want: 4 * time.Second},
+		{attempt: 5, jitter: 0, want: 5 * time.Second},
+		{attempt: 50, jitter: 0, want: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, p.Backoff(tt.attempt, tt.jitter), "attempt %d jitter %g", tt.attempt, tt.jitter)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		name string
+		want bool
+	}{
+		{name: "rate limit", err: &httpclient.APIError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "server error", err: &httpclient.APIError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "network", err: httpclient.NewError(errors.New("connection reset by peer")), want: true},
+		{name: "client error", err: &httpclient.APIError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "unauthorized", err: &httpclient.APIError{StatusCode: http.StatusUnauthorized}, want: false},
+		{name: "invalid request", err: httpclient.NewError(httpclient.ErrInvalidRequest), want: false},
+		{name: "unknown instance", err: httpclient.ErrUnknownInstance, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, queue.Retryable(tt.err))
+		})
+	}
+}
+
+func TestRejected(t *testing.T) {
+	assert.True(t, queue.Rejected(queue.ErrUnknownMethod))
+	assert.True(t, queue.Rejected(httpclient.ErrUnknownInstance))
+	assert.True(t, queue.Rejected(httpclient.NewError(httpclient.ErrInvalidRequest)))
+	assert.False(t, queue.Rejected(errors.New("connection refused")))
+}
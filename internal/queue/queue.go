@@ -0,0 +1,709 @@
+// Package queue sends messages in background. Jobs of an instance are sent one by one by its worker,
+// failed attempts are retried with jittered exponential backoff until attempts are exhausted,
+// then the job is dead and waits for a manual retry. Stored jobs are leased to the queue which sends them,
+// a job interrupted while sending is dead rather than sent twice.
+package queue
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	randv2 "math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/log"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var logger = log.NewLogger("info", log.DefaultBuildLogger)
+
+var (
+	ErrNotFound      = errors.New("job not found")
+	ErrUnknownMethod = errors.New("method can not be queued")
+	ErrNotDead       = errors.New("only dead jobs can be retried")
+)
+
+// DefaultRetention is how long finished jobs are kept in memory without a database.
+const DefaultRetention = time.Hour
+
+// DefaultListLimit is how many jobs List returns when limit is not set.
+const DefaultListLimit = 100
+
+// DefaultLease is how long stored jobs are leased to the queue, the lease is renewed three times as often
+// and jobs of a queue which stopped are claimed by others once it expires.
+const DefaultLease = time.Minute
+
+// errInterrupted is the error of jobs interrupted while sending, they may have been sent.
+var errInterrupted = errors.New("interrupted while sending, the message may have been sent: check the chat and retry")
+
+// Queue is an outbound message queue with a worker per instance. Jobs are kept in memory,
+// with JobStorage they are persisted and leased to the queue, so queues of several replicas
+// share the database without sending a job twice.
+type Queue struct {
+	ctx       context.Context
+	clients   httpclient.Provider
+	store     storage.JobStorage
+	messages  storage.Storage
+	jitter    func() float64
+	jobs      map[string]*storage.Job
+	workers   map[string]*worker
+	owner     string
+	policy    Policy
+	retention time.Duration
+	lease     time.Duration
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	running   bool
+}
+
+// worker holds pending jobs of an instance, wake is signalled when a job is scheduled.
+type worker struct {
+	wake    chan struct{}
+	pending []*storage.Job
+}
+
+func New(clients httpclient.Provider) *Queue {
+	return &Queue{
+		clients:   clients,
+		jitter:    randv2.Float64,
+		jobs:      make(map[string]*storage.Job),
+		workers:   make(map[string]*worker),
+		owner:     newID(),
+		policy:    DefaultPolicy,
+		retention: DefaultRetention,
+		lease:     DefaultLease,
+	}
+}
+
+// SetJobStorage sets persistence of jobs. It is optional, jobs are lost on restart without it.
+func (q *Queue) SetJobStorage(store storage.JobStorage) *Queue {
+	q.store = store
+	return q
+}
+
+// SetStorage sets storage of sent messages, finished jobs are saved there as the proxy does.
+func (q *Queue) SetStorage(store storage.Storage) *Queue {
+	q.messages = store
+	return q
+}
+
+// SetPolicy sets retry policy of new jobs.
+func (q *Queue) SetPolicy(p Policy) *Queue {
+	q.policy = p
+	return q
+}
+
+// SetJitter sets source of backoff jitter in [0, 1).
+func (q *Queue) SetJitter(jitter func() float64) *Queue {
+	q.jitter = jitter
+	return q
+}
+
+// SetRetention sets how long finished jobs are kept in memory without a database.
+func (q *Queue) SetRetention(d time.Duration) *Queue {
+	q.retention = d
+	return q
+}
+
+// SetLease sets how long stored jobs are leased to the queue.
+func (q *Queue) SetLease(d time.Duration) *Queue {
+	q.lease = d
+	return q
+}
+
+// Enqueue validates payload of the method and queues it for the instance. The job is returned
+// right away, it is sent by the worker of the instance.
+func (q *Queue) Enqueue(ctx context.Context, idInstance, method string, payload []byte) (*storage.Job, error) {
+	chatID, compact, err := q.Validate(idInstance, method, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// the name of a registered instance is kept as its idInstance, so jobs are listed and checked under one key
+	c, err := q.clients.Client(idInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &storage.Job{
+		ID:            newID(),
+		IDInstance:    c.GetIDInstance(),
+		Method:        method,
+		ChatID:        chatID,
+		Payload:       compact,
+		Status:        storage.JobQueued,
+		MaxAttempts:   q.policy.MaxAttempts,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if q.store != nil {
+		q.leaseJob(job, now)
+
+		if err := q.store.SaveJob(ctx, job); err != nil {
+			return nil, err
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.prune(now)
+	q.jobs[job.ID] = job
+	q.schedule(job)
+
+	snapshot := *job
+
+	return &snapshot, nil
+}
+
+// Validate checks that the method can be queued for the instance and its payload is valid.
+// It returns the chat of the message and the payload compacted.
+func (q *Queue) Validate(idInstance, method string, payload []byte) (string, []byte, error) {
+	s, ok := senders[method]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	}
+
+	if _, err := q.clients.Client(idInstance); err != nil {
+		return "", nil, err
+	}
+
+	chatID, _, err := s.parse(payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, payload); err != nil {
+		return "", nil, httpclient.NewError(fmt.Errorf("%w: %w", httpclient.ErrInvalidRequest, err))
+	}
+
+	return chatID, compact.Bytes(), nil
+}
+
+// Get returns the job by id.
+func (q *Queue) Get(ctx context.Context, id string) (*storage.Job, error) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+
+	if ok {
+		snapshot := *job
+		q.mu.Unlock()
+
+		return &snapshot, nil
+	}
+
+	q.mu.Unlock()
+
+	if q.store == nil {
+		return nil, ErrNotFound
+	}
+
+	job, err := q.store.GetJob(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	return job, err
+}
+
+// List returns the latest jobs, empty idInstance and status match any.
+func (q *Queue) List(ctx context.Context, idInstance, status string, limit int) ([]storage.Job, error) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+
+	if q.store != nil {
+		return q.store.ListJobs(ctx, idInstance, status, limit)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := []storage.Job{}
+
+	for _, job := range q.jobs {
+		if (idInstance == "" || job.IDInstance == idInstance) && (status == "" || job.Status == status) {
+			jobs = append(jobs, *job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+
+	return jobs, nil
+}
+
+// Retry queues a dead job again with a fresh set of attempts. A stored job is queued only by
+// the retry which changes it in the database, concurrent retries get ErrNotDead.
+func (q *Queue) Retry(ctx context.Context, id string) (*storage.Job, error) {
+	if q.store != nil {
+		return q.retryStored(ctx, id)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if job.Status != storage.JobDead {
+		return nil, ErrNotDead
+	}
+
+	q.reset(job, time.Now())
+	q.schedule(job)
+
+	snapshot := *job
+
+	return &snapshot, nil
+}
+
+func (q *Queue) retryStored(ctx context.Context, id string) (*storage.Job, error) {
+	job, err := q.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if job.Status != storage.JobDead {
+		return nil, ErrNotDead
+	}
+
+	now := time.Now()
+	q.reset(job, now)
+	q.leaseJob(job, now)
+
+	err = q.store.RetryJob(ctx, job)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotDead
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.jobs[job.ID] = job
+	q.schedule(job)
+
+	snapshot := *job
+
+	return &snapshot, nil
+}
+
+// reset gives the job a fresh set of attempts.
+func (q *Queue) reset(job *storage.Job, now time.Time) {
+	job.Status = storage.JobQueued
+	job.Attempts = 0
+	job.MaxAttempts = q.policy.MaxAttempts
+	job.Error = ""
+	job.NextAttemptAt = now
+	job.UpdatedAt = now
+}
+
+// leaseJob leases the job to the queue.
+func (q *Queue) leaseJob(job *storage.Job, now time.Time) {
+	until := now.Add(q.lease)
+	job.Owner = q.owner
+	job.LeaseUntil = &until
+}
+
+// Run claims stored jobs and sends queued jobs until done is closed. Leases of stored jobs are renewed
+// meanwhile and jobs of stopped queues are claimed. An attempt in progress is finished on shutdown,
+// pending jobs stay in the database for the next claim.
+func (q *Queue) Run(done <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q.claim(ctx)
+
+	q.mu.Lock()
+	q.ctx = ctx
+	q.running = true
+
+	for _, w := range q.workers {
+		q.start(w)
+	}
+
+	q.mu.Unlock()
+
+	if q.store != nil {
+		q.wg.Add(1)
+
+		go func() {
+			defer q.wg.Done()
+			q.renew(ctx)
+		}()
+	}
+
+	<-done
+
+	q.mu.Lock()
+	q.running = false
+	q.mu.Unlock()
+
+	cancel()
+	q.wg.Wait()
+}
+
+// renew extends leases of the queue and claims expired leases of others until ctx is done.
+func (q *Queue) renew(ctx context.Context) {
+	const times = 3
+
+	ticker := time.NewTicker(q.lease / times)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := q.store.RenewJobs(ctx, q.owner, time.Now().Add(q.lease)); err != nil {
+			logger.Errorw("failed to renew job leases", "error", err)
+		}
+
+		q.claim(ctx)
+	}
+}
+
+// claim leases unfinished jobs nobody holds and schedules them. A job interrupted while sending
+// may have been sent, it is dead-lettered to be checked and retried manually rather than sent twice.
+func (q *Queue) claim(ctx context.Context) {
+	if q.store == nil {
+		return
+	}
+
+	now := time.Now()
+
+	jobs, err := q.store.ClaimJobs(ctx, q.owner, now, now.Add(q.lease))
+	if err != nil {
+		logger.Errorw("failed to claim queued jobs", "error", err)
+		return
+	}
+
+	if len(jobs) == 0 {
+		return
+	}
+
+	var interrupted []*storage.Job
+
+	q.mu.Lock()
+
+	for i := range jobs {
+		job := &jobs[i]
+		if _, ok := q.jobs[job.ID]; ok {
+			continue
+		}
+
+		if job.Status == storage.JobSending {
+			job.Status = storage.JobDead
+			job.Error = errInterrupted.Error()
+			job.UpdatedAt = now
+			interrupted = append(interrupted, job)
+
+			continue
+		}
+
+		q.jobs[job.ID] = job
+		q.schedule(job)
+	}
+
+	q.mu.Unlock()
+
+	for _, job := range interrupted {
+		if err := q.persist(ctx, job); err != nil {
+			logger.Errorw("failed to update job", "id", job.ID, "error", err)
+			continue
+		}
+
+		logger.Errorw("job is dead", "id", job.ID, "instance", job.IDInstance, "error", job.Error)
+		q.record(ctx, senders[job.Method], job)
+	}
+
+	logger.Infow("...queued jobs claimed", "count", len(jobs))
+}
+
+// schedule adds the job to pending jobs of its instance worker. q.mu must be held.
+func (q *Queue) schedule(job *storage.Job) {
+	w, ok := q.workers[job.IDInstance]
+	if !ok {
+		w = &worker{
+			wake: make(chan struct{}, 1),
+		}
+		q.workers[job.IDInstance] = w
+
+		if q.running {
+			q.start(w)
+		}
+	}
+
+	w.pending = append(w.pending, job)
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// start runs the worker. q.mu must be held.
+func (q *Queue) start(w *worker) {
+	q.wg.Add(1)
+
+	go func() {
+		defer q.wg.Done()
+		q.work(q.ctx, w)
+	}()
+}
+
+func (q *Queue) work(ctx context.Context, w *worker) {
+	for ctx.Err() == nil {
+		job, wait := q.next(w)
+		if job != nil {
+			// a throttled instance sends nothing until the limiter has a token
+			if throttled := q.attempt(ctx, w, job); throttled > 0 && !sleep(ctx, nil, throttled) {
+				return
+			}
+
+			continue
+		}
+
+		if !sleep(ctx, w.wake, wait) {
+			return
+		}
+	}
+}
+
+// sleep waits for wake or for d when it is positive. It returns false once ctx is done.
+func sleep(ctx context.Context, wake <-chan struct{}, d time.Duration) bool {
+	var timer <-chan time.Time
+
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+
+		timer = t.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-wake:
+	case <-timer:
+	}
+
+	return true
+}
+
+// next takes the earliest due job of the worker. Otherwise it returns how long to wait
+// for the earliest one, 0 when there are no pending jobs.
+func (q *Queue) next(w *worker) (*storage.Job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(w.pending) == 0 {
+		return nil, 0
+	}
+
+	earliest := 0
+
+	for i, job := range w.pending {
+		if job.NextAttemptAt.Before(w.pending[earliest].NextAttemptAt) {
+			earliest = i
+		}
+	}
+
+	job := w.pending[earliest]
+
+	wait := time.Until(job.NextAttemptAt)
+	if wait > 0 {
+		return nil, wait
+	}
+
+	w.pending = append(w.pending[:earliest], w.pending[earliest+1:]...)
+
+	return job, 0
+}
+
+// attempt sends the job once and decides whether it is sent, retried or dead. A job throttled
+// by the rate limiter is not sent, it stays pending without losing an attempt and attempt returns
+// how long the worker should wait.
+func (q *Queue) attempt(ctx context.Context, w *worker, job *storage.Job) time.Duration {
+	// an attempt in progress is finished on shutdown so its result is not lost
+	ctx = context.WithoutCancel(ctx)
+	s := senders[job.Method]
+
+	q.mu.Lock()
+	status := job.Status
+	job.Status = storage.JobSending
+	job.Attempts++
+	job.UpdatedAt = time.Now()
+	snapshot := *job
+	q.mu.Unlock()
+
+	err := q.persist(ctx, &snapshot)
+	if errors.Is(err, storage.ErrNotFound) {
+		// the lease expired and another queue claimed the job, it sends the job
+		logger.Errorw("job is claimed by another queue", "id", job.ID)
+
+		q.mu.Lock()
+		delete(q.jobs, job.ID)
+		q.mu.Unlock()
+
+		return 0
+	}
+
+	if err != nil {
+		logger.Errorw("failed to update job", "id", job.ID, "error", err)
+	}
+
+	idMessage, err := q.send(ctx, s, job)
+
+	q.mu.Lock()
+
+	now := time.Now()
+	job.UpdatedAt = now
+
+	var limitErr *httpclient.RateLimitError
+
+	switch {
+	case errors.As(err, &limitErr):
+		job.Status = status
+		job.Attempts--
+		w.pending = append(w.pending, job)
+	case err == nil:
+		job.Status = storage.JobSent
+		job.IDMessage = idMessage
+		job.Error = ""
+	case Retryable(err) && job.Attempts < job.MaxAttempts:
+		job.Status = storage.JobRetrying
+		job.Error = err.Error()
+		job.NextAttemptAt = now.Add(q.policy.Backoff(job.Attempts, q.jitter()))
+		w.pending = append(w.pending, job)
+	default:
+		job.Status = storage.JobDead
+		job.Error = err.Error()
+	}
+
+	snapshot = *job
+	q.mu.Unlock()
+
+	if err := q.persist(ctx, &snapshot); err != nil {
+		logger.Errorw("failed to update job", "id", job.ID, "error", err)
+	}
+
+	if limitErr != nil {
+		return limitErr.RetryAfter
+	}
+
+	if !snapshot.Finished() {
+		logger.Infow("job attempt failed", "id", job.ID, "instance", job.IDInstance,
+			"attempt", snapshot.Attempts, "next", snapshot.NextAttemptAt, "error", snapshot.Error)
+
+		return 0
+	}
+
+	if snapshot.Status == storage.JobDead {
+		logger.Errorw("job is dead", "id", job.ID, "instance", job.IDInstance,
+			"attempts", snapshot.Attempts, "error", snapshot.Error)
+	}
+
+	q.record(ctx, s, &snapshot)
+
+	// the database answers for finished jobs from now on
+	if q.store != nil {
+		q.mu.Lock()
+		delete(q.jobs, job.ID)
+		q.mu.Unlock()
+	}
+
+	return 0
+}
+
+func (q *Queue) send(ctx context.Context, s sender, job *storage.Job) (string, error) {
+	c, err := q.clients.Client(job.IDInstance)
+	if err != nil {
+		return "", err
+	}
+
+	return s.send(ctx, c, job.Payload)
+}
+
+func (q *Queue) persist(ctx context.Context, job *storage.Job) error {
+	if q.store == nil {
+		return nil
+	}
+
+	return q.store.UpdateJob(ctx, job)
+}
+
+// record saves the finished job as an outgoing message, so delivery statuses are tracked.
+func (q *Queue) record(ctx context.Context, s sender, job *storage.Job) {
+	if q.messages == nil {
+		return
+	}
+
+	chatID, body, err := s.parse(job.Payload)
+	if err != nil {
+		chatID = job.ChatID
+	}
+
+	m := &storage.Message{
+		IDInstance: job.IDInstance,
+		Method:     job.Method,
+		ChatID:     chatID,
+		Body:       body,
+		IDMessage:  job.IDMessage,
+		Status:     storage.StatusSent,
+	}
+
+	if job.Status == storage.JobDead {
+		m.Status = storage.StatusFailed
+		m.Error = job.Error
+	}
+
+	if _, err := q.messages.SaveMessage(ctx, m); err != nil {
+		logger.Errorln(err)
+	}
+}
+
+// prune forgets finished jobs older than retention. q.mu must be held.
+func (q *Queue) prune(now time.Time) {
+	for id, job := range q.jobs {
+		if job.Finished() && now.Sub(job.UpdatedAt) > q.retention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// newID returns a random job id.
+func newID() string {
+	const size = 16
+
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,589 @@
+package queue_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/ratelimit"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+const (
+	testID    = "1101000001"
+	testToken = "d75b3a66374942c5b3c019c698abc2067e151558acbd412345"
+	message   = `{"chatId":"79876543210@c.us","message":"hello"}`
+)
+
+var fastPolicy = queue.Policy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    5 * time.Millisecond,
+}
+
+// fakeAPI answers with the next status of statuses, the last one repeats.
+type fakeAPI struct {
+	statuses []int
+	calls    int
+	mu       sync.Mutex
+}
+
+func (a *fakeAPI) setStatuses(statuses ...int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.statuses = statuses
+	a.calls = 0
+}
+
+func (a *fakeAPI) Calls() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.calls
+}
+
+func newPool(t *testing.T, api *fakeAPI) httpclient.Provider {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		api.mu.Lock()
+		status := api.statuses[min(api.calls, len(api.statuses)-1)]
+		api.calls++
+		api.mu.Unlock()
+
+		rw.WriteHeader(status)
+
+		if status == http.StatusOK {
+			_, _ = io.WriteString(rw, `{"idMessage":"3EB0C767D097B7C7C030"}`)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	return httpclient.NewPool(ts.URL, ts.Client(), map[string]string{testID: testToken})
+}
+
+// run starts q until the test ends.
+func run(t *testing.T, q *queue.Queue) {
+	t.Helper()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		q.Run(done)
+	}()
+
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+	})
+}
+
+func waitStatus(t *testing.T, q *queue.Queue, id, status string) *storage.Job {
+	t.Helper()
+
+	var job *storage.Job
+
+	require.Eventually(t, func() bool {
+		var err error
+
+		job, err = q.Get(context.Background(), id)
+		require.NoError(t, err)
+
+		return job.Status == status
+	}, 2*time.Second, time.Millisecond)
+
+	return job
+}
+
+type fakeMessages struct {
+	messages []storage.Message
+	mu       sync.Mutex
+}
+
+func (f *fakeMessages) Ping(context.Context) error { return nil }
+
+func (f *fakeMessages) Close() error { return nil }
+
+func (f *fakeMessages) SaveMessage(_ context.Context, m *storage.Message) (*storage.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages = append(f.messages, *m)
+
+	return m, nil
+}
+
+func (f *fakeMessages) UpdateMessageStatus(context.Context, string, string, string) error { return nil }
+
+func (f *fakeMessages) SaveNotification(_ context.Context, n *storage.Notification) (*storage.Notification, error) {
+	return n, nil
+}
+
+func (f *fakeMessages) Messages() []storage.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]storage.Message(nil), f.messages...)
+}
+
+// fakeJobs is an in-memory JobStorage.
+type fakeJobs struct {
+	jobs map[string]storage.Job
+	mu   sync.Mutex
+}
+
+func newFakeJobs(jobs ...storage.Job) *fakeJobs {
+	f := &fakeJobs{jobs: make(map[string]storage.Job)}
+	for _, j := range jobs {
+		f.jobs[j.ID] = j
+	}
+
+	return f
+}
+
+func (f *fakeJobs) SaveJob(_ context.Context, j *storage.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.jobs[j.ID] = *j
+
+	return nil
+}
+
+func (f *fakeJobs) UpdateJob(_ context.Context, j *storage.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if stored, ok := f.jobs[j.ID]; !ok || stored.Owner != j.Owner {
+		return storage.ErrNotFound
+	}
+
+	j.LeaseUntil = f.jobs[j.ID].LeaseUntil
+	f.jobs[j.ID] = *j
+
+	return nil
+}
+
+func (f *fakeJobs) RetryJob(_ context.Context, j *storage.Job) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if stored, ok := f.jobs[j.ID]; !ok || stored.Status != storage.JobDead {
+		return storage.ErrNotFound
+	}
+
+	f.jobs[j.ID] = *j
+
+	return nil
+}
+
+func (f *fakeJobs) GetJob(_ context.Context, id string) (*storage.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	j, ok := f.jobs[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &j, nil
+}
+
+func (f *fakeJobs) ListJobs(_ context.Context, _, status string, _ int) ([]storage.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	jobs := []storage.Job{}
+
+	for _, j := range f.jobs {
+		if status == "" || j.Status == status {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return jobs, nil
+}
+
+func (f *fakeJobs) ClaimJobs(_ context.Context, owner string, now, until time.Time) ([]storage.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	jobs := []storage.Job{}
+
+	for id, j := range f.jobs {
+		if j.Finished() || (j.LeaseUntil != nil && !j.LeaseUntil.Before(now)) {
+			continue
+		}
+
+		j.Owner = owner
+		j.LeaseUntil = &until
+		f.jobs[id] = j
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
+
+func (f *fakeJobs) RenewJobs(_ context.Context, owner string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id, j := range f.jobs {
+		if j.Owner == owner && !j.Finished() {
+			j.LeaseUntil = &until
+			f.jobs[id] = j
+		}
+	}
+
+	return nil
+}
+
+func TestQueue_RetriesUntilSent(t *testing.T) {
+	api := &fakeAPI{statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK}}
+	messages := &fakeMessages{}
+
+	q := queue.New(newPool(t, api)).SetPolicy(fastPolicy).SetStorage(messages)
+	run(t, q)
+
+	job, err := q.Enqueue(context.Background(), testID, httpclient.MethodSendMessage, []byte(message))
+	require.NoError(t, err)
+
+	assert.Equal(t, storage.JobQueued, job.Status)
+	assert.Equal(t, "79876543210@c.us", job.ChatID)
+	assert.Len(t, job.ID, 32)
+
+	job = waitStatus(t, q, job.ID, storage.JobSent)
+
+	assert.Equal(t, 3, job.Attempts)
+	assert.Equal(t, "3EB0C767D097B7C7C030", job.IDMessage)
+	assert.Empty(t, job.Error)
+	assert.Equal(t, 3, api.Calls())
+
+	require.Eventually(t, func() bool { return len(messages.Messages()) == 1 }, time.Second, time.Millisecond)
+
+	m := messages.Messages()[0]
+	assert.Equal(t, storage.StatusSent, m.Status)
+	assert.Equal(t, "hello", m.Body)
+	assert.Equal(t, "3EB0C767D097B7C7C030", m.IDMessage)
+}
+
+func TestQueue_DeadLetter(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int
+	}{
+		{name: "out of attempts", status: http.StatusBadGateway, attempts: 3},
+		{name: "client error", status: http.StatusForbidden, attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeAPI{statuses: []int{tt.status}}
+			messages := &fakeMessages{}
+
+			q := queue.New(newPool(t, api)).SetPolicy(fastPolicy).SetStorage(messages)
+			run(t, q)
+
+			job, err := q.Enqueue(context.Background(), testID, httpclient.MethodSendMessage, []byte(message))
+			require.NoError(t, err)
+
+			job = waitStatus(t, q, job.ID, storage.JobDead)
+			assert.Equal(t, tt.attempts, job.Attempts)
+			assert.Contains(t, job.Error, "unexpected status")
+
+			dead, err := q.List(context.Background(), testID, storage.JobDead, 0)
+			require.NoError(t, err)
+			require.Len(t, dead, 1)
+			assert.Equal(t, job.ID, dead[0].ID)
+
+			require.Eventually(t, func() bool { return len(messages.Messages()) == 1 }, time.Second, time.Millisecond)
+			assert.Equal(t, storage.StatusFailed, messages.Messages()[0].Status)
+
+			api.setStatuses(http.StatusOK)
+
+			retried, err := q.Retry(context.Background(), job.ID)
+			require.NoError(t, err)
+			assert.Equal(t, 0, retried.Attempts)
+
+			job = waitStatus(t, q, job.ID, storage.JobSent)
+			assert.Equal(t, 1, job.Attempts)
+
+			_, err = q.Retry(context.Background(), job.ID)
+			require.ErrorIs(t, err, queue.ErrNotDead)
+		})
+	}
+}
+
+func TestQueue_Enqueue_Errors(t *testing.T) {
+	api := &fakeAPI{statuses: []int{http.StatusOK}}
+	q := queue.New(newPool(t, api))
+
+	tests := []struct {
+		want       error
+		name       string
+		idInstance string
+		method     string
+		payload    string
+	}{
+		{
+			name:       "unknown method",
+			idInstance: testID,
+			method:     httpclient.MethodGetSettings,
+			payload:    `{}`,
+			want:       queue.ErrUnknownMethod,
+		},
+		{
+			name:       "unknown instance",
+			idInstance: "1101000002",
+			method:     httpclient.MethodSendMessage,
+			payload:    message,
+			want:       httpclient.ErrUnknownInstance,
+		},
+		{
+			name:       "invalid json",
+			idInstance: testID,
+			method:     httpclient.MethodSendMessage,
+			payload:    `{"chatId":`,
+			want:       httpclient.ErrInvalidRequest,
+		},
+		{
+			name:       "invalid request",
+			idInstance: testID,
+			method:     httpclient.MethodSendMessage,
+			payload:    `{"message":"hello"}`,
+			want:       httpclient.ErrInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := q.Enqueue(context.Background(), tt.idInstance, tt.method, []byte(tt.payload))
+			require.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	_, err := q.Get(context.Background(), "unknown")
+	require.ErrorIs(t, err, queue.ErrNotFound)
+	assert.Equal(t, 0, api.Calls())
+}
+
+// namedProvider resolves names of instances as the registry does.
+type namedProvider struct {
+	httpclient.Provider
+	names map[string]string
+}
+
+func (p *namedProvider) Client(idInstance string) (*httpclient.Client, error) {
+	if id, ok := p.names[idInstance]; ok {
+		idInstance = id
+	}
+
+	return p.Provider.Client(idInstance)
+}
+
+func TestQueue_Enqueue_Name(t *testing.T) {
+	api := &fakeAPI{statuses: []int{http.StatusOK}}
+	q := queue.New(&namedProvider{Provider: newPool(t, api), names: map[string]string{"sales": testID}})
+
+	job, err := q.Enqueue(context.Background(), "sales", httpclient.MethodSendMessage, []byte(message))
+	require.NoError(t, err)
+	assert.Equal(t, testID, job.IDInstance, "jobs keep idInstance of the name")
+
+	jobs, err := q.List(context.Background(), testID, "", 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, job.ID, jobs[0].ID)
+}
+
+func TestQueue_Persistence(t *testing.T) {
+	interrupted := storage.Job{
+		ID:          "a1",
+		IDInstance:  testID,
+		Method:      httpclient.MethodSendMessage,
+		ChatID:      "79876543210@c.us",
+		Payload:     []byte(message),
+		Status:      storage.JobSending,
+		Attempts:    1,
+		MaxAttempts: 3,
+		CreatedAt:   time.Now(),
+	}
+	jobs := newFakeJobs(interrupted)
+	api := &fakeAPI{statuses: []int{http.StatusOK}}
+
+	q := queue.New(newPool(t, api)).SetPolicy(fastPolicy).SetJobStorage(jobs)
+
+	queued, err := q.Enqueue(context.Background(), testID, httpclient.MethodSendMessage, []byte(message))
+	require.NoError(t, err)
+
+	stored, err := jobs.GetJob(context.Background(), queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.JobQueued, stored.Status)
+
+	run(t, q)
+
+	sent := waitStatus(t, q, queued.ID, storage.JobSent)
+	assert.Equal(t, 1, sent.Attempts)
+
+	dead, err := q.Get(context.Background(), "a1")
+	require.NoError(t, err)
+	assert.Equal(t, storage.JobDead, dead.Status, "the interrupted job may have been sent")
+	assert.Equal(t, 1, api.Calls())
+
+	stored, err = jobs.GetJob(context.Background(), queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.JobSent, stored.Status)
+	assert.Equal(t, "3EB0C767D097B7C7C030", stored.IDMessage)
+}
+
+func TestQueue_RetryConcurrently(t *testing.T) {
+	dead := storage.Job{
+		ID:          "d1",
+		IDInstance:  testID,
+		Method:      httpclient.MethodSendMessage,
+		ChatID:      "79876543210@c.us",
+		Payload:     []byte(message),
+		Status:      storage.JobDead,
+		Attempts:    3,
+		MaxAttempts: 3,
+		CreatedAt:   time.Now(),
+	}
+	jobs := newFakeJobs(dead)
+	api := &fakeAPI{statuses: []int{http.StatusOK}}
+
+	q := queue.New(newPool(t, api)).SetPolicy(fastPolicy).SetJobStorage(jobs)
+	run(t, q)
+
+	const retries = 8
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		retried int
+	)
+
+	for range retries {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := q.Retry(context.Background(), dead.ID)
+			if err == nil {
+				mu.Lock()
+				retried++
+				mu.Unlock()
+
+				return
+			}
+
+			assert.ErrorIs(t, err, queue.ErrNotDead)
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, 1, retried)
+
+	sent := waitStatus(t, q, dead.ID, storage.JobSent)
+	assert.Equal(t, 1, sent.Attempts)
+	assert.Equal(t, 1, api.Calls(), "the job is sent once")
+}
+
+func TestQueue_SharedStorage(t *testing.T) {
+	jobs := newFakeJobs()
+	api := &fakeAPI{statuses: []int{http.StatusOK}}
+	ctx := context.Background()
+
+	first := queue.New(newPool(t, api)).SetPolicy(fastPolicy).SetJobStorage(jobs).SetLease(time.Hour)
+
+	var ids []string
+
+	for range 5 {
+		job, err := first.Enqueue(ctx, testID, httpclient.MethodSendMessage, []byte(message))
+		require.NoError(t, err)
+
+		ids = append(ids, job.ID)
+	}
+
+	// the second replica starts while the jobs are leased to the first one
+	second := queue.New(newPool(t, api)).SetPolicy(fastPolicy).SetJobStorage(jobs).SetLease(time.Hour)
+	run(t, second)
+	run(t, first)
+
+	for _, id := range ids {
+		waitStatus(t, first, id, storage.JobSent)
+	}
+
+	assert.Equal(t, len(ids), api.Calls(), "every job is sent once")
+}
+
+func TestQueue_ListWithoutStorage(t *testing.T) {
+	q := queue.New(newPool(t, &fakeAPI{statuses: []int{http.StatusOK}}))
+
+	for range 3 {
+		_, err := q.Enqueue(context.Background(), testID, httpclient.MethodSendMessage, []byte(message))
+		require.NoError(t, err)
+	}
+
+	jobs, err := q.List(context.Background(), testID, storage.JobQueued, 2)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.False(t, jobs[0].CreatedAt.Before(jobs[1].CreatedAt))
+
+	jobs, err = q.List(context.Background(), "1101000002", "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestMethods(t *testing.T) {
+	assert.Equal(t, []string{
+		httpclient.MethodSendContact,
+		httpclient.MethodSendFileByURL,
+		httpclient.MethodSendInteractiveButtons,
+		httpclient.MethodSendLocation,
+		httpclient.MethodSendMessage,
+		httpclient.MethodSendPoll,
+	}, queue.Methods())
+}
+
+func TestQueue_RateLimited(t *testing.T) {
+	api := &fakeAPI{statuses: []int{http.StatusOK}}
+	limiter := ratelimit.New(ratelimit.Limit{Rate: 20, Burst: 1})
+
+	pool := newPool(t, api).(*httpclient.Pool).SetLimiter(limiter)
+	q := queue.New(pool).SetPolicy(queue.Policy{MaxAttempts: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	run(t, q)
+
+	ids := make([]string, 0, 3)
+
+	for range 3 {
+		job, err := q.Enqueue(context.Background(), testID, httpclient.MethodSendMessage, []byte(message))
+		require.NoError(t, err)
+
+		ids = append(ids, job.ID)
+	}
+
+	// throttled sends wait for a token, they do not spend attempts
+	for _, id := range ids {
+		job := waitStatus(t, q, id, storage.JobSent)
+		assert.Equal(t, 1, job.Attempts)
+	}
+
+	assert.Equal(t, 3, api.Calls())
+
+	status := limiter.Status([]string{testID})[0]
+	assert.Equal(t, int64(3), status.Allowed)
+	assert.Positive(t, status.Throttled)
+}
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+)
+
+// sender sends queued payloads of a GREEN-API method.
+type sender struct {
+	// parse decodes and validates payload, it returns chat id and a short body of the stored message.
+	parse func(payload []byte) (chatID, body string, err error)
+	send  func(ctx context.Context, c *httpclient.Client, payload []byte) (idMessage string, err error)
+}
+
+type request interface {
+	Validate() error
+}
+
+func newSender[T any, PT interface {
+	*T
+	request
+}](
+	describe func(in PT) (chatID, body string),
+	send func(c *httpclient.Client, ctx context.Context, in PT) (*httpclient.SendMessageResponse, error),
+) sender {
+	decode := func(payload []byte) (PT, error) {
+		in := PT(new(T))
+		if err := json.Unmarshal(payload, in); err != nil {
+			return nil, httpclient.NewError(fmt.Errorf("%w: %w", httpclient.ErrInvalidRequest, err))
+		}
+
+		return in, in.Validate()
+	}
+
+	return sender{
+		parse: func(payload []byte) (string, string, error) {
+			in, err := decode(payload)
+			if err != nil {
+				return "", "", err
+			}
+
+			chatID, body := describe(in)
+
+			return chatID, body, nil
+		},
+		send: func(ctx context.Context, c *httpclient.Client, payload []byte) (string, error) {
+			in, err := decode(payload)
+			if err != nil {
+				return "", err
+			}
+
+			out, err := send(c, ctx, in)
+			if err != nil {
+				return "", err
+			}
+
+			return out.IDMessage, nil
+		},
+	}
+}
+
+// senders are methods which can be queued, they answer with a single idMessage.
+var senders = map[string]sender{
+	httpclient.MethodSendMessage: newSender(
+		func(in *httpclient.SendMessageRequest) (string, string) { return in.ChatID, in.Message },
+		(*httpclient.Client).SendMessage),
+	httpclient.MethodSendFileByURL: newSender(
+		func(in *httpclient.SendFileByURLRequest) (string, string) { return in.ChatID, in.URLFile },
+		(*httpclient.Client).SendFileByURL),
+	httpclient.MethodSendPoll: newSender(
+		func(in *httpclient.SendPollRequest) (string, string) { return in.ChatID, in.Message },
+		(*httpclient.Client).SendPoll),
+	httpclient.MethodSendLocation: newSender(
+		func(in *httpclient.SendLocationRequest) (string, string) {
+			return in.ChatID, strings.TrimSpace(fmt.Sprintf("%g,%g %s", in.Latitude, in.Longitude, in.NameLocation))
+		},
+		(*httpclient.Client).SendLocation),
+	httpclient.MethodSendContact: newSender(
+		func(in *httpclient.SendContactRequest) (string, string) {
+			return in.ChatID, strconv.FormatInt(in.Contact.PhoneContact, 10)
+		},
+		(*httpclient.Client).SendContact),
+	httpclient.MethodSendInteractiveButtons: newSender(
+		func(in *httpclient.SendInteractiveButtonsRequest) (string, string) { return in.ChatID, in.Body },
+		(*httpclient.Client).SendInteractiveButtons),
+}
+
+// Methods returns sorted GREEN-API methods which can be queued.
+func Methods() []string {
+	methods := make([]string, 0, len(senders))
+	for m := range senders {
+		methods = append(methods, m)
+	}
+
+	sort.Strings(methods)
+
+	return methods
+}
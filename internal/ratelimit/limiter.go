@@ -0,0 +1,210 @@
+// Package ratelimit throttles sending of GREEN-API instances with a token bucket per instance.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLimit allows a message per second with bursts of 5 messages.
+var DefaultLimit = Limit{Rate: 1, Burst: 5}
+
+var ErrWrongLimit = errors.New("limit must be rate:burst")
+
+// Limit of a token bucket: Rate tokens are added per second up to Burst. Zero Rate disables the limit.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Unlimited reports whether the limit does not throttle.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+func (l Limit) String() string {
+	return strconv.FormatFloat(l.Rate, 'f', -1, 64) + ":" + strconv.Itoa(l.Burst)
+}
+
+// ParseLimit parses "rate:burst", e.g. "0.5:3" is a message per 2 seconds with bursts of 3.
+func ParseLimit(s string) (Limit, error) {
+	rate, burst, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return Limit{}, fmt.Errorf("%w: %q", ErrWrongLimit, s)
+	}
+
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r < 0 || math.IsInf(r, 0) || math.IsNaN(r) {
+		return Limit{}, fmt.Errorf("%w: %q", ErrWrongLimit, s)
+	}
+
+	b, err := strconv.Atoi(burst)
+	if err != nil || b < 1 {
+		return Limit{}, fmt.Errorf("%w: %q", ErrWrongLimit, s)
+	}
+
+	return Limit{Rate: r, Burst: b}, nil
+}
+
+// Status is the state of the instance bucket.
+type Status struct {
+	IDInstance string  `json:"id_instance"`
+	Limit      Limit   `json:"limit"`
+	Tokens     float64 `json:"tokens"`
+	// RetryAfter is how long to wait for the next token, seconds.
+	RetryAfter float64 `json:"retry_after"`
+	Allowed    int64   `json:"allowed"`
+	Throttled  int64   `json:"throttled"`
+}
+
+type bucket struct {
+	updated   time.Time
+	tokens    float64
+	allowed   int64
+	throttled int64
+}
+
+// Limiter keeps a token bucket per instance. Instances without own limit share the default one
+// by value, each of them has its own bucket.
+type Limiter struct {
+	now     func() time.Time
+	limits  map[string]Limit
+	buckets map[string]*bucket
+	def     Limit
+	mu      sync.Mutex
+}
+
+// New creates Limiter with the default limit of instances.
+func New(def Limit) *Limiter {
+	return &Limiter{
+		now:     time.Now,
+		limits:  make(map[string]Limit),
+		buckets: make(map[string]*bucket),
+		def:     def,
+	}
+}
+
+// SetLimit sets own limit of the instance. The bucket starts full.
+func (l *Limiter) SetLimit(idInstance string, limit Limit) *Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits[idInstance] = limit
+	delete(l.buckets, idInstance)
+
+	return l
+}
+
+// SetClock replaces time source, for tests.
+func (l *Limiter) SetClock(now func() time.Time) *Limiter {
+	l.now = now
+	return l
+}
+
+// Limit returns the limit of the instance.
+func (l *Limiter) Limit(idInstance string) Limit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit(idInstance)
+}
+
+// Allow takes a token of the instance. Otherwise it returns how long to wait for one.
+func (l *Limiter) Allow(idInstance string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limit(idInstance)
+	b := l.bucket(idInstance, limit)
+
+	if limit.Unlimited() {
+		b.allowed++
+		return true, 0
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.allowed++
+
+		return true, 0
+	}
+
+	b.throttled++
+
+	return false, wait(b.tokens, limit)
+}
+
+// Status returns state of the instances sorted by id.
+func (l *Limiter) Status(instances []string) []Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ids := append([]string(nil), instances...)
+	sort.Strings(ids)
+
+	statuses := make([]Status, 0, len(ids))
+
+	for _, id := range ids {
+		limit := l.limit(id)
+		b := l.bucket(id, limit)
+
+		s := Status{
+			IDInstance: id,
+			Limit:      limit,
+			Tokens:     math.Floor(b.tokens*100) / 100,
+			Allowed:    b.allowed,
+			Throttled:  b.throttled,
+		}
+
+		if !limit.Unlimited() && b.tokens < 1 {
+			s.RetryAfter = wait(b.tokens, limit).Seconds()
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	return statuses
+}
+
+func (l *Limiter) limit(idInstance string) Limit {
+	if limit, ok := l.limits[idInstance]; ok {
+		return limit
+	}
+
+	return l.def
+}
+
+// bucket returns the instance bucket refilled by now. l.mu must be held.
+func (l *Limiter) bucket(idInstance string, limit Limit) *bucket {
+	now := l.now()
+
+	b, ok := l.buckets[idInstance]
+	if !ok {
+		b = &bucket{
+			updated: now,
+			tokens:  float64(limit.Burst),
+		}
+		l.buckets[idInstance] = b
+
+		return b
+	}
+
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 && !limit.Unlimited() {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	}
+
+	b.updated = now
+
+	return b
+}
+
+// wait is how long the bucket with tokens takes to get a whole token.
+func wait(tokens float64, limit Limit) time.Duration {
+	return time.Duration(math.Ceil((1 - tokens) / limit.Rate * float64(time.Second)))
+}
@@ -0,0 +1,145 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/ratelimit"
+)
+
+const testID = "1101000001"
+
+// clock is a manual time source.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func (c *clock) Add(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ratelimit.Limit
+		wantErr bool
+	}{
+		{in: "1:5", want: ratelimit.Limit{Rate: 1, Burst: 5}},
+		{in: " 0.5:3 ", want: ratelimit.Limit{Rate: 0.5, Burst: 3}},
+		{in: "0:1", want: ratelimit.Limit{Rate: 0, Burst: 1}},
+		{in: "1", wantErr: true},
+		{in: "a:5", wantErr: true},
+		{in: "1:b", wantErr: true},
+		{in: "-1:5", wantErr: true},
+		{in: "1:0", wantErr: true},
+		{in: "Inf:5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ratelimit.ParseLimit(tt.in)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ratelimit.ErrWrongLimit)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	assert.Equal(t, "0.5:3", ratelimit.Limit{Rate: 0.5, Burst: 3}.String())
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	l := ratelimit.New(ratelimit.Limit{Rate: 2, Burst: 3}).SetClock(c.Now)
+
+	for range 3 {
+		ok, wait := l.Allow(testID)
+		assert.True(t, ok)
+		assert.Zero(t, wait)
+	}
+
+	ok, wait := l.Allow(testID)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	c.Add(200 * time.Millisecond)
+
+	ok, wait = l.Allow(testID)
+	assert.False(t, ok)
+	assert.Equal(t, 300*time.Millisecond, wait)
+
+	c.Add(300 * time.Millisecond)
+
+	ok, _ = l.Allow(testID)
+	assert.True(t, ok)
+
+	// the bucket does not grow over burst
+	c.Add(time.Hour)
+
+	for range 3 {
+		ok, _ = l.Allow(testID)
+		assert.True(t, ok)
+	}
+
+	ok, _ = l.Allow(testID)
+	assert.False(t, ok)
+
+	// other instances have own buckets
+	ok, _ = l.Allow("1101000002")
+	assert.True(t, ok)
+}
+
+func TestLimiter_SetLimit(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	l := ratelimit.New(ratelimit.Limit{Rate: 1, Burst: 1}).SetClock(c.Now)
+
+	ok, _ := l.Allow(testID)
+	assert.True(t, ok)
+
+	ok, _ = l.Allow(testID)
+	assert.False(t, ok)
+
+	l.SetLimit(testID, ratelimit.Limit{Rate: 0, Burst: 1})
+	assert.True(t, l.Limit(testID).Unlimited())
+
+	for range 10 {
+		ok, wait := l.Allow(testID)
+		assert.True(t, ok)
+		assert.Zero(t, wait)
+	}
+
+	assert.Equal(t, ratelimit.Limit{Rate: 1, Burst: 1}, l.Limit("1101000002"))
+}
+
+func TestLimiter_Status(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	l := ratelimit.New(ratelimit.Limit{Rate: 0.5, Burst: 2}).SetClock(c.Now)
+	l.SetLimit("1101000002", ratelimit.Limit{Rate: 10, Burst: 20})
+
+	l.Allow(testID)
+	l.Allow(testID)
+	l.Allow(testID)
+	c.Add(time.Second)
+
+	assert.Equal(t, []ratelimit.Status{
+		{
+			IDInstance: testID,
+			Limit:      ratelimit.Limit{Rate: 0.5, Burst: 2},
+			Tokens:     0.5,
+			RetryAfter: 1,
+			Allowed:    2,
+			Throttled:  1,
+		},
+		{
+			IDInstance: "1101000002",
+			Limit:      ratelimit.Limit{Rate: 10, Burst: 20},
+			Tokens:     20,
+		},
+	}, l.Status([]string{"1101000002", testID}))
+}
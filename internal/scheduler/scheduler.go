@@ -0,0 +1,398 @@
+// Package scheduler keeps messages to be sent later and hands them to the outbound queue
+// once they are due. Messages are stored in the database, so they survive restarts.
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	// zones are embedded, the server does not depend on tzdata of the host
+	_ "time/tzdata"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/log"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var logger = log.NewLogger("info", log.DefaultBuildLogger)
+
+var (
+	ErrNotFound   = errors.New("scheduled message not found")
+	ErrNotPending = errors.New("only scheduled messages can be changed")
+	ErrInvalid    = errors.New("invalid schedule")
+)
+
+const (
+	// DefaultInterval is how often due messages are looked up.
+	DefaultInterval = 5 * time.Second
+	// DefaultListLimit is how many messages List returns when limit is not set.
+	DefaultListLimit = 100
+	// dispatchBatch is how many due messages are read at once.
+	dispatchBatch = 100
+	// dispatchTimeout is how long a message may stay dispatched without a job. Older ones were left by
+	// a dispatcher that stopped before it enqueued them and are returned to pending.
+	dispatchTimeout = time.Minute
+)
+
+// localLayouts are wall clock times of the message timezone, the first one is used to show them.
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// Request schedules a message. SendAt is RFC 3339 time or wall clock time "2006-01-02T15:04" of Timezone,
+// UTC when Timezone is empty. Payload is the json request of Method, sendMessage by default.
+// Empty fields keep their values on Update, IDInstance and Method can not be changed.
+type Request struct {
+	IDInstance string          `json:"id_instance"`
+	Method     string          `json:"method,omitempty"`
+	SendAt     string          `json:"send_at"`
+	Timezone   string          `json:"timezone,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// Scheduler stores scheduled messages and enqueues due ones.
+type Scheduler struct {
+	store    storage.ScheduledStorage
+	queue    *queue.Queue
+	now      func() time.Time
+	interval time.Duration
+}
+
+func New(store storage.ScheduledStorage, q *queue.Queue) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		queue:    q,
+		now:      time.Now,
+		interval: DefaultInterval,
+	}
+}
+
+// SetInterval sets how often due messages are looked up.
+func (s *Scheduler) SetInterval(d time.Duration) *Scheduler {
+	s.interval = d
+	return s
+}
+
+// SetClock replaces time source, for tests.
+func (s *Scheduler) SetClock(now func() time.Time) *Scheduler {
+	s.now = now
+	return s
+}
+
+// Schedule validates the message and stores it to be sent at r.SendAt.
+func (s *Scheduler) Schedule(ctx context.Context, r *Request) (*storage.ScheduledMessage, error) {
+	method := r.Method
+	if method == "" {
+		method = httpclient.MethodSendMessage
+	}
+
+	chatID, payload, err := s.queue.Validate(r.IDInstance, method, r.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+
+	sendAt, timezone, err := parseSendAt(r.SendAt, r.Timezone, now)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &storage.ScheduledMessage{
+		ID:         newID(),
+		IDInstance: r.IDInstance,
+		Method:     method,
+		ChatID:     chatID,
+		Payload:    payload,
+		SendAt:     sendAt,
+		Timezone:   timezone,
+		Status:     storage.ScheduledPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	if err := s.store.SaveScheduled(ctx, m); err != nil {
+		return nil, err
+	}
+
+	return local(m), nil
+}
+
+// Get returns the scheduled message by id.
+func (s *Scheduler) Get(ctx context.Context, id string) (*storage.ScheduledMessage, error) {
+	m, err := s.store.GetScheduled(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return local(m), nil
+}
+
+// List returns scheduled messages, the latest send time first. Empty idInstance and status match any.
+func (s *Scheduler) List(ctx context.Context, idInstance, status string, limit int) ([]storage.ScheduledMessage, error) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+
+	messages, err := s.store.ListScheduled(ctx, idInstance, status, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range messages {
+		messages[i] = *local(&messages[i])
+	}
+
+	return messages, nil
+}
+
+// Update changes payload, send time or timezone of a message which is not sent yet. A new timezone
+// without SendAt keeps the wall clock time, 09:00 stays 09:00 of the new zone.
+func (s *Scheduler) Update(ctx context.Context, id string, r *Request) (*storage.ScheduledMessage, error) {
+	m, err := s.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.Payload) > 0 {
+		chatID, payload, err := s.queue.Validate(m.IDInstance, m.Method, r.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		m.ChatID = chatID
+		m.Payload = payload
+	}
+
+	if r.SendAt != "" || r.Timezone != "" {
+		sendAt, timezone := r.SendAt, r.Timezone
+		if timezone == "" {
+			timezone = m.Timezone
+		}
+
+		if sendAt == "" {
+			sendAt = local(m).SendAt.Format(localLayouts[0])
+		}
+
+		if m.SendAt, m.Timezone, err = parseSendAt(sendAt, timezone, s.now()); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.save(ctx, m)
+}
+
+// Cancel cancels a message which is not sent yet.
+func (s *Scheduler) Cancel(ctx context.Context, id string) (*storage.ScheduledMessage, error) {
+	m, err := s.pending(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Status = storage.ScheduledCancelled
+
+	return s.save(ctx, m)
+}
+
+// Run enqueues due messages every interval until done is closed.
+func (s *Scheduler) Run(done <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.dispatch(ctx)
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch hands due messages to the queue. A message is marked dispatched before it is enqueued,
+// so it is not cancelled or changed meanwhile, those left without a job for dispatchTimeout are
+// dispatched again.
+func (s *Scheduler) dispatch(ctx context.Context) {
+	now := s.now()
+
+	if n, err := s.store.RestoreScheduled(ctx, now.Add(-dispatchTimeout), now); err != nil {
+		logger.Errorw("failed to restore dispatched scheduled messages", "error", err)
+	} else if n > 0 {
+		logger.Infow("interrupted scheduled messages returned to pending", "count", n)
+	}
+
+	for {
+		due, err := s.store.DueScheduled(ctx, s.now(), dispatchBatch)
+		if err != nil {
+			logger.Errorw("failed to read due scheduled messages", "error", err)
+			return
+		}
+
+		for i := range due {
+			// messages returned to pending would be read again, they wait for the next tick
+			if !s.enqueue(ctx, &due[i]) {
+				return
+			}
+		}
+
+		if len(due) < dispatchBatch {
+			return
+		}
+	}
+}
+
+// enqueue hands the message to the queue. It returns false when the queue or the database failed
+// and the message stays pending.
+func (s *Scheduler) enqueue(ctx context.Context, m *storage.ScheduledMessage) bool {
+	m.Status = storage.ScheduledDispatched
+	m.UpdatedAt = s.now()
+
+	if err := s.store.UpdateScheduled(ctx, m, storage.ScheduledPending); err != nil {
+		// cancelled or changed meanwhile
+		if errors.Is(err, storage.ErrNotFound) {
+			return true
+		}
+
+		logger.Errorw("failed to dispatch scheduled message", "id", m.ID, "error", err)
+
+		return false
+	}
+
+	job, err := s.queue.Enqueue(ctx, m.IDInstance, m.Method, m.Payload)
+
+	switch {
+	case err == nil:
+		m.IDJob = job.ID
+	case queue.Rejected(err):
+		m.Status = storage.ScheduledFailed
+		m.Error = err.Error()
+	default:
+		// the queue is not available, the message is dispatched on the next tick
+		logger.Errorw("failed to enqueue scheduled message", "id", m.ID, "error", err)
+
+		m.Status = storage.ScheduledPending
+	}
+
+	m.UpdatedAt = s.now()
+
+	if err := s.store.UpdateScheduled(ctx, m, storage.ScheduledDispatched); err != nil {
+		logger.Errorw("failed to update scheduled message", "id", m.ID, "error", err)
+		return false
+	}
+
+	logger.Infow("scheduled message dispatched", "id", m.ID, "instance", m.IDInstance,
+		"status", m.Status, "job", m.IDJob)
+
+	return m.Status != storage.ScheduledPending
+}
+
+// pending returns the message when it is not sent yet.
+func (s *Scheduler) pending(ctx context.Context, id string) (*storage.ScheduledMessage, error) {
+	m, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Status != storage.ScheduledPending {
+		return nil, ErrNotPending
+	}
+
+	return m, nil
+}
+
+// save stores changes of a pending message. It fails when the message was dispatched meanwhile.
+func (s *Scheduler) save(ctx context.Context, m *storage.ScheduledMessage) (*storage.ScheduledMessage, error) {
+	m.UpdatedAt = s.now()
+
+	err := s.store.UpdateScheduled(ctx, m, storage.ScheduledPending)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotPending
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return local(m), nil
+}
+
+// parseSendAt parses the send time in the timezone, it must be after now.
+func parseSendAt(value, timezone string, now time.Time) (time.Time, string, error) {
+	if timezone == "" {
+		timezone = time.UTC.String()
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "Local" {
+		return time.Time{}, "", fmt.Errorf("%w: unknown timezone %q", ErrInvalid, timezone)
+	}
+
+	sendAt, err := parseTime(strings.TrimSpace(value), loc)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	if !sendAt.After(now) {
+		return time.Time{}, "", fmt.Errorf("%w: send_at %s is in the past", ErrInvalid, sendAt.Format(time.RFC3339))
+	}
+
+	return sendAt.UTC(), timezone, nil
+}
+
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%w: send_at is required", ErrInvalid)
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: send_at %q must be RFC 3339 or 2006-01-02T15:04", ErrInvalid, value)
+}
+
+// local returns a copy of the message with SendAt in its timezone.
+func local(m *storage.ScheduledMessage) *storage.ScheduledMessage {
+	c := *m
+
+	if loc, err := time.LoadLocation(m.Timezone); err == nil {
+		c.SendAt = c.SendAt.In(loc)
+	}
+
+	return &c
+}
+
+// newID returns a random message id.
+func newID() string {
+	const size = 16
+
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
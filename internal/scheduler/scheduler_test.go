@@ -0,0 +1,448 @@
+package scheduler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/scheduler"
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+const (
+	testID    = "1101000001"
+	testToken = "d75b3a66374942c5b3c019c698abc2067e151558acbd412345"
+	message   = `{"chatId":"79876543210@c.us","message":"hello"}`
+)
+
+// 2026-10-16 12:00 UTC, 15:00 in Moscow
+var testNow = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+// fakeScheduled is an in-memory ScheduledStorage.
+type fakeScheduled struct {
+	messages map[string]storage.ScheduledMessage
+	mu       sync.Mutex
+}
+
+func newFakeScheduled() *fakeScheduled {
+	return &fakeScheduled{messages: make(map[string]storage.ScheduledMessage)}
+}
+
+func (f *fakeScheduled) SaveScheduled(_ context.Context, m *storage.ScheduledMessage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.messages[m.ID] = *m
+
+	return nil
+}
+
+func (f *fakeScheduled) UpdateScheduled(_ context.Context, m *storage.ScheduledMessage, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if stored, ok := f.messages[m.ID]; !ok || stored.Status != status {
+		return storage.ErrNotFound
+	}
+
+	f.messages[m.ID] = *m
+
+	return nil
+}
+
+func (f *fakeScheduled) GetScheduled(_ context.Context, id string) (*storage.ScheduledMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m, ok := f.messages[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &m, nil
+}
+
+func (f *fakeScheduled) ListScheduled(_ context.Context, _, status string, _ int) ([]storage.ScheduledMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	messages := []storage.ScheduledMessage{}
+
+	for _, m := range f.messages {
+		if status == "" || m.Status == status {
+			messages = append(messages, m)
+		}
+	}
+
+	return messages, nil
+}
+
+func (f *fakeScheduled) DueScheduled(_ context.Context, now time.Time, _ int) ([]storage.ScheduledMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	messages := []storage.ScheduledMessage{}
+
+	for _, m := range f.messages {
+		if m.Status == storage.ScheduledPending && !m.SendAt.After(now) {
+			messages = append(messages, m)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].SendAt.Before(messages[j].SendAt)
+	})
+
+	return messages, nil
+}
+
+func (f *fakeScheduled) RestoreScheduled(_ context.Context, before, now time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int64
+
+	for id, m := range f.messages {
+		if m.Status == storage.ScheduledDispatched && m.IDJob == "" && m.UpdatedAt.Before(before) {
+			m.Status, m.UpdatedAt = storage.ScheduledPending, now
+			f.messages[id] = m
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func newQueue(t *testing.T) *queue.Queue {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(rw, `{"idMessage":"3EB0C767D097B7C7C030"}`)
+	}))
+	t.Cleanup(ts.Close)
+
+	return queue.New(httpclient.NewPool(ts.URL, ts.Client(), map[string]string{testID: testToken}))
+}
+
+func newScheduler(t *testing.T, store storage.ScheduledStorage) *scheduler.Scheduler {
+	t.Helper()
+
+	return scheduler.New(store, newQueue(t)).SetClock(func() time.Time { return testNow })
+}
+
+func TestScheduler_Schedule(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	tests := []struct {
+		want     time.Time
+		name     string
+		sendAt   string
+		timezone string
+		wantZone string
+	}{
+		{
+			name:     "wall clock of timezone",
+			sendAt:   "2026-10-17T09:00",
+			timezone: "Europe/Moscow",
+			want:     time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC),
+			wantZone: "Europe/Moscow",
+		},
+		{
+			name:     "utc by default",
+			sendAt:   "2026-10-17 09:00:30",
+			want:     time.Date(2026, 10, 17, 9, 0, 30, 0, time.UTC),
+			wantZone: "UTC",
+		},
+		{
+			name:     "rfc 3339 keeps its offset",
+			sendAt:   "2026-10-16T16:00:00+03:00",
+			timezone: "Europe/Moscow",
+			want:     time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC),
+			wantZone: "Europe/Moscow",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeScheduled()
+
+			m, err := newScheduler(t, store).Schedule(context.Background(), &scheduler.Request{
+				IDInstance: testID,
+				SendAt:     tt.sendAt,
+				Timezone:   tt.timezone,
+				Payload:    json.RawMessage(message),
+			})
+			require.NoError(t, err)
+
+			assert.True(t, tt.want.Equal(m.SendAt), "send at %s", m.SendAt)
+			assert.Equal(t, tt.wantZone, m.Timezone)
+			assert.Equal(t, httpclient.MethodSendMessage, m.Method)
+			assert.Equal(t, "79876543210@c.us", m.ChatID)
+			assert.Equal(t, storage.ScheduledPending, m.Status)
+			assert.Len(t, m.ID, 32)
+
+			stored, err := store.GetScheduled(context.Background(), m.ID)
+			require.NoError(t, err)
+			assert.Equal(t, time.UTC, stored.SendAt.Location())
+		})
+	}
+
+	m, err := newScheduler(t, newFakeScheduled()).Schedule(context.Background(), &scheduler.Request{
+		IDInstance: testID,
+		SendAt:     "2026-10-17T09:00",
+		Timezone:   "Europe/Moscow",
+		Payload:    json.RawMessage(message),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 17, 9, 0, 0, 0, moscow).Format(time.RFC3339), m.SendAt.Format(time.RFC3339))
+}
+
+func TestScheduler_Schedule_Errors(t *testing.T) {
+	tests := []struct {
+		wantErr error
+		req     scheduler.Request
+		name    string
+	}{
+		{
+			name:    "past",
+			req:     scheduler.Request{IDInstance: testID, SendAt: "2026-10-16T14:59", Timezone: "Europe/Moscow"},
+			wantErr: scheduler.ErrInvalid,
+		},
+		{
+			name:    "unknown timezone",
+			req:     scheduler.Request{IDInstance: testID, SendAt: "2026-10-17T09:00", Timezone: "Mars/Olympus"},
+			wantErr: scheduler.ErrInvalid,
+		},
+		{
+			name:    "local timezone",
+			req:     scheduler.Request{IDInstance: testID, SendAt: "2026-10-17T09:00", Timezone: "Local"},
+			wantErr: scheduler.ErrInvalid,
+		},
+		{
+			name:    "wrong time",
+			req:     scheduler.Request{IDInstance: testID, SendAt: "tomorrow 9am"},
+			wantErr: scheduler.ErrInvalid,
+		},
+		{
+			name:    "no time",
+			req:     scheduler.Request{IDInstance: testID},
+			wantErr: scheduler.ErrInvalid,
+		},
+		{
+			name:    "unknown instance",
+			req:     scheduler.Request{IDInstance: "1", SendAt: "2026-10-17T09:00"},
+			wantErr: httpclient.ErrUnknownInstance,
+		},
+		{
+			name:    "unknown method",
+			req:     scheduler.Request{IDInstance: testID, Method: "getSettings", SendAt: "2026-10-17T09:00"},
+			wantErr: queue.ErrUnknownMethod,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Payload = json.RawMessage(message)
+
+			_, err := newScheduler(t, newFakeScheduled()).Schedule(context.Background(), &tt.req)
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	_, err := newScheduler(t, newFakeScheduled()).Schedule(context.Background(), &scheduler.Request{
+		IDInstance: testID,
+		SendAt:     "2026-10-17T09:00",
+		Payload:    json.RawMessage(`{"chatId":"79876543210@c.us"}`),
+	})
+	require.ErrorIs(t, err, httpclient.ErrInvalidRequest)
+}
+
+func TestScheduler_UpdateCancel(t *testing.T) {
+	ctx := context.Background()
+	s := newScheduler(t, newFakeScheduled())
+
+	m, err := s.Schedule(ctx, &scheduler.Request{
+		IDInstance: testID,
+		SendAt:     "2026-10-17T09:00",
+		Timezone:   "Europe/Moscow",
+		Payload:    json.RawMessage(message),
+	})
+	require.NoError(t, err)
+
+	// 09:00 stays 09:00 of the new zone
+	m, err = s.Update(ctx, m.ID, &scheduler.Request{Timezone: "Asia/Yekaterinburg"})
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10-17T09:00:00+05:00", m.SendAt.Format(time.RFC3339))
+	assert.Equal(t, "Asia/Yekaterinburg", m.Timezone)
+
+	m, err = s.Update(ctx, m.ID, &scheduler.Request{
+		SendAt:  "2026-10-18T10:30",
+		Payload: json.RawMessage(`{"chatId":"79990000000@c.us","message":"later"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10-18T10:30:00+05:00", m.SendAt.Format(time.RFC3339))
+	assert.Equal(t, "79990000000@c.us", m.ChatID)
+	assert.JSONEq(t, `{"chatId":"79990000000@c.us","message":"later"}`, string(m.Payload))
+
+	_, err = s.Update(ctx, m.ID, &scheduler.Request{Payload: json.RawMessage(`{"message":"no chat"}`)})
+	require.ErrorIs(t, err, httpclient.ErrInvalidRequest)
+
+	_, err = s.Update(ctx, m.ID, &scheduler.Request{SendAt: "2026-10-01T10:30"})
+	require.ErrorIs(t, err, scheduler.ErrInvalid)
+
+	m, err = s.Cancel(ctx, m.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduledCancelled, m.Status)
+
+	_, err = s.Cancel(ctx, m.ID)
+	require.ErrorIs(t, err, scheduler.ErrNotPending)
+
+	_, err = s.Update(ctx, m.ID, &scheduler.Request{SendAt: "2026-10-18T10:30"})
+	require.ErrorIs(t, err, scheduler.ErrNotPending)
+
+	_, err = s.Get(ctx, "unknown")
+	require.ErrorIs(t, err, scheduler.ErrNotFound)
+
+	list, err := s.List(ctx, "", storage.ScheduledCancelled, 0)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "2026-10-18T10:30:00+05:00", list[0].SendAt.Format(time.RFC3339))
+}
+
+func TestScheduler_Run(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeScheduled()
+
+	var (
+		now = testNow
+		mu  sync.Mutex
+	)
+
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return now
+	}
+
+	q := newQueue(t)
+	s := scheduler.New(store, q).SetClock(clock).SetInterval(time.Millisecond)
+
+	due, err := s.Schedule(ctx, &scheduler.Request{IDInstance: testID, SendAt: "2026-10-16T12:00:01Z",
+		Payload: json.RawMessage(message)})
+	require.NoError(t, err)
+
+	later, err := s.Schedule(ctx, &scheduler.Request{IDInstance: testID, SendAt: "2026-10-17T12:00:00Z",
+		Payload: json.RawMessage(message)})
+	require.NoError(t, err)
+
+	// the instance was removed from the configuration after the message was scheduled
+	broken := *due
+	broken.ID = "broken"
+	broken.IDInstance = "1101000002"
+	require.NoError(t, store.SaveScheduled(ctx, &broken))
+
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	for _, run := range []func(<-chan struct{}){s.Run, q.Run} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			run(done)
+		}()
+	}
+
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		m, err := s.Get(ctx, due.ID)
+		require.NoError(t, err)
+
+		return m.Status == storage.ScheduledDispatched
+	}, 2*time.Second, time.Millisecond)
+
+	m, err := s.Get(ctx, due.ID)
+	require.NoError(t, err)
+	require.NotEmpty(t, m.IDJob)
+
+	require.Eventually(t, func() bool {
+		job, err := q.Get(ctx, m.IDJob)
+		require.NoError(t, err)
+
+		return job.Status == storage.JobSent
+	}, 2*time.Second, time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		m, err = s.Get(ctx, "broken")
+		require.NoError(t, err)
+
+		return m.Status == storage.ScheduledFailed
+	}, 2*time.Second, time.Millisecond)
+	assert.Contains(t, m.Error, "unknown instance")
+
+	m, err = s.Get(ctx, later.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduledPending, m.Status)
+
+	_, err = s.Cancel(ctx, due.ID)
+	require.ErrorIs(t, err, scheduler.ErrNotPending)
+}
+
+func TestScheduler_Run_Interrupted(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeScheduled()
+	s := newScheduler(t, store)
+
+	m, err := s.Schedule(ctx, &scheduler.Request{IDInstance: testID, SendAt: "2026-10-16T12:00:01Z",
+		Payload: json.RawMessage(message)})
+	require.NoError(t, err)
+
+	// the dispatcher stopped after it marked the due messages and before it enqueued them
+	interrupted := *m
+	interrupted.SendAt = testNow
+	interrupted.Status = storage.ScheduledDispatched
+	interrupted.UpdatedAt = testNow.Add(-2 * time.Minute)
+	require.NoError(t, store.UpdateScheduled(ctx, &interrupted, storage.ScheduledPending))
+
+	// another dispatcher is enqueueing this one
+	dispatching := interrupted
+	dispatching.ID = "dispatching"
+	dispatching.UpdatedAt = testNow
+	require.NoError(t, store.SaveScheduled(ctx, &dispatching))
+
+	done := make(chan struct{})
+	close(done)
+	s.Run(done)
+
+	got, err := s.Get(ctx, m.ID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduledDispatched, got.Status)
+	assert.NotEmpty(t, got.IDJob, "the interrupted message is dispatched again")
+
+	got, err = s.Get(ctx, "dispatching")
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduledDispatched, got.Status)
+	assert.Empty(t, got.IDJob, "the message is left to its dispatcher")
+}
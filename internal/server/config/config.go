@@ -3,31 +3,79 @@
 package config
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ole-larsen/green-api/internal/common"
+	"github.com/ole-larsen/green-api/internal/httpclient"
+	"github.com/ole-larsen/green-api/internal/ratelimit"
 )
 
+// DefaultSecret is the secret used when none is set. It is public, so credentials are not encrypted with it.
+const DefaultSecret = "supersecret"
+
+// ErrPublicSecret is returned by CheckSecret when the secret is empty or the default one.
+var ErrPublicSecret = errors.New("SECRET is empty or the default one, set a secret of your own")
+
 type Config struct {
-	Host     string
-	Protocol string
-	DSN      string
+	Instances map[string]string
+	Host      string
+	Protocol  string
+	DSN       string
+	APIURL    string
 
 	Secret    string
 	ServerKey []byte
 	ServerCrt []byte
 	Port      int
+	// RedirectPort is a port of plain http listener redirecting to https. 0 disables it.
+	RedirectPort int
+	// ShutdownTimeout is how long in-flight requests are drained on shutdown.
+	ShutdownTimeout time.Duration
+	// WebhookToken is webhookUrlToken of instances. Notifications are received by webhooks
+	// instead of polling when it is set.
+	WebhookToken string
+	// MaxUploadSize is the size limit of files uploaded through the server, bytes.
+	MaxUploadSize int64
+	// RateLimits are sending limits of instances, others use RateLimit.
+	RateLimits map[string]ratelimit.Limit
+	// RateLimit is the sending limit of instances.
+	RateLimit ratelimit.Limit
+	// QueueMaxAttempts is how many times a queued message is sent before it is dead.
+	QueueMaxAttempts int
+	// Migrate applies pending database migrations at startup.
+	Migrate bool
+	// PreviousSecrets are secrets replaced by Secret. Stored credentials encrypted with them are still
+	// decrypted until rotate-keys re-encrypts them.
+	PreviousSecrets []string
+	// SessionIdleTimeout ends sessions of the web interface unused for so long.
+	SessionIdleTimeout time.Duration
+	// SessionMaxAge ends sessions of the web interface this long after login.
+	SessionMaxAge time.Duration
 }
 
 type Opts struct {
 	APtr *string
 	DPtr *string
 	SPtr *string
+	IPtr *string
+	UPtr *string
+	RPtr *string
+	TPtr *string
+	MPtr *string
+	WPtr *string
+	LPtr *string
+	QPtr *string
+	BPtr *string
+	OPtr *string
+	EPtr *string
+	GPtr *string
 }
 
 var (
@@ -46,6 +94,18 @@ func GetConfig() *Config {
 			WithAddress(os.Getenv("ADDRESS"), f.APtr),
 			WithDSN(os.Getenv("DATABASE_DSN"), f.DPtr),
 			WithSecret(os.Getenv("SECRET"), f.SPtr),
+			WithPreviousSecrets(os.Getenv("PREVIOUS_SECRETS"), f.OPtr),
+			WithInstances(os.Getenv("INSTANCES"), f.IPtr),
+			WithAPIURL(os.Getenv("API_URL"), f.UPtr),
+			WithRedirectPort(os.Getenv("REDIRECT_PORT"), f.RPtr),
+			WithShutdownTimeout(os.Getenv("SHUTDOWN_TIMEOUT"), f.TPtr),
+			WithMigrate(os.Getenv("MIGRATE"), f.MPtr),
+			WithWebhookToken(os.Getenv("WEBHOOK_TOKEN"), f.WPtr),
+			WithMaxUploadSize(os.Getenv("MAX_UPLOAD_SIZE"), f.LPtr),
+			WithQueueMaxAttempts(os.Getenv("QUEUE_MAX_ATTEMPTS"), f.QPtr),
+			WithRateLimits(os.Getenv("RATE_LIMITS"), f.BPtr),
+			WithSessionIdleTimeout(os.Getenv("SESSION_IDLE_TIMEOUT"), f.EPtr),
+			WithSessionMaxAge(os.Getenv("SESSION_MAX_AGE"), f.GPtr),
 			WithProtocol(common.HTTPSProtocol),
 		)
 	})
@@ -53,6 +113,15 @@ func GetConfig() *Config {
 	return config
 }
 
+// CheckSecret returns ErrPublicSecret unless the secret is private enough to encrypt stored credentials.
+func (c *Config) CheckSecret() error {
+	if c.Secret == "" || c.Secret == DefaultSecret {
+		return ErrPublicSecret
+	}
+
+	return nil
+}
+
 func (c *Config) Reload(opts ...func(*Config)) {
 	for _, opt := range opts {
 		opt(c)
@@ -70,7 +139,20 @@ func parseFlags() Opts {
 	flags := Opts{
 		APtr: flag.String("a", "localhost:8080", "адрес эндпоинта HTTP-сервера (по умолчанию localhost:8080)"),
 		DPtr: flag.String("d", "", "строка с адресом подключения к БД"),
-		SPtr: flag.String("s", "supersecret", "секрет для соли"),
+		SPtr: flag.String("s", DefaultSecret, "секрет для соли"),
+		OPtr: flag.String("o", "", "прежние секреты через запятую, ими расшифровываются данные до ротации ключей"),
+		IPtr: flag.String("i", "", "инстансы GREEN-API в формате idInstance:apiTokenInstance,..."),
+		UPtr: flag.String("u", httpclient.APIURL, "адрес GREEN-API"),
+		RPtr: flag.String("r", "", "порт HTTP-сервера, перенаправляющего на HTTPS (по умолчанию выключен)"),
+		TPtr: flag.String("t", "10s", "время ожидания завершения запросов при остановке сервера"),
+		MPtr: flag.String("m", "false", "применить миграции БД при запуске сервера"),
+		LPtr: flag.String("l", "104857600", "максимальный размер загружаемого файла в байтах"),
+		QPtr: flag.String("q", "5", "количество попыток отправки сообщения из очереди"),
+		BPtr: flag.String("b", ratelimit.DefaultLimit.String(),
+			"лимиты отправки в формате rate:burst,idInstance=rate:burst,... (сообщений в секунду:пачка)"),
+		WPtr: flag.String("w", "", "webhookUrlToken инстансов, включает прием уведомлений вебхуками вместо опроса"),
+		EPtr: flag.String("e", "30m", "время бездействия, после которого сессия веб-интерфейса завершается"),
+		GPtr: flag.String("g", "12h", "максимальное время жизни сессии веб-интерфейса"),
 	}
 
 	flag.Parse()
@@ -125,6 +207,257 @@ func WithSecret(s string, sPtr *string) func(*Config) {
 	}
 }
 
+// WithPreviousSecrets parses secrets separated by comma.
+func WithPreviousSecrets(o string, oPtr *string) func(*Config) {
+	return func(c *Config) {
+		if o == "" && oPtr != nil {
+			o = *oPtr
+		}
+
+		c.PreviousSecrets = nil
+
+		for _, secret := range strings.Split(o, ",") {
+			if secret = strings.TrimSpace(secret); secret != "" {
+				c.PreviousSecrets = append(c.PreviousSecrets, secret)
+			}
+		}
+	}
+}
+
+// WithInstances parses "idInstance:apiTokenInstance" pairs separated by comma.
+func WithInstances(i string, iPtr *string) func(*Config) {
+	return func(c *Config) {
+		if i == "" && iPtr != nil {
+			i = *iPtr
+		}
+
+		instances := make(map[string]string)
+
+		for _, pair := range strings.Split(i, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+
+			const reqLen = 2
+
+			creds := strings.Split(pair, ":")
+			if len(creds) != reqLen || creds[0] == "" || creds[1] == "" {
+				panic(fmt.Errorf("wrong i parameters"))
+			}
+
+			if _, err := strconv.ParseInt(creds[0], 10, 64); err != nil {
+				panic(fmt.Errorf("wrong i parameters"))
+			}
+
+			instances[creds[0]] = creds[1]
+		}
+
+		c.Instances = instances
+	}
+}
+
+func WithAPIURL(u string, uPtr *string) func(*Config) {
+	return func(c *Config) {
+		if u == "" && uPtr != nil {
+			u = *uPtr
+		}
+
+		c.APIURL = u
+	}
+}
+
+func WithRedirectPort(r string, rPtr *string) func(*Config) {
+	return func(c *Config) {
+		if r == "" && rPtr != nil {
+			r = *rPtr
+		}
+
+		if r == "" {
+			c.RedirectPort = 0
+			return
+		}
+
+		port, err := strconv.Atoi(r)
+		if err != nil {
+			panic(fmt.Errorf("wrong r parameters"))
+		}
+
+		c.RedirectPort = port
+	}
+}
+
+func WithShutdownTimeout(t string, tPtr *string) func(*Config) {
+	return func(c *Config) {
+		if t == "" && tPtr != nil {
+			t = *tPtr
+		}
+
+		if t == "" {
+			c.ShutdownTimeout = 0
+			return
+		}
+
+		timeout, err := time.ParseDuration(t)
+		if err != nil {
+			panic(fmt.Errorf("wrong t parameters"))
+		}
+
+		c.ShutdownTimeout = timeout
+	}
+}
+
+func WithSessionIdleTimeout(e string, ePtr *string) func(*Config) {
+	return func(c *Config) {
+		if e == "" && ePtr != nil {
+			e = *ePtr
+		}
+
+		if e == "" {
+			c.SessionIdleTimeout = 0
+			return
+		}
+
+		timeout, err := time.ParseDuration(e)
+		if err != nil || timeout < 0 {
+			panic(fmt.Errorf("wrong e parameters"))
+		}
+
+		c.SessionIdleTimeout = timeout
+	}
+}
+
+func WithSessionMaxAge(g string, gPtr *string) func(*Config) {
+	return func(c *Config) {
+		if g == "" && gPtr != nil {
+			g = *gPtr
+		}
+
+		if g == "" {
+			c.SessionMaxAge = 0
+			return
+		}
+
+		maxAge, err := time.ParseDuration(g)
+		if err != nil || maxAge < 0 {
+			panic(fmt.Errorf("wrong g parameters"))
+		}
+
+		c.SessionMaxAge = maxAge
+	}
+}
+
+func WithMigrate(m string, mPtr *string) func(*Config) {
+	return func(c *Config) {
+		if m == "" && mPtr != nil {
+			m = *mPtr
+		}
+
+		if m == "" {
+			c.Migrate = false
+			return
+		}
+
+		migrate, err := strconv.ParseBool(m)
+		if err != nil {
+			panic(fmt.Errorf("wrong m parameters"))
+		}
+
+		c.Migrate = migrate
+	}
+}
+
+func WithWebhookToken(w string, wPtr *string) func(*Config) {
+	return func(c *Config) {
+		if w == "" && wPtr != nil {
+			w = *wPtr
+		}
+
+		c.WebhookToken = w
+	}
+}
+
+func WithMaxUploadSize(l string, lPtr *string) func(*Config) {
+	return func(c *Config) {
+		if l == "" && lPtr != nil {
+			l = *lPtr
+		}
+
+		if l == "" {
+			c.MaxUploadSize = 0
+			return
+		}
+
+		size, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || size < 0 {
+			panic(fmt.Errorf("wrong l parameters"))
+		}
+
+		c.MaxUploadSize = size
+	}
+}
+
+func WithQueueMaxAttempts(q string, qPtr *string) func(*Config) {
+	return func(c *Config) {
+		if q == "" && qPtr != nil {
+			q = *qPtr
+		}
+
+		if q == "" {
+			c.QueueMaxAttempts = 0
+			return
+		}
+
+		attempts, err := strconv.Atoi(q)
+		if err != nil || attempts < 1 {
+			panic(fmt.Errorf("wrong q parameters"))
+		}
+
+		c.QueueMaxAttempts = attempts
+	}
+}
+
+// WithRateLimits parses sending limits "rate:burst,idInstance=rate:burst,...". An entry without
+// idInstance is the limit of other instances, DefaultLimit is used without it.
+func WithRateLimits(b string, bPtr *string) func(*Config) {
+	return func(c *Config) {
+		if b == "" && bPtr != nil {
+			b = *bPtr
+		}
+
+		c.RateLimit = ratelimit.DefaultLimit
+		c.RateLimits = make(map[string]ratelimit.Limit)
+
+		for _, entry := range strings.Split(b, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+
+			id, value, ok := strings.Cut(entry, "=")
+			if !ok {
+				value = id
+			}
+
+			limit, err := ratelimit.ParseLimit(value)
+			if err != nil {
+				panic(fmt.Errorf("wrong b parameters"))
+			}
+
+			if !ok {
+				c.RateLimit = limit
+				continue
+			}
+
+			if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+				panic(fmt.Errorf("wrong b parameters"))
+			}
+
+			c.RateLimits[id] = limit
+		}
+	}
+}
+
 func WithServerCrt(crt []byte) func(*Config) {
 	return func(c *Config) {
 		c.ServerCrt = crt
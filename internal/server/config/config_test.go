@@ -4,8 +4,10 @@ import (
 	"flag"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/ole-larsen/green-api/internal/common"
+	"github.com/ole-larsen/green-api/internal/ratelimit"
 	"github.com/ole-larsen/green-api/internal/server/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,7 +15,7 @@ import (
 
 const (
 	defaultAddress = "localhost:8080"
-	defaultSecret  = "supersecret"
+	defaultSecret  = config.DefaultSecret
 )
 
 func Test_NewConfig(t *testing.T) {
@@ -257,6 +259,16 @@ func Test_WithSecret(t *testing.T) {
 	}
 }
 
+func TestConfig_CheckSecret(t *testing.T) {
+	for _, secret := range []string{"", defaultSecret} {
+		cfg := config.InitConfig(config.WithSecret(secret, nil))
+		require.ErrorIs(t, cfg.CheckSecret(), config.ErrPublicSecret, "secret %q", secret)
+	}
+
+	cfg := config.InitConfig(config.WithSecret("a secret of our own", nil))
+	require.NoError(t, cfg.CheckSecret())
+}
+
 func Test_withServeKey(t *testing.T) {
 	type args struct {
 		k string
@@ -342,3 +354,212 @@ func Test_withProtocol(t *testing.T) {
 		})
 	}
 }
+
+func Test_WithInstances(t *testing.T) {
+	instances := "1101000001:token1, 1101000002:token2"
+	invalid := "1101000001"
+
+	tests := []struct {
+		iPtr      *string
+		want      map[string]string
+		name      string
+		i         string
+		wantPanic bool
+	}{
+		{
+			name: "instances from environment variable",
+			i:    instances,
+			want: map[string]string{"1101000001": "token1", "1101000002": "token2"},
+		},
+		{
+			name: "instances from command line argument",
+			iPtr: &instances,
+			want: map[string]string{"1101000001": "token1", "1101000002": "token2"},
+		},
+		{
+			name: "no instances",
+			want: map[string]string{},
+		},
+		{
+			name:      "missing token",
+			i:         invalid,
+			wantPanic: true,
+		},
+		{
+			name:      "not numeric idInstance",
+			i:         "instance:token",
+			wantPanic: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() {
+					config.InitConfig(config.WithInstances(tt.i, tt.iPtr))
+				})
+
+				return
+			}
+
+			cfg := config.InitConfig(config.WithInstances(tt.i, tt.iPtr))
+			assert.Equal(t, tt.want, cfg.Instances)
+		})
+	}
+}
+
+func Test_WithAPIURL(t *testing.T) {
+	u := "https://7103.api.greenapi.com"
+
+	cfg := config.InitConfig(config.WithAPIURL(u, nil))
+	assert.Equal(t, u, cfg.APIURL)
+
+	cfg = config.InitConfig(config.WithAPIURL("", &u))
+	assert.Equal(t, u, cfg.APIURL)
+}
+
+func Test_WithRedirectPort(t *testing.T) {
+	port := "8081"
+
+	cfg := config.InitConfig(config.WithRedirectPort(port, nil))
+	assert.Equal(t, 8081, cfg.RedirectPort)
+
+	cfg = config.InitConfig(config.WithRedirectPort("", &port))
+	assert.Equal(t, 8081, cfg.RedirectPort)
+
+	cfg = config.InitConfig(config.WithRedirectPort("", nil))
+	assert.Equal(t, 0, cfg.RedirectPort)
+
+	assert.Panics(t, func() {
+		config.InitConfig(config.WithRedirectPort("http", nil))
+	})
+}
+
+func Test_WithShutdownTimeout(t *testing.T) {
+	timeout := "15s"
+
+	cfg := config.InitConfig(config.WithShutdownTimeout(timeout, nil))
+	assert.Equal(t, 15*time.Second, cfg.ShutdownTimeout)
+
+	cfg = config.InitConfig(config.WithShutdownTimeout("", &timeout))
+	assert.Equal(t, 15*time.Second, cfg.ShutdownTimeout)
+
+	assert.Panics(t, func() {
+		config.InitConfig(config.WithShutdownTimeout("soon", nil))
+	})
+}
+
+func Test_WithSessionTimeouts(t *testing.T) {
+	idle, maxAge := "15m", "8h"
+
+	cfg := config.InitConfig(config.WithSessionIdleTimeout(idle, nil), config.WithSessionMaxAge(maxAge, nil))
+	assert.Equal(t, 15*time.Minute, cfg.SessionIdleTimeout)
+	assert.Equal(t, 8*time.Hour, cfg.SessionMaxAge)
+
+	cfg = config.InitConfig(config.WithSessionIdleTimeout("", &idle), config.WithSessionMaxAge("", &maxAge))
+	assert.Equal(t, 15*time.Minute, cfg.SessionIdleTimeout)
+	assert.Equal(t, 8*time.Hour, cfg.SessionMaxAge)
+
+	assert.Panics(t, func() {
+		config.InitConfig(config.WithSessionIdleTimeout("a while", nil))
+	})
+
+	assert.Panics(t, func() {
+		config.InitConfig(config.WithSessionMaxAge("-1h", nil))
+	})
+}
+
+func Test_WithMigrate(t *testing.T) {
+	migrate := "true"
+
+	cfg := config.InitConfig(config.WithMigrate(migrate, nil))
+	assert.True(t, cfg.Migrate)
+
+	cfg = config.InitConfig(config.WithMigrate("", &migrate))
+	assert.True(t, cfg.Migrate)
+
+	cfg = config.InitConfig(config.WithMigrate("", nil))
+	assert.False(t, cfg.Migrate)
+
+	assert.Panics(t, func() {
+		config.InitConfig(config.WithMigrate("sometimes", nil))
+	})
+}
+
+func Test_WithWebhookToken(t *testing.T) {
+	token := "webhook-secret"
+
+	cfg := config.InitConfig(config.WithWebhookToken(token, nil))
+	assert.Equal(t, token, cfg.WebhookToken)
+
+	cfg = config.InitConfig(config.WithWebhookToken("", &token))
+	assert.Equal(t, token, cfg.WebhookToken)
+}
+
+func Test_WithPreviousSecrets(t *testing.T) {
+	secrets := "old, older,"
+
+	cfg := config.InitConfig(config.WithPreviousSecrets(secrets, nil))
+	assert.Equal(t, []string{"old", "older"}, cfg.PreviousSecrets)
+
+	cfg = config.InitConfig(config.WithPreviousSecrets("", &secrets))
+	assert.Equal(t, []string{"old", "older"}, cfg.PreviousSecrets)
+
+	cfg = config.InitConfig(config.WithPreviousSecrets("", nil))
+	assert.Empty(t, cfg.PreviousSecrets)
+}
+
+func Test_WithMaxUploadSize(t *testing.T) {
+	size := "1048576"
+
+	cfg := config.InitConfig(config.WithMaxUploadSize(size, nil))
+	assert.Equal(t, int64(1<<20), cfg.MaxUploadSize)
+
+	cfg = config.InitConfig(config.WithMaxUploadSize("", &size))
+	assert.Equal(t, int64(1<<20), cfg.MaxUploadSize)
+
+	cfg = config.InitConfig(config.WithMaxUploadSize("", nil))
+	assert.Equal(t, int64(0), cfg.MaxUploadSize)
+
+	assert.Panics(t, func() {
+		config.InitConfig(config.WithMaxUploadSize("1MB", nil))
+	})
+}
+
+func Test_WithQueueMaxAttempts(t *testing.T) {
+	attempts := "7"
+
+	cfg := config.InitConfig(config.WithQueueMaxAttempts(attempts, nil))
+	assert.Equal(t, 7, cfg.QueueMaxAttempts)
+
+	cfg = config.InitConfig(config.WithQueueMaxAttempts("", &attempts))
+	assert.Equal(t, 7, cfg.QueueMaxAttempts)
+
+	cfg = config.InitConfig(config.WithQueueMaxAttempts("", nil))
+	assert.Equal(t, 0, cfg.QueueMaxAttempts)
+
+	assert.Panics(t, func() {
+		config.InitConfig(config.WithQueueMaxAttempts("0", nil))
+	})
+}
+
+func Test_WithRateLimits(t *testing.T) {
+	limits := "2:10, 1101000001=0.5:3"
+
+	cfg := config.InitConfig(config.WithRateLimits(limits, nil))
+	assert.Equal(t, ratelimit.Limit{Rate: 2, Burst: 10}, cfg.RateLimit)
+	assert.Equal(t, map[string]ratelimit.Limit{"1101000001": {Rate: 0.5, Burst: 3}}, cfg.RateLimits)
+
+	cfg = config.InitConfig(config.WithRateLimits("", &limits))
+	assert.Equal(t, ratelimit.Limit{Rate: 2, Burst: 10}, cfg.RateLimit)
+
+	cfg = config.InitConfig(config.WithRateLimits("", nil))
+	assert.Equal(t, ratelimit.DefaultLimit, cfg.RateLimit)
+	assert.Empty(t, cfg.RateLimits)
+
+	for _, wrong := range []string{"fast", "1:0", "-1:5", "abc=1:5"} {
+		assert.Panics(t, func() {
+			config.InitConfig(config.WithRateLimits(wrong, nil))
+		}, wrong)
+	}
+}
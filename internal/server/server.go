@@ -3,29 +3,61 @@ package server
 import (
 	"context"
 	"errors"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/ole-larsen/green-api/internal/auth"
+	"github.com/ole-larsen/green-api/internal/campaign"
+	"github.com/ole-larsen/green-api/internal/common"
+	"github.com/ole-larsen/green-api/internal/encryption"
+	"github.com/ole-larsen/green-api/internal/httpclient"
 	"github.com/ole-larsen/green-api/internal/httpserver"
 	"github.com/ole-larsen/green-api/internal/httpserver/router"
+	"github.com/ole-larsen/green-api/internal/instances"
 	"github.com/ole-larsen/green-api/internal/log"
+	"github.com/ole-larsen/green-api/internal/notifications"
+	"github.com/ole-larsen/green-api/internal/queue"
+	"github.com/ole-larsen/green-api/internal/ratelimit"
+	"github.com/ole-larsen/green-api/internal/scheduler"
 	"github.com/ole-larsen/green-api/internal/server/config"
+	"github.com/ole-larsen/green-api/internal/storage"
+	"github.com/ole-larsen/green-api/internal/storage/migrations"
+	"github.com/ole-larsen/green-api/internal/templates"
 )
 
 var (
 	logger = log.NewLogger("info", log.DefaultBuildLogger)
 )
 
+const defaultShutdownTimeout = 10 * time.Second
+
 // Server represents the server instance, encapsulating settings,
 // logger, signal handling, and storage and gRPC server components.
 type Server struct {
-	http     *httpserver.HTTPServer
-	settings *config.Config
-	logger   *log.Logger
-	signal   chan os.Signal
-	done     chan struct{}
+	http          *httpserver.HTTPServer
+	storage       storage.Storage
+	clients       httpclient.Provider
+	notifications *notifications.Dispatcher
+	queue         *queue.Queue
+	limiter       *ratelimit.Limiter
+	scheduler     *scheduler.Scheduler
+	campaigns     *campaign.Manager
+	templates     *templates.Manager
+	registry      *instances.Registry
+	users         *auth.Users
+	sessions      *auth.Sessions
+	keys          *auth.APIKeys
+	settings      *config.Config
+	logger        *log.Logger
+	signal        chan os.Signal
+	done          chan struct{}
+	workers       sync.WaitGroup
+	stopOnce      sync.Once
 }
 
 // NewServer creates and returns a new Server instance with default logger settings.
@@ -39,9 +71,24 @@ var SetupFunc = Setup
 
 // Setup initializes the server with provided configuration settings and sets up
 // storage. Returns an error if initialization fails.
-func Setup(_ context.Context, settings *config.Config) (*Server, error) {
+func Setup(ctx context.Context, settings *config.Config) (*Server, error) {
 	s := NewServer()
 
+	if settings != nil && settings.DSN != "" {
+		store, err := storage.NewPostgres(ctx, settings.DSN)
+		if err != nil {
+			return nil, NewError(err)
+		}
+
+		if settings.Migrate {
+			if err := migrate(ctx, store); err != nil {
+				return nil, NewError(errors.Join(err, store.Close()))
+			}
+		}
+
+		s.SetStorage(store)
+	}
+
 	if err := s.Init(settings, make(chan os.Signal, 1), make(chan struct{})); err != nil {
 		return nil, err
 	}
@@ -49,54 +96,142 @@ func Setup(_ context.Context, settings *config.Config) (*Server, error) {
 	return s, nil
 }
 
+// migrate applies pending migrations. Replicas started together wait for each other on the lock.
+func migrate(ctx context.Context, store *storage.Postgres) error {
+	m, err := migrations.New(store.DB())
+	if err != nil {
+		return err
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger.Infow("...migrations applied", "count", applied)
+
+	return nil
+}
+
 // Run starts the server and begins listening for shutdown signals. It runs the gRPC server
 // and handles shutdown on receiving system interrupt signals like SIGINT or SIGTERM.
+// Notifications of configured instances are polled in background unless webhooks are enabled.
+// On shutdown in-flight requests are drained and background workers are awaited.
 func (s *Server) Run(ctx context.Context, cancel context.CancelFunc) {
 	defer cancel()
 
 	defer close(s.signal)
+	defer signal.Stop(s.signal)
 
 	// shutdown workers
 	go func() {
 		signal.Notify(s.signal, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	}()
 
-	go func(signal chan os.Signal, done chan struct{}) {
+	go func(signal chan os.Signal) {
 		<-signal
-		close(done)
+		s.stop()
 		s.logger.Infow("...graceful server shutdown")
-	}(s.signal, s.done)
+	}(s.signal)
 
 	port := s.settings.Port
 	host := s.settings.Host
 
 	s.logger.Infow("...starting server",
+		"protocol", s.settings.Protocol,
 		"host", host,
 		"port", port,
 		"goroutines", runtime.NumGoroutine(),
 	)
 
 	go func() {
-		if err := s.http.ListenAndServe(); err != nil {
+		if err := s.http.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			s.logger.Errorln(err)
 		}
 	}()
 
+	if s.registry != nil {
+		if err := s.registry.Load(ctx); err != nil {
+			s.logger.Errorln(err)
+		}
+	}
+
+	// GREEN-API delivers notifications either to webhookUrl or to the receiveNotification queue,
+	// the poller picks up instances registered later
+	if s.settings.WebhookToken == "" {
+		s.Go(notifications.NewPoller(s.clients, s.notifications).Run)
+	}
+
+	s.Go(s.queue.Run)
+
+	if s.scheduler != nil {
+		s.Go(s.scheduler.Run)
+	}
+
+	if s.campaigns != nil {
+		s.Go(s.campaigns.Run)
+	}
+
 	for {
 		select {
 		case <-s.done:
+			s.shutdown()
 			s.logger.Infow("...stop server",
 				"goroutines", runtime.NumGoroutine(),
 			)
 
 			return
 		case <-ctx.Done():
+			s.stop()
+			s.shutdown()
 			s.logger.Infow("stop server by ctx")
+
 			return
 		}
 	}
 }
 
+// Go runs fn as a background worker. Workers must return once done channel is closed,
+// Run waits for them before exit.
+func (s *Server) Go(fn func(done <-chan struct{})) {
+	s.workers.Add(1)
+
+	go func() {
+		defer s.workers.Done()
+		fn(s.done)
+	}()
+}
+
+// stop closes done channel once, background workers are notified by it.
+func (s *Server) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// shutdown drains in-flight http requests within ShutdownTimeout and waits for background workers.
+func (s *Server) shutdown() {
+	timeout := s.settings.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.http.Shutdown(ctx); err != nil {
+		s.logger.Errorln(err)
+	}
+
+	s.workers.Wait()
+
+	if s.storage != nil {
+		if err := s.storage.Close(); err != nil {
+			s.logger.Errorln(err)
+		}
+	}
+}
+
 // Init initializes the server with the given settings, signal channels,
 // storage interface, and gRPC interface. Returns an error if any component is missing.
 func (s *Server) Init(
@@ -120,7 +255,122 @@ func (s *Server) Init(
 		return NewError(errors.New("done is missing"))
 	}
 
+	s.limiter = ratelimit.New(s.settings.RateLimit)
+	for id, limit := range s.settings.RateLimits {
+		s.limiter.SetLimit(id, limit)
+	}
+
+	// the proxy and the queue share limiter, sends are counted once by clients
+	pool := httpclient.NewPool(s.settings.APIURL, nil, s.settings.Instances).SetLimiter(s.limiter)
+	s.clients = pool
+
+	// tokens of registered instances and bodies of saved messages are encrypted with a key derived from
+	// the secret, keys of previous secrets decrypt them until rotate-keys is run. The default secret is
+	// public, nothing is encrypted with it.
+	var sealer *encryption.Sealer
+
+	if s.storage != nil {
+		var err error
+
+		if sealer, err = s.sealer(); err != nil {
+			s.logger.Warnw("...instance registry and message encryption are disabled, they require SECRET",
+				"error", err)
+		}
+	}
+
+	// registered instances are resolved by name
+	if store, ok := s.storage.(storage.InstanceStorage); ok && sealer != nil {
+		s.registry = instances.New(store, sealer, s.settings.APIURL, nil).
+			SetStatic(pool).
+			SetLimiter(s.limiter)
+		s.clients = s.registry
+	}
+
+	if messages, ok := s.storage.(storage.SealedMessageStorage); ok && sealer != nil {
+		messages.SetSealer(sealer)
+	}
+
+	// accounts are kept in the database, without it anyone reaching the server can use it. Sessions are
+	// signed with the secret, the default one is public and would let anyone forge them.
+	store, ok := s.storage.(storage.UserStorage)
+
+	switch err := s.settings.CheckSecret(); {
+	case !ok:
+		s.logger.Warnw("...sign in is disabled, it requires a database: the server is open to anyone")
+	case err != nil:
+		s.logger.Warnw("...sign in is disabled, it requires SECRET: the server is open to anyone", "error", err)
+	default:
+		s.users = auth.NewUsers(store).SetInstances(s.clients)
+
+		// roles of users per instance, without them every user is an admin of every instance
+		if roles, ok := s.storage.(storage.RoleStorage); ok {
+			s.users.SetRoles(roles)
+		}
+
+		sessions, err := auth.NewSessions(s.users, s.settings.Secret, s.settings.PreviousSecrets...)
+		if err != nil {
+			return NewError(err)
+		}
+
+		s.sessions = sessions.
+			SetTimeouts(s.settings.SessionIdleTimeout, s.settings.SessionMaxAge).
+			SetSecure(s.settings.Protocol == common.HTTPSProtocol)
+
+		// machine clients use API keys instead of sessions, keys restricted to instances accept their names
+		if keys, ok := s.storage.(storage.APIKeyStorage); ok {
+			s.keys = auth.NewAPIKeys(keys).SetInstances(s.clients)
+		}
+	}
+
+	s.notifications = notifications.NewDispatcher()
+
+	if s.storage != nil {
+		s.notifications.Handle("", notifications.StorageHandler(s.storage))
+	}
+
+	policy := queue.DefaultPolicy
+	if s.settings.QueueMaxAttempts > 0 {
+		policy.MaxAttempts = s.settings.QueueMaxAttempts
+	}
+
+	s.queue = queue.New(s.clients).
+		SetPolicy(policy).
+		SetStorage(s.storage)
+
+	// jobs survive restarts when the storage can keep them
+	if jobs, ok := s.storage.(storage.JobStorage); ok {
+		s.queue.SetJobStorage(jobs)
+	}
+
+	// scheduled messages are kept in the database only
+	if scheduled, ok := s.storage.(storage.ScheduledStorage); ok {
+		s.scheduler = scheduler.New(scheduled, s.queue)
+	}
+
+	if campaigns, ok := s.storage.(storage.CampaignStorage); ok {
+		s.campaigns = campaign.New(campaigns, s.queue)
+	}
+
+	if tpl, ok := s.storage.(storage.TemplateStorage); ok {
+		s.templates = templates.New(tpl)
+	}
+
 	r := router.NewMux().
+		SetClients(s.clients).
+		SetSecret(s.settings.Secret).
+		SetPrivateKey(s.settings.ServerKey).
+		SetStorage(s.storage).
+		SetNotifications(s.notifications).
+		SetQueue(s.queue).
+		SetLimiter(s.limiter).
+		SetScheduler(s.scheduler).
+		SetCampaigns(s.campaigns).
+		SetTemplates(s.templates).
+		SetRegistry(s.registry).
+		SetAuth(s.users, s.sessions).
+		SetAPIKeys(s.keys).
+		SetWebhookToken(s.settings.WebhookToken).
+		SetMaxUploadSize(s.settings.MaxUploadSize).
 		SetMiddlewares().
 		SetHandlers()
 
@@ -128,6 +378,9 @@ func (s *Server) Init(
 		setHTTPServer(httpserver.NewHTTPServer().
 			SetHost(s.settings.Host).
 			SetPort(s.settings.Port).
+			SetProtocol(s.settings.Protocol).
+			SetCertificates(s.settings.ServerCrt, s.settings.ServerKey).
+			SetRedirectPort(s.settings.RedirectPort).
 			SetRouter(r))
 
 	if s.http == nil {
@@ -142,17 +395,38 @@ func (s *Server) Init(
 		if s.http.GetRouter() == nil {
 			return NewError(errors.New("http server router is missing"))
 		}
+
+		if s.http.IsTLS() {
+			if _, err := s.http.TLSConfig(); err != nil {
+				return NewError(err)
+			}
+		}
 	}
 
 	return nil
 }
 
+// sealer creates the sealer of stored credentials, it is refused with a public secret.
+func (s *Server) sealer() (*encryption.Sealer, error) {
+	if err := s.settings.CheckSecret(); err != nil {
+		return nil, err
+	}
+
+	return encryption.NewSealer(s.settings.Secret, s.settings.PreviousSecrets...)
+}
+
 // SetSettings sets the server configuration.
 func (s *Server) SetSettings(settings *config.Config) *Server {
 	s.settings = settings
 	return s
 }
 
+// SetStorage sets the storage. It is optional, messages are not persisted without it.
+func (s *Server) SetStorage(store storage.Storage) *Server {
+	s.storage = store
+	return s
+}
+
 // SetSignal sets the signal channel for handling OS signals.
 func (s *Server) SetSignal(sgnl chan os.Signal) *Server {
 	s.signal = sgnl
@@ -175,6 +449,57 @@ func (s *Server) GetSettings() *config.Config {
 	return s.settings
 }
 
+// GetStorage retrieves the server storage, it is nil when database is not configured.
+func (s *Server) GetStorage() storage.Storage {
+	return s.storage
+}
+
+// GetNotifications retrieves the dispatcher of incoming notifications to register handlers.
+// It is created by Init.
+func (s *Server) GetNotifications() *notifications.Dispatcher {
+	return s.notifications
+}
+
+// GetLimiter retrieves the rate limiter of sending methods. It is created by Init.
+func (s *Server) GetLimiter() *ratelimit.Limiter {
+	return s.limiter
+}
+
+// GetScheduler retrieves the scheduler of messages sent later. It is nil without a database.
+func (s *Server) GetScheduler() *scheduler.Scheduler {
+	return s.scheduler
+}
+
+// GetCampaigns retrieves the manager of bulk campaigns. It is nil without a database.
+func (s *Server) GetCampaigns() *campaign.Manager {
+	return s.campaigns
+}
+
+// GetTemplates retrieves the manager of message templates. It is nil without a database.
+func (s *Server) GetTemplates() *templates.Manager {
+	return s.templates
+}
+
+// GetRegistry retrieves the registry of instances. It is nil without a database or a secret.
+func (s *Server) GetRegistry() *instances.Registry {
+	return s.registry
+}
+
+// GetUsers retrieves accounts of the web interface. It is nil without a database.
+func (s *Server) GetUsers() *auth.Users {
+	return s.users
+}
+
+// GetAPIKeys retrieves API keys of machine clients. It is nil without a database.
+func (s *Server) GetAPIKeys() *auth.APIKeys {
+	return s.keys
+}
+
+// GetQueue retrieves the outbound message queue. It is created by Init.
+func (s *Server) GetQueue() *queue.Queue {
+	return s.queue
+}
+
 // GetSignal retrieves the signal channel used by the server.
 func (s *Server) GetSignal() chan os.Signal {
 	return s.signal
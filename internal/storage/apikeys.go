@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKeyStorage persists API keys of machine clients.
+type APIKeyStorage interface {
+	SaveAPIKey(ctx context.Context, k *APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) error
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+// APIKey is an API key found by its public prefix. Hash is SHA-256 of the whole key, it is never serialized.
+// Empty Instances allow every instance.
+type APIKey struct {
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time     `db:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time     `db:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time     `db:"revoked_at" json:"revoked_at,omitempty"`
+	ID         string         `db:"id" json:"id"`
+	Prefix     string         `db:"prefix" json:"prefix"`
+	Name       string         `db:"name" json:"name"`
+	Hash       string         `db:"key_hash" json:"-"`
+	CreatedBy  string         `db:"created_by" json:"created_by"`
+	Scopes     pq.StringArray `db:"scopes" json:"scopes"`
+	Instances  pq.StringArray `db:"instances" json:"instances"`
+}
+
+const apiKeyColumns = `id, prefix, name, key_hash, scopes, instances, created_by, created_at, expires_at, last_used_at,
+	revoked_at`
+
+// SaveAPIKey inserts a new key, ErrDuplicate is returned when its prefix is taken.
+func (s *Postgres) SaveAPIKey(ctx context.Context, k *APIKey) error {
+	query := `INSERT INTO api_keys (id, prefix, name, key_hash, scopes, instances, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT DO NOTHING`
+
+	res, err := s.db.ExecContext(ctx, query,
+		k.ID, k.Prefix, k.Name, k.Hash, k.Scopes, k.Instances, k.CreatedBy, k.CreatedAt, k.ExpiresAt)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrDuplicate
+	}
+
+	return nil
+}
+
+// GetAPIKeyByPrefix returns the key by its prefix, revoked keys included.
+func (s *Postgres) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	var k APIKey
+
+	err := s.db.GetContext(ctx, &k, `SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return &k, nil
+}
+
+// ListAPIKeys returns keys, the latest first.
+func (s *Postgres) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	keys := []APIKey{}
+
+	if err := s.db.SelectContext(ctx, &keys, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC`); err != nil {
+		return nil, NewError(err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey marks the key revoked, ErrNotFound is returned for unknown or already revoked id.
+func (s *Postgres) RevokeAPIKey(ctx context.Context, id string, at time.Time) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`, at, id)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// TouchAPIKey records the last use of the key.
+func (s *Postgres) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, at, id)
+	return NewError(err)
+}
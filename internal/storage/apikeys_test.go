@@ -0,0 +1,112 @@
+package storage_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var apiKeyColumns = []string{"id", "prefix", "name", "key_hash", "scopes", "instances", "created_by", "created_at",
+	"expires_at", "last_used_at", "revoked_at"}
+
+func testAPIKey(now time.Time) *storage.APIKey {
+	return &storage.APIKey{
+		ID:        "k1",
+		Prefix:    "0a1b2c3d4e5f",
+		Name:      "billing",
+		Hash:      "hash",
+		Scopes:    pq.StringArray{"send", "read"},
+		Instances: pq.StringArray{"1101000001"},
+		CreatedBy: "anna",
+		CreatedAt: now,
+		ExpiresAt: &now,
+	}
+}
+
+func TestPostgres_SaveAPIKey(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	k := testAPIKey(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO api_keys")).
+		WithArgs(k.ID, k.Prefix, k.Name, k.Hash, k.Scopes, k.Instances, k.CreatedBy, now, k.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveAPIKey(context.Background(), k))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO api_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.SaveAPIKey(context.Background(), k), storage.ErrDuplicate)
+}
+
+func TestPostgres_GetAPIKeyByPrefix(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	k := testAPIKey(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM api_keys WHERE prefix = $1")).
+		WithArgs(k.Prefix).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(k.ID, k.Prefix, k.Name, k.Hash, "{send,read}", "{1101000001}", k.CreatedBy, now, now, nil, nil))
+
+	got, err := s.GetAPIKeyByPrefix(context.Background(), k.Prefix)
+	require.NoError(t, err)
+	assert.Equal(t, k, got)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM api_keys WHERE prefix = $1")).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+
+	_, err = s.GetAPIKeyByPrefix(context.Background(), "unknown")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgres_ListAPIKeys(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	k := testAPIKey(now)
+	k.ExpiresAt = nil
+	k.LastUsedAt = &now
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM api_keys ORDER BY created_at DESC")).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(k.ID, k.Prefix, k.Name, k.Hash, "{send,read}", "{1101000001}", k.CreatedBy, now, nil, now, nil))
+
+	keys, err := s.ListAPIKeys(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []storage.APIKey{*k}, keys)
+}
+
+func TestPostgres_RevokeAPIKey(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL")).
+		WithArgs(now, "k1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.RevokeAPIKey(context.Background(), "k1", now))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET revoked_at = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.RevokeAPIKey(context.Background(), "k1", now), storage.ErrNotFound)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET last_used_at = $1 WHERE id = $2")).
+		WithArgs(now, "k1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.TouchAPIKey(context.Background(), "k1", now))
+}
@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Statuses of campaigns. A draft is launched once and then runs until every recipient is done,
+// it can be paused and resumed or cancelled meanwhile.
+const (
+	CampaignDraft     = "draft"
+	CampaignRunning   = "running"
+	CampaignPaused    = "paused"
+	CampaignCompleted = "completed"
+	CampaignCancelled = "cancelled"
+)
+
+// Statuses of campaign recipients. Skipped recipients are rows of the file which can not be sent to,
+// cancelled ones were pending when the campaign was cancelled.
+const (
+	RecipientPending   = "pending"
+	RecipientQueued    = "queued"
+	RecipientSent      = "sent"
+	RecipientFailed    = "failed"
+	RecipientSkipped   = "skipped"
+	RecipientCancelled = "cancelled"
+)
+
+// CampaignStorage persists bulk campaigns and their recipients.
+type CampaignStorage interface {
+	SaveCampaign(ctx context.Context, c *Campaign, recipients []Recipient) error
+	UpdateCampaign(ctx context.Context, c *Campaign, status string) error
+	GetCampaign(ctx context.Context, id string) (*Campaign, error)
+	ListCampaigns(ctx context.Context, idInstance string, limit int) ([]Campaign, error)
+	ActiveCampaigns(ctx context.Context) ([]Campaign, error)
+	CampaignProgress(ctx context.Context, id string) (map[string]int, error)
+	CampaignRecipients(ctx context.Context, id, status string, limit int) ([]Recipient, error)
+	UpdateRecipient(ctx context.Context, r *Recipient, status string) error
+	CancelRecipients(ctx context.Context, id string, now time.Time) error
+}
+
+// Campaign sends a message rendered from Template to every recipient of an uploaded file.
+// Progress counts recipients by status.
+type Campaign struct {
+	CreatedAt  time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time      `db:"updated_at" json:"updated_at"`
+	Progress   map[string]int `db:"-" json:"progress,omitempty"`
+	ID         string         `db:"id" json:"id"`
+	IDInstance string         `db:"id_instance" json:"id_instance"`
+	Name       string         `db:"name" json:"name"`
+	Template   string         `db:"template" json:"template"`
+	Status     string         `db:"status" json:"status"`
+	Total      int            `db:"total" json:"total"`
+}
+
+// Recipient is a row of the campaign file. Line is its line in the file, Fields are merge fields
+// of the template by column names. With a sealer Fields are saved encrypted in SealedFields.
+type Recipient struct {
+	UpdatedAt    time.Time       `db:"updated_at" json:"updated_at"`
+	CampaignID   string          `db:"campaign_id" json:"-"`
+	Phone        string          `db:"phone" json:"phone"`
+	ChatID       string          `db:"chat_id" json:"chat_id"`
+	Status       string          `db:"status" json:"status"`
+	IDJob        string          `db:"id_job" json:"id_job,omitempty"`
+	IDMessage    string          `db:"id_message" json:"id_message,omitempty"`
+	Error        string          `db:"error" json:"error,omitempty"`
+	Fields       json.RawMessage `db:"fields" json:"fields"`
+	SealedFields []byte          `db:"sealed_fields" json:"-"`
+	Line         int             `db:"line" json:"line"`
+}
+
+// SealingData is the additional data the fields are sealed with, fields copied to another row don't open.
+func (r *Recipient) SealingData() []byte {
+	return []byte(r.CampaignID + "/" + strconv.Itoa(r.Line))
+}
+
+const campaignColumns = `id, id_instance, name, template, status, total, created_at, updated_at`
+
+const recipientColumns = `campaign_id, line, phone, chat_id, fields, sealed_fields, status, id_job, id_message, error,
+	updated_at`
+
+// SaveCampaign inserts the campaign with its recipients in a transaction. Fields of recipients are sealed
+// when the storage has a sealer.
+func (s *Postgres) SaveCampaign(ctx context.Context, c *Campaign, recipients []Recipient) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return NewError(err)
+	}
+
+	defer func() {
+		if e := tx.Rollback(); e != nil {
+			return
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO campaigns (`+campaignColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		c.ID, c.IDInstance, c.Name, c.Template, c.Status, c.Total, c.CreatedAt, c.UpdatedAt)
+	if err != nil {
+		return NewError(err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO campaign_recipients (`+recipientColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`)
+	if err != nil {
+		return NewError(err)
+	}
+
+	defer func() {
+		if e := stmt.Close(); e != nil {
+			return
+		}
+	}()
+
+	for i := range recipients {
+		r := recipients[i]
+		r.CampaignID = c.ID
+
+		fields, sealed, err := s.sealPayload(r.Fields, r.SealingData())
+		if err != nil {
+			return err
+		}
+
+		_, err = stmt.ExecContext(ctx, c.ID, r.Line, r.Phone, r.ChatID, fields, sealed, r.Status,
+			r.IDJob, r.IDMessage, r.Error, r.UpdatedAt)
+		if err != nil {
+			return NewError(err)
+		}
+	}
+
+	return NewError(tx.Commit())
+}
+
+// UpdateCampaign saves the campaign only while it has the status. ErrNotFound is returned otherwise.
+func (s *Postgres) UpdateCampaign(ctx context.Context, c *Campaign, status string) error {
+	query := `UPDATE campaigns SET name = $1, template = $2, status = $3, updated_at = $4
+		WHERE id = $5 AND status = $6`
+
+	res, err := s.db.ExecContext(ctx, query, c.Name, c.Template, c.Status, c.UpdatedAt, c.ID, status)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetCampaign returns the campaign by id without progress.
+func (s *Postgres) GetCampaign(ctx context.Context, id string) (*Campaign, error) {
+	var c Campaign
+
+	err := s.db.GetContext(ctx, &c, `SELECT `+campaignColumns+` FROM campaigns WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return &c, nil
+}
+
+// ListCampaigns returns the latest campaigns, empty idInstance matches any.
+func (s *Postgres) ListCampaigns(ctx context.Context, idInstance string, limit int) ([]Campaign, error) {
+	query := `SELECT ` + campaignColumns + ` FROM campaigns
+		WHERE ($1 = '' OR id_instance = $1) ORDER BY created_at DESC LIMIT $2`
+
+	campaigns := []Campaign{}
+	if err := s.db.SelectContext(ctx, &campaigns, query, idInstance, limit); err != nil {
+		return nil, NewError(err)
+	}
+
+	return campaigns, nil
+}
+
+// ActiveCampaigns returns running campaigns and the ones still waiting for queued messages.
+func (s *Postgres) ActiveCampaigns(ctx context.Context) ([]Campaign, error) {
+	query := `SELECT ` + campaignColumns + ` FROM campaigns c
+		WHERE status = $1 OR EXISTS (
+			SELECT 1 FROM campaign_recipients r WHERE r.campaign_id = c.id AND r.status = $2
+		) ORDER BY created_at`
+
+	campaigns := []Campaign{}
+	if err := s.db.SelectContext(ctx, &campaigns, query, CampaignRunning, RecipientQueued); err != nil {
+		return nil, NewError(err)
+	}
+
+	return campaigns, nil
+}
+
+// CampaignProgress counts recipients of the campaign by status.
+func (s *Postgres) CampaignProgress(ctx context.Context, id string) (map[string]int, error) {
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+
+	query := `SELECT status, count(*) AS count FROM campaign_recipients WHERE campaign_id = $1 GROUP BY status`
+	if err := s.db.SelectContext(ctx, &rows, query, id); err != nil {
+		return nil, NewError(err)
+	}
+
+	progress := make(map[string]int, len(rows))
+	for _, row := range rows {
+		progress[row.Status] = row.Count
+	}
+
+	return progress, nil
+}
+
+// CampaignRecipients returns recipients in order of the file. Empty status matches any, limit 0 returns all.
+func (s *Postgres) CampaignRecipients(ctx context.Context, id, status string, limit int) ([]Recipient, error) {
+	query := `SELECT ` + recipientColumns + ` FROM campaign_recipients
+		WHERE campaign_id = $1 AND ($2 = '' OR status = $2) ORDER BY line LIMIT NULLIF($3, 0)`
+
+	recipients := []Recipient{}
+	if err := s.db.SelectContext(ctx, &recipients, query, id, status, limit); err != nil {
+		return nil, NewError(err)
+	}
+
+	for i := range recipients {
+		r := &recipients[i]
+
+		fields, err := s.openPayload(r.Fields, r.SealedFields, r.SealingData())
+		if err != nil {
+			return nil, err
+		}
+
+		r.Fields = fields
+	}
+
+	return recipients, nil
+}
+
+// UpdateRecipient saves state of the recipient only while it has the status, so a recipient
+// claimed by another runner is not sent twice. ErrNotFound is returned otherwise.
+func (s *Postgres) UpdateRecipient(ctx context.Context, r *Recipient, status string) error {
+	query := `UPDATE campaign_recipients SET status = $1, id_job = $2, id_message = $3, error = $4, updated_at = $5
+		WHERE campaign_id = $6 AND line = $7 AND status = $8`
+
+	res, err := s.db.ExecContext(ctx, query,
+		r.Status, r.IDJob, r.IDMessage, r.Error, r.UpdatedAt, r.CampaignID, r.Line, status)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CancelRecipients cancels pending recipients of the campaign, queued ones are still sent.
+func (s *Postgres) CancelRecipients(ctx context.Context, id string, now time.Time) error {
+	query := `UPDATE campaign_recipients SET status = $1, updated_at = $2 WHERE campaign_id = $3 AND status = $4`
+
+	_, err := s.db.ExecContext(ctx, query, RecipientCancelled, now, id, RecipientPending)
+
+	return NewError(err)
+}
+
+// ListRecipientsAfter returns up to limit recipients of every campaign after the given line of the campaign,
+// by campaign and line. Fields are returned as saved, sealed ones are not opened.
+func (s *Postgres) ListRecipientsAfter(ctx context.Context, campaignID string, line, limit int) ([]Recipient, error) {
+	query := `SELECT ` + recipientColumns + ` FROM campaign_recipients
+		WHERE (campaign_id, line) > ($1, $2) ORDER BY campaign_id, line LIMIT $3`
+
+	recipients := []Recipient{}
+	if err := s.db.SelectContext(ctx, &recipients, query, campaignID, line, limit); err != nil {
+		return nil, NewError(err)
+	}
+
+	return recipients, nil
+}
+
+// UpdateRecipientFields replaces the sealed fields of the recipient if they are still the ones read,
+// the plaintext is cleared. ErrNotFound is returned when they are changed meanwhile.
+func (s *Postgres) UpdateRecipientFields(ctx context.Context, r *Recipient, sealed []byte) error {
+	query := `UPDATE campaign_recipients SET fields = 'null', sealed_fields = $1
+		WHERE campaign_id = $2 AND line = $3 AND sealed_fields = $4`
+
+	res, err := s.db.ExecContext(ctx, query, sealed, r.CampaignID, r.Line, r.SealedFields)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var campaignColumns = []string{"id", "id_instance", "name", "template", "status", "total", "created_at", "updated_at"}
+
+var recipientColumns = []string{"campaign_id", "line", "phone", "chat_id", "fields", "status", "id_job", "id_message",
+	"error", "updated_at"}
+
+func testCampaign(now time.Time) *storage.Campaign {
+	return &storage.Campaign{
+		ID:         "c1",
+		IDInstance: "1101000001",
+		Name:       "orders",
+		Template:   "Hello {{.name}}",
+		Status:     storage.CampaignDraft,
+		Total:      1,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+func testRecipient(now time.Time) storage.Recipient {
+	return storage.Recipient{
+		CampaignID: "c1",
+		Line:       2,
+		Phone:      "79991234567",
+		ChatID:     "79991234567@c.us",
+		Fields:     json.RawMessage(`{"name":"Anna","phone":"79991234567"}`),
+		Status:     storage.RecipientPending,
+		UpdatedAt:  now,
+	}
+}
+
+func TestPostgres_SaveCampaign(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	c := testCampaign(now)
+	r := testRecipient(now)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO campaigns")).
+		WithArgs(c.ID, c.IDInstance, c.Name, c.Template, c.Status, 1, now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO campaign_recipients")).
+		ExpectExec().
+		WithArgs(c.ID, 2, r.Phone, r.ChatID, []byte(r.Fields), []byte(nil), storage.RecipientPending, "", "", "", now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, s.SaveCampaign(context.Background(), c, []storage.Recipient{r}))
+
+	// nothing is saved when a recipient fails
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO campaigns")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO campaign_recipients")).
+		ExpectExec().
+		WillReturnError(errors.New("duplicate key"))
+	mock.ExpectRollback()
+
+	require.Error(t, s.SaveCampaign(context.Background(), c, []storage.Recipient{r}))
+}
+
+func TestPostgres_UpdateCampaign(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	c := testCampaign(now)
+	c.Status = storage.CampaignRunning
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE campaigns SET name = $1")).
+		WithArgs(c.Name, c.Template, storage.CampaignRunning, now, c.ID, storage.CampaignDraft).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateCampaign(context.Background(), c, storage.CampaignDraft))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE campaigns SET name = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateCampaign(context.Background(), c, storage.CampaignDraft), storage.ErrNotFound)
+}
+
+func TestPostgres_GetCampaign(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	c := testCampaign(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM campaigns WHERE id = $1")).
+		WithArgs(c.ID).
+		WillReturnRows(sqlmock.NewRows(campaignColumns).
+			AddRow(c.ID, c.IDInstance, c.Name, c.Template, c.Status, c.Total, now, now))
+
+	got, err := s.GetCampaign(context.Background(), c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM campaigns WHERE id = $1")).
+		WillReturnRows(sqlmock.NewRows(campaignColumns))
+
+	_, err = s.GetCampaign(context.Background(), "unknown")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgres_ListCampaigns(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM campaigns")).
+		WithArgs("1101000001", 10).
+		WillReturnRows(sqlmock.NewRows(campaignColumns))
+
+	campaigns, err := s.ListCampaigns(context.Background(), "1101000001", 10)
+	require.NoError(t, err)
+	assert.Empty(t, campaigns)
+}
+
+func TestPostgres_ActiveCampaigns(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	c := testCampaign(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE status = $1 OR EXISTS")).
+		WithArgs(storage.CampaignRunning, storage.RecipientQueued).
+		WillReturnRows(sqlmock.NewRows(campaignColumns).
+			AddRow(c.ID, c.IDInstance, c.Name, c.Template, storage.CampaignRunning, c.Total, now, now))
+
+	campaigns, err := s.ActiveCampaigns(context.Background())
+	require.NoError(t, err)
+	require.Len(t, campaigns, 1)
+	assert.Equal(t, storage.CampaignRunning, campaigns[0].Status)
+}
+
+func TestPostgres_CampaignProgress(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("GROUP BY status")).
+		WithArgs("c1").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "count"}).
+			AddRow(storage.RecipientSent, 10).
+			AddRow(storage.RecipientFailed, 2))
+
+	progress, err := s.CampaignProgress(context.Background(), "c1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{storage.RecipientSent: 10, storage.RecipientFailed: 2}, progress)
+}
+
+func TestPostgres_CampaignRecipients(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	r := testRecipient(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM campaign_recipients")).
+		WithArgs("c1", storage.RecipientPending, 5).
+		WillReturnRows(sqlmock.NewRows(recipientColumns).AddRow(r.CampaignID, r.Line, r.Phone, r.ChatID,
+			[]byte(r.Fields), r.Status, "", "", "", now))
+
+	recipients, err := s.CampaignRecipients(context.Background(), "c1", storage.RecipientPending, 5)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Recipient{r}, recipients)
+}
+
+func TestPostgres_UpdateRecipient(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	r := testRecipient(now)
+	r.Status = storage.RecipientQueued
+	r.IDJob = "a1"
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE campaign_recipients SET status = $1")).
+		WithArgs(storage.RecipientQueued, "a1", "", "", now, "c1", 2, storage.RecipientPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateRecipient(context.Background(), &r, storage.RecipientPending))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE campaign_recipients SET status = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateRecipient(context.Background(), &r, storage.RecipientPending), storage.ErrNotFound,
+		"claimed by another runner")
+}
+
+func TestPostgres_CancelRecipients(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE campaign_recipients SET status = $1, updated_at = $2")).
+		WithArgs(storage.RecipientCancelled, now, "c1", storage.RecipientPending).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	require.NoError(t, s.CancelRecipients(context.Background(), "c1", now))
+}
+
+func TestPostgres_Recipients_Sealed(t *testing.T) {
+	s, mock := newMock(t)
+	s.SetSealer(reverseSealer{})
+
+	now := time.Now()
+	r := testRecipient(now)
+	sealed, err := reverseSealer{}.Seal(r.Fields, r.SealingData())
+	require.NoError(t, err)
+
+	columns := []string{"campaign_id", "line", "fields", "sealed_fields"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM campaign_recipients")).
+		WithArgs("c1", "", 0).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("c1", 2, []byte("null"), sealed))
+
+	recipients, err := s.CampaignRecipients(context.Background(), "c1", "", 0)
+	require.NoError(t, err)
+	require.Len(t, recipients, 1)
+	assert.JSONEq(t, string(r.Fields), string(recipients[0].Fields), "fields are opened")
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE (campaign_id, line) > ($1, $2) ORDER BY campaign_id, line LIMIT $3")).
+		WithArgs("c1", 1, 100).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("c1", 2, []byte("null"), sealed))
+
+	recipients, err = s.ListRecipientsAfter(context.Background(), "c1", 1, 100)
+	require.NoError(t, err)
+	require.Len(t, recipients, 1)
+	assert.Equal(t, sealed, recipients[0].SealedFields, "fields are not opened")
+
+	query := `UPDATE campaign_recipients SET fields = 'null', sealed_fields = $1
+		WHERE campaign_id = $2 AND line = $3 AND sealed_fields = $4`
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs([]byte("new"), "c1", 2, sealed).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateRecipientFields(context.Background(), &recipients[0], []byte("new")))
+}
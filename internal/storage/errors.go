@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNotFound = &Error{
+	err: errors.New("not found"),
+}
+
+// ErrNoSealer is returned when sealed data is read by a storage without a sealer.
+var ErrNoSealer = &Error{
+	err: errors.New("data is sealed, the storage has no sealer"),
+}
+
+// Error - custom storage error.
+type Error struct {
+	err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("[storage]: %v", e.err)
+}
+
+func NewError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{
+		err: err,
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
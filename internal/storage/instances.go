@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrDuplicate = &Error{
+	err: errors.New("already exists"),
+}
+
+// InstanceStorage persists the registry of GREEN-API instances.
+type InstanceStorage interface {
+	SaveInstance(ctx context.Context, i *Instance) error
+	UpdateInstance(ctx context.Context, i *Instance) error
+	GetInstance(ctx context.Context, key string) (*Instance, error)
+	ListInstances(ctx context.Context) ([]Instance, error)
+	ListInstancesAfter(ctx context.Context, after string, limit int) ([]Instance, error)
+	UpdateInstanceToken(ctx context.Context, name string, old, token []byte) error
+	DeleteInstance(ctx context.Context, name string) error
+}
+
+// Instance is a registered instance. Token is apiTokenInstance encrypted by the caller,
+// it is never serialized.
+type Instance struct {
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+	Name       string    `db:"name" json:"name"`
+	IDInstance string    `db:"id_instance" json:"id_instance"`
+	Token      []byte    `db:"token" json:"-"`
+}
+
+const instanceColumns = `name, id_instance, token, created_at, updated_at`
+
+// SaveInstance inserts a new instance, ErrDuplicate is returned when its name or idInstance is taken.
+func (s *Postgres) SaveInstance(ctx context.Context, i *Instance) error {
+	query := `INSERT INTO instances (name, id_instance, token, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT DO NOTHING`
+
+	res, err := s.db.ExecContext(ctx, query, i.Name, i.IDInstance, i.Token, i.CreatedAt, i.UpdatedAt)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrDuplicate
+	}
+
+	return nil
+}
+
+// UpdateInstance saves idInstance and token of the instance, ErrNotFound is returned for unknown name.
+func (s *Postgres) UpdateInstance(ctx context.Context, i *Instance) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE instances SET id_instance = $1, token = $2, updated_at = $3 WHERE name = $4`,
+		i.IDInstance, i.Token, i.UpdatedAt, i.Name)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetInstance returns the instance by name or by idInstance.
+func (s *Postgres) GetInstance(ctx context.Context, key string) (*Instance, error) {
+	var i Instance
+
+	err := s.db.GetContext(ctx, &i, `SELECT `+instanceColumns+` FROM instances WHERE name = $1 OR id_instance = $1`, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return &i, nil
+}
+
+// ListInstances returns instances by name.
+func (s *Postgres) ListInstances(ctx context.Context) ([]Instance, error) {
+	instances := []Instance{}
+
+	if err := s.db.SelectContext(ctx, &instances, `SELECT `+instanceColumns+` FROM instances ORDER BY name`); err != nil {
+		return nil, NewError(err)
+	}
+
+	return instances, nil
+}
+
+// ListInstancesAfter returns up to limit instances with names after the given one, by name.
+func (s *Postgres) ListInstancesAfter(ctx context.Context, after string, limit int) ([]Instance, error) {
+	instances := []Instance{}
+
+	err := s.db.SelectContext(ctx, &instances,
+		`SELECT `+instanceColumns+` FROM instances WHERE name > $1 ORDER BY name LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return instances, nil
+}
+
+// UpdateInstanceToken replaces the token of the instance if it is still old. ErrNotFound is returned
+// when the instance is deleted or its token is changed meanwhile.
+func (s *Postgres) UpdateInstanceToken(ctx context.Context, name string, old, token []byte) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE instances SET token = $1 WHERE name = $2 AND token = $3`, token, name, old)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteInstance deletes the instance, ErrNotFound is returned for unknown name.
+func (s *Postgres) DeleteInstance(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM instances WHERE name = $1`, name)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package storage_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var instanceColumns = []string{"name", "id_instance", "token", "created_at", "updated_at"}
+
+func testInstance(now time.Time) *storage.Instance {
+	return &storage.Instance{
+		Name:       "sales",
+		IDInstance: "1101000001",
+		Token:      []byte("sealed token"),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+func TestPostgres_SaveInstance(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	i := testInstance(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO instances")).
+		WithArgs(i.Name, i.IDInstance, i.Token, now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveInstance(context.Background(), i))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO instances")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.SaveInstance(context.Background(), i), storage.ErrDuplicate)
+}
+
+func TestPostgres_UpdateInstance(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	i := testInstance(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE instances SET id_instance = $1")).
+		WithArgs(i.IDInstance, i.Token, now, i.Name).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateInstance(context.Background(), i))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE instances SET id_instance = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateInstance(context.Background(), i), storage.ErrNotFound)
+}
+
+func TestPostgres_GetInstance(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	i := testInstance(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM instances WHERE name = $1 OR id_instance = $1")).
+		WithArgs(i.IDInstance).
+		WillReturnRows(sqlmock.NewRows(instanceColumns).AddRow(i.Name, i.IDInstance, i.Token, now, now))
+
+	got, err := s.GetInstance(context.Background(), i.IDInstance)
+	require.NoError(t, err)
+	assert.Equal(t, i, got)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM instances WHERE name = $1")).
+		WillReturnRows(sqlmock.NewRows(instanceColumns))
+
+	_, err = s.GetInstance(context.Background(), "unknown")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgres_ListInstances(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	i := testInstance(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM instances ORDER BY name")).
+		WillReturnRows(sqlmock.NewRows(instanceColumns).AddRow(i.Name, i.IDInstance, i.Token, now, now))
+
+	instances, err := s.ListInstances(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Instance{*i}, instances)
+}
+
+func TestPostgres_ListInstancesAfter(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	i := testInstance(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM instances WHERE name > $1 ORDER BY name LIMIT $2")).
+		WithArgs("marketing", 100).
+		WillReturnRows(sqlmock.NewRows(instanceColumns).AddRow(i.Name, i.IDInstance, i.Token, now, now))
+
+	instances, err := s.ListInstancesAfter(context.Background(), "marketing", 100)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Instance{*i}, instances)
+}
+
+func TestPostgres_UpdateInstanceToken(t *testing.T) {
+	s, mock := newMock(t)
+
+	old, token := []byte("old"), []byte("new")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE instances SET token = $1 WHERE name = $2 AND token = $3")).
+		WithArgs(token, "sales", old).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateInstanceToken(context.Background(), "sales", old, token))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE instances SET token = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateInstanceToken(context.Background(), "sales", old, token), storage.ErrNotFound)
+}
+
+func TestPostgres_DeleteInstance(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM instances WHERE name = $1")).
+		WithArgs("sales").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.DeleteInstance(context.Background(), "sales"))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM instances WHERE name = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.DeleteInstance(context.Background(), "sales"), storage.ErrNotFound)
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Statuses of outbound queue jobs. JobDead is the dead-letter state of jobs out of attempts
+// or failed permanently.
+const (
+	JobQueued   = "queued"
+	JobSending  = "sending"
+	JobRetrying = "retrying"
+	JobSent     = "sent"
+	JobDead     = "dead"
+)
+
+// JobStorage persists jobs of the outbound queue, so they survive a restart. Unfinished jobs are leased
+// by the queue sending them, so queues of several replicas never send the same job.
+type JobStorage interface {
+	SaveJob(ctx context.Context, j *Job) error
+	UpdateJob(ctx context.Context, j *Job) error
+	RetryJob(ctx context.Context, j *Job) error
+	GetJob(ctx context.Context, id string) (*Job, error)
+	ListJobs(ctx context.Context, idInstance, status string, limit int) ([]Job, error)
+	ClaimJobs(ctx context.Context, owner string, now, until time.Time) ([]Job, error)
+	RenewJobs(ctx context.Context, owner string, until time.Time) error
+}
+
+// Job is a message queued to be sent in background. Owner is the queue holding the lease of the job
+// until LeaseUntil. With a sealer Payload is saved encrypted in SealedPayload.
+type Job struct {
+	NextAttemptAt time.Time       `db:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time       `db:"updated_at" json:"updated_at"`
+	LeaseUntil    *time.Time      `db:"lease_until" json:"-"`
+	ID            string          `db:"id" json:"id"`
+	IDInstance    string          `db:"id_instance" json:"id_instance"`
+	Method        string          `db:"method" json:"method"`
+	ChatID        string          `db:"chat_id" json:"chat_id"`
+	Status        string          `db:"status" json:"status"`
+	IDMessage     string          `db:"id_message" json:"id_message,omitempty"`
+	Error         string          `db:"error" json:"error,omitempty"`
+	Owner         string          `db:"owner" json:"-"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	SealedPayload []byte          `db:"sealed_payload" json:"-"`
+	Attempts      int             `db:"attempts" json:"attempts"`
+	MaxAttempts   int             `db:"max_attempts" json:"max_attempts"`
+}
+
+// Finished reports whether the job is sent or dead and will not be attempted again.
+func (j *Job) Finished() bool {
+	return j.Status == JobSent || j.Status == JobDead
+}
+
+// SealingData is the additional data the payload is sealed with, a payload copied to another job doesn't open.
+func (j *Job) SealingData() []byte {
+	return []byte(j.IDInstance + "/" + j.ID)
+}
+
+const jobColumns = `id, id_instance, method, chat_id, payload, sealed_payload, status, attempts, max_attempts,
+	id_message, error, next_attempt_at, created_at, updated_at, owner, lease_until`
+
+// pendingStatuses are statuses of jobs which are not finished.
+var pendingStatuses = []any{JobQueued, JobSending, JobRetrying}
+
+// SaveJob inserts a new job, id and the lease are set by the queue. The payload is sealed when the storage
+// has a sealer.
+func (s *Postgres) SaveJob(ctx context.Context, j *Job) error {
+	query := `INSERT INTO jobs (` + jobColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`
+
+	payload, sealed, err := s.sealPayload(j.Payload, j.SealingData())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, query,
+		j.ID, j.IDInstance, j.Method, j.ChatID, payload, sealed, j.Status, j.Attempts, j.MaxAttempts,
+		j.IDMessage, j.Error, j.NextAttemptAt, j.CreatedAt, j.UpdatedAt, j.Owner, j.LeaseUntil,
+	)
+
+	return NewError(err)
+}
+
+// UpdateJob saves state of the job after an attempt while its owner holds it. ErrNotFound is returned
+// for unknown jobs and jobs claimed by another queue meanwhile.
+func (s *Postgres) UpdateJob(ctx context.Context, j *Job) error {
+	query := `UPDATE jobs SET status = $1, attempts = $2, max_attempts = $3, id_message = $4, error = $5,
+		next_attempt_at = $6, updated_at = $7 WHERE id = $8 AND owner = $9`
+
+	res, err := s.db.ExecContext(ctx, query,
+		j.Status, j.Attempts, j.MaxAttempts, j.IDMessage, j.Error, j.NextAttemptAt, j.UpdatedAt, j.ID, j.Owner)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RetryJob saves the job queued again with its owner only while it is dead, so concurrent retries
+// queue it once. ErrNotFound is returned otherwise.
+func (s *Postgres) RetryJob(ctx context.Context, j *Job) error {
+	query := `UPDATE jobs SET status = $1, attempts = $2, max_attempts = $3, error = $4, next_attempt_at = $5,
+		updated_at = $6, owner = $7, lease_until = $8 WHERE id = $9 AND status = $10`
+
+	res, err := s.db.ExecContext(ctx, query,
+		j.Status, j.Attempts, j.MaxAttempts, j.Error, j.NextAttemptAt, j.UpdatedAt, j.Owner, j.LeaseUntil, j.ID, JobDead)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetJob returns the job by id.
+func (s *Postgres) GetJob(ctx context.Context, id string) (*Job, error) {
+	var j Job
+
+	err := s.db.GetContext(ctx, &j, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	if err := s.openJob(&j); err != nil {
+		return nil, err
+	}
+
+	return &j, nil
+}
+
+// ListJobs returns the latest jobs, empty idInstance and status match any.
+func (s *Postgres) ListJobs(ctx context.Context, idInstance, status string, limit int) ([]Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE ($1 = '' OR id_instance = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC LIMIT $3`
+
+	jobs := []Job{}
+	if err := s.db.SelectContext(ctx, &jobs, query, idInstance, status, limit); err != nil {
+		return nil, NewError(err)
+	}
+
+	if err := s.openJobs(jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// ClaimJobs leases unfinished jobs without a valid lease to the owner until the time and returns them
+// in order they were queued. Jobs of a queue which stopped renewing its leases are claimed too.
+func (s *Postgres) ClaimJobs(ctx context.Context, owner string, now, until time.Time) ([]Job, error) {
+	query := `UPDATE jobs SET owner = $1, lease_until = $2
+		WHERE status IN ($3, $4, $5) AND (lease_until IS NULL OR lease_until < $6)
+		RETURNING ` + jobColumns
+
+	args := append([]any{owner, until}, pendingStatuses...)
+
+	jobs := []Job{}
+	if err := s.db.SelectContext(ctx, &jobs, query, append(args, now)...); err != nil {
+		return nil, NewError(err)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	if err := s.openJobs(jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// RenewJobs extends leases of unfinished jobs of the owner until the time.
+func (s *Postgres) RenewJobs(ctx context.Context, owner string, until time.Time) error {
+	query := `UPDATE jobs SET lease_until = $1 WHERE owner = $2 AND status IN ($3, $4, $5)`
+
+	_, err := s.db.ExecContext(ctx, query, append([]any{until, owner}, pendingStatuses...)...)
+
+	return NewError(err)
+}
+
+// ListJobsAfter returns up to limit jobs with ids after the given one, by id. Payloads are returned as saved,
+// sealed ones are not opened.
+func (s *Postgres) ListJobsAfter(ctx context.Context, after string, limit int) ([]Job, error) {
+	jobs := []Job{}
+
+	err := s.db.SelectContext(ctx, &jobs, `SELECT `+jobColumns+` FROM jobs WHERE id > $1 ORDER BY id LIMIT $2`,
+		after, limit)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return jobs, nil
+}
+
+// UpdateJobPayload replaces the sealed payload of the job if it is still old, empty old is a payload saved
+// in plaintext, the plaintext is cleared. ErrNotFound is returned when it is changed meanwhile.
+func (s *Postgres) UpdateJobPayload(ctx context.Context, id string, old, sealed []byte) error {
+	query := `UPDATE jobs SET payload = 'null', sealed_payload = $1 WHERE id = $2 AND sealed_payload = $3`
+
+	res, err := s.db.ExecContext(ctx, query, sealed, id, old)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// openJob decrypts the sealed payload of the job read from the database.
+func (s *Postgres) openJob(j *Job) error {
+	payload, err := s.openPayload(j.Payload, j.SealedPayload, j.SealingData())
+	if err != nil {
+		return err
+	}
+
+	j.Payload = payload
+
+	return nil
+}
+
+func (s *Postgres) openJobs(jobs []Job) error {
+	for i := range jobs {
+		if err := s.openJob(&jobs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var jobColumns = []string{"id", "id_instance", "method", "chat_id", "payload", "status", "attempts", "max_attempts",
+	"id_message", "error", "next_attempt_at", "created_at", "updated_at", "owner", "lease_until"}
+
+func testJob(now time.Time) *storage.Job {
+	return &storage.Job{
+		ID:            "a1",
+		IDInstance:    "1101000001",
+		Method:        "sendMessage",
+		ChatID:        "79876543210@c.us",
+		Payload:       json.RawMessage(`{"chatId":"79876543210@c.us","message":"hello"}`),
+		Status:        storage.JobQueued,
+		MaxAttempts:   5,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Owner:         "q1",
+		LeaseUntil:    &now,
+	}
+}
+
+func TestPostgres_SaveJob(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	j := testJob(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO jobs")).
+		WithArgs(j.ID, j.IDInstance, j.Method, j.ChatID, []byte(j.Payload), []byte(nil), j.Status, 0, 5, "", "",
+			now, now, now, "q1", &now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveJob(context.Background(), j))
+}
+
+func TestPostgres_UpdateJob(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	j := testJob(now)
+	j.Status = storage.JobSent
+	j.Attempts = 1
+	j.IDMessage = "3EB0C767D097B7C7C030"
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE jobs SET status = $1")).
+		WithArgs(storage.JobSent, 1, 5, j.IDMessage, "", now, now, j.ID, "q1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateJob(context.Background(), j))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE jobs SET status = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateJob(context.Background(), j), storage.ErrNotFound)
+}
+
+func TestPostgres_GetJob(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	j := testJob(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM jobs WHERE id = $1")).
+		WithArgs(j.ID).
+		WillReturnRows(sqlmock.NewRows(jobColumns).AddRow(j.ID, j.IDInstance, j.Method, j.ChatID, []byte(j.Payload),
+			j.Status, 0, 5, "", "", now, now, now, "q1", now))
+
+	got, err := s.GetJob(context.Background(), j.ID)
+	require.NoError(t, err)
+	assert.Equal(t, j, got)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM jobs WHERE id = $1")).
+		WillReturnRows(sqlmock.NewRows(jobColumns))
+
+	_, err = s.GetJob(context.Background(), "unknown")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgres_ListJobs(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	j := testJob(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM jobs")).
+		WithArgs("1101000001", storage.JobDead, 10).
+		WillReturnRows(sqlmock.NewRows(jobColumns).AddRow(j.ID, j.IDInstance, j.Method, j.ChatID, []byte(j.Payload),
+			storage.JobDead, 5, 5, "", "unexpected status 500", now, now, now, "q1", nil))
+
+	jobs, err := s.ListJobs(context.Background(), "1101000001", storage.JobDead, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, storage.JobDead, jobs[0].Status)
+	assert.True(t, jobs[0].Finished())
+}
+
+func TestPostgres_RetryJob(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	j := testJob(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE jobs SET status = $1")).
+		WithArgs(storage.JobQueued, 0, 5, "", now, now, "q1", &now, j.ID, storage.JobDead).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.RetryJob(context.Background(), j))
+
+	mock.ExpectExec(regexp.QuoteMeta("WHERE id = $9 AND status = $10")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.RetryJob(context.Background(), j), storage.ErrNotFound, "retried meanwhile")
+}
+
+func TestPostgres_ClaimJobs(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	until := now.Add(time.Minute)
+	j := testJob(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE jobs SET owner = $1, lease_until = $2")).
+		WithArgs("q2", until, storage.JobQueued, storage.JobSending, storage.JobRetrying, now).
+		WillReturnRows(sqlmock.NewRows(jobColumns).AddRow(j.ID, j.IDInstance, j.Method, j.ChatID, []byte(j.Payload),
+			j.Status, 0, 5, "", "", now, now, now, "q2", until))
+
+	jobs, err := s.ClaimJobs(context.Background(), "q2", now, until)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "q2", jobs[0].Owner)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE jobs SET lease_until = $1 WHERE owner = $2")).
+		WithArgs(until, "q2", storage.JobQueued, storage.JobSending, storage.JobRetrying).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.RenewJobs(context.Background(), "q2", until))
+}
+
+func TestPostgres_Job_Sealed(t *testing.T) {
+	s, mock := newMock(t)
+	s.SetSealer(reverseSealer{})
+
+	now := time.Now()
+	j := testJob(now)
+	sealed, err := reverseSealer{}.Seal(j.Payload, j.SealingData())
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO jobs")).
+		WithArgs(j.ID, j.IDInstance, j.Method, j.ChatID, []byte("null"), sealed, j.Status, 0, 5, "", "",
+			now, now, now, "q1", &now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveJob(context.Background(), j))
+
+	columns := []string{"id", "id_instance", "payload", "sealed_payload"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM jobs WHERE id = $1")).
+		WithArgs(j.ID).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(j.ID, j.IDInstance, []byte("null"), sealed))
+
+	got, err := s.GetJob(context.Background(), j.ID)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(j.Payload), string(got.Payload), "payload is opened")
+
+	s.SetSealer(nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM jobs")).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(j.ID, j.IDInstance, []byte("null"), sealed))
+
+	_, err = s.ListJobs(context.Background(), "", "", 10)
+	require.ErrorIs(t, err, storage.ErrNoSealer)
+}
+
+func TestPostgres_ListJobsAfter(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM jobs WHERE id > $1 ORDER BY id LIMIT $2")).
+		WithArgs("a1", 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "id_instance", "payload", "sealed_payload"}).
+			AddRow("a2", "1101000001", []byte("null"), []byte("sealed")))
+
+	jobs, err := s.ListJobsAfter(context.Background(), "a1", 100)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, []byte("sealed"), jobs[0].SealedPayload, "payload is not opened")
+
+	old, sealed := []byte("old"), []byte("new")
+	query := "UPDATE jobs SET payload = 'null', sealed_payload = $1 WHERE id = $2 AND sealed_payload = $3"
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs(sealed, "a2", old).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateJobPayload(context.Background(), "a2", old, sealed))
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateJobPayload(context.Background(), "a2", old, sealed), storage.ErrNotFound)
+}
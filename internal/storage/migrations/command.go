@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrUsage = errors.New("usage: migrate up|down|status")
+
+// Command runs migrate subcommand (up, down or status) and prints the result to w.
+func Command(ctx context.Context, db *sqlx.DB, args []string, w io.Writer) error {
+	if len(args) != 1 {
+		return ErrUsage
+	}
+
+	m, err := New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "applied %d migrations\n", applied)
+
+		return err
+	case "down":
+		reverted, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "reverted %04d_%s\n", reverted.Version, reverted.Name)
+
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		return printStatus(w, statuses)
+	default:
+		return ErrUsage
+	}
+}
+
+func printStatus(w io.Writer, statuses []Status) error {
+	const padding = 2
+
+	tw := tabwriter.NewWriter(w, 0, 0, padding, ' ', 0)
+
+	if _, err := fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT"); err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+
+		if _, err := fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt); err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
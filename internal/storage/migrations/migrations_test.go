@@ -0,0 +1,195 @@
+package migrations_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage/migrations"
+)
+
+var testFS = fstest.MapFS{
+	"sql/0001_create_messages.up.sql":        {Data: []byte("CREATE TABLE messages (id BIGSERIAL)")},
+	"sql/0001_create_messages.down.sql":      {Data: []byte("DROP TABLE messages")},
+	"sql/0002_create_notifications.up.sql":   {Data: []byte("CREATE TABLE notifications (id BIGSERIAL)")},
+	"sql/0002_create_notifications.down.sql": {Data: []byte("DROP TABLE notifications")},
+	"sql/README.md":                          {Data: []byte("ignored")},
+}
+
+func newMigrator(t *testing.T) (*migrations.Migrator, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	m, err := migrations.NewWithFS(sqlx.NewDb(db, "postgres"), testFS, "sql")
+	require.NoError(t, err)
+
+	return m, mock
+}
+
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock")).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestLoad(t *testing.T) {
+	list, err := migrations.Load(testFS, "sql")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	assert.Equal(t, int64(1), list[0].Version)
+	assert.Equal(t, "create_messages", list[0].Name)
+	assert.Equal(t, "DROP TABLE messages", list[0].Down)
+	assert.Equal(t, int64(2), list[1].Version)
+
+	tests := []struct {
+		fsys fstest.MapFS
+		name string
+	}{
+		{
+			name: "no up migration",
+			fsys: fstest.MapFS{"sql/0001_a.down.sql": {Data: []byte("DROP TABLE a")}},
+		},
+		{
+			name: "different names",
+			fsys: fstest.MapFS{
+				"sql/0001_a.up.sql":   {Data: []byte("CREATE TABLE a ()")},
+				"sql/0001_b.down.sql": {Data: []byte("DROP TABLE b")},
+			},
+		},
+		{
+			name: "missing dir",
+			fsys: fstest.MapFS{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrations.Load(tt.fsys, "sql")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNew_Embedded(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+
+	m, err := migrations.New(sqlx.NewDb(db, "postgres"))
+	require.NoError(t, err)
+	require.NotEmpty(t, m.Migrations())
+
+	for i, migration := range m.Migrations() {
+		assert.Equal(t, int64(i+1), migration.Version)
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	m, mock := newMigrator(t)
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, applied_at FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE notifications")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations")).
+		WithArgs(int64(2), "create_notifications").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	applied, err := m.Up(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+}
+
+func TestMigrator_Up_Rollback(t *testing.T) {
+	m, mock := newMigrator(t)
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, applied_at FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE messages")).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	applied, err := m.Up(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "0001_create_messages")
+	assert.Equal(t, 0, applied)
+}
+
+func TestMigrator_Down(t *testing.T) {
+	m, mock := newMigrator(t)
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE notifications")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations")).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	reverted, err := m.Down(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "create_notifications", reverted.Name)
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	expectUnlock(mock)
+
+	_, err = m.Down(context.Background())
+	require.ErrorIs(t, err, migrations.ErrNoMigrations)
+}
+
+func TestCommand(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, mock.ExpectationsWereMet())
+	}()
+
+	sqlxDB := sqlx.NewDb(db, "postgres")
+	appliedAt := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	expectLock(mock)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version, applied_at FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, appliedAt))
+	expectUnlock(mock)
+
+	var out bytes.Buffer
+
+	require.NoError(t, migrations.Command(context.Background(), sqlxDB, []string{"status"}, &out))
+	assert.Contains(t, out.String(), "create_messages")
+	assert.Contains(t, out.String(), "2024-10-01T12:00:00Z")
+	assert.Contains(t, out.String(), "pending")
+
+	require.ErrorIs(t, migrations.Command(context.Background(), sqlxDB, nil, &out), migrations.ErrUsage)
+	require.ErrorIs(t, migrations.Command(context.Background(), sqlxDB, []string{"sideways"}, &out), migrations.ErrUsage)
+}
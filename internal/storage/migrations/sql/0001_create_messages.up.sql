@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS messages (
+    id          BIGSERIAL PRIMARY KEY,
+    id_instance TEXT NOT NULL,
+    method      TEXT NOT NULL,
+    chat_id     TEXT NOT NULL,
+    body        TEXT NOT NULL DEFAULT '',
+    id_message  TEXT NOT NULL DEFAULT '',
+    status      TEXT NOT NULL,
+    error       TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS messages_id_message_idx ON messages (id_instance, id_message);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id           BIGSERIAL PRIMARY KEY,
+    id_instance  TEXT NOT NULL,
+    receipt_id   BIGINT NOT NULL DEFAULT 0,
+    type_webhook TEXT NOT NULL,
+    id_message   TEXT NOT NULL DEFAULT '',
+    chat_id      TEXT NOT NULL DEFAULT '',
+    payload      JSONB NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
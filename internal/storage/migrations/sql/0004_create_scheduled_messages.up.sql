@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS scheduled_messages (
+    id          TEXT PRIMARY KEY,
+    id_instance TEXT NOT NULL,
+    method      TEXT NOT NULL,
+    chat_id     TEXT NOT NULL,
+    payload     JSONB NOT NULL,
+    send_at     TIMESTAMPTZ NOT NULL,
+    timezone    TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    id_job      TEXT NOT NULL DEFAULT '',
+    error       TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_messages_due_idx ON scheduled_messages (status, send_at);
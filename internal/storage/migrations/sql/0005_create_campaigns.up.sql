@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS campaigns (
+    id          TEXT PRIMARY KEY,
+    id_instance TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    template    TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    total       INTEGER NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS campaign_recipients (
+    campaign_id TEXT NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+    line        INTEGER NOT NULL,
+    phone       TEXT NOT NULL,
+    chat_id     TEXT NOT NULL,
+    fields      JSONB NOT NULL,
+    status      TEXT NOT NULL,
+    id_job      TEXT NOT NULL DEFAULT '',
+    id_message  TEXT NOT NULL DEFAULT '',
+    error       TEXT NOT NULL DEFAULT '',
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (campaign_id, line)
+);
+
+CREATE INDEX IF NOT EXISTS campaign_recipients_status_idx ON campaign_recipients (campaign_id, status);
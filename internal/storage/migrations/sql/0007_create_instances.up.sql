@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS instances (
+    name        TEXT PRIMARY KEY,
+    id_instance TEXT NOT NULL UNIQUE,
+    token       BYTEA NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           TEXT PRIMARY KEY,
+    prefix       TEXT NOT NULL UNIQUE,
+    name         TEXT NOT NULL,
+    key_hash     TEXT NOT NULL,
+    scopes       TEXT[] NOT NULL,
+    instances    TEXT[] NOT NULL DEFAULT '{}',
+    created_by   TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id  TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    instance TEXT NOT NULL,
+    role     TEXT NOT NULL,
+    PRIMARY KEY (user_id, instance)
+);
+
+-- accounts created before roles keep using every instance
+INSERT INTO user_roles (user_id, instance, role) SELECT id, '*', 'admin' FROM users ON CONFLICT DO NOTHING;
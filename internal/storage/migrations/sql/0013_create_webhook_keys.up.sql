@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS webhook_keys (
+    key     TEXT PRIMARY KEY,
+    seen_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_keys_seen_at_idx ON webhook_keys (seen_at);
@@ -0,0 +1,4 @@
+ALTER TABLE campaign_recipients DROP COLUMN IF EXISTS sealed_fields;
+ALTER TABLE scheduled_messages DROP COLUMN IF EXISTS sealed_payload;
+ALTER TABLE jobs DROP COLUMN IF EXISTS sealed_payload;
+ALTER TABLE notifications DROP COLUMN IF EXISTS sealed_payload;
@@ -0,0 +1,4 @@
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS sealed_payload BYTEA NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS sealed_payload BYTEA NOT NULL DEFAULT '';
+ALTER TABLE scheduled_messages ADD COLUMN IF NOT EXISTS sealed_payload BYTEA NOT NULL DEFAULT '';
+ALTER TABLE campaign_recipients ADD COLUMN IF NOT EXISTS sealed_fields BYTEA NOT NULL DEFAULT '';
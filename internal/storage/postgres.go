@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq" // postgres driver
+)
+
+// Postgres is Storage over postgres database.
+type Postgres struct {
+	db     *sqlx.DB
+	sealer Sealer
+}
+
+// NewPostgres connects to the database by dsn. Schema is created by migrations.
+func NewPostgres(ctx context.Context, dsn string) (*Postgres, error) {
+	db, err := sqlx.ConnectContext(ctx, "postgres", dsn)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return NewPostgresFromDB(db), nil
+}
+
+// NewPostgresFromDB wraps existing connection.
+func NewPostgresFromDB(db *sqlx.DB) *Postgres {
+	return &Postgres{
+		db: db,
+	}
+}
+
+func (s *Postgres) DB() *sqlx.DB {
+	return s.db
+}
+
+func (s *Postgres) Ping(ctx context.Context) error {
+	return NewError(s.db.PingContext(ctx))
+}
+
+func (s *Postgres) Close() error {
+	return NewError(s.db.Close())
+}
+
+// SetSealer encrypts bodies of messages and payloads of notifications, jobs, scheduled messages
+// and campaign recipients saved afterwards, it is set before the storage is used.
+func (s *Postgres) SetSealer(sealer Sealer) {
+	s.sealer = sealer
+}
+
+// sealedNull is kept in the JSONB column of a payload saved sealed.
+var sealedNull = []byte("null")
+
+// sealPayload returns the values of the JSONB column of the payload and of its sealed copy.
+// Without a sealer the payload is saved in plaintext.
+func (s *Postgres) sealPayload(payload json.RawMessage, additionalData []byte) ([]byte, []byte, error) {
+	if s.sealer == nil || len(payload) == 0 {
+		return []byte(payload), nil, nil
+	}
+
+	sealed, err := s.sealer.Seal(payload, additionalData)
+	if err != nil {
+		return nil, nil, NewError(err)
+	}
+
+	return sealedNull, sealed, nil
+}
+
+// openPayload returns the payload read from the database, the sealed copy is decrypted when there is one.
+func (s *Postgres) openPayload(payload json.RawMessage, sealed, additionalData []byte) (json.RawMessage, error) {
+	if len(sealed) == 0 {
+		return payload, nil
+	}
+
+	if s.sealer == nil {
+		return nil, ErrNoSealer
+	}
+
+	plaintext, err := s.sealer.Open(sealed, additionalData)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return plaintext, nil
+}
+
+const messageColumns = `id, id_instance, method, chat_id, body, sealed_body, id_message, status, error,
+	created_at, updated_at`
+
+// SaveMessage inserts outgoing message and returns it with id and timestamps.
+// The body is sealed when the storage has a sealer, the returned message keeps it in plaintext too.
+func (s *Postgres) SaveMessage(ctx context.Context, m *Message) (*Message, error) {
+	query := `INSERT INTO messages (id_instance, method, chat_id, body, sealed_body, id_message, status, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at`
+
+	saved := *m
+	body := m.Body
+
+	if s.sealer != nil && m.Body != "" {
+		sealed, err := s.sealer.Seal([]byte(m.Body), m.SealingData())
+		if err != nil {
+			return nil, NewError(err)
+		}
+
+		saved.SealedBody = sealed
+		body = ""
+	}
+
+	err := s.db.QueryRowxContext(ctx, query,
+		m.IDInstance, m.Method, m.ChatID, body, saved.SealedBody, m.IDMessage, m.Status, m.Error,
+	).Scan(&saved.ID, &saved.CreatedAt, &saved.UpdatedAt)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return &saved, nil
+}
+
+// ListMessagesAfter returns up to limit messages with ids after the given one, by id.
+func (s *Postgres) ListMessagesAfter(ctx context.Context, after int64, limit int) ([]Message, error) {
+	messages := []Message{}
+
+	err := s.db.SelectContext(ctx, &messages,
+		`SELECT `+messageColumns+` FROM messages WHERE id > $1 ORDER BY id LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return messages, nil
+}
+
+// UpdateMessageBody replaces the sealed body of the message if it is still old, empty old is a body saved
+// in plaintext, the plaintext is cleared. ErrNotFound is returned when the body is changed meanwhile.
+func (s *Postgres) UpdateMessageBody(ctx context.Context, id int64, old, sealed []byte) error {
+	query := `UPDATE messages SET body = '', sealed_body = $1 WHERE id = $2 AND sealed_body = $3`
+
+	res, err := s.db.ExecContext(ctx, query, sealed, id, old)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdateMessageStatus sets status of the message found by GREEN-API idMessage.
+func (s *Postgres) UpdateMessageStatus(ctx context.Context, idInstance, idMessage, status string) error {
+	query := `UPDATE messages SET status = $1, updated_at = now() WHERE id_instance = $2 AND id_message = $3`
+
+	res, err := s.db.ExecContext(ctx, query, status, idInstance, idMessage)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SaveNotification inserts incoming notification. The payload is sealed when the storage has a sealer,
+// the returned notification keeps it in plaintext too.
+func (s *Postgres) SaveNotification(ctx context.Context, n *Notification) (*Notification, error) {
+	query := `INSERT INTO notifications (id_instance, receipt_id, type_webhook, id_message, chat_id, payload,
+			sealed_payload)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	saved := *n
+
+	payload, sealed, err := s.sealPayload(n.Payload, n.SealingData())
+	if err != nil {
+		return nil, err
+	}
+
+	saved.SealedPayload = sealed
+
+	err = s.db.QueryRowxContext(ctx, query,
+		n.IDInstance, n.ReceiptID, n.TypeWebhook, n.IDMessage, n.ChatID, payload, sealed,
+	).Scan(&saved.ID, &saved.CreatedAt)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return &saved, nil
+}
+
+// ListNotificationsAfter returns up to limit notifications with ids after the given one, by id.
+// Payloads are returned as saved, sealed ones are not opened.
+func (s *Postgres) ListNotificationsAfter(ctx context.Context, after int64, limit int) ([]Notification, error) {
+	query := `SELECT id, id_instance, receipt_id, type_webhook, id_message, chat_id, payload, sealed_payload,
+		created_at FROM notifications WHERE id > $1 ORDER BY id LIMIT $2`
+
+	list := []Notification{}
+	if err := s.db.SelectContext(ctx, &list, query, after, limit); err != nil {
+		return nil, NewError(err)
+	}
+
+	return list, nil
+}
+
+// UpdateNotificationPayload replaces the sealed payload of the notification if it is still old, empty old
+// is a payload saved in plaintext, the plaintext is cleared. ErrNotFound is returned when it is changed meanwhile.
+func (s *Postgres) UpdateNotificationPayload(ctx context.Context, id int64, old, sealed []byte) error {
+	query := `UPDATE notifications SET payload = 'null', sealed_payload = $1 WHERE id = $2 AND sealed_payload = $3`
+
+	res, err := s.db.ExecContext(ctx, query, sealed, id, old)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
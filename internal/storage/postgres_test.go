@@ -0,0 +1,276 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+func newMock(t *testing.T) (*storage.Postgres, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	return storage.NewPostgresFromDB(sqlx.NewDb(db, "postgres")), mock
+}
+
+func TestPostgres_SaveMessage(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	m := &storage.Message{
+		IDInstance: "1101000001",
+		Method:     "sendMessage",
+		ChatID:     "79876543210@c.us",
+		Body:       "hello",
+		IDMessage:  "3EB0C767D097B7C7C030",
+		Status:     storage.StatusSent,
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO messages")).
+		WithArgs(m.IDInstance, m.Method, m.ChatID, m.Body, []byte(nil), m.IDMessage, m.Status, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(1, now, now))
+
+	saved, err := s.SaveMessage(context.Background(), m)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), saved.ID)
+	assert.Equal(t, now, saved.CreatedAt)
+	assert.Equal(t, m.IDMessage, saved.IDMessage)
+	assert.Equal(t, int64(0), m.ID, "input must not be modified")
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO messages")).WillReturnError(errors.New("connection refused"))
+
+	_, err = s.SaveMessage(context.Background(), m)
+	require.Error(t, err)
+}
+
+// reverseSealer "seals" bodies by reversing them after the additional data.
+type reverseSealer struct{}
+
+func (reverseSealer) Seal(plaintext, additionalData []byte) ([]byte, error) {
+	sealed := append([]byte{}, additionalData...)
+	for i := len(plaintext) - 1; i >= 0; i-- {
+		sealed = append(sealed, plaintext[i])
+	}
+
+	return sealed, nil
+}
+
+func (reverseSealer) Open(ciphertext, additionalData []byte) ([]byte, error) {
+	if !bytes.HasPrefix(ciphertext, additionalData) {
+		return nil, errors.New("wrong additional data")
+	}
+
+	sealed := ciphertext[len(additionalData):]
+	plaintext := make([]byte, 0, len(sealed))
+
+	for i := len(sealed) - 1; i >= 0; i-- {
+		plaintext = append(plaintext, sealed[i])
+	}
+
+	return plaintext, nil
+}
+
+func TestPostgres_SaveMessage_Sealed(t *testing.T) {
+	s, mock := newMock(t)
+	s.SetSealer(reverseSealer{})
+
+	now := time.Now()
+	m := &storage.Message{
+		IDInstance: "1101000001",
+		Method:     "sendMessage",
+		ChatID:     "79876543210@c.us",
+		Body:       "hello",
+		Status:     storage.StatusSent,
+	}
+	sealed := []byte("1101000001/79876543210@c.usolleh")
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO messages")).
+		WithArgs(m.IDInstance, m.Method, m.ChatID, "", sealed, "", m.Status, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow(1, now, now))
+
+	saved, err := s.SaveMessage(context.Background(), m)
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", saved.Body, "the caller gets the plaintext")
+	assert.Equal(t, sealed, saved.SealedBody)
+	assert.Empty(t, m.SealedBody, "input must not be modified")
+}
+
+func TestPostgres_ListMessagesAfter(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	columns := []string{"id", "id_instance", "method", "chat_id", "body", "sealed_body", "id_message", "status", "error",
+		"created_at", "updated_at"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM messages WHERE id > $1 ORDER BY id LIMIT $2")).
+		WithArgs(int64(41), 100).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(42, "1101000001", "sendMessage", "79876543210@c.us", "", []byte("sealed"), "", "sent", "", now, now))
+
+	messages, err := s.ListMessagesAfter(context.Background(), 41, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Message{{
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		IDInstance: "1101000001",
+		Method:     "sendMessage",
+		ChatID:     "79876543210@c.us",
+		Status:     "sent",
+		SealedBody: []byte("sealed"),
+		ID:         42,
+	}}, messages)
+}
+
+func TestPostgres_UpdateMessageBody(t *testing.T) {
+	s, mock := newMock(t)
+
+	old, sealed := []byte("old"), []byte("new")
+
+	query := "UPDATE messages SET body = '', sealed_body = $1 WHERE id = $2 AND sealed_body = $3"
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs(sealed, int64(42), old).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateMessageBody(context.Background(), 42, old, sealed))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE messages SET body = ''")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateMessageBody(context.Background(), 42, old, sealed), storage.ErrNotFound)
+}
+
+func TestPostgres_UpdateMessageStatus(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE messages SET status = $1")).
+		WithArgs(storage.StatusDelivered, "1101000001", "3EB0C767D097B7C7C030").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateMessageStatus(context.Background(), "1101000001", "3EB0C767D097B7C7C030", storage.StatusDelivered))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE messages SET status = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := s.UpdateMessageStatus(context.Background(), "1101000001", "unknown", storage.StatusRead)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgres_SaveNotification(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	n := &storage.Notification{
+		IDInstance:  "1101000001",
+		ReceiptID:   1,
+		TypeWebhook: "incomingMessageReceived",
+		IDMessage:   "F7AEC1B7086ECDC7E6E45923F5EDB825",
+		ChatID:      "79876543210@c.us",
+		Payload:     json.RawMessage(`{"typeWebhook":"incomingMessageReceived"}`),
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO notifications")).
+		WithArgs(n.IDInstance, n.ReceiptID, n.TypeWebhook, n.IDMessage, n.ChatID, []byte(n.Payload), []byte(nil)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, now))
+
+	saved, err := s.SaveNotification(context.Background(), n)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(7), saved.ID)
+	assert.Equal(t, now, saved.CreatedAt)
+}
+
+func TestPostgres_SaveNotification_Sealed(t *testing.T) {
+	s, mock := newMock(t)
+	s.SetSealer(reverseSealer{})
+
+	now := time.Now()
+	n := &storage.Notification{
+		IDInstance:  "1101000001",
+		TypeWebhook: "incomingMessageReceived",
+		ChatID:      "79876543210@c.us",
+		Payload:     json.RawMessage(`{"typeWebhook":"incomingMessageReceived"}`),
+	}
+	sealed := []byte(`1101000001/79876543210@c.us}"devieceRegasseMgnimocni":"koohbeWepyt"{`)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO notifications")).
+		WithArgs(n.IDInstance, int64(0), n.TypeWebhook, "", n.ChatID, []byte("null"), sealed).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, now))
+
+	saved, err := s.SaveNotification(context.Background(), n)
+	require.NoError(t, err)
+
+	assert.Equal(t, n.Payload, saved.Payload, "the caller gets the plaintext")
+	assert.Equal(t, sealed, saved.SealedPayload)
+}
+
+func TestPostgres_ListNotificationsAfter(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM notifications WHERE id > $1 ORDER BY id LIMIT $2")).
+		WithArgs(int64(6), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "id_instance", "payload", "sealed_payload"}).
+			AddRow(7, "1101000001", []byte(`{"typeWebhook":"incomingMessageReceived"}`), []byte{}))
+
+	list, err := s.ListNotificationsAfter(context.Background(), 6, 100)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, int64(7), list[0].ID)
+	assert.Empty(t, list[0].SealedPayload)
+
+	sealed := []byte("new")
+	query := "UPDATE notifications SET payload = 'null', sealed_payload = $1 WHERE id = $2 AND sealed_payload = $3"
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs(sealed, int64(7), []byte{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateNotificationPayload(context.Background(), 7, []byte{}, sealed))
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateNotificationPayload(context.Background(), 7, []byte{}, sealed), storage.ErrNotFound)
+}
+
+func TestPostgres_PingClose(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+
+	s := storage.NewPostgresFromDB(sqlx.NewDb(db, "postgres"))
+
+	mock.ExpectPing()
+	require.NoError(t, s.Ping(context.Background()))
+
+	mock.ExpectClose()
+	require.NoError(t, s.Close())
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestError(t *testing.T) {
+	require.NoError(t, storage.NewError(nil))
+
+	err := storage.NewError(errors.New("some error"))
+	assert.Equal(t, "[storage]: some error", err.Error())
+	assert.Equal(t, "some error", errors.Unwrap(err).Error())
+}
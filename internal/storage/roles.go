@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+)
+
+// RoleStorage persists roles of users per instance.
+type RoleStorage interface {
+	SaveUserRole(ctx context.Context, r *UserRole) error
+	ListUserRoles(ctx context.Context, userID string) ([]UserRole, error)
+	DeleteUserRole(ctx context.Context, userID, instance string) error
+}
+
+// UserRole is the role of the user on the instance by idInstance, instance "*" is every instance.
+type UserRole struct {
+	UserID   string `db:"user_id" json:"-"`
+	Instance string `db:"instance" json:"instance"`
+	Role     string `db:"role" json:"role"`
+}
+
+// SaveUserRole sets the role of the user on the instance, the previous role is replaced.
+func (s *Postgres) SaveUserRole(ctx context.Context, r *UserRole) error {
+	query := `INSERT INTO user_roles (user_id, instance, role) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, instance) DO UPDATE SET role = EXCLUDED.role`
+
+	_, err := s.db.ExecContext(ctx, query, r.UserID, r.Instance, r.Role)
+
+	return NewError(err)
+}
+
+// ListUserRoles returns roles of the user by instance.
+func (s *Postgres) ListUserRoles(ctx context.Context, userID string) ([]UserRole, error) {
+	roles := []UserRole{}
+
+	err := s.db.SelectContext(ctx, &roles,
+		`SELECT user_id, instance, role FROM user_roles WHERE user_id = $1 ORDER BY instance`, userID)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return roles, nil
+}
+
+// DeleteUserRole takes the role on the instance from the user, ErrNotFound is returned when there is none.
+func (s *Postgres) DeleteUserRole(ctx context.Context, userID, instance string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM user_roles WHERE user_id = $1 AND instance = $2`, userID, instance)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
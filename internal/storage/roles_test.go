@@ -0,0 +1,56 @@
+package storage_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+func TestPostgres_SaveUserRole(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_roles (user_id, instance, role) VALUES ($1, $2, $3)")).
+		WithArgs("u1", "1101000001", "operator").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveUserRole(context.Background(),
+		&storage.UserRole{UserID: "u1", Instance: "1101000001", Role: "operator"}))
+}
+
+func TestPostgres_ListUserRoles(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_roles WHERE user_id = $1 ORDER BY instance")).
+		WithArgs("u1").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "instance", "role"}).
+			AddRow("u1", "*", "viewer").
+			AddRow("u1", "1101000001", "operator"))
+
+	roles, err := s.ListUserRoles(context.Background(), "u1")
+	require.NoError(t, err)
+	assert.Equal(t, []storage.UserRole{
+		{UserID: "u1", Instance: "*", Role: "viewer"},
+		{UserID: "u1", Instance: "1101000001", Role: "operator"},
+	}, roles)
+}
+
+func TestPostgres_DeleteUserRole(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_roles WHERE user_id = $1 AND instance = $2")).
+		WithArgs("u1", "1101000001").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.DeleteUserRole(context.Background(), "u1", "1101000001"))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_roles")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.DeleteUserRole(context.Background(), "u1", "1101000001"), storage.ErrNotFound)
+}
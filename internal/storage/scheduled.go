@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Statuses of scheduled messages. A dispatched message is handed to the outbound queue,
+// its delivery is tracked by the job IDJob.
+const (
+	ScheduledPending    = "scheduled"
+	ScheduledDispatched = "dispatched"
+	ScheduledCancelled  = "cancelled"
+	ScheduledFailed     = "failed"
+)
+
+// ScheduledStorage persists messages scheduled to be sent later.
+type ScheduledStorage interface {
+	SaveScheduled(ctx context.Context, m *ScheduledMessage) error
+	UpdateScheduled(ctx context.Context, m *ScheduledMessage, status string) error
+	GetScheduled(ctx context.Context, id string) (*ScheduledMessage, error)
+	ListScheduled(ctx context.Context, idInstance, status string, limit int) ([]ScheduledMessage, error)
+	DueScheduled(ctx context.Context, now time.Time, limit int) ([]ScheduledMessage, error)
+	RestoreScheduled(ctx context.Context, before, now time.Time) (int64, error)
+}
+
+// ScheduledMessage is a message to be sent at SendAt. Timezone is the zone SendAt was given in,
+// it is kept to show and edit the time as the sender meant it. With a sealer Payload is saved encrypted
+// in SealedPayload.
+type ScheduledMessage struct {
+	SendAt        time.Time       `db:"send_at" json:"send_at"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time       `db:"updated_at" json:"updated_at"`
+	ID            string          `db:"id" json:"id"`
+	IDInstance    string          `db:"id_instance" json:"id_instance"`
+	Method        string          `db:"method" json:"method"`
+	ChatID        string          `db:"chat_id" json:"chat_id"`
+	Timezone      string          `db:"timezone" json:"timezone"`
+	Status        string          `db:"status" json:"status"`
+	IDJob         string          `db:"id_job" json:"id_job,omitempty"`
+	Error         string          `db:"error" json:"error,omitempty"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	SealedPayload []byte          `db:"sealed_payload" json:"-"`
+}
+
+// SealingData is the additional data the payload is sealed with, a payload copied to another message doesn't open.
+func (m *ScheduledMessage) SealingData() []byte {
+	return []byte(m.IDInstance + "/" + m.ID)
+}
+
+const scheduledColumns = `id, id_instance, method, chat_id, payload, sealed_payload, send_at, timezone, status,
+	id_job, error, created_at, updated_at`
+
+// SaveScheduled inserts a new scheduled message, id is set by the scheduler. The payload is sealed
+// when the storage has a sealer.
+func (s *Postgres) SaveScheduled(ctx context.Context, m *ScheduledMessage) error {
+	query := `INSERT INTO scheduled_messages (` + scheduledColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+
+	payload, sealed, err := s.sealPayload(m.Payload, m.SealingData())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, query,
+		m.ID, m.IDInstance, m.Method, m.ChatID, payload, sealed, m.SendAt, m.Timezone, m.Status,
+		m.IDJob, m.Error, m.CreatedAt, m.UpdatedAt,
+	)
+
+	return NewError(err)
+}
+
+// UpdateScheduled saves the message only while it has the status, so a message cancelled
+// or dispatched meanwhile is not overwritten. ErrNotFound is returned otherwise.
+func (s *Postgres) UpdateScheduled(ctx context.Context, m *ScheduledMessage, status string) error {
+	query := `UPDATE scheduled_messages SET chat_id = $1, payload = $2, sealed_payload = $3, send_at = $4,
+		timezone = $5, status = $6, id_job = $7, error = $8, updated_at = $9 WHERE id = $10 AND status = $11`
+
+	payload, sealed, err := s.sealPayload(m.Payload, m.SealingData())
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, query,
+		m.ChatID, payload, sealed, m.SendAt, m.Timezone, m.Status, m.IDJob, m.Error, m.UpdatedAt, m.ID, status)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetScheduled returns the scheduled message by id.
+func (s *Postgres) GetScheduled(ctx context.Context, id string) (*ScheduledMessage, error) {
+	var m ScheduledMessage
+
+	err := s.db.GetContext(ctx, &m, `SELECT `+scheduledColumns+` FROM scheduled_messages WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	if err := s.openScheduled(&m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// ListScheduled returns scheduled messages by send time, empty idInstance and status match any.
+func (s *Postgres) ListScheduled(ctx context.Context, idInstance, status string, limit int) ([]ScheduledMessage, error) {
+	query := `SELECT ` + scheduledColumns + ` FROM scheduled_messages
+		WHERE ($1 = '' OR id_instance = $1) AND ($2 = '' OR status = $2)
+		ORDER BY send_at DESC LIMIT $3`
+
+	messages := []ScheduledMessage{}
+	if err := s.db.SelectContext(ctx, &messages, query, idInstance, status, limit); err != nil {
+		return nil, NewError(err)
+	}
+
+	if err := s.openScheduledList(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// DueScheduled returns pending messages to be sent by now, the earliest first.
+func (s *Postgres) DueScheduled(ctx context.Context, now time.Time, limit int) ([]ScheduledMessage, error) {
+	query := `SELECT ` + scheduledColumns + ` FROM scheduled_messages
+		WHERE status = $1 AND send_at <= $2 ORDER BY send_at LIMIT $3`
+
+	messages := []ScheduledMessage{}
+	if err := s.db.SelectContext(ctx, &messages, query, ScheduledPending, now, limit); err != nil {
+		return nil, NewError(err)
+	}
+
+	if err := s.openScheduledList(messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// RestoreScheduled returns messages dispatched before the given time without a job to pending, their dispatcher
+// stopped before it enqueued them. It returns how many messages are restored.
+func (s *Postgres) RestoreScheduled(ctx context.Context, before, now time.Time) (int64, error) {
+	query := `UPDATE scheduled_messages SET status = $1, updated_at = $2
+		WHERE status = $3 AND id_job = '' AND updated_at < $4`
+
+	res, err := s.db.ExecContext(ctx, query, ScheduledPending, now, ScheduledDispatched, before)
+	if err != nil {
+		return 0, NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, NewError(err)
+	}
+
+	return n, nil
+}
+
+// ListScheduledAfter returns up to limit scheduled messages with ids after the given one, by id.
+// Payloads are returned as saved, sealed ones are not opened.
+func (s *Postgres) ListScheduledAfter(ctx context.Context, after string, limit int) ([]ScheduledMessage, error) {
+	query := `SELECT ` + scheduledColumns + ` FROM scheduled_messages WHERE id > $1 ORDER BY id LIMIT $2`
+
+	messages := []ScheduledMessage{}
+	if err := s.db.SelectContext(ctx, &messages, query, after, limit); err != nil {
+		return nil, NewError(err)
+	}
+
+	return messages, nil
+}
+
+// UpdateScheduledPayload replaces the sealed payload of the message if the message is not updated since it
+// was read, the plaintext is cleared. ErrNotFound is returned when it is changed meanwhile.
+func (s *Postgres) UpdateScheduledPayload(ctx context.Context, m *ScheduledMessage, sealed []byte) error {
+	query := `UPDATE scheduled_messages SET payload = 'null', sealed_payload = $1
+		WHERE id = $2 AND sealed_payload = $3 AND updated_at = $4`
+
+	res, err := s.db.ExecContext(ctx, query, sealed, m.ID, m.SealedPayload, m.UpdatedAt)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// openScheduled decrypts the sealed payload of the message read from the database.
+func (s *Postgres) openScheduled(m *ScheduledMessage) error {
+	payload, err := s.openPayload(m.Payload, m.SealedPayload, m.SealingData())
+	if err != nil {
+		return err
+	}
+
+	m.Payload = payload
+
+	return nil
+}
+
+func (s *Postgres) openScheduledList(messages []ScheduledMessage) error {
+	for i := range messages {
+		if err := s.openScheduled(&messages[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
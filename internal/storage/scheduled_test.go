@@ -0,0 +1,196 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var scheduledColumns = []string{"id", "id_instance", "method", "chat_id", "payload", "send_at", "timezone", "status",
+	"id_job", "error", "created_at", "updated_at"}
+
+func testScheduled(now time.Time) *storage.ScheduledMessage {
+	return &storage.ScheduledMessage{
+		ID:         "s1",
+		IDInstance: "1101000001",
+		Method:     "sendMessage",
+		ChatID:     "79876543210@c.us",
+		Payload:    json.RawMessage(`{"chatId":"79876543210@c.us","message":"hello"}`),
+		SendAt:     now.Add(time.Hour),
+		Timezone:   "Europe/Moscow",
+		Status:     storage.ScheduledPending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+func scheduledRow(m *storage.ScheduledMessage) *sqlmock.Rows {
+	return sqlmock.NewRows(scheduledColumns).AddRow(m.ID, m.IDInstance, m.Method, m.ChatID, []byte(m.Payload),
+		m.SendAt, m.Timezone, m.Status, m.IDJob, m.Error, m.CreatedAt, m.UpdatedAt)
+}
+
+func TestPostgres_SaveScheduled(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	m := testScheduled(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scheduled_messages")).
+		WithArgs(m.ID, m.IDInstance, m.Method, m.ChatID, []byte(m.Payload), []byte(nil), m.SendAt, m.Timezone,
+			storage.ScheduledPending, "", "", now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveScheduled(context.Background(), m))
+}
+
+func TestPostgres_UpdateScheduled(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	m := testScheduled(now)
+	m.Status = storage.ScheduledDispatched
+	m.IDJob = "a1"
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scheduled_messages SET chat_id = $1")).
+		WithArgs(m.ChatID, []byte(m.Payload), []byte(nil), m.SendAt, m.Timezone, storage.ScheduledDispatched, "a1", "", now,
+			m.ID, storage.ScheduledPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateScheduled(context.Background(), m, storage.ScheduledPending))
+
+	// the message is not pending any more
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE scheduled_messages SET chat_id = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateScheduled(context.Background(), m, storage.ScheduledPending), storage.ErrNotFound)
+}
+
+func TestPostgres_GetScheduled(t *testing.T) {
+	s, mock := newMock(t)
+
+	m := testScheduled(time.Now())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scheduled_messages WHERE id = $1")).
+		WithArgs(m.ID).
+		WillReturnRows(scheduledRow(m))
+
+	got, err := s.GetScheduled(context.Background(), m.ID)
+	require.NoError(t, err)
+	assert.Equal(t, m, got)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scheduled_messages WHERE id = $1")).
+		WillReturnRows(sqlmock.NewRows(scheduledColumns))
+
+	_, err = s.GetScheduled(context.Background(), "unknown")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgres_ListScheduled(t *testing.T) {
+	s, mock := newMock(t)
+
+	m := testScheduled(time.Now())
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scheduled_messages")).
+		WithArgs("1101000001", storage.ScheduledPending, 10).
+		WillReturnRows(scheduledRow(m))
+
+	messages, err := s.ListScheduled(context.Background(), "1101000001", storage.ScheduledPending, 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, m.ID, messages[0].ID)
+}
+
+func TestPostgres_DueScheduled(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE status = $1 AND send_at <= $2 ORDER BY send_at LIMIT $3")).
+		WithArgs(storage.ScheduledPending, now, 50).
+		WillReturnRows(sqlmock.NewRows(scheduledColumns))
+
+	messages, err := s.DueScheduled(context.Background(), now, 50)
+	require.NoError(t, err)
+	assert.Empty(t, messages)
+}
+
+func TestPostgres_RestoreScheduled(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	before := now.Add(-time.Minute)
+
+	mock.ExpectExec(regexp.QuoteMeta("WHERE status = $3 AND id_job = '' AND updated_at < $4")).
+		WithArgs(storage.ScheduledPending, now, storage.ScheduledDispatched, before).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := s.RestoreScheduled(context.Background(), before, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestPostgres_Scheduled_Sealed(t *testing.T) {
+	s, mock := newMock(t)
+	s.SetSealer(reverseSealer{})
+
+	now := time.Now()
+	m := testScheduled(now)
+	sealed, err := reverseSealer{}.Seal(m.Payload, m.SealingData())
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO scheduled_messages")).
+		WithArgs(m.ID, m.IDInstance, m.Method, m.ChatID, []byte("null"), sealed, m.SendAt, m.Timezone,
+			m.Status, "", "", now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveScheduled(context.Background(), m))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scheduled_messages WHERE status = $1")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "id_instance", "payload", "sealed_payload"}).
+			AddRow(m.ID, m.IDInstance, []byte("null"), sealed))
+
+	due, err := s.DueScheduled(context.Background(), now, 50)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.JSONEq(t, string(m.Payload), string(due[0].Payload), "payload is opened")
+}
+
+func TestPostgres_ListScheduledAfter(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	m := testScheduled(now)
+	m.SealedPayload = []byte("old")
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM scheduled_messages WHERE id > $1 ORDER BY id LIMIT $2")).
+		WithArgs("", 100).
+		WillReturnRows(scheduledRow(m))
+
+	list, err := s.ListScheduledAfter(context.Background(), "", 100)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	sealed := []byte("new")
+	query := `UPDATE scheduled_messages SET payload = 'null', sealed_payload = $1
+		WHERE id = $2 AND sealed_payload = $3 AND updated_at = $4`
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WithArgs(sealed, m.ID, m.SealedPayload, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateScheduledPayload(context.Background(), m, sealed))
+
+	mock.ExpectExec(regexp.QuoteMeta(query)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateScheduledPayload(context.Background(), m, sealed), storage.ErrNotFound,
+		"updated meanwhile")
+}
@@ -0,0 +1,94 @@
+// Package storage persists messages sent through the server and incoming notifications.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Outgoing message statuses. Delivery statuses come from outgoingMessageStatus notifications.
+const (
+	StatusSent      = "sent"
+	StatusFailed    = "failed"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+)
+
+// Storage is a persistence layer of the server.
+type Storage interface {
+	Ping(ctx context.Context) error
+	Close() error
+	SaveMessage(ctx context.Context, m *Message) (*Message, error)
+	UpdateMessageStatus(ctx context.Context, idInstance, idMessage, status string) error
+	SaveNotification(ctx context.Context, n *Notification) (*Notification, error)
+}
+
+// Sealer encrypts message bodies and payloads before they are saved and decrypts payloads read back,
+// *encryption.Sealer implements it.
+type Sealer interface {
+	Seal(plaintext, additionalData []byte) ([]byte, error)
+	Open(ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// SealedMessageStorage keeps bodies of outgoing messages encrypted by the sealer. rotate-keys lists
+// messages by id and seals their bodies again with the current key.
+type SealedMessageStorage interface {
+	SetSealer(sealer Sealer)
+	ListMessagesAfter(ctx context.Context, after int64, limit int) ([]Message, error)
+	UpdateMessageBody(ctx context.Context, id int64, old, sealed []byte) error
+}
+
+// SealedPayloadStorage keeps payloads of notifications, jobs and scheduled messages and merge fields
+// of campaign recipients encrypted by the sealer of SealedMessageStorage. rotate-keys lists the rows
+// by key and seals them again with the current key, old is the sealed value the row is expected to have.
+type SealedPayloadStorage interface {
+	ListNotificationsAfter(ctx context.Context, after int64, limit int) ([]Notification, error)
+	UpdateNotificationPayload(ctx context.Context, id int64, old, sealed []byte) error
+	ListJobsAfter(ctx context.Context, after string, limit int) ([]Job, error)
+	UpdateJobPayload(ctx context.Context, id string, old, sealed []byte) error
+	ListScheduledAfter(ctx context.Context, after string, limit int) ([]ScheduledMessage, error)
+	UpdateScheduledPayload(ctx context.Context, m *ScheduledMessage, sealed []byte) error
+	ListRecipientsAfter(ctx context.Context, campaignID string, line, limit int) ([]Recipient, error)
+	UpdateRecipientFields(ctx context.Context, r *Recipient, sealed []byte) error
+}
+
+// Message is an outgoing message sent through the server. With a sealer Body is saved encrypted
+// in SealedBody and the body column is left empty, SealedBody is never serialized.
+type Message struct {
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+	IDInstance string    `db:"id_instance" json:"id_instance"`
+	Method     string    `db:"method" json:"method"`
+	ChatID     string    `db:"chat_id" json:"chat_id"`
+	Body       string    `db:"body" json:"body"`
+	IDMessage  string    `db:"id_message" json:"id_message"`
+	Status     string    `db:"status" json:"status"`
+	Error      string    `db:"error" json:"error,omitempty"`
+	SealedBody []byte    `db:"sealed_body" json:"-"`
+	ID         int64     `db:"id" json:"id"`
+}
+
+// SealingData is the additional data the body is sealed with, a body copied to another chat doesn't open.
+func (m *Message) SealingData() []byte {
+	return []byte(m.IDInstance + "/" + m.ChatID)
+}
+
+// Notification is an incoming GREEN-API notification as received. With a sealer Payload is saved
+// encrypted in SealedPayload and the payload column keeps JSON null.
+type Notification struct {
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+	IDInstance    string          `db:"id_instance" json:"id_instance"`
+	TypeWebhook   string          `db:"type_webhook" json:"type_webhook"`
+	IDMessage     string          `db:"id_message" json:"id_message"`
+	ChatID        string          `db:"chat_id" json:"chat_id"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	SealedPayload []byte          `db:"sealed_payload" json:"-"`
+	ReceiptID     int64           `db:"receipt_id" json:"receipt_id"`
+	ID            int64           `db:"id" json:"id"`
+}
+
+// SealingData is the additional data the payload is sealed with, like bodies of messages.
+func (n *Notification) SealingData() []byte {
+	return []byte(n.IDInstance + "/" + n.ChatID)
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// TemplateStorage persists message templates.
+type TemplateStorage interface {
+	SaveTemplate(ctx context.Context, t *Template) error
+	UpdateTemplate(ctx context.Context, t *Template) error
+	GetTemplate(ctx context.Context, id string) (*Template, error)
+	ListTemplates(ctx context.Context, limit int) ([]Template, error)
+	DeleteTemplate(ctx context.Context, id string) error
+}
+
+// Template is a message body with placeholders like {{name}}. Variables are placeholders of the body,
+// they are not stored.
+type Template struct {
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	ID        string    `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Body      string    `db:"body" json:"body"`
+	Variables []string  `db:"-" json:"variables"`
+}
+
+const templateColumns = `id, name, body, created_at, updated_at`
+
+// SaveTemplate inserts a new template, id is set by the caller.
+func (s *Postgres) SaveTemplate(ctx context.Context, t *Template) error {
+	query := `INSERT INTO templates (id, name, body, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := s.db.ExecContext(ctx, query, t.ID, t.Name, t.Body, t.CreatedAt, t.UpdatedAt)
+
+	return NewError(err)
+}
+
+// UpdateTemplate saves name and body of the template, ErrNotFound is returned for unknown id.
+func (s *Postgres) UpdateTemplate(ctx context.Context, t *Template) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE templates SET name = $1, body = $2, updated_at = $3 WHERE id = $4`,
+		t.Name, t.Body, t.UpdatedAt, t.ID)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetTemplate returns the template by id.
+func (s *Postgres) GetTemplate(ctx context.Context, id string) (*Template, error) {
+	var t Template
+
+	err := s.db.GetContext(ctx, &t, `SELECT `+templateColumns+` FROM templates WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return &t, nil
+}
+
+// ListTemplates returns templates by name.
+func (s *Postgres) ListTemplates(ctx context.Context, limit int) ([]Template, error) {
+	templates := []Template{}
+
+	err := s.db.SelectContext(ctx, &templates,
+		`SELECT `+templateColumns+` FROM templates ORDER BY name, created_at LIMIT $1`, limit)
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return templates, nil
+}
+
+// DeleteTemplate deletes the template, ErrNotFound is returned for unknown id.
+func (s *Postgres) DeleteTemplate(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM templates WHERE id = $1`, id)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package storage_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var templateColumns = []string{"id", "name", "body", "created_at", "updated_at"}
+
+func testTemplate(now time.Time) *storage.Template {
+	return &storage.Template{
+		ID:        "t1",
+		Name:      "order ready",
+		Body:      "Hello {{name}}, order {{order_id}} is ready",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func TestPostgres_SaveTemplate(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	tpl := testTemplate(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO templates")).
+		WithArgs(tpl.ID, tpl.Name, tpl.Body, now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveTemplate(context.Background(), tpl))
+}
+
+func TestPostgres_UpdateTemplate(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	tpl := testTemplate(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE templates SET name = $1")).
+		WithArgs(tpl.Name, tpl.Body, now, tpl.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateTemplate(context.Background(), tpl))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE templates SET name = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateTemplate(context.Background(), tpl), storage.ErrNotFound)
+}
+
+func TestPostgres_GetTemplate(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	tpl := testTemplate(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM templates WHERE id = $1")).
+		WithArgs(tpl.ID).
+		WillReturnRows(sqlmock.NewRows(templateColumns).AddRow(tpl.ID, tpl.Name, tpl.Body, now, now))
+
+	got, err := s.GetTemplate(context.Background(), tpl.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tpl, got)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM templates WHERE id = $1")).
+		WillReturnRows(sqlmock.NewRows(templateColumns))
+
+	_, err = s.GetTemplate(context.Background(), "unknown")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgres_ListTemplates(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	tpl := testTemplate(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM templates ORDER BY name")).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows(templateColumns).AddRow(tpl.ID, tpl.Name, tpl.Body, now, now))
+
+	templates, err := s.ListTemplates(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Template{*tpl}, templates)
+}
+
+func TestPostgres_DeleteTemplate(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM templates WHERE id = $1")).
+		WithArgs("t1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.DeleteTemplate(context.Background(), "t1"))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM templates WHERE id = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.DeleteTemplate(context.Background(), "t1"), storage.ErrNotFound)
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// UserStorage persists accounts of the web interface.
+type UserStorage interface {
+	SaveUser(ctx context.Context, u *User) error
+	GetUser(ctx context.Context, id string) (*User, error)
+	GetUserByName(ctx context.Context, username string) (*User, error)
+	ListUsers(ctx context.Context) ([]User, error)
+	UpdateUserPassword(ctx context.Context, u *User) error
+	DeleteUser(ctx context.Context, id string) error
+}
+
+// User is an account of the web interface. PasswordHash is never serialized.
+type User struct {
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	ID           string    `db:"id" json:"id"`
+	Username     string    `db:"username" json:"username"`
+	PasswordHash string    `db:"password_hash" json:"-"`
+}
+
+const userColumns = `id, username, password_hash, created_at, updated_at`
+
+// SaveUser inserts a new user, id is set by the caller. ErrDuplicate is returned when the username is taken.
+func (s *Postgres) SaveUser(ctx context.Context, u *User) error {
+	query := `INSERT INTO users (id, username, password_hash, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT DO NOTHING`
+
+	res, err := s.db.ExecContext(ctx, query, u.ID, u.Username, u.PasswordHash, u.CreatedAt, u.UpdatedAt)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrDuplicate
+	}
+
+	return nil
+}
+
+// GetUser returns the user by id.
+func (s *Postgres) GetUser(ctx context.Context, id string) (*User, error) {
+	return s.getUser(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id)
+}
+
+// GetUserByName returns the user by username.
+func (s *Postgres) GetUserByName(ctx context.Context, username string) (*User, error) {
+	return s.getUser(ctx, `SELECT `+userColumns+` FROM users WHERE username = $1`, username)
+}
+
+func (s *Postgres) getUser(ctx context.Context, query, arg string) (*User, error) {
+	var u User
+
+	err := s.db.GetContext(ctx, &u, query, arg)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, NewError(err)
+	}
+
+	return &u, nil
+}
+
+// ListUsers returns users by username.
+func (s *Postgres) ListUsers(ctx context.Context) ([]User, error) {
+	users := []User{}
+
+	if err := s.db.SelectContext(ctx, &users, `SELECT `+userColumns+` FROM users ORDER BY username`); err != nil {
+		return nil, NewError(err)
+	}
+
+	return users, nil
+}
+
+// UpdateUserPassword saves the password hash of the user, ErrNotFound is returned for unknown id.
+func (s *Postgres) UpdateUserPassword(ctx context.Context, u *User) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3`,
+		u.PasswordHash, u.UpdatedAt, u.ID)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteUser deletes the user, ErrNotFound is returned for unknown id.
+func (s *Postgres) DeleteUser(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package storage_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var userColumns = []string{"id", "username", "password_hash", "created_at", "updated_at"}
+
+func testUser(now time.Time) *storage.User {
+	return &storage.User{
+		ID:           "u1",
+		Username:     "anna",
+		PasswordHash: "$2a$10$hash",
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+func TestPostgres_SaveUser(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	u := testUser(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users")).
+		WithArgs(u.ID, u.Username, u.PasswordHash, now, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.SaveUser(context.Background(), u))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.SaveUser(context.Background(), u), storage.ErrDuplicate)
+}
+
+func TestPostgres_GetUser(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	u := testUser(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE id = $1")).
+		WithArgs(u.ID).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(u.ID, u.Username, u.PasswordHash, now, now))
+
+	got, err := s.GetUser(context.Background(), u.ID)
+	require.NoError(t, err)
+	assert.Equal(t, u, got)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE username = $1")).
+		WithArgs(u.Username).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(u.ID, u.Username, u.PasswordHash, now, now))
+
+	got, err = s.GetUserByName(context.Background(), u.Username)
+	require.NoError(t, err)
+	assert.Equal(t, u, got)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users WHERE username = $1")).
+		WillReturnRows(sqlmock.NewRows(userColumns))
+
+	_, err = s.GetUserByName(context.Background(), "unknown")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestPostgres_ListUsers(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	u := testUser(now)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users ORDER BY username")).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(u.ID, u.Username, u.PasswordHash, now, now))
+
+	users, err := s.ListUsers(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []storage.User{*u}, users)
+}
+
+func TestPostgres_UpdateUserPassword(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	u := testUser(now)
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET password_hash = $1")).
+		WithArgs(u.PasswordHash, now, u.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.UpdateUserPassword(context.Background(), u))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET password_hash = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.UpdateUserPassword(context.Background(), u), storage.ErrNotFound)
+}
+
+func TestPostgres_DeleteUser(t *testing.T) {
+	s, mock := newMock(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = $1")).
+		WithArgs("u1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.DeleteUser(context.Background(), "u1"))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM users WHERE id = $1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.DeleteUser(context.Background(), "u1"), storage.ErrNotFound)
+}
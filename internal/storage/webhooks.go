@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// WebhookKeyStorage keeps keys of delivered webhooks, so every replica skips deliveries GREEN-API repeats.
+type WebhookKeyStorage interface {
+	ClaimWebhookKey(ctx context.Context, key string, now, expired time.Time) error
+	DeleteWebhookKey(ctx context.Context, key string) error
+	DeleteWebhookKeysBefore(ctx context.Context, before time.Time) error
+}
+
+// ClaimWebhookKey marks the key seen at now. ErrDuplicate is returned when it was seen after expired.
+func (s *Postgres) ClaimWebhookKey(ctx context.Context, key string, now, expired time.Time) error {
+	query := `INSERT INTO webhook_keys (key, seen_at) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET seen_at = EXCLUDED.seen_at WHERE webhook_keys.seen_at < $3`
+
+	res, err := s.db.ExecContext(ctx, query, key, now, expired)
+	if err != nil {
+		return NewError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return NewError(err)
+	}
+
+	if n == 0 {
+		return ErrDuplicate
+	}
+
+	return nil
+}
+
+// DeleteWebhookKey forgets the key, the next delivery with it is not a duplicate.
+func (s *Postgres) DeleteWebhookKey(ctx context.Context, key string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM webhook_keys WHERE key = $1`, key); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
+
+// DeleteWebhookKeysBefore forgets keys seen before the given time.
+func (s *Postgres) DeleteWebhookKeysBefore(ctx context.Context, before time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM webhook_keys WHERE seen_at < $1`, before); err != nil {
+		return NewError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package storage_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+func TestPostgres_ClaimWebhookKey(t *testing.T) {
+	s, mock := newMock(t)
+
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_keys (key, seen_at) VALUES ($1, $2)")).
+		WithArgs("key", now, expired).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.ClaimWebhookKey(context.Background(), "key", now, expired))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.ErrorIs(t, s.ClaimWebhookKey(context.Background(), "key", now, expired), storage.ErrDuplicate)
+}
+
+func TestPostgres_DeleteWebhookKeys(t *testing.T) {
+	s, mock := newMock(t)
+
+	before := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_keys WHERE key = $1")).
+		WithArgs("key").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, s.DeleteWebhookKey(context.Background(), "key"))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_keys WHERE seen_at < $1")).
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	require.NoError(t, s.DeleteWebhookKeysBefore(context.Background(), before))
+}
@@ -0,0 +1,255 @@
+// Package templates keeps message bodies with placeholders like {{name}} and renders them with variables.
+// Bodies are text/template: a placeholder is a shorthand of {{.name}}, other actions work as usual.
+// A variable missing on rendering is an error, a message is never sent with a blank in it.
+package templates
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+)
+
+var (
+	ErrNotFound = errors.New("template not found")
+	ErrInvalid  = errors.New("invalid template")
+)
+
+// DefaultListLimit is how many templates List returns when limit is not set.
+const DefaultListLimit = 100
+
+// placeholder matches {{name}} and {{.name}}, spaces inside the braces are allowed.
+var placeholder = regexp.MustCompile(`\{\{\s*(\.?)([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// keywords are actions of text/template which look like placeholders.
+var keywords = map[string]bool{"else": true, "end": true, "break": true, "continue": true, "nil": true}
+
+// Request creates or changes a template, empty fields keep their values on Update.
+type Request struct {
+	Name string `json:"name"`
+	Body string `json:"body"`
+}
+
+// Parse parses the body, missing variables fail its execution.
+func Parse(body string) (*template.Template, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("%w: body is required", ErrInvalid)
+	}
+
+	text := placeholder.ReplaceAllStringFunc(body, func(match string) string {
+		sub := placeholder.FindStringSubmatch(match)
+		if sub[1] == "" && keywords[sub[2]] {
+			return match
+		}
+
+		return "{{." + sub[2] + "}}"
+	})
+
+	t, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	return t, nil
+}
+
+// Variables returns names of placeholders of the body in order of appearance.
+// Fields used in other actions, like {{if .vip}}, are not listed.
+func Variables(body string) []string {
+	variables := []string{}
+	seen := make(map[string]bool)
+
+	for _, sub := range placeholder.FindAllStringSubmatch(body, -1) {
+		name := sub[2]
+		if (sub[1] == "" && keywords[name]) || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		variables = append(variables, name)
+	}
+
+	return variables
+}
+
+// Manager keeps templates in the storage and renders them.
+type Manager struct {
+	store storage.TemplateStorage
+	now   func() time.Time
+}
+
+func New(store storage.TemplateStorage) *Manager {
+	return &Manager{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// SetClock replaces time source, for tests.
+func (m *Manager) SetClock(now func() time.Time) *Manager {
+	m.now = now
+	return m
+}
+
+// Create validates and saves a new template.
+func (m *Manager) Create(ctx context.Context, r *Request) (*storage.Template, error) {
+	now := m.now()
+	t := &storage.Template{
+		ID:        newID(),
+		Name:      strings.TrimSpace(r.Name),
+		Body:      r.Body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := validate(t); err != nil {
+		return nil, err
+	}
+
+	if err := m.store.SaveTemplate(ctx, t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Get returns the template with its variables.
+func (m *Manager) Get(ctx context.Context, id string) (*storage.Template, error) {
+	t, err := m.store.GetTemplate(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.Variables = Variables(t.Body)
+
+	return t, nil
+}
+
+// List returns templates by name with their variables.
+func (m *Manager) List(ctx context.Context, limit int) ([]storage.Template, error) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+
+	templates, err := m.store.ListTemplates(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range templates {
+		templates[i].Variables = Variables(templates[i].Body)
+	}
+
+	return templates, nil
+}
+
+// Update changes name and body of the template, empty values are kept.
+func (m *Manager) Update(ctx context.Context, id string, r *Request) (*storage.Template, error) {
+	t, err := m.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name := strings.TrimSpace(r.Name); name != "" {
+		t.Name = name
+	}
+
+	if r.Body != "" {
+		t.Body = r.Body
+	}
+
+	if err := validate(t); err != nil {
+		return nil, err
+	}
+
+	t.UpdatedAt = m.now()
+
+	err = m.store.UpdateTemplate(ctx, t)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Delete deletes the template.
+func (m *Manager) Delete(ctx context.Context, id string) error {
+	err := m.store.DeleteTemplate(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// Render renders the template with the variables, every placeholder must have a value.
+func (m *Manager) Render(ctx context.Context, id string, variables map[string]string) (string, error) {
+	t, err := m.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	missing := []string{}
+
+	for _, name := range t.Variables {
+		if _, ok := variables[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: missing variables %s", ErrInvalid, strings.Join(missing, ", "))
+	}
+
+	parsed, err := Parse(t.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var message strings.Builder
+	if err := parsed.Execute(&message, variables); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	return message.String(), nil
+}
+
+func validate(t *storage.Template) error {
+	if t.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+
+	if _, err := Parse(t.Body); err != nil {
+		return err
+	}
+
+	t.Variables = Variables(t.Body)
+
+	return nil
+}
+
+func newID() string {
+	const size = 16
+
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,190 @@
+package templates_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ole-larsen/green-api/internal/storage"
+	"github.com/ole-larsen/green-api/internal/templates"
+)
+
+// fakeTemplates is an in-memory TemplateStorage.
+type fakeTemplates struct {
+	templates map[string]storage.Template
+	mu        sync.Mutex
+}
+
+func newFakeTemplates() *fakeTemplates {
+	return &fakeTemplates{templates: make(map[string]storage.Template)}
+}
+
+func (f *fakeTemplates) SaveTemplate(_ context.Context, t *storage.Template) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.templates[t.ID] = *t
+
+	return nil
+}
+
+func (f *fakeTemplates) UpdateTemplate(_ context.Context, t *storage.Template) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.templates[t.ID]; !ok {
+		return storage.ErrNotFound
+	}
+
+	f.templates[t.ID] = *t
+
+	return nil
+}
+
+func (f *fakeTemplates) GetTemplate(_ context.Context, id string) (*storage.Template, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.templates[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	return &t, nil
+}
+
+func (f *fakeTemplates) ListTemplates(context.Context, int) ([]storage.Template, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	templates := []storage.Template{}
+	for _, t := range f.templates {
+		templates = append(templates, t)
+	}
+
+	return templates, nil
+}
+
+func (f *fakeTemplates) DeleteTemplate(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.templates[id]; !ok {
+		return storage.ErrNotFound
+	}
+
+	delete(f.templates, id)
+
+	return nil
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		variables map[string]string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "placeholders",
+			body:      "Hello {{name}}, order {{ order_id }} is ready",
+			variables: map[string]string{"name": "Anna", "order_id": "1024"},
+			want:      "Hello Anna, order 1024 is ready",
+		},
+		{
+			name:      "fields",
+			body:      "Hello {{.name}}",
+			variables: map[string]string{"name": "Anna"},
+			want:      "Hello Anna",
+		},
+		{
+			name:      "actions",
+			body:      "{{if .vip}}Dear {{name}}{{else}}Hello{{end}}",
+			variables: map[string]string{"vip": "yes", "name": "Anna"},
+			want:      "Dear Anna",
+		},
+		{
+			name:      "missing variable",
+			body:      "Hello {{name}}",
+			variables: map[string]string{},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl, err := templates.Parse(tt.body)
+			require.NoError(t, err)
+
+			var message strings.Builder
+
+			err = tpl.Execute(&message, tt.variables)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, message.String())
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, body := range []string{"", "  ", "Hello {{name", "{{if .vip}}Dear"} {
+		_, err := templates.Parse(body)
+		require.ErrorIs(t, err, templates.ErrInvalid, body)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	// fields of other actions are not placeholders
+	assert.Equal(t, []string{"name", "order_id"},
+		templates.Variables("{{name}}: {{.order_id}} {{if .vip}}{{name}}{{else}}-{{end}}"))
+	assert.Empty(t, templates.Variables("Hello"))
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	m := templates.New(newFakeTemplates())
+
+	tpl, err := m.Create(ctx, &templates.Request{Name: " order ready ", Body: "Hello {{name}}, order {{order_id}}"})
+	require.NoError(t, err)
+	assert.Equal(t, "order ready", tpl.Name)
+	assert.Equal(t, []string{"name", "order_id"}, tpl.Variables)
+
+	message, err := m.Render(ctx, tpl.ID, map[string]string{"name": "Anna", "order_id": "1024"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello Anna, order 1024", message)
+
+	_, err = m.Render(ctx, tpl.ID, map[string]string{"name": "Anna"})
+	require.ErrorIs(t, err, templates.ErrInvalid)
+	assert.Contains(t, err.Error(), "missing variables order_id")
+
+	tpl, err = m.Update(ctx, tpl.ID, &templates.Request{Body: "Hi {{name}}"})
+	require.NoError(t, err)
+	assert.Equal(t, "order ready", tpl.Name)
+	assert.Equal(t, []string{"name"}, tpl.Variables)
+
+	_, err = m.Update(ctx, tpl.ID, &templates.Request{Body: "Hi {{name"})
+	require.ErrorIs(t, err, templates.ErrInvalid)
+
+	list, err := m.List(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, []string{"name"}, list[0].Variables)
+
+	require.NoError(t, m.Delete(ctx, tpl.ID))
+	require.ErrorIs(t, m.Delete(ctx, tpl.ID), templates.ErrNotFound)
+
+	_, err = m.Render(ctx, tpl.ID, nil)
+	require.ErrorIs(t, err, templates.ErrNotFound)
+
+	_, err = m.Create(ctx, &templates.Request{Body: "Hello"})
+	require.ErrorIs(t, err, templates.ErrInvalid)
+}